@@ -4,9 +4,11 @@ require (
 	github.com/apex/log v1.1.1
 	github.com/blacktop/ipsw v0.0.0-20190907012325-eda024ad7908
 	github.com/docker/docker v1.13.1
+	github.com/docker/go-connections v0.4.0
 	github.com/docker/go-units v0.4.0 // indirect
 	github.com/dustin/go-humanize v1.0.0
 	github.com/gizak/termui/v3 v3.1.0
+	github.com/klauspost/compress v1.11.13
 	github.com/konsorten/go-windows-terminal-sequences v1.0.2 // indirect
 	github.com/mattn/go-isatty v0.0.9 // indirect
 	github.com/mattn/go-runewidth v0.0.4 // indirect
@@ -22,6 +24,7 @@ require (
 	golang.org/x/sys v0.0.0-20190907184412-d223b2b6db03 // indirect
 	gopkg.in/check.v1 v1.0.0-20190902080502-41f04d3bba15 // indirect
 	gopkg.in/cheggaaa/pb.v1 v1.0.16
+	gopkg.in/yaml.v2 v2.2.2
 )
 
 go 1.13
@@ -0,0 +1,98 @@
+// Package testimage builds synthetic docker save images for the tests of the
+// packages working on parsed images.
+package testimage
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/blacktop/graboid/pkg/image"
+	"github.com/opencontainers/go-digest"
+)
+
+// Layer is a layer of a synthetic image, Files maps paths to their content
+// and Modes to their mode when it is not 0644
+type Layer struct {
+	Command string
+	Files   map[string]string
+	Modes   map[string]int64
+}
+
+// WriteTar writes the files sorted by path with a fixed mtime so equal layers have equal diff IDs
+func WriteTar(t testing.TB, w *tar.Writer, files map[string]string, modes map[string]int64) {
+	t.Helper()
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		mode, ok := modes[name]
+		if !ok {
+			mode = 0644
+		}
+		hdr := &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: mode, Size: int64(len(files[name])), ModTime: time.Unix(0, 0)}
+		if err := w.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(files[name])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// GzipTar returns the gzipped tar of the files and the digest of the uncompressed tar
+func GzipTar(t testing.TB, files map[string]string, modes map[string]int64) ([]byte, digest.Digest) {
+	t.Helper()
+	var raw bytes.Buffer
+	WriteTar(t, tar.NewWriter(&raw), files, modes)
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	gw.Write(raw.Bytes())
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes(), digest.FromBytes(raw.Bytes())
+}
+
+// NewRepo parses a docker save style image made of the layers
+func NewRepo(t testing.TB, layers ...Layer) *image.Tar {
+	t.Helper()
+	img := &image.Image{RootFS: &image.ImageRootFS{Type: "layers"}}
+	manifest := image.Manifest{RepoTags: []string{"graboid/test:latest"}, Config: "config.json"}
+	files := make(map[string]string)
+	for idx, layer := range layers {
+		layerTar, diffID := GzipTar(t, layer.Files, layer.Modes)
+		name := fmt.Sprintf("%d-%s/layer.tar", idx, diffID.Hex()[:12])
+		files[name] = string(layerTar)
+		manifest.Layers = append(manifest.Layers, name)
+		img.RootFS.DiffIDs = append(img.RootFS.DiffIDs, image.DiffID(diffID))
+		img.History = append(img.History, image.HistoryEntry{CreatedBy: layer.Command})
+	}
+	config, err := json.Marshal(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files["config.json"] = string(config)
+	manifests, err := json.Marshal([]image.Manifest{manifest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files["manifest.json"] = string(manifests)
+
+	archive, _ := GzipTar(t, files, nil)
+	repo, err := image.Parse(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
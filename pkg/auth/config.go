@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// ErrConfigNotFound is returned when the docker config file does not exist
+var ErrConfigNotFound = errors.New("docker config not found")
+
+type dockerAuth struct {
+	Auth     string `json:"auth,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// dockerConfig is the credential part of ~/.docker/config.json
+type dockerConfig struct {
+	Auths       map[string]dockerAuth `json:"auths,omitempty"`
+	CredHelpers map[string]string     `json:"credHelpers,omitempty"`
+	CredsStore  string                `json:"credsStore,omitempty"`
+}
+
+// DockerConfigCredentials returns a CredentialFunc that looks up credentials the way docker does using
+// the config.json at configPath: per registry credHelpers, then the credsStore, then inline auths
+func DockerConfigCredentials(configPath string) (CredentialFunc, error) {
+	rawJSON, err := ioutil.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrConfigNotFound, configPath)
+	} else if err != nil {
+		return nil, err
+	}
+
+	var cfg dockerConfig
+	if err := json.Unmarshal(rawJSON, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse docker config %s: %w", configPath, err)
+	}
+
+	// index entries by host since docker accepts keys like https://ghcr.io/v1/
+	auths := make(map[string]dockerAuth)
+	for key, a := range cfg.Auths {
+		auths[configHost(key)] = a
+	}
+	helpers := make(map[string]string)
+	for key, helper := range cfg.CredHelpers {
+		helpers[configHost(key)] = helper
+	}
+
+	return func(host string) (string, string, error) {
+		host = configHost(host)
+
+		if helper, ok := helpers[host]; ok {
+			username, password, err := NewCredentialHelper(helper).Credentials(host)
+			if !errors.Is(err, ErrCredentialsNotFound) {
+				return username, password, err
+			}
+		}
+		if cfg.CredsStore != "" {
+			username, password, err := NewCredentialHelper(cfg.CredsStore).Credentials(host)
+			if !errors.Is(err, ErrCredentialsNotFound) {
+				return username, password, err
+			}
+		}
+		if a, ok := auths[host]; ok {
+			return a.credentials()
+		}
+
+		// no credentials means anonymous access
+		return "", "", nil
+	}, nil
+}
+
+func (a dockerAuth) credentials() (string, string, error) {
+	if a.Auth == "" {
+		return a.Username, a.Password, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(a.Auth)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to decode auth: %w", err)
+	}
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 {
+		return "", "", errors.New("auth is not base64 encoded username:password")
+	}
+	return parts[0], parts[1], nil
+}
+
+// configHost returns the registry host of a docker config key or registry host
+func configHost(key string) string {
+	if idx := strings.Index(key, "://"); idx >= 0 {
+		key = key[idx+3:]
+	}
+	if idx := strings.Index(key, "/"); idx >= 0 {
+		key = key[:idx]
+	}
+	switch key {
+	case "docker.io", "index.docker.io", "registry-1.docker.io":
+		return "index.docker.io"
+	}
+	return key
+}
@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "graboid-auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// writeConfig writes config to a config.json in dir
+func writeConfig(t *testing.T, dir, config string) string {
+	t.Helper()
+	configPath := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return configPath
+}
+
+func basicAuth(username, password string) string {
+	return base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+}
+
+func TestDockerConfigCredentials(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		host     string
+		username string
+		password string
+	}{
+		{
+			name:     "credHelpers",
+			config:   `{"credHelpers": {"registry.example.com": "graboid-test"}, "credsStore": "graboid-store", "auths": {"registry.example.com": {"auth": "` + basicAuth("inline", "pw") + `"}}}`,
+			host:     "registry.example.com",
+			username: "user",
+			password: "secret",
+		},
+		{
+			name:     "credHelpers for Docker Hub",
+			config:   `{"credHelpers": {"https://index.docker.io/v1/": "graboid-test"}}`,
+			host:     "docker.io",
+			username: "hubuser",
+			password: "hubsecret",
+		},
+		{
+			name:     "credHelpers without credentials falls back to credsStore",
+			config:   `{"credHelpers": {"unknown.example.com": "graboid-test"}, "credsStore": "graboid-store"}`,
+			host:     "unknown.example.com",
+			username: "store",
+			password: "store-secret",
+		},
+		{
+			name:     "credsStore",
+			config:   `{"credsStore": "graboid-store", "auths": {"quay.io": {"auth": "` + basicAuth("inline", "pw") + `"}}}`,
+			host:     "quay.io",
+			username: "store",
+			password: "store-secret",
+		},
+		{
+			name:     "credsStore without credentials falls back to auths",
+			config:   `{"credsStore": "graboid-store", "auths": {"ghcr.io": {"auth": "` + basicAuth("ghuser", "ghpw") + `"}}}`,
+			host:     "ghcr.io",
+			username: "ghuser",
+			password: "ghpw",
+		},
+		{
+			name:     "auths",
+			config:   `{"auths": {"https://quay.io/v1/": {"auth": "` + basicAuth("quay", "pass:word") + `"}}}`,
+			host:     "quay.io",
+			username: "quay",
+			password: "pass:word",
+		},
+		{
+			name:     "auths with username and password",
+			config:   `{"auths": {"quay.io": {"username": "quay", "password": "pw"}}}`,
+			host:     "https://quay.io",
+			username: "quay",
+			password: "pw",
+		},
+		{
+			name:   "anonymous",
+			config: `{"auths": {"quay.io": {"auth": "` + basicAuth("quay", "pw") + `"}}}`,
+			host:   "ghcr.io",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := tempDir(t)
+			defer os.RemoveAll(dir)
+			configPath := writeConfig(t, dir, tt.config)
+
+			creds, err := DockerConfigCredentials(configPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			username, password, err := creds(tt.host)
+			if err != nil || username != tt.username || password != tt.password {
+				t.Errorf("credentials(%q) = %q, %q, %v, want %q, %q", tt.host, username, password, err, tt.username, tt.password)
+			}
+		})
+	}
+}
+
+func TestDockerConfigCredentialsErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		host   string
+	}{
+		{name: "invalid base64", config: `{"auths": {"quay.io": {"auth": "not base64!"}}}`, host: "quay.io"},
+		{name: "no colon", config: `{"auths": {"quay.io": {"auth": "` + base64.StdEncoding.EncodeToString([]byte("quay")) + `"}}}`, host: "quay.io"},
+		{name: "failing helper", config: `{"credHelpers": {"locked.example.com": "graboid-test"}, "credsStore": "graboid-store"}`, host: "locked.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := tempDir(t)
+			defer os.RemoveAll(dir)
+			configPath := writeConfig(t, dir, tt.config)
+
+			creds, err := DockerConfigCredentials(configPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := creds(tt.host); err == nil {
+				t.Errorf("credentials(%q) succeeded, want an error", tt.host)
+			}
+		})
+	}
+}
+
+func TestDockerConfigCredentialsNotFound(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	configPath := writeConfig(t, dir, `{"auths": `)
+
+	if _, err := DockerConfigCredentials(configPath); err == nil || errors.Is(err, ErrConfigNotFound) {
+		t.Errorf("DockerConfigCredentials(malformed) = %v, want a parse error", err)
+	}
+	missing := filepath.Join(dir, "missing.json")
+	if _, err := DockerConfigCredentials(missing); !errors.Is(err, ErrConfigNotFound) {
+		t.Errorf("DockerConfigCredentials(missing) = %v, want %v", err, ErrConfigNotFound)
+	}
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// dockerHubServer is the server URL docker stores Docker Hub credentials under
+const dockerHubServer = "https://index.docker.io/v1/"
+
+// ErrCredentialsNotFound is returned when a credential helper has no credentials for a server
+var ErrCredentialsNotFound = errors.New("credentials not found in native keychain")
+
+// CredentialFunc returns the username and password to use for a registry host
+type CredentialFunc func(host string) (username, password string, err error)
+
+// CredentialHelper gets credentials from a docker-credential-<name> binary
+type CredentialHelper struct {
+	Name string
+}
+
+type helperCredentials struct {
+	ServerURL string `json:"ServerURL,omitempty"`
+	Username  string `json:"Username"`
+	Secret    string `json:"Secret"`
+}
+
+// NewCredentialHelper returns the helper for docker-credential-<name> (e.g. osxkeychain)
+func NewCredentialHelper(name string) *CredentialHelper {
+	return &CredentialHelper{Name: name}
+}
+
+// Get asks the helper for the credentials stored for serverURL
+func (h *CredentialHelper) Get(serverURL string) (string, string, error) {
+	cmd := exec.Command("docker-credential-"+h.Name, "get")
+	cmd.Stdin = strings.NewReader(serverURL)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		// helpers print the error message on stdout
+		msg := strings.TrimSpace(stdout.String())
+		if msg == "" {
+			msg = strings.TrimSpace(stderr.String())
+		}
+		if strings.Contains(msg, "credentials not found") {
+			return "", "", fmt.Errorf("%w: %s", ErrCredentialsNotFound, serverURL)
+		}
+		if msg != "" {
+			return "", "", fmt.Errorf("docker-credential-%s: %s", h.Name, msg)
+		}
+		return "", "", fmt.Errorf("docker-credential-%s: %w", h.Name, err)
+	}
+
+	var creds helperCredentials
+	if err := json.Unmarshal(stdout.Bytes(), &creds); err != nil {
+		return "", "", fmt.Errorf("failed to parse docker-credential-%s output: %w", h.Name, err)
+	}
+
+	return creds.Username, creds.Secret, nil
+}
+
+// Credentials gets the credentials for a registry host and can be used as a CredentialFunc
+func (h *CredentialHelper) Credentials(host string) (string, string, error) {
+	return h.Get(serverURL(host))
+}
+
+// serverURL returns the key docker stores a registry host's credentials under
+func serverURL(host string) string {
+	switch host {
+	case "docker.io", "index.docker.io", "registry-1.docker.io":
+		return dockerHubServer
+	}
+	return host
+}
@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain puts the fake docker-credential-graboid-* helpers of testdata on the PATH
+func TestMain(m *testing.M) {
+	testdata, err := filepath.Abs("testdata")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("PATH", testdata+string(os.PathListSeparator)+os.Getenv("PATH"))
+	os.Exit(m.Run())
+}
+
+func TestCredentialHelperGet(t *testing.T) {
+	h := NewCredentialHelper("graboid-test")
+	tests := []struct {
+		server   string
+		username string
+		password string
+		err      error
+	}{
+		{server: "registry.example.com", username: "user", password: "secret"},
+		{server: dockerHubServer, username: "hubuser", password: "hubsecret"},
+		{server: "unknown.example.com", err: ErrCredentialsNotFound},
+	}
+	for _, tt := range tests {
+		username, password, err := h.Get(tt.server)
+		if !errors.Is(err, tt.err) || username != tt.username || password != tt.password {
+			t.Errorf("Get(%q) = %q, %q, %v, want %q, %q, %v", tt.server, username, password, err, tt.username, tt.password, tt.err)
+		}
+	}
+}
+
+func TestCredentialHelperErrors(t *testing.T) {
+	tests := []struct {
+		helper string
+		server string
+		msg    string
+	}{
+		{helper: "graboid-test", server: "locked.example.com", msg: "docker-credential-graboid-test: keychain is locked"},
+		{helper: "graboid-test", server: "broken.example.com", msg: "failed to parse docker-credential-graboid-test output"},
+		{helper: "graboid-missing", server: "registry.example.com", msg: "docker-credential-graboid-missing"},
+	}
+	for _, tt := range tests {
+		_, _, err := NewCredentialHelper(tt.helper).Get(tt.server)
+		if err == nil || errors.Is(err, ErrCredentialsNotFound) || !strings.HasPrefix(err.Error(), tt.msg) {
+			t.Errorf("Get(%q) with %s = %v, want %q", tt.server, tt.helper, err, tt.msg)
+		}
+	}
+}
+
+func TestCredentialHelperCredentials(t *testing.T) {
+	h := NewCredentialHelper("graboid-test")
+	for _, host := range []string{"docker.io", "index.docker.io", "registry-1.docker.io"} {
+		username, password, err := h.Credentials(host)
+		if err != nil || username != "hubuser" || password != "hubsecret" {
+			t.Errorf("Credentials(%q) = %q, %q, %v, want the Docker Hub credentials", host, username, password, err)
+		}
+	}
+	if username, _, err := h.Credentials("registry.example.com"); err != nil || username != "user" {
+		t.Errorf("Credentials(registry.example.com) = %q, %v", username, err)
+	}
+}
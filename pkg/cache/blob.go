@@ -0,0 +1,193 @@
+package cache
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	blobdigest "github.com/blacktop/graboid/pkg/digest"
+	"github.com/opencontainers/go-digest"
+)
+
+// BlobCache is a content-addressable on-disk cache of blobs keyed by digest
+type BlobCache struct {
+	root string
+}
+
+// NewBlobCache creates a blob cache rooted at dir
+func NewBlobCache(dir string) (*BlobCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &BlobCache{root: dir}, nil
+}
+
+func (bc *BlobCache) path(d digest.Digest) string {
+	return filepath.Join(bc.root, d.Algorithm().String(), d.Hex())
+}
+
+// Has returns true if the blob is in the cache
+func (bc *BlobCache) Has(d digest.Digest) bool {
+	if d.Validate() != nil {
+		return false
+	}
+	_, err := os.Stat(bc.path(d))
+	return err == nil
+}
+
+// Put streams r into the cache. The content is verified against d and only
+// renamed into the cache once complete, so readers never see partial blobs.
+func (bc *BlobCache) Put(d digest.Digest, r io.Reader) error {
+	vr, err := blobdigest.NewVerifyingReader(r, d)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(bc.path(d))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, d.Hex()+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, vr); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := vr.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), bc.path(d))
+}
+
+// Get returns a reader for the cached blob. The caller must close it.
+func (bc *BlobCache) Get(d digest.Digest) (io.ReadCloser, bool) {
+	if d.Validate() != nil {
+		return nil, false
+	}
+	f, err := os.Open(bc.path(d))
+	if err != nil {
+		return nil, false
+	}
+	// mtime tracks the last use for Prune
+	now := time.Now()
+	os.Chtimes(bc.path(d), now, now)
+	return f, true
+}
+
+// Evict removes the blob from the cache
+func (bc *BlobCache) Evict(d digest.Digest) error {
+	if err := d.Validate(); err != nil {
+		return err
+	}
+	err := os.Remove(bc.path(d))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// staleTempAge is how old a temp file of Put must be before Prune treats it
+// as left over by a crashed process rather than a write in progress
+const staleTempAge = 24 * time.Hour
+
+type cacheEntry struct {
+	path    string
+	size    int64
+	lastUse time.Time
+	temp    bool
+}
+
+func (bc *BlobCache) entries() ([]cacheEntry, error) {
+	var entries []cacheEntry
+	err := filepath.Walk(bc.root, func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			// a Put renamed its temp file while walking
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			entries = append(entries, cacheEntry{
+				path:    path,
+				size:    info.Size(),
+				lastUse: info.ModTime(),
+				temp:    strings.Contains(info.Name(), ".tmp"),
+			})
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// Size returns the total number of bytes used by the cache
+func (bc *BlobCache) Size() (int64, error) {
+	entries, err := bc.entries()
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, entry := range entries {
+		total += entry.size
+	}
+	return total, nil
+}
+
+// Prune evicts the least recently used blobs until the cache uses at most
+// maxBytes and returns the number of bytes freed. Temp files of blobs being
+// written are left alone unless they are older than a day.
+func (bc *BlobCache) Prune(maxBytes int64) (int64, error) {
+	all, err := bc.entries()
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		entries []cacheEntry
+		total   int64
+		freed   int64
+	)
+	for _, entry := range all {
+		if !entry.temp {
+			entries = append(entries, entry)
+			total += entry.size
+			continue
+		}
+		if time.Since(entry.lastUse) < staleTempAge {
+			continue
+		}
+		if err := os.Remove(entry.path); err != nil && !os.IsNotExist(err) {
+			return freed, err
+		}
+		freed += entry.size
+	}
+
+	sort.Slice(entries, func(a, b int) bool {
+		return entries[a].lastUse.Before(entries[b].lastUse)
+	})
+
+	for _, entry := range entries {
+		if total <= maxBytes {
+			break
+		}
+		if err := os.Remove(entry.path); err != nil {
+			return freed, err
+		}
+		total -= entry.size
+		freed += entry.size
+	}
+
+	return freed, nil
+}
@@ -0,0 +1,154 @@
+package cache
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	blobdigest "github.com/blacktop/graboid/pkg/digest"
+	"github.com/opencontainers/go-digest"
+)
+
+func newBlobCache(t *testing.T) *BlobCache {
+	t.Helper()
+	bc, err := NewBlobCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bc
+}
+
+func putBlob(t *testing.T, bc *BlobCache, data string, lastUse time.Time) digest.Digest {
+	t.Helper()
+	d := digest.FromString(data)
+	if err := bc.Put(d, strings.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(bc.path(d), lastUse, lastUse); err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestBlobCache(t *testing.T) {
+	bc := newBlobCache(t)
+	d := digest.FromString("layer")
+
+	if bc.Has(d) {
+		t.Fatal("empty cache has the blob")
+	}
+	if _, ok := bc.Get(d); ok {
+		t.Fatal("Get() found a blob in the empty cache")
+	}
+	if err := bc.Put(d, strings.NewReader("layer")); err != nil {
+		t.Fatal(err)
+	}
+	if !bc.Has(d) {
+		t.Fatal("Has() = false after Put()")
+	}
+	rc, ok := bc.Get(d)
+	if !ok {
+		t.Fatal("Get() = false after Put()")
+	}
+	data, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "layer" {
+		t.Errorf("Get() = %q", data)
+	}
+
+	if err := bc.Evict(d); err != nil {
+		t.Fatal(err)
+	}
+	if bc.Has(d) {
+		t.Error("Has() = true after Evict()")
+	}
+	if err := bc.Evict(d); err != nil {
+		t.Errorf("Evict() of a missing blob = %v", err)
+	}
+}
+
+func TestBlobCachePutMismatch(t *testing.T) {
+	bc := newBlobCache(t)
+	d := digest.FromString("layer")
+
+	err := bc.Put(d, strings.NewReader("corrupted layer"))
+	var mismatch *blobdigest.ErrDigestMismatch
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("Put() error = %v, want a digest mismatch", err)
+	}
+	if bc.Has(d) {
+		t.Error("corrupted blob was cached")
+	}
+	if size, err := bc.Size(); err != nil || size != 0 {
+		t.Errorf("Size() = %d, %v: the temp file was left behind", size, err)
+	}
+}
+
+func TestBlobCachePrune(t *testing.T) {
+	bc := newBlobCache(t)
+	now := time.Now()
+	oldest := putBlob(t, bc, "aaaa", now.Add(-3*time.Hour))
+	middle := putBlob(t, bc, "bbbb", now.Add(-2*time.Hour))
+	newest := putBlob(t, bc, "cccc", now.Add(-time.Hour))
+
+	freed, err := bc.Prune(8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if freed != 4 {
+		t.Errorf("Prune() freed %d bytes, want 4", freed)
+	}
+	if bc.Has(oldest) || !bc.Has(middle) || !bc.Has(newest) {
+		t.Errorf("Prune() kept oldest=%t middle=%t newest=%t, want only the least recently used evicted",
+			bc.Has(oldest), bc.Has(middle), bc.Has(newest))
+	}
+
+	// Get marks the blob as used
+	rc, _ := bc.Get(middle)
+	rc.Close()
+	if _, err := bc.Prune(4); err != nil {
+		t.Fatal(err)
+	}
+	if !bc.Has(middle) || bc.Has(newest) {
+		t.Errorf("Prune() after Get kept middle=%t newest=%t", bc.Has(middle), bc.Has(newest))
+	}
+}
+
+func TestBlobCachePruneTempFiles(t *testing.T) {
+	bc := newBlobCache(t)
+	d := putBlob(t, bc, "aaaa", time.Now().Add(-time.Hour))
+
+	dir := filepath.Dir(bc.path(d))
+	inProgress := filepath.Join(dir, digest.FromString("bbbb").Hex()+".tmp123")
+	stale := filepath.Join(dir, digest.FromString("cccc").Hex()+".tmp456")
+	for _, name := range []string{inProgress, stale} {
+		if err := ioutil.WriteFile(name, []byte("partial"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-2 * staleTempAge)
+	if err := os.Chtimes(stale, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	freed, err := bc.Prune(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if freed != int64(len("aaaa")+len("partial")) {
+		t.Errorf("Prune() freed %d bytes", freed)
+	}
+	if _, err := os.Stat(inProgress); err != nil {
+		t.Errorf("Prune() removed the temp file of a blob being written: %v", err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("Prune() kept a stale temp file: %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/blacktop/graboid/pkg/image"
+	"github.com/opencontainers/go-digest"
+)
+
+// CacheStats are the usage counters of a LayerCache
+type CacheStats struct {
+	Hits      int64
+	Misses    int64
+	Entries   int
+	DiskUsage int64
+}
+
+// LayerCache is an on-disk cache of parsed layers keyed by digest, stored as JSON
+type LayerCache struct {
+	root string
+
+	mu     sync.Mutex
+	hits   int64
+	misses int64
+}
+
+// NewLayerCache creates a layer cache rooted at dir
+func NewLayerCache(dir string) (*LayerCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &LayerCache{root: dir}, nil
+}
+
+func (lc *LayerCache) path(d digest.Digest) string {
+	return filepath.Join(lc.root, d.Algorithm().String(), d.Hex()+".json")
+}
+
+// Put stores the layer under d. The entry is written to a temp file and
+// checked to parse back before it is renamed into the cache.
+func (lc *LayerCache) Put(d digest.Digest, l image.Layer) error {
+	if err := d.Validate(); err != nil {
+		return err
+	}
+	data, err := l.ExportJSON()
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(lc.path(d))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, d.Hex()+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	written, err := ioutil.ReadFile(tmp.Name())
+	if err != nil {
+		return err
+	}
+	if _, err := image.LayerFromJSON(written); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), lc.path(d))
+}
+
+// Get returns the layer cached under d, the bool is false on a cache miss
+func (lc *LayerCache) Get(d digest.Digest) (image.Layer, bool, error) {
+	if err := d.Validate(); err != nil {
+		return nil, false, err
+	}
+	data, err := ioutil.ReadFile(lc.path(d))
+	if os.IsNotExist(err) {
+		lc.count(false)
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	l, err := image.LayerFromJSON(data)
+	if err != nil {
+		return nil, false, err
+	}
+	lc.count(true)
+	return l, true, nil
+}
+
+// Invalidate removes the layer cached under d
+func (lc *LayerCache) Invalidate(d digest.Digest) error {
+	if err := d.Validate(); err != nil {
+		return err
+	}
+	err := os.Remove(lc.path(d))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Stats returns the hit and miss counts since the cache was created and its disk usage
+func (lc *LayerCache) Stats() CacheStats {
+	lc.mu.Lock()
+	stats := CacheStats{Hits: lc.hits, Misses: lc.misses}
+	lc.mu.Unlock()
+
+	filepath.Walk(lc.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.Mode().IsRegular() && filepath.Ext(path) == ".json" {
+			stats.Entries++
+			stats.DiskUsage += info.Size()
+		}
+		return nil
+	})
+	return stats
+}
+
+func (lc *LayerCache) count(hit bool) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	if hit {
+		lc.hits++
+	} else {
+		lc.misses++
+	}
+}
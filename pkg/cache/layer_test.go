@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blacktop/graboid/pkg/image"
+	"github.com/opencontainers/go-digest"
+	"github.com/wagoodman/dive/filetree"
+)
+
+const testLayerJSON = `{"tar_path":"abc/layer.tar","index":1,"history":{"created_by":"/bin/sh -c apk add curl"},"tree_name":"abc/layer.tar","file_size":1034,` +
+	`"files":[{"path":"usr","type":53,"size":0,"mode":2147484141,"uid":0,"gid":0,"dir":true},` +
+	`{"path":"usr/bin/curl","type":48,"size":1024,"mode":493,"uid":0,"gid":0},` +
+	`{"path":"usr/bin/curl-config","type":50,"linkname":"curl","size":10,"mode":134218239,"uid":0,"gid":0}]}`
+
+func newLayerCache(t *testing.T) *LayerCache {
+	t.Helper()
+	lc, err := NewLayerCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lc
+}
+
+func testLayer(t *testing.T) image.Layer {
+	t.Helper()
+	l, err := image.LayerFromJSON([]byte(testLayerJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func layerPaths(l image.Layer) []string {
+	var paths []string
+	l.Walk(func(node *filetree.FileNode) error {
+		if node.Parent != nil {
+			paths = append(paths, node.Path())
+		}
+		return nil
+	})
+	return paths
+}
+
+func TestLayerCache(t *testing.T) {
+	lc := newLayerCache(t)
+	d := digest.FromString("layer")
+
+	if l, ok, err := lc.Get(d); err != nil || ok || l != nil {
+		t.Fatalf("Get() of a missing layer = %v, %t, %v", l, ok, err)
+	}
+	if stats := lc.Stats(); stats != (CacheStats{Misses: 1}) {
+		t.Errorf("Stats() after a miss = %+v", stats)
+	}
+
+	layer := testLayer(t)
+	if err := lc.Put(d, layer); err != nil {
+		t.Fatal(err)
+	}
+	got, ok, err := lc.Get(d)
+	if err != nil || !ok {
+		t.Fatalf("Get() = %v, %t, %v", got, ok, err)
+	}
+	if got.Index() != 1 || got.Command() != "apk add curl" || got.TarID() != layer.TarID() {
+		t.Errorf("Get() = %s", got)
+	}
+	if paths := layerPaths(got); len(paths) != 4 || paths[3] != "/usr/bin/curl-config" {
+		t.Errorf("cached layer files = %v", paths)
+	}
+	if node, ok := got.FileByPath("/usr/bin/curl-config"); !ok || node.Data.FileInfo.Linkname != "curl" {
+		t.Errorf("FileByPath() = %v, %t", node, ok)
+	}
+
+	fi, err := os.Stat(lc.path(d))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := lc.Stats(); stats != (CacheStats{Hits: 1, Misses: 1, Entries: 1, DiskUsage: fi.Size()}) {
+		t.Errorf("Stats() = %+v, want 1 hit, 1 miss and %d bytes", stats, fi.Size())
+	}
+
+	if err := lc.Invalidate(d); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := lc.Get(d); err != nil || ok {
+		t.Errorf("Get() after Invalidate() = %t, %v", ok, err)
+	}
+	if err := lc.Invalidate(d); err != nil {
+		t.Errorf("Invalidate() of a missing layer = %v", err)
+	}
+	if stats := lc.Stats(); stats != (CacheStats{Hits: 1, Misses: 2}) {
+		t.Errorf("Stats() after Invalidate() = %+v", stats)
+	}
+}
+
+func TestLayerCachePutLeavesNoTempFiles(t *testing.T) {
+	lc := newLayerCache(t)
+	for _, data := range []string{"a", "b", "a"} {
+		if err := lc.Put(digest.FromString(data), testLayer(t)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := ioutil.ReadDir(filepath.Join(lc.root, "sha256"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		t.Errorf("cache holds %v, want the two entries", names)
+	}
+}
+
+func TestLayerCacheCorruptEntry(t *testing.T) {
+	lc := newLayerCache(t)
+	d := digest.FromString("layer")
+	if err := lc.Put(d, testLayer(t)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(lc.path(d), []byte(`{"tar_path":`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := lc.Get(d); err == nil || ok {
+		t.Errorf("Get() of a truncated entry = %t, %v, want an error", ok, err)
+	}
+}
+
+func TestLayerCacheInvalidDigest(t *testing.T) {
+	lc := newLayerCache(t)
+	d := digest.Digest("sha256:nothex")
+	if err := lc.Put(d, testLayer(t)); err == nil {
+		t.Error("Put() with an invalid digest succeeded")
+	}
+	if _, _, err := lc.Get(d); err == nil {
+		t.Error("Get() with an invalid digest succeeded")
+	}
+	if err := lc.Invalidate(d); err == nil {
+		t.Error("Invalidate() with an invalid digest succeeded")
+	}
+}
@@ -0,0 +1,204 @@
+package convert
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/blacktop/graboid/pkg/image"
+	"github.com/blacktop/graboid/pkg/oci"
+	"github.com/blacktop/graboid/pkg/tarball"
+)
+
+// DockerToOCI converts the docker save tarball at archivePath to an OCI image layout in destDir.
+// Layers and configs are copied byte for byte so their digests are unchanged.
+func DockerToOCI(archivePath string, destDir string) error {
+	archive, err := tarball.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	layout, err := oci.CreateLayout(destDir)
+	if err != nil {
+		return err
+	}
+
+	for idx := range archive.Manifests {
+		m := &archive.Manifests[idx]
+		if err := dockerManifestToOCI(archive, m, layout); err != nil {
+			return fmt.Errorf("failed to convert %s: %w", m.Config, err)
+		}
+	}
+
+	return nil
+}
+
+func dockerManifestToOCI(archive *tarball.Archive, m *image.Manifest, layout *oci.Layout) error {
+	img, err := archive.Image(m)
+	if err != nil {
+		return err
+	}
+
+	var layers []io.Reader
+	for _, layerPath := range m.Layers {
+		rc, err := archive.File(layerPath)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		layers = append(layers, rc)
+	}
+
+	opts := []oci.WriteOption{oci.WithOverwrite(true)}
+	if len(m.RepoTags) > 0 {
+		name := m.RepoTags[0]
+		tag := name[strings.LastIndex(name, ":")+1:]
+		opts = append(opts, oci.WithAnnotations(map[string]string{
+			oci.AnnotationRefName:   tag,
+			oci.AnnotationImageName: name,
+		}))
+	}
+
+	return layout.WriteManifest(image.OCIManifest{}, img, layers, opts...)
+}
+
+type ociImage struct {
+	manifest image.OCIManifest
+	repoTags []string
+}
+
+// ociImages returns the image manifests referenced by descs, descending into nested indexes
+func ociImages(layout *oci.Layout, descs []image.Descriptor) ([]ociImage, error) {
+	var images []ociImage
+
+	for _, desc := range descs {
+		switch desc.MediaType {
+		case image.MediaTypeOCIManifest, image.MediaTypeDockerManifest, oci.MediaTypeOCIIndex, oci.MediaTypeDockerManifestList:
+		default:
+			continue
+		}
+
+		rc, err := layout.BlobReader(desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+		var index oci.Index
+		var m image.OCIManifest
+		if desc.MediaType == oci.MediaTypeOCIIndex || desc.MediaType == oci.MediaTypeDockerManifestList {
+			err = json.NewDecoder(rc).Decode(&index)
+		} else {
+			err = json.NewDecoder(rc).Decode(&m)
+		}
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", desc.Digest, err)
+		}
+
+		if len(index.Manifests) > 0 {
+			nested, err := ociImages(layout, index.Manifests)
+			if err != nil {
+				return nil, err
+			}
+			images = append(images, nested...)
+			continue
+		}
+
+		var repoTags []string
+		if name, ok := desc.Annotations[oci.AnnotationImageName]; ok {
+			repoTags = append(repoTags, name)
+		} else if tag, ok := desc.Annotations[oci.AnnotationRefName]; ok && strings.Contains(tag, ":") {
+			repoTags = append(repoTags, tag)
+		}
+		images = append(images, ociImage{manifest: m, repoTags: repoTags})
+	}
+
+	return images, nil
+}
+
+// OCIToDocker converts the OCI image layout in layoutDir to a docker save tarball at destPath
+// that docker load accepts. Blobs are copied byte for byte.
+func OCIToDocker(layoutDir string, destPath string) (err error) {
+	layout, err := oci.OpenLayout(layoutDir)
+	if err != nil {
+		return err
+	}
+	images, err := ociImages(layout, layout.Index.Manifests)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(destPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(destPath)
+		}
+	}()
+	tw := tar.NewWriter(f)
+
+	var manifests image.Manifests
+	written := make(map[string]bool)
+
+	for _, img := range images {
+		m := image.Manifest{
+			Config:   img.manifest.Config.Digest.Hex() + ".json",
+			RepoTags: img.repoTags,
+		}
+		if err := copyBlob(tw, layout, img.manifest.Config, m.Config, written); err != nil {
+			return err
+		}
+		for _, layer := range img.manifest.Layers {
+			layerPath := layer.Digest.Hex() + "/layer.tar"
+			if err := copyBlob(tw, layout, layer, layerPath, written); err != nil {
+				return err
+			}
+			m.Layers = append(m.Layers, layerPath)
+		}
+		manifests = append(manifests, m)
+	}
+
+	rawManifests, err := json.Marshal(manifests)
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: "manifest.json", Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(rawManifests))}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(rawManifests); err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+// copyBlob writes the blob desc describes from the layout to the tar as name unless it was already written
+func copyBlob(tw *tar.Writer, layout *oci.Layout, desc image.Descriptor, name string, written map[string]bool) error {
+	if written[name] {
+		return nil
+	}
+
+	rc, err := layout.BlobReader(desc.Digest)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	if err := tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: desc.Size}); err != nil {
+		return err
+	}
+	// the tar writer fails if the blob is not desc.Size bytes
+	if _, err := io.Copy(tw, rc); err != nil {
+		return fmt.Errorf("failed to copy blob %s: %w", desc.Digest, err)
+	}
+	written[name] = true
+	return nil
+}
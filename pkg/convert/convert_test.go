@@ -0,0 +1,213 @@
+package convert
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/blacktop/graboid/pkg/image"
+	"github.com/blacktop/graboid/pkg/oci"
+	"github.com/blacktop/graboid/pkg/tarball"
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	// dockerSave is the docker save tarball of graboid/test:latest the tarball tests use
+	dockerSave = "../tarball/testdata/docker-save.tar"
+	// ociLayout is the OCI layout with a two platform index and a single image the oci tests use
+	ociLayout = "../oci/testdata/layout"
+)
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "graboid-convert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// blobs lists the config and the layer digests of an image
+type blobs struct {
+	repoTags []string
+	config   digest.Digest
+	layers   []digest.Digest
+}
+
+// archiveBlobs digests the configs and layers of a docker save tarball
+func archiveBlobs(t *testing.T, archivePath string) []blobs {
+	t.Helper()
+	archive, err := tarball.Open(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+
+	fileDigest := func(name string) digest.Digest {
+		rc, err := archive.File(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rc.Close()
+		d, err := digest.FromReader(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	var images []blobs
+	for _, m := range archive.Manifests {
+		b := blobs{repoTags: m.RepoTags, config: fileDigest(m.Config)}
+		for _, layer := range m.Layers {
+			b.layers = append(b.layers, fileDigest(layer))
+		}
+		images = append(images, b)
+	}
+	return images
+}
+
+// layoutBlobs lists the config and layer digests of the images of an OCI layout after checking the blobs
+func layoutBlobs(t *testing.T, layoutDir string) []blobs {
+	t.Helper()
+	layout, err := oci.OpenLayout(layoutDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifests, err := layout.Manifests()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blobDigest := func(d digest.Digest) digest.Digest {
+		rc, err := layout.BlobReader(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rc.Close()
+		got, err := digest.FromReader(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != d {
+			t.Errorf("blob %s has digest %s", d, got)
+		}
+		return got
+	}
+
+	var images []blobs
+	for _, m := range manifests {
+		b := blobs{config: blobDigest(m.Config.Digest)}
+		for _, layer := range m.Layers {
+			b.layers = append(b.layers, blobDigest(layer.Digest))
+		}
+		images = append(images, b)
+	}
+	return images
+}
+
+func TestDockerToOCI(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	dest := filepath.Join(dir, "layout")
+
+	if err := DockerToOCI(dockerSave, dest); err != nil {
+		t.Fatal(err)
+	}
+
+	want := archiveBlobs(t, dockerSave)
+	got := layoutBlobs(t, dest)
+	if len(got) != 1 || got[0].config != want[0].config || !reflect.DeepEqual(got[0].layers, want[0].layers) {
+		t.Errorf("layout blobs = %+v, want %+v", got, want)
+	}
+
+	layout, err := oci.OpenLayout(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc := layout.Index.Manifests[0]
+	if desc.MediaType != image.MediaTypeOCIManifest || desc.Annotations[oci.AnnotationRefName] != "latest" || desc.Annotations[oci.AnnotationImageName] != "graboid/test:latest" {
+		t.Errorf("index entry = %+v", desc)
+	}
+	manifests, err := layout.Manifests()
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := layout.Config(manifests[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(img.RootFS.DiffIDs) != 2 || img.RootFS.DiffIDs[0].String() != want[0].layers[0].String() {
+		t.Errorf("config rootfs = %+v", img.RootFS)
+	}
+}
+
+func TestDockerToOCIRoundTrip(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	layoutDir := filepath.Join(dir, "layout")
+	archivePath := filepath.Join(dir, "image.tar")
+
+	if err := DockerToOCI(dockerSave, layoutDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := OCIToDocker(layoutDir, archivePath); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := archiveBlobs(t, archivePath), archiveBlobs(t, dockerSave); !reflect.DeepEqual(got, want) {
+		t.Errorf("round tripped archive = %+v, want %+v", got, want)
+	}
+}
+
+func TestOCIToDocker(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	archivePath := filepath.Join(dir, "image.tar")
+
+	if err := OCIToDocker(ociLayout, archivePath); err != nil {
+		t.Fatal(err)
+	}
+
+	got := archiveBlobs(t, archivePath)
+	want := layoutBlobs(t, ociLayout)
+	if len(got) != 3 || len(got) != len(want) {
+		t.Fatalf("archive has %d images, want the 3 of the layout", len(got))
+	}
+	for idx := range want {
+		if got[idx].config != want[idx].config || !reflect.DeepEqual(got[idx].layers, want[idx].layers) {
+			t.Errorf("image %d = %+v, want %+v", idx, got[idx], want[idx])
+		}
+		// the layout's ref names are plain tags without a repository
+		if len(got[idx].repoTags) != 0 {
+			t.Errorf("image %d repo tags = %v", idx, got[idx].repoTags)
+		}
+	}
+
+	// and back again, blobs are copied as they are
+	layoutDir := filepath.Join(dir, "layout")
+	if err := DockerToOCI(archivePath, layoutDir); err != nil {
+		t.Fatal(err)
+	}
+	if again := layoutBlobs(t, layoutDir); !reflect.DeepEqual(again, want) {
+		t.Errorf("layout blobs = %+v, want %+v", again, want)
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	if err := DockerToOCI(filepath.Join(dir, "missing.tar"), filepath.Join(dir, "layout")); !os.IsNotExist(err) {
+		t.Errorf("DockerToOCI() of a missing archive = %v", err)
+	}
+	dest := filepath.Join(dir, "image.tar")
+	if err := OCIToDocker(dir, dest); err == nil {
+		t.Error("OCIToDocker() of a directory without a layout succeeded")
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Errorf("OCIToDocker() left %s behind", dest)
+	}
+}
@@ -0,0 +1,171 @@
+package diff
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/blacktop/graboid/pkg/image"
+	"github.com/wagoodman/dive/filetree"
+)
+
+// LayerDiff is a layer that differs between the base and target image at the same position
+type LayerDiff struct {
+	Index  int
+	Base   image.Layer
+	Target image.Layer
+	Files  image.LayerDiff
+}
+
+// FileDiff groups the paths of the flattened images by how they changed
+type FileDiff struct {
+	Added     []string
+	Removed   []string
+	Modified  []string
+	Unchanged []string
+}
+
+// DiffReport describes how the target image differs from the base image
+type DiffReport struct {
+	// AddedLayers are the target layers that are not in base
+	AddedLayers []image.Layer
+	// RemovedLayers are the base layers that are not in target
+	RemovedLayers []image.Layer
+	// ModifiedLayers pairs up differing layers found at the same index in both images
+	ModifiedLayers []LayerDiff
+	// FileDiff compares the final filesystems of both images
+	FileDiff FileDiff
+}
+
+// Compare compares the layers and the final filesystems of two images.
+// Layers are matched by their diff ID so both images need their config.
+func Compare(base, target *image.Tar) (*DiffReport, error) {
+	baseChain, err := base.LayerChain()
+	if err != nil {
+		return nil, fmt.Errorf("base: %w", err)
+	}
+	targetChain, err := target.LayerChain()
+	if err != nil {
+		return nil, fmt.Errorf("target: %w", err)
+	}
+
+	inBase := make(map[string]bool)
+	for idx := range baseChain {
+		d, _ := base.DiffID(idx)
+		inBase[d.String()] = true
+	}
+	inTarget := make(map[string]bool)
+	for idx := range targetChain {
+		d, _ := target.DiffID(idx)
+		inTarget[d.String()] = true
+	}
+
+	report := &DiffReport{}
+
+	// base layers missing from target by index
+	removed := make(map[int]bool)
+	for idx := range baseChain {
+		if d, _ := base.DiffID(idx); !inTarget[d.String()] {
+			removed[idx] = true
+		}
+	}
+
+	for idx, layer := range targetChain {
+		if d, _ := target.DiffID(idx); inBase[d.String()] {
+			continue
+		}
+		if removed[idx] {
+			report.ModifiedLayers = append(report.ModifiedLayers, LayerDiff{
+				Index:  idx,
+				Base:   baseChain[idx],
+				Target: layer,
+				Files:  baseChain[idx].Diff(layer),
+			})
+			delete(removed, idx)
+			continue
+		}
+		report.AddedLayers = append(report.AddedLayers, layer)
+	}
+	for idx, layer := range baseChain {
+		if removed[idx] {
+			report.RemovedLayers = append(report.RemovedLayers, layer)
+		}
+	}
+
+	baseFlat, err := base.Flatten()
+	if err != nil {
+		return nil, fmt.Errorf("base: %w", err)
+	}
+	targetFlat, err := target.Flatten()
+	if err != nil {
+		return nil, fmt.Errorf("target: %w", err)
+	}
+	report.FileDiff = fileDiff(baseFlat, targetFlat)
+
+	return report, nil
+}
+
+func paths(nodes []*filetree.FileNode) []string {
+	var ps []string
+	for _, node := range nodes {
+		ps = append(ps, node.Path())
+	}
+	sort.Strings(ps)
+	return ps
+}
+
+func fileDiff(base, target image.Layer) FileDiff {
+	ld := base.Diff(target)
+	fd := FileDiff{
+		Added:    paths(ld.Added),
+		Removed:  paths(ld.Removed),
+		Modified: paths(ld.Modified),
+	}
+
+	changed := make(map[string]bool)
+	for _, p := range fd.Modified {
+		changed[p] = true
+	}
+	target.Walk(func(node *filetree.FileNode) error {
+		if node.Parent == nil || node.Data.FileInfo.IsDir || len(node.Children) > 0 {
+			return nil
+		}
+		if _, ok := base.FileByPath(node.Path()); ok && !changed[node.Path()] {
+			fd.Unchanged = append(fd.Unchanged, node.Path())
+		}
+		return nil
+	})
+	sort.Strings(fd.Unchanged)
+
+	return fd
+}
+
+// Summary returns a human readable summary of the report
+func (r *DiffReport) Summary() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "layers: %d added, %d removed, %d modified\n", len(r.AddedLayers), len(r.RemovedLayers), len(r.ModifiedLayers))
+	for _, layer := range r.AddedLayers {
+		fmt.Fprintf(&sb, "+ layer %d: %s\n", layer.Index(), layer.Command())
+	}
+	for _, layer := range r.RemovedLayers {
+		fmt.Fprintf(&sb, "- layer %d: %s\n", layer.Index(), layer.Command())
+	}
+	for _, ld := range r.ModifiedLayers {
+		fmt.Fprintf(&sb, "~ layer %d: %s\n", ld.Index, ld.Target.Command())
+	}
+
+	fd := r.FileDiff
+	fmt.Fprintf(&sb, "files: %d added, %d removed, %d modified, %d unchanged\n", len(fd.Added), len(fd.Removed), len(fd.Modified), len(fd.Unchanged))
+	for _, p := range fd.Added {
+		fmt.Fprintf(&sb, "+ %s\n", p)
+	}
+	for _, p := range fd.Removed {
+		fmt.Fprintf(&sb, "- %s\n", p)
+	}
+	for _, p := range fd.Modified {
+		fmt.Fprintf(&sb, "~ %s\n", p)
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,124 @@
+package diff
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/blacktop/graboid/internal/testimage"
+	"github.com/blacktop/graboid/pkg/image"
+)
+
+func commands(layers []image.Layer) []string {
+	var cmds []string
+	for _, layer := range layers {
+		cmds = append(cmds, layer.Command())
+	}
+	return cmds
+}
+
+var (
+	baseLayer = testimage.Layer{Command: "ADD rootfs /", Files: map[string]string{"etc/passwd": "root:x:0:0", "etc/motd": "welcome", "bin/sh": "#!sh"}}
+	appV1     = testimage.Layer{Command: "COPY app v1", Files: map[string]string{"app/main.py": "print(1)", "app/config": "debug"}}
+	appV2     = testimage.Layer{Command: "COPY app v2", Files: map[string]string{"app/main.py": "print(2)", "app/config": "debug", "app/new.py": "pass"}}
+	noMotd    = testimage.Layer{Command: "RUN rm /etc/motd", Files: map[string]string{"etc/.wh.motd": ""}}
+)
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     []testimage.Layer
+		target   []testimage.Layer
+		added    []string
+		removed  []string
+		modified []int
+		files    FileDiff
+	}{
+		{
+			name:     "modified and added layer",
+			base:     []testimage.Layer{baseLayer, appV1},
+			target:   []testimage.Layer{baseLayer, appV2, noMotd},
+			added:    []string{"RUN rm /etc/motd"},
+			modified: []int{1},
+			files: FileDiff{
+				Added:     []string{"/app/new.py"},
+				Removed:   []string{"/etc/motd"},
+				Modified:  []string{"/app/main.py"},
+				Unchanged: []string{"/app/config", "/bin/sh", "/etc/passwd"},
+			},
+		},
+		{
+			name:    "removed layer",
+			base:    []testimage.Layer{baseLayer, appV1},
+			target:  []testimage.Layer{baseLayer},
+			removed: []string{"COPY app v1"},
+			files: FileDiff{
+				Removed:   []string{"/app", "/app/config", "/app/main.py"},
+				Unchanged: []string{"/bin/sh", "/etc/motd", "/etc/passwd"},
+			},
+		},
+		{
+			name:   "same image",
+			base:   []testimage.Layer{baseLayer, appV1},
+			target: []testimage.Layer{baseLayer, appV1},
+			files: FileDiff{
+				Unchanged: []string{"/app/config", "/app/main.py", "/bin/sh", "/etc/motd", "/etc/passwd"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := Compare(testimage.NewRepo(t, tt.base...), testimage.NewRepo(t, tt.target...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := commands(report.AddedLayers); !reflect.DeepEqual(got, tt.added) {
+				t.Errorf("AddedLayers = %v, want %v", got, tt.added)
+			}
+			if got := commands(report.RemovedLayers); !reflect.DeepEqual(got, tt.removed) {
+				t.Errorf("RemovedLayers = %v, want %v", got, tt.removed)
+			}
+			var modified []int
+			for _, ld := range report.ModifiedLayers {
+				modified = append(modified, ld.Index)
+				if ld.Files.IsEmpty() {
+					t.Errorf("modified layer %d has no file changes", ld.Index)
+				}
+			}
+			if !reflect.DeepEqual(modified, tt.modified) {
+				t.Errorf("ModifiedLayers = %v, want %v", modified, tt.modified)
+			}
+			if !reflect.DeepEqual(report.FileDiff, tt.files) {
+				t.Errorf("FileDiff = %+v, want %+v", report.FileDiff, tt.files)
+			}
+		})
+	}
+}
+
+func TestCompareNoConfig(t *testing.T) {
+	repo := testimage.NewRepo(t, baseLayer)
+	if _, err := Compare(&image.Tar{}, repo); err == nil || !strings.HasPrefix(err.Error(), "base: ") {
+		t.Errorf("Compare() = %v, want a base error", err)
+	}
+	if _, err := Compare(repo, &image.Tar{}); err == nil || !strings.HasPrefix(err.Error(), "target: ") {
+		t.Errorf("Compare() = %v, want a target error", err)
+	}
+}
+
+func TestDiffReportSummary(t *testing.T) {
+	report, err := Compare(testimage.NewRepo(t, baseLayer, appV1), testimage.NewRepo(t, baseLayer, appV2, noMotd))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `layers: 1 added, 0 removed, 1 modified
++ layer 2: RUN rm /etc/motd
+~ layer 1: COPY app v2
+files: 1 added, 1 removed, 1 modified, 3 unchanged
++ /app/new.py
+- /etc/motd
+~ /app/main.py
+`
+	if got := report.Summary(); got != want {
+		t.Errorf("Summary() = %q, want %q", got, want)
+	}
+}
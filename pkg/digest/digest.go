@@ -0,0 +1,65 @@
+package digest
+
+import (
+	_ "crypto/sha256" // register sha256 for go-digest
+	"fmt"
+	"hash"
+	"io"
+
+	godigest "github.com/opencontainers/go-digest"
+)
+
+// ErrDigestMismatch is returned when content does not match its expected digest
+type ErrDigestMismatch struct {
+	Expected godigest.Digest
+	Got      godigest.Digest
+}
+
+func (e *ErrDigestMismatch) Error() string {
+	return fmt.Sprintf("digest mismatch: expected %s, got %s", e.Expected, e.Got)
+}
+
+// VerifyingReader hashes everything read through it and checks it against
+// the expected digest when closed
+type VerifyingReader struct {
+	r        io.Reader
+	expected godigest.Digest
+	hash     hash.Hash
+}
+
+// NewVerifyingReader wraps r to verify its content matches expected
+func NewVerifyingReader(r io.Reader, expected godigest.Digest) (*VerifyingReader, error) {
+	if err := expected.Validate(); err != nil {
+		return nil, err
+	}
+	return &VerifyingReader{
+		r:        r,
+		expected: expected,
+		hash:     expected.Algorithm().Hash(),
+	}, nil
+}
+
+func (vr *VerifyingReader) Read(p []byte) (int, error) {
+	n, err := vr.r.Read(p)
+	vr.hash.Write(p[:n])
+	return n, err
+}
+
+// Digest returns the digest of the content read so far
+func (vr *VerifyingReader) Digest() godigest.Digest {
+	return godigest.NewDigest(vr.expected.Algorithm(), vr.hash)
+}
+
+// Close closes the wrapped reader if it is an io.Closer and returns
+// *ErrDigestMismatch if the content read does not match the expected digest
+func (vr *VerifyingReader) Close() error {
+	if closer, ok := vr.r.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			return err
+		}
+	}
+	if got := vr.Digest(); got != vr.expected {
+		return &ErrDigestMismatch{Expected: vr.expected, Got: got}
+	}
+	return nil
+}
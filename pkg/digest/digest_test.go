@@ -0,0 +1,76 @@
+package digest
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	godigest "github.com/opencontainers/go-digest"
+)
+
+func TestVerifyingReader(t *testing.T) {
+	data := bytes.Repeat([]byte("layer blob "), 1000)
+	expected := godigest.FromBytes(data)
+
+	vr, err := NewVerifyingReader(bytes.NewReader(data), expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(ioutil.Discard, vr); err != nil {
+		t.Fatal(err)
+	}
+	if err := vr.Close(); err != nil {
+		t.Errorf("Close() = %v", err)
+	}
+}
+
+func TestVerifyingReaderBitFlips(t *testing.T) {
+	data := bytes.Repeat([]byte("layer blob "), 1000)
+	expected := godigest.FromBytes(data)
+
+	for _, offset := range []int{0, 1, 7, 511, 512, len(data) / 2, len(data) - 2, len(data) - 1} {
+		for bit := uint(0); bit < 8; bit++ {
+			flipped := append([]byte(nil), data...)
+			flipped[offset] ^= 1 << bit
+
+			vr, err := NewVerifyingReader(bytes.NewReader(flipped), expected)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.Copy(ioutil.Discard, vr); err != nil {
+				t.Fatal(err)
+			}
+			err = vr.Close()
+			var mismatch *ErrDigestMismatch
+			if !errors.As(err, &mismatch) {
+				t.Fatalf("offset %d bit %d: Close() = %v, want ErrDigestMismatch", offset, bit, err)
+			}
+			if mismatch.Expected != expected || mismatch.Got != godigest.FromBytes(flipped) {
+				t.Errorf("offset %d bit %d: %v", offset, bit, mismatch)
+			}
+		}
+	}
+}
+
+func TestVerifyingReaderTruncated(t *testing.T) {
+	data := []byte("layer blob")
+	vr, err := NewVerifyingReader(bytes.NewReader(data[:len(data)-1]), godigest.FromBytes(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(ioutil.Discard, vr); err != nil {
+		t.Fatal(err)
+	}
+	var mismatch *ErrDigestMismatch
+	if err := vr.Close(); !errors.As(err, &mismatch) {
+		t.Errorf("Close() = %v, want ErrDigestMismatch", err)
+	}
+}
+
+func TestNewVerifyingReaderInvalidDigest(t *testing.T) {
+	if _, err := NewVerifyingReader(bytes.NewReader(nil), "sha256:nothex"); err == nil {
+		t.Error("NewVerifyingReader() accepted an invalid digest")
+	}
+}
@@ -0,0 +1,294 @@
+package extract
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/graboid/pkg/image"
+	"github.com/blacktop/graboid/pkg/progress"
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// ProgressFunc is called while layers are extracted with the bytes written so far for the current layer
+type ProgressFunc func(layerIndex, totalLayers int, bytesWritten int64)
+
+// ExtractOptions configures layer extraction
+type ExtractOptions struct {
+	// OverwriteExisting replaces files that already exist in dest
+	OverwriteExisting bool
+	// PreserveOwnership applies the uid/gid recorded in the layer (usually requires root)
+	PreserveOwnership bool
+	// StripComponents removes that many leading path elements from each entry
+	StripComponents int
+	// Filter skips entries it returns false for
+	Filter func(hdr *tar.Header) bool
+	// ProgressFunc reports progress when extracting several layers
+	ProgressFunc ProgressFunc
+	// Progress is told about the bytes of each layer extracted
+	Progress progress.ProgressReporter
+}
+
+// FileError is the error extracting a single layer entry
+type FileError struct {
+	Path string
+	Err  error
+}
+
+func (fe FileError) Error() string {
+	return fmt.Sprintf("%s: %v", fe.Path, fe.Err)
+}
+
+// ExtractionError lists the entries that could not be extracted
+type ExtractionError struct {
+	Files []FileError
+}
+
+func (ee *ExtractionError) Error() string {
+	if len(ee.Files) == 1 {
+		return "extract failed: " + ee.Files[0].Error()
+	}
+	return fmt.Sprintf("extract failed for %d files, first: %s", len(ee.Files), ee.Files[0].Error())
+}
+
+// Decompress returns r decompressed if it is gzip or zstd compressed
+func Decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if bytes.HasPrefix(magic, gzipMagic) {
+		return gzip.NewReader(br)
+	}
+	if bytes.Equal(magic, zstdMagic) {
+		d, err := zstd.NewReader(br, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return &zstdReader{d}, nil
+	}
+	return br, nil
+}
+
+// zstdReader releases the decoder once the stream ended so callers that
+// only read the layer don't leak its goroutine
+type zstdReader struct {
+	d *zstd.Decoder
+}
+
+func (z *zstdReader) Read(p []byte) (int, error) {
+	n, err := z.d.Read(p)
+	if err != nil {
+		z.d.Close()
+	}
+	return n, err
+}
+
+// ExtractLayer writes the layer tar (optionally gzip or zstd compressed) read from r to dest.
+// Whiteout entries delete their target from dest so layers can be applied in order.
+func ExtractLayer(r io.Reader, dest string, opts ExtractOptions) (err error) {
+	if opts.Progress != nil {
+		opts.Progress.Start("extract "+dest, 0)
+		defer func() { opts.Progress.Done(err) }()
+		r = progress.NewReader(r, opts.Progress)
+	}
+
+	r, err = Decompress(r)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+
+	ee := &ExtractionError{}
+	tr := tar.NewReader(r)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break // End of archive
+		}
+		if err != nil {
+			return err
+		}
+
+		if opts.Filter != nil && !opts.Filter(hdr) {
+			continue
+		}
+
+		name, ok := stripComponents(hdr.Name, opts.StripComponents)
+		if !ok {
+			continue
+		}
+		target, err := securePath(dest, name)
+		if err != nil {
+			ee.Files = append(ee.Files, FileError{Path: hdr.Name, Err: err})
+			continue
+		}
+
+		if err := extractEntry(tr, hdr, dest, relPath(dest, target), opts); err != nil {
+			log.WithError(err).WithField("path", hdr.Name).Debug("extract failed")
+			ee.Files = append(ee.Files, FileError{Path: hdr.Name, Err: err})
+		}
+	}
+
+	if len(ee.Files) > 0 {
+		return ee
+	}
+	return nil
+}
+
+// extractEntry writes the entry at name (relative to dest). Parents are
+// checked before anything is written or removed so symlinks of earlier
+// entries can't redirect it outside dest.
+func extractEntry(tr *tar.Reader, hdr *tar.Header, dest, name string, opts ExtractOptions) error {
+	target := filepath.Join(dest, filepath.FromSlash(name))
+
+	switch {
+	case image.IsOpaqueWhiteout(name):
+		if ok, err := SecureParents(dest, name, ParentsCheck); err != nil || !ok {
+			return err
+		}
+		return clearDir(filepath.Dir(target))
+	case image.IsWhiteout(name):
+		whiteout := image.WhiteoutTarget(name)
+		if len(whiteout) == 0 {
+			return nil
+		}
+		if ok, err := SecureParents(dest, whiteout, ParentsCheck); err != nil || !ok {
+			return err
+		}
+		return os.RemoveAll(filepath.Join(dest, filepath.FromSlash(whiteout)))
+	}
+
+	parents := ParentsCreate
+	if opts.OverwriteExisting {
+		parents = ParentsReplace
+	}
+	if _, err := SecureParents(dest, name, parents); err != nil {
+		return err
+	}
+
+	if fi, err := os.Lstat(target); err == nil && !(fi.IsDir() && hdr.Typeflag == tar.TypeDir) {
+		// only a real directory merges with a directory entry, chmod would follow a symlink
+		if !opts.OverwriteExisting {
+			return os.ErrExist
+		}
+		if err := os.RemoveAll(target); err != nil {
+			return err
+		}
+	}
+
+	mode := hdr.FileInfo().Mode()
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if err := os.MkdirAll(target, 0755); err != nil {
+			return err
+		}
+		if err := os.Chmod(target, mode.Perm()); err != nil {
+			return err
+		}
+	case tar.TypeReg, tar.TypeRegA:
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm())
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, tr); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	case tar.TypeSymlink:
+		if err := os.Symlink(hdr.Linkname, target); err != nil {
+			return err
+		}
+	case tar.TypeLink:
+		linkTarget, err := securePath(dest, hdr.Linkname)
+		if err != nil {
+			return err
+		}
+		if ok, err := SecureParents(dest, relPath(dest, linkTarget), ParentsCheck); err != nil {
+			return err
+		} else if !ok {
+			return fmt.Errorf("%w: hardlink target %s", ErrUnsafeParent, hdr.Linkname)
+		}
+		if err := os.Link(linkTarget, target); err != nil {
+			return err
+		}
+	default:
+		// devices and fifos need root and are not needed to inspect an image
+		log.WithField("path", hdr.Name).Debugf("skipping tar entry of type %c", hdr.Typeflag)
+		return nil
+	}
+
+	if opts.PreserveOwnership {
+		if err := os.Lchown(target, hdr.Uid, hdr.Gid); err != nil {
+			return err
+		}
+	}
+	if hdr.Typeflag != tar.TypeSymlink {
+		return os.Chtimes(target, hdr.ModTime, hdr.ModTime)
+	}
+	return nil
+}
+
+// clearDir removes the contents of dir but not dir itself
+func clearDir(dir string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stripComponents removes n leading elements from name and reports whether anything is left
+func stripComponents(name string, n int) (string, bool) {
+	if n <= 0 {
+		return name, true
+	}
+	parts := strings.Split(strings.Trim(filepath.ToSlash(name), "/"), "/")
+	if len(parts) <= n {
+		return "", false
+	}
+	return strings.Join(parts[n:], "/"), true
+}
+
+// relPath returns target relative to dest with slashes, target must be inside dest
+func relPath(dest, target string) string {
+	rel := strings.TrimPrefix(target, filepath.Clean(dest))
+	return strings.TrimPrefix(filepath.ToSlash(rel), "/")
+}
+
+// securePath joins name to dest refusing names that escape dest
+func securePath(dest, name string) (string, error) {
+	target := filepath.Join(dest, filepath.FromSlash(filepath.Clean("/"+name)))
+	if target != filepath.Clean(dest) && !strings.HasPrefix(target, filepath.Clean(dest)+string(os.PathSeparator)) {
+		return "", fmt.Errorf("path %q escapes %s", name, dest)
+	}
+	return target, nil
+}
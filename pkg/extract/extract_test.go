@@ -0,0 +1,395 @@
+package extract
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+type tarEntry struct {
+	name     string
+	typeflag byte
+	linkname string
+	body     string
+}
+
+func layerTar(t testing.TB, entries ...tarEntry) io.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Typeflag: e.typeflag, Linkname: e.linkname, Mode: 0644}
+		if hdr.Typeflag == 0 {
+			hdr.Typeflag = tar.TypeReg
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			hdr.Mode = 0755
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = int64(len(e.body))
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "graboid-extract")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestExtractLayerTarSlip(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []tarEntry
+	}{
+		{"write through symlink", []tarEntry{
+			{name: "foo", typeflag: tar.TypeSymlink, linkname: "OUTSIDE"},
+			{name: "foo/passwd", body: "pwned"},
+		}},
+		{"write through nested symlink", []tarEntry{
+			{name: "a/", typeflag: tar.TypeDir},
+			{name: "a/b", typeflag: tar.TypeSymlink, linkname: "OUTSIDE"},
+			{name: "a/b/c/passwd", body: "pwned"},
+		}},
+		{"whiteout through symlink", []tarEntry{
+			{name: "foo", typeflag: tar.TypeSymlink, linkname: "OUTSIDE"},
+			{name: "foo/.wh.victim"},
+		}},
+		{"opaque whiteout through symlink", []tarEntry{
+			{name: "foo", typeflag: tar.TypeSymlink, linkname: "OUTSIDE"},
+			{name: "foo/.wh..wh..opq"},
+		}},
+		{"overwrite symlink target", []tarEntry{
+			{name: "victim", typeflag: tar.TypeSymlink, linkname: "OUTSIDE/victim"},
+			{name: "victim", body: "pwned"},
+		}},
+		{"chmod directory symlink", []tarEntry{
+			{name: "dir", typeflag: tar.TypeSymlink, linkname: "OUTSIDE"},
+			{name: "dir/", typeflag: tar.TypeDir},
+		}},
+		{"hardlink through symlink", []tarEntry{
+			{name: "foo", typeflag: tar.TypeSymlink, linkname: "OUTSIDE"},
+			{name: "stolen", typeflag: tar.TypeLink, linkname: "foo/victim"},
+		}},
+		{"dot dot", []tarEntry{
+			{name: "../../victim", body: "pwned"},
+		}},
+	}
+
+	for _, tt := range tests {
+		for _, overwrite := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/overwrite=%t", tt.name, overwrite), func(t *testing.T) {
+				outside := tempDir(t)
+				defer os.RemoveAll(outside)
+				dest := tempDir(t)
+				defer os.RemoveAll(dest)
+				victim := filepath.Join(outside, "victim")
+				if err := ioutil.WriteFile(victim, []byte("original"), 0600); err != nil {
+					t.Fatal(err)
+				}
+
+				entries := make([]tarEntry, len(tt.entries))
+				for idx, e := range tt.entries {
+					e.linkname = strings.Replace(e.linkname, "OUTSIDE", outside, 1)
+					entries[idx] = e
+				}
+				// the result may be an ExtractionError, only the host files matter
+				ExtractLayer(layerTar(t, entries...), dest, ExtractOptions{OverwriteExisting: overwrite})
+
+				got, err := ioutil.ReadFile(victim)
+				if err != nil {
+					t.Fatalf("victim was removed: %v", err)
+				}
+				if string(got) != "original" {
+					t.Fatalf("victim content = %q", got)
+				}
+				fi, err := os.Stat(outside)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if fi.Mode().Perm() != 0700 {
+					t.Errorf("outside mode changed to %v", fi.Mode().Perm())
+				}
+				others, _ := ioutil.ReadDir(outside)
+				if len(others) != 1 {
+					t.Errorf("files written outside dest: %d entries", len(others))
+				}
+				if fi, err := os.Stat(filepath.Join(dest, "stolen")); err == nil && os.SameFile(fi, mustStat(t, victim)) {
+					t.Error("hardlink to a file outside dest")
+				}
+			})
+		}
+	}
+}
+
+func mustStat(t *testing.T, name string) os.FileInfo {
+	t.Helper()
+	fi, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fi
+}
+
+func TestExtractLayerReplacesSymlinkParent(t *testing.T) {
+	outside := tempDir(t)
+	defer os.RemoveAll(outside)
+	dest := tempDir(t)
+	defer os.RemoveAll(dest)
+
+	if err := ExtractLayer(layerTar(t, tarEntry{name: "foo", typeflag: tar.TypeSymlink, linkname: outside}), dest, ExtractOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ExtractLayer(layerTar(t, tarEntry{name: "foo/passwd", body: "root"}), dest, ExtractOptions{OverwriteExisting: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Lstat(filepath.Join(dest, "foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.IsDir() {
+		t.Fatalf("foo is %v, want a directory", fi.Mode())
+	}
+	got, err := ioutil.ReadFile(filepath.Join(dest, "foo", "passwd"))
+	if err != nil || string(got) != "root" {
+		t.Fatalf("foo/passwd = %q, %v", got, err)
+	}
+}
+
+func TestExtractLayerWhiteouts(t *testing.T) {
+	dest := tempDir(t)
+	defer os.RemoveAll(dest)
+
+	base := layerTar(t,
+		tarEntry{name: "etc/", typeflag: tar.TypeDir},
+		tarEntry{name: "etc/a", body: "a"},
+		tarEntry{name: "etc/b", body: "b"},
+		tarEntry{name: "opt/x", body: "x"},
+	)
+	if err := ExtractLayer(base, dest, ExtractOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	upper := layerTar(t,
+		tarEntry{name: "etc/.wh.a"},
+		tarEntry{name: "opt/.wh..wh..opq"},
+		tarEntry{name: ".wh."},
+	)
+	if err := ExtractLayer(upper, dest, ExtractOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Lstat(filepath.Join(dest, "etc", "a")); !os.IsNotExist(err) {
+		t.Errorf("etc/a was not removed: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(dest, "etc", "b")); err != nil {
+		t.Errorf("etc/b: %v", err)
+	}
+	entries, err := ioutil.ReadDir(filepath.Join(dest, "opt"))
+	if err != nil || len(entries) != 0 {
+		t.Errorf("opt has %d entries, %v", len(entries), err)
+	}
+}
+
+func compress(t *testing.T, kind string, r io.Reader) io.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch kind {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "zstd":
+		zw, err := zstd.NewWriter(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w = zw
+	default:
+		return r
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestDecompress(t *testing.T) {
+	for _, kind := range []string{"none", "gzip", "zstd"} {
+		t.Run(kind, func(t *testing.T) {
+			want := strings.Repeat("layer content ", 1000)
+			r, err := Decompress(compress(t, kind, strings.NewReader(want)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != want {
+				t.Errorf("got %d bytes, want %d", len(got), len(want))
+			}
+		})
+	}
+}
+
+func TestExtractLayerZstd(t *testing.T) {
+	dest := tempDir(t)
+	defer os.RemoveAll(dest)
+
+	layer := compress(t, "zstd", layerTar(t,
+		tarEntry{name: "etc/", typeflag: tar.TypeDir},
+		tarEntry{name: "etc/hostname", body: "graboid\n"},
+	))
+	if err := ExtractLayer(layer, dest, ExtractOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(filepath.Join(dest, "etc", "hostname"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "graboid\n" {
+		t.Errorf("etc/hostname = %q", got)
+	}
+}
+
+func TestExtractLayerOptions(t *testing.T) {
+	entries := []tarEntry{
+		{name: "rootfs/", typeflag: tar.TypeDir},
+		{name: "rootfs/etc/hostname", body: "graboid\n"},
+		{name: "rootfs/etc/passwd", body: "root:x:0:0\n"},
+		{name: "rootfs/bin/sh", typeflag: tar.TypeSymlink, linkname: "busybox"},
+		{name: "top-level", body: "dropped by strip"},
+	}
+	tests := []struct {
+		name string
+		opts ExtractOptions
+		want map[string]string
+	}{
+		{
+			name: "strip components",
+			opts: ExtractOptions{StripComponents: 1},
+			want: map[string]string{"etc/hostname": "graboid\n", "etc/passwd": "root:x:0:0\n", "bin/sh": "-> busybox"},
+		},
+		{
+			name: "filter",
+			opts: ExtractOptions{Filter: func(hdr *tar.Header) bool { return strings.HasSuffix(hdr.Name, "hostname") }},
+			want: map[string]string{"rootfs/etc/hostname": "graboid\n"},
+		},
+		{
+			name: "strip and filter",
+			opts: ExtractOptions{StripComponents: 2, Filter: func(hdr *tar.Header) bool { return hdr.Typeflag == tar.TypeReg }},
+			want: map[string]string{"hostname": "graboid\n", "passwd": "root:x:0:0\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := tempDir(t)
+			defer os.RemoveAll(dest)
+			if err := ExtractLayer(layerTar(t, entries...), dest, tt.opts); err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]string)
+			filepath.Walk(dest, func(p string, fi os.FileInfo, err error) error {
+				if err != nil || fi.IsDir() {
+					return err
+				}
+				rel, _ := filepath.Rel(dest, p)
+				if fi.Mode()&os.ModeSymlink != 0 {
+					target, _ := os.Readlink(p)
+					got[filepath.ToSlash(rel)] = "-> " + target
+					return nil
+				}
+				data, _ := ioutil.ReadFile(p)
+				got[filepath.ToSlash(rel)] = string(data)
+				return nil
+			})
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("extracted %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractLayerOverwriteExisting(t *testing.T) {
+	dest := tempDir(t)
+	defer os.RemoveAll(dest)
+	if err := ExtractLayer(layerTar(t, tarEntry{name: "etc/motd", body: "old"}, tarEntry{name: "etc/issue", body: "old"}), dest, ExtractOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	upper := []tarEntry{{name: "etc/motd", body: "new"}, {name: "etc/issue", body: "new"}, {name: "etc/hosts", body: "new"}}
+	err := ExtractLayer(layerTar(t, upper...), dest, ExtractOptions{})
+	var ee *ExtractionError
+	if !errors.As(err, &ee) {
+		t.Fatalf("ExtractLayer() over existing files = %v, want an ExtractionError", err)
+	}
+	if len(ee.Files) != 2 || ee.Files[0].Path != "etc/motd" || ee.Files[1].Path != "etc/issue" || !errors.Is(ee.Files[0].Err, os.ErrExist) {
+		t.Errorf("ExtractionError.Files = %v, want etc/motd and etc/issue existing", ee.Files)
+	}
+	if !strings.HasPrefix(err.Error(), "extract failed for 2 files, first: etc/motd: ") {
+		t.Errorf("Error() = %q", err.Error())
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(dest, "etc", "hosts")); string(data) != "new" {
+		t.Error("the other entries were not extracted after a failed one")
+	}
+
+	if err := ExtractLayer(layerTar(t, upper...), dest, ExtractOptions{OverwriteExisting: true}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"motd", "issue"} {
+		if data, _ := ioutil.ReadFile(filepath.Join(dest, "etc", name)); string(data) != "new" {
+			t.Errorf("etc/%s = %q, want it overwritten", name, data)
+		}
+	}
+}
+
+// BenchmarkExtractLayer extracts a synthetic layer of 1,000 files in 10 directories
+func BenchmarkExtractLayer(b *testing.B) {
+	entries := make([]tarEntry, 0, 1010)
+	for d := 0; d < 10; d++ {
+		entries = append(entries, tarEntry{name: fmt.Sprintf("usr/share/dir%d/", d), typeflag: tar.TypeDir})
+		for f := 0; f < 100; f++ {
+			entries = append(entries, tarEntry{name: fmt.Sprintf("usr/share/dir%d/file%03d", d, f), body: strings.Repeat("x", 512)})
+		}
+	}
+	layer := layerTar(b, entries...).(*bytes.Buffer).Bytes()
+
+	root, err := ioutil.TempDir("", "graboid-extract")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if err := ExtractLayer(bytes.NewReader(layer), filepath.Join(root, fmt.Sprint(n)), ExtractOptions{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
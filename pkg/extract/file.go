@@ -0,0 +1,111 @@
+package extract
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/blacktop/graboid/pkg/image"
+)
+
+// maxSymlinks is the number of links followed before giving up like the kernel does
+const maxSymlinks = 40
+
+var (
+	// ErrFileNotFound is returned when the layer has no file at the path
+	ErrFileNotFound = errors.New("file not found in layer")
+	// ErrIsDirectory is returned when the path is a directory
+	ErrIsDirectory = errors.New("path is a directory")
+)
+
+// ExtractFile copies the content of the file at filePath in layer l to w
+// reading the layer tar (optionally compressed) from r. Symlinks and hardlinks
+// are followed inside the layer.
+func ExtractFile(l image.Layer, r io.Reader, filePath string, w io.Writer) error {
+	target, err := resolveFile(l, filePath)
+	if err != nil {
+		return err
+	}
+
+	r, err = Decompress(r)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if path.Clean("/"+hdr.Name) != target {
+			continue
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			return fmt.Errorf("%s is not a regular file in the layer tar", target)
+		}
+		_, err = io.Copy(w, tr)
+		return err
+	}
+
+	return fmt.Errorf("%w: %s", ErrFileNotFound, target)
+}
+
+// resolveFile follows links in every component of filePath, a parent
+// directory may be a symlink like /lib -> usr/lib, until it names a regular
+// file of the layer
+func resolveFile(l image.Layer, filePath string) (string, error) {
+	current := "/"
+	remaining := splitPath(filePath)
+	hops := 0
+
+	for len(remaining) > 0 {
+		next := path.Join(current, remaining[0])
+		remaining = remaining[1:]
+		node, ok := l.FileByPath(next)
+		if !ok {
+			return "", fmt.Errorf("%w: %s", ErrFileNotFound, next)
+		}
+		info := node.Data.FileInfo
+
+		var target string
+		switch {
+		case info.TypeFlag == tar.TypeSymlink:
+			target = info.Linkname
+			if !path.IsAbs(target) {
+				target = path.Join(current, target)
+			}
+		case info.TypeFlag == tar.TypeLink && len(remaining) == 0:
+			// hardlink targets are relative to the layer root
+			target = "/" + info.Linkname
+		default:
+			current = next
+			continue
+		}
+		if hops++; hops > maxSymlinks {
+			return "", fmt.Errorf("too many levels of symbolic links: %s", filePath)
+		}
+		current = "/"
+		remaining = append(splitPath(target), remaining...)
+	}
+
+	node, ok := l.FileByPath(current)
+	if current == "/" || (ok && image.FileIsDir(node)) {
+		return "", fmt.Errorf("%w: %s", ErrIsDirectory, current)
+	}
+	return current, nil
+}
+
+// splitPath returns the components of the cleaned absolute path p
+func splitPath(p string) []string {
+	p = path.Clean("/" + p)
+	if p == "/" {
+		return nil
+	}
+	return strings.Split(p[1:], "/")
+}
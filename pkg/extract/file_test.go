@@ -0,0 +1,177 @@
+package extract
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blacktop/graboid/pkg/image"
+)
+
+// testLayer returns the layer tree of the tar entries
+func testLayer(t testing.TB, entries ...tarEntry) image.Layer {
+	t.Helper()
+	files := make([]image.SerializableFileInfo, 0, len(entries))
+	for _, e := range entries {
+		fi := image.SerializableFileInfo{Path: strings.TrimSuffix(e.name, "/"), TypeFlag: e.typeflag, Linkname: e.linkname, FileSize: int64(len(e.body))}
+		if fi.TypeFlag == 0 {
+			fi.TypeFlag = tar.TypeReg
+		}
+		fi.Directory = fi.TypeFlag == tar.TypeDir
+		files = append(files, fi)
+	}
+	data, err := json.Marshal(map[string]interface{}{"tar_path": "layer.tar", "files": files})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := image.LayerFromJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+var fileEntries = []tarEntry{
+	{name: "etc/", typeflag: tar.TypeDir},
+	{name: "etc/os-release", body: "ID=alpine\n"},
+	{name: "etc/alpine-release", typeflag: tar.TypeSymlink, linkname: "os-release"},
+	{name: "etc/release", typeflag: tar.TypeSymlink, linkname: "/etc/alpine-release"},
+	{name: "usr/lib/os-release", typeflag: tar.TypeSymlink, linkname: "../../etc/os-release"},
+	{name: "etc/hardlink", typeflag: tar.TypeLink, linkname: "etc/os-release"},
+	{name: "etc/dangling", typeflag: tar.TypeSymlink, linkname: "missing"},
+	{name: "etc/loop-a", typeflag: tar.TypeSymlink, linkname: "loop-b"},
+	{name: "etc/loop-b", typeflag: tar.TypeSymlink, linkname: "loop-a"},
+	{name: "etc/dir-link", typeflag: tar.TypeSymlink, linkname: "/etc"},
+	{name: "bin/busybox", body: "#!busybox"},
+	{name: "usr/lib/libc.so", body: "libc"},
+	{name: "lib", typeflag: tar.TypeSymlink, linkname: "usr/lib"},
+	{name: "lib64", typeflag: tar.TypeSymlink, linkname: "/lib"},
+}
+
+func TestExtractFile(t *testing.T) {
+	l := testLayer(t, fileEntries...)
+	layer := layerTar(t, fileEntries...).(*bytes.Buffer).Bytes()
+
+	tests := []struct {
+		path string
+		want string
+		err  error
+	}{
+		{path: "/etc/os-release", want: "ID=alpine\n"},
+		{path: "etc/os-release", want: "ID=alpine\n"},
+		{path: "./etc/../etc//os-release", want: "ID=alpine\n"},
+		{path: "/bin/busybox", want: "#!busybox"},
+		{path: "/etc/alpine-release", want: "ID=alpine\n"},
+		{path: "/etc/release", want: "ID=alpine\n"},
+		{path: "/usr/lib/os-release", want: "ID=alpine\n"},
+		{path: "/etc/hardlink", want: "ID=alpine\n"},
+		{path: "/etc/missing", err: ErrFileNotFound},
+		{path: "/etc/dangling", err: ErrFileNotFound},
+		{path: "/etc", err: ErrIsDirectory},
+		{path: "/usr/lib", err: ErrIsDirectory},
+		{path: "/etc/dir-link", err: ErrIsDirectory},
+		// symlinked parent directories like the /lib -> usr/lib of usrmerge images
+		{path: "/lib/libc.so", want: "libc"},
+		{path: "/lib64/libc.so", want: "libc"},
+		{path: "/etc/dir-link/os-release", want: "ID=alpine\n"},
+		{path: "/lib/os-release", want: "ID=alpine\n"},
+		{path: "/lib/missing", err: ErrFileNotFound},
+		{path: "/lib", err: ErrIsDirectory},
+		{path: "/etc/os-release/passwd", err: ErrFileNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			for _, kind := range []string{"tar", "gzip", "zstd"} {
+				var buf bytes.Buffer
+				err := ExtractFile(l, compress(t, kind, bytes.NewReader(layer)), tt.path, &buf)
+				if tt.err != nil {
+					if !errors.Is(err, tt.err) {
+						t.Errorf("%s: ExtractFile() = %v, want %v", kind, err, tt.err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("%s: %v", kind, err)
+				}
+				if buf.String() != tt.want {
+					t.Errorf("%s: ExtractFile() wrote %q, want %q", kind, buf.String(), tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractFileSymlinkLoop(t *testing.T) {
+	l := testLayer(t, fileEntries...)
+	err := ExtractFile(l, layerTar(t, fileEntries...), "/etc/loop-a", ioutil.Discard)
+	if err == nil || !strings.Contains(err.Error(), "too many levels of symbolic links") {
+		t.Errorf("ExtractFile() of a symlink loop = %v", err)
+	}
+}
+
+func TestExtractFileNotInTar(t *testing.T) {
+	// the tree knows the file but the tar read doesn't hold it
+	l := testLayer(t, fileEntries...)
+	err := ExtractFile(l, layerTar(t, tarEntry{name: "bin/busybox", body: "#!busybox"}), "/etc/os-release", ioutil.Discard)
+	if !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("ExtractFile() of a file missing from the tar = %v, want ErrFileNotFound", err)
+	}
+
+	// the tree and the tar disagree about the type of the file
+	err = ExtractFile(l, layerTar(t, tarEntry{name: "etc/os-release", typeflag: tar.TypeSymlink, linkname: "x"}), "/etc/os-release", ioutil.Discard)
+	if err == nil || errors.Is(err, ErrFileNotFound) {
+		t.Errorf("ExtractFile() of a symlink in the tar = %v, want a not a regular file error", err)
+	}
+}
+
+// benchmarkLayer has 500 files in 5 directories, the file looked up is the last one
+func benchmarkLayer(b *testing.B) (image.Layer, []byte) {
+	entries := make([]tarEntry, 0, 505)
+	for d := 0; d < 5; d++ {
+		entries = append(entries, tarEntry{name: fmt.Sprintf("usr/share/dir%d/", d), typeflag: tar.TypeDir})
+		for f := 0; f < 100; f++ {
+			entries = append(entries, tarEntry{name: fmt.Sprintf("usr/share/dir%d/file%03d", d, f), body: strings.Repeat("x", 512)})
+		}
+	}
+	return testLayer(b, entries...), layerTar(b, entries...).(*bytes.Buffer).Bytes()
+}
+
+// BenchmarkExtractFile copies one file out of a 500 file layer
+func BenchmarkExtractFile(b *testing.B) {
+	l, layer := benchmarkLayer(b)
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if err := ExtractFile(l, bytes.NewReader(layer), "/usr/share/dir4/file099", ioutil.Discard); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkExtractFileFullLayer extracts the whole 500 file layer to read the same file
+func BenchmarkExtractFileFullLayer(b *testing.B) {
+	_, layer := benchmarkLayer(b)
+	root, err := ioutil.TempDir("", "graboid-extract")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		dest := filepath.Join(root, fmt.Sprint(n))
+		if err := ExtractLayer(bytes.NewReader(layer), dest, ExtractOptions{}); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := ioutil.ReadFile(filepath.Join(dest, "usr", "share", "dir4", "file099")); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
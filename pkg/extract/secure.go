@@ -0,0 +1,65 @@
+package extract
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrUnsafeParent is returned when a parent of a layer entry is a symlink or
+// a file that may not be replaced, writing through it could escape dest
+var ErrUnsafeParent = errors.New("parent is a symlink or not a directory")
+
+// ParentMode is what SecureParents does with parents that are missing or not directories
+type ParentMode int
+
+const (
+	// ParentsCheck only reports whether all parents are real directories
+	ParentsCheck ParentMode = iota
+	// ParentsCreate creates missing parents and fails on symlinks and files
+	ParentsCreate
+	// ParentsReplace creates missing parents and replaces symlinks and files with directories
+	ParentsReplace
+)
+
+// SecureParents makes sure every parent of name (relative to dest, slash
+// separated) is a real directory of dest so nothing is written or removed
+// through a symlink an earlier entry created. No link is ever followed. It
+// returns false if a parent is missing or not a directory and mode is ParentsCheck.
+func SecureParents(dest, name string, mode ParentMode) (bool, error) {
+	dir := dest
+	parts := strings.Split(name, "/")
+	for _, part := range parts[:len(parts)-1] {
+		if len(part) == 0 || part == "." {
+			continue
+		}
+		dir = filepath.Join(dir, part)
+		fi, err := os.Lstat(dir)
+		switch {
+		case err == nil && fi.IsDir():
+			continue
+		case err == nil:
+			switch mode {
+			case ParentsCheck:
+				return false, nil
+			case ParentsCreate:
+				return false, fmt.Errorf("%w: %s", ErrUnsafeParent, dir)
+			}
+			if err := os.Remove(dir); err != nil {
+				return false, err
+			}
+		case os.IsNotExist(err):
+			if mode == ParentsCheck {
+				return false, nil
+			}
+		default:
+			return false, err
+		}
+		if err := os.Mkdir(dir, 0755); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,237 @@
+package format
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/blacktop/graboid/pkg/image"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ErrUnknownFormat is returned for output formats no formatter is registered for
+var ErrUnknownFormat = errors.New("unknown output format")
+
+// Formatter renders image data to w
+type Formatter interface {
+	FormatImage(img *image.Image, w io.Writer) error
+	FormatLayer(l image.Layer, w io.Writer) error
+	FormatManifests(ms image.Manifests, w io.Writer) error
+}
+
+// LayerInfo is what formatters render of a layer
+type LayerInfo struct {
+	Index   int    `json:"index"`
+	ID      string `json:"id"`
+	Command string `json:"command"`
+	Size    uint64 `json:"size"`
+}
+
+func layerInfo(l image.Layer) LayerInfo {
+	return LayerInfo{
+		Index:   l.Index(),
+		ID:      l.ID(),
+		Command: l.Command(),
+		Size:    l.Size(),
+	}
+}
+
+// JSONFormatter renders indented JSON
+type JSONFormatter struct{}
+
+// FormatImage writes the image config JSON
+func (JSONFormatter) FormatImage(img *image.Image, w io.Writer) error {
+	return writeJSON(img, w)
+}
+
+// FormatLayer writes the layer as a LayerInfo
+func (JSONFormatter) FormatLayer(l image.Layer, w io.Writer) error {
+	return writeJSON(layerInfo(l), w)
+}
+
+// FormatManifests writes the manifests like manifest.json
+func (JSONFormatter) FormatManifests(ms image.Manifests, w io.Writer) error {
+	return writeJSON(ms, w)
+}
+
+func writeJSON(v interface{}, w io.Writer) error {
+	raw, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(raw, '\n'))
+	return err
+}
+
+// YAMLFormatter renders YAML with the keys of the JSON output
+type YAMLFormatter struct{}
+
+// FormatImage writes the image config
+func (YAMLFormatter) FormatImage(img *image.Image, w io.Writer) error {
+	return writeYAML(img, w)
+}
+
+// FormatLayer writes the layer as a LayerInfo
+func (YAMLFormatter) FormatLayer(l image.Layer, w io.Writer) error {
+	return writeYAML(layerInfo(l), w)
+}
+
+// FormatManifests writes the manifests
+func (YAMLFormatter) FormatManifests(ms image.Manifests, w io.Writer) error {
+	return writeYAML(ms, w)
+}
+
+// writeYAML goes through JSON so the output uses the json field names and custom marshalers
+func writeYAML(v interface{}, w io.Writer) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var generic interface{}
+	if err := json.Unmarshal(raw, &generic); err != nil {
+		return err
+	}
+	out, err := yaml.Marshal(generic)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// TableFormatter renders tab separated columns with a header line
+type TableFormatter struct{}
+
+// FormatImage writes the platform, creation time, layer count and command of the image
+func (TableFormatter) FormatImage(img *image.Image, w io.Writer) error {
+	var layers int
+	if img.RootFS != nil {
+		layers = len(img.RootFS.DiffIDs)
+	}
+	var command []string
+	if img.Config != nil {
+		command = append(append(command, img.Config.Entrypoint...), img.Config.Cmd...)
+	}
+	created := ""
+	if !img.Created.IsZero() {
+		created = img.Created.UTC().Format(time.RFC3339)
+	}
+	return writeRows(w, []string{"PLATFORM", "CREATED", "LAYERS", "COMMAND"},
+		[]string{img.Platform().String(), created, fmt.Sprint(layers), strings.Join(command, " ")})
+}
+
+// FormatLayer writes the index, ID, size and command of the layer
+func (TableFormatter) FormatLayer(l image.Layer, w io.Writer) error {
+	info := layerInfo(l)
+	return writeRows(w, []string{"INDEX", "ID", "SIZE", "COMMAND"},
+		[]string{fmt.Sprint(info.Index), info.ID, fmt.Sprint(info.Size), info.Command})
+}
+
+// FormatManifests writes a row per manifest with its tags, config and layer count
+func (TableFormatter) FormatManifests(ms image.Manifests, w io.Writer) error {
+	rows := make([][]string, len(ms))
+	for idx, m := range ms {
+		rows[idx] = []string{strings.Join(m.RepoTags, ","), m.Config, fmt.Sprint(len(m.Layers))}
+	}
+	return writeRows(w, []string{"REPO TAGS", "CONFIG", "LAYERS"}, rows...)
+}
+
+func writeRows(w io.Writer, header []string, rows ...[]string) error {
+	for _, row := range append([][]string{header}, rows...) {
+		if _, err := fmt.Fprintln(w, strings.Join(row, "\t")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TemplateFormatter executes a text/template against the *image.Image,
+// image.LayerInfo or image.Manifests being formatted
+type TemplateFormatter struct {
+	tmpl *template.Template
+}
+
+// NewTemplateFormatter parses tmpl, e.g. {{.Architecture}}
+func NewTemplateFormatter(tmpl string) (*TemplateFormatter, error) {
+	t, err := template.New("format").Parse(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	return &TemplateFormatter{tmpl: t}, nil
+}
+
+// FormatImage executes the template against the image
+func (f *TemplateFormatter) FormatImage(img *image.Image, w io.Writer) error {
+	return f.tmpl.Execute(w, img)
+}
+
+// FormatLayer executes the template against the layer's LayerInfo
+func (f *TemplateFormatter) FormatLayer(l image.Layer, w io.Writer) error {
+	return f.tmpl.Execute(w, layerInfo(l))
+}
+
+// FormatManifests executes the template against the manifests
+func (f *TemplateFormatter) FormatManifests(ms image.Manifests, w io.Writer) error {
+	return f.tmpl.Execute(w, ms)
+}
+
+// FormatterFunc creates a formatter from the argument given after "=" in
+// the output format, e.g. the template of template={{.OS}}
+type FormatterFunc func(arg string) (Formatter, error)
+
+// FormatterRegistry looks up formatters by name
+type FormatterRegistry struct {
+	mu         sync.RWMutex
+	formatters map[string]FormatterFunc
+}
+
+// NewFormatterRegistry creates a registry with the json, yaml, table and template formatters
+func NewFormatterRegistry() *FormatterRegistry {
+	r := &FormatterRegistry{formatters: make(map[string]FormatterFunc)}
+	r.Register("json", func(string) (Formatter, error) { return JSONFormatter{}, nil })
+	r.Register("yaml", func(string) (Formatter, error) { return YAMLFormatter{}, nil })
+	r.Register("table", func(string) (Formatter, error) { return TableFormatter{}, nil })
+	r.Register("template", func(arg string) (Formatter, error) { return NewTemplateFormatter(arg) })
+	return r
+}
+
+// Register adds the formatter created by fn under name, replacing any formatter with that name
+func (r *FormatterRegistry) Register(name string, fn FormatterFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.formatters[name] = fn
+}
+
+// Get returns the formatter of an output format like json or template={{.OS}}
+func (r *FormatterRegistry) Get(output string) (Formatter, error) {
+	name, arg := output, ""
+	if idx := strings.Index(output, "="); idx >= 0 {
+		name, arg = output[:idx], output[idx+1:]
+	}
+
+	r.mu.RLock()
+	fn, ok := r.formatters[name]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w %q, expected one of %s", ErrUnknownFormat, name, strings.Join(r.Names(), ", "))
+	}
+	return fn(arg)
+}
+
+// Names returns the sorted names of the registered formatters
+func (r *FormatterRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.formatters))
+	for name := range r.formatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,258 @@
+package format
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/blacktop/graboid/pkg/image"
+)
+
+const testConfig = `{"architecture":"arm64","variant":"v8","os":"linux","created":"2020-09-13T12:26:40Z","config":{"Env":["PATH=/usr/bin"],"Entrypoint":["/docker-entrypoint.sh"],"Cmd":["nginx","-g","daemon off;"]},"rootfs":{"type":"layers","diff_ids":["sha256:5f70bf18a086007016e948b04aed3b82103a36bea41755b6cddfaf10ace3c6ef"]}}`
+
+const testLayer = `{"tar_path":"398cfa9b5a67/layer.tar","index":1,"history":{"ID":"398cfa9b5a67","Size":4096,"created":"2020-09-13T12:26:40Z","created_by":"/bin/sh -c #(nop) COPY file:abc in /app "},"files":[]}`
+
+var testManifests = image.Manifests{
+	{Config: "e556c36f.json", RepoTags: []string{"graboid/test:latest", "graboid/test:1.0"}, Layers: []string{"398cfa9b/layer.tar"}},
+	{Config: "2f6d5a9c.json", Layers: []string{"398cfa9b/layer.tar", "337f61d1/layer.tar"}},
+}
+
+// outputs is what each format renders of the test image, layer and manifests
+var outputs = []struct {
+	format                  string
+	image, layer, manifests string
+}{
+	{
+		format: "json",
+		image: `{
+  "architecture": "arm64",
+  "variant": "v8",
+  "os": "linux",
+  "created": "2020-09-13T12:26:40Z",
+  "config": {
+    "Env": [
+      "PATH=/usr/bin"
+    ],
+    "Entrypoint": [
+      "/docker-entrypoint.sh"
+    ],
+    "Cmd": [
+      "nginx",
+      "-g",
+      "daemon off;"
+    ]
+  },
+  "rootfs": {
+    "type": "layers",
+    "diff_ids": [
+      "sha256:5f70bf18a086007016e948b04aed3b82103a36bea41755b6cddfaf10ace3c6ef"
+    ]
+  }
+}
+`,
+		layer: `{
+  "index": 1,
+  "id": "398cfa9b5a67",
+  "command": "#(nop) COPY file:abc in /app ",
+  "size": 4096
+}
+`,
+		manifests: `[
+  {
+    "Config": "e556c36f.json",
+    "Layers": [
+      "398cfa9b/layer.tar"
+    ],
+    "RepoTags": [
+      "graboid/test:latest",
+      "graboid/test:1.0"
+    ]
+  },
+  {
+    "Config": "2f6d5a9c.json",
+    "Layers": [
+      "398cfa9b/layer.tar",
+      "337f61d1/layer.tar"
+    ]
+  }
+]
+`,
+	},
+	{
+		format: "yaml",
+		image: `architecture: arm64
+config:
+  Cmd:
+  - nginx
+  - -g
+  - daemon off;
+  Entrypoint:
+  - /docker-entrypoint.sh
+  Env:
+  - PATH=/usr/bin
+created: "2020-09-13T12:26:40Z"
+os: linux
+rootfs:
+  diff_ids:
+  - sha256:5f70bf18a086007016e948b04aed3b82103a36bea41755b6cddfaf10ace3c6ef
+  type: layers
+variant: v8
+`,
+		layer: `command: '#(nop) COPY file:abc in /app '
+id: 398cfa9b5a67
+index: 1
+size: 4096
+`,
+		manifests: `- Config: e556c36f.json
+  Layers:
+  - 398cfa9b/layer.tar
+  RepoTags:
+  - graboid/test:latest
+  - graboid/test:1.0
+- Config: 2f6d5a9c.json
+  Layers:
+  - 398cfa9b/layer.tar
+  - 337f61d1/layer.tar
+`,
+	},
+	{
+		format: "table",
+		image: "PLATFORM\tCREATED\tLAYERS\tCOMMAND\n" +
+			"linux/arm64/v8\t2020-09-13T12:26:40Z\t1\t/docker-entrypoint.sh nginx -g daemon off;\n",
+		layer: "INDEX\tID\tSIZE\tCOMMAND\n" +
+			"1\t398cfa9b5a67\t4096\t#(nop) COPY file:abc in /app \n",
+		manifests: "REPO TAGS\tCONFIG\tLAYERS\n" +
+			"graboid/test:latest,graboid/test:1.0\te556c36f.json\t1\n" +
+			"\t2f6d5a9c.json\t2\n",
+	},
+}
+
+func TestFormatters(t *testing.T) {
+	img, err := image.NewFromJSON([]byte(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer, err := image.LayerFromJSON([]byte(testLayer))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registry := NewFormatterRegistry()
+	for _, tt := range outputs {
+		t.Run(tt.format, func(t *testing.T) {
+			f, err := registry.Get(tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, out := range []struct {
+				name   string
+				format func(io.Writer) error
+				want   string
+			}{
+				{name: "image", format: func(w io.Writer) error { return f.FormatImage(img, w) }, want: tt.image},
+				{name: "layer", format: func(w io.Writer) error { return f.FormatLayer(layer, w) }, want: tt.layer},
+				{name: "manifests", format: func(w io.Writer) error { return f.FormatManifests(testManifests, w) }, want: tt.manifests},
+			} {
+				var buf bytes.Buffer
+				if err := out.format(&buf); err != nil {
+					t.Fatalf("%s: %v", out.name, err)
+				}
+				if got := buf.String(); got != out.want {
+					t.Errorf("%s = %q, want %q", out.name, got, out.want)
+				}
+			}
+		})
+	}
+}
+
+func TestTemplateFormatter(t *testing.T) {
+	img, err := image.NewFromJSON([]byte(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer, err := image.LayerFromJSON([]byte(testLayer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		tmpl   string
+		format func(*TemplateFormatter, io.Writer) error
+		want   string
+	}{
+		{
+			tmpl:   "{{.OS}}/{{.Architecture}}{{range .RootFS.DiffIDs}} {{.Hex}}{{end}}",
+			format: func(f *TemplateFormatter, w io.Writer) error { return f.FormatImage(img, w) },
+			want:   "linux/arm64 5f70bf18a086007016e948b04aed3b82103a36bea41755b6cddfaf10ace3c6ef",
+		},
+		{
+			tmpl:   "{{.Index}}: {{.Command}} ({{.Size}} bytes)",
+			format: func(f *TemplateFormatter, w io.Writer) error { return f.FormatLayer(layer, w) },
+			want:   "1: #(nop) COPY file:abc in /app  (4096 bytes)",
+		},
+		{
+			tmpl:   "{{range .}}{{.Config}}={{len .Layers}}\n{{end}}",
+			format: func(f *TemplateFormatter, w io.Writer) error { return f.FormatManifests(testManifests, w) },
+			want:   "e556c36f.json=1\n2f6d5a9c.json=2\n",
+		},
+	}
+	for _, tt := range tests {
+		f, err := NewTemplateFormatter(tt.tmpl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := tt.format(f, &buf); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.tmpl, got, tt.want)
+		}
+	}
+
+	if _, err := NewTemplateFormatter("{{.OS"); err == nil {
+		t.Error("NewTemplateFormatter() parsed an unterminated action")
+	}
+	f, _ := NewTemplateFormatter("{{.Missing}}")
+	if err := f.FormatLayer(layer, &bytes.Buffer{}); err == nil {
+		t.Error("FormatLayer() executed a template with an unknown field")
+	}
+}
+
+type nameFormatter struct {
+	JSONFormatter
+	arg string
+}
+
+func TestFormatterRegistry(t *testing.T) {
+	r := NewFormatterRegistry()
+	if got, want := r.Names(), []string{"json", "table", "template", "yaml"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Names() = %v, want %v", got, want)
+	}
+
+	if _, err := r.Get("xml"); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Get(xml) = %v, want ErrUnknownFormat", err)
+	}
+	if f, err := r.Get("template={{.OS}}"); err != nil {
+		t.Errorf("Get(template={{.OS}}) = %v", err)
+	} else if _, ok := f.(*TemplateFormatter); !ok {
+		t.Errorf("Get(template={{.OS}}) = %T, want a TemplateFormatter", f)
+	}
+	if _, err := r.Get("template={{.OS"); err == nil || errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Get() of an invalid template = %v, want the parse error", err)
+	}
+
+	r.Register("custom", func(arg string) (Formatter, error) { return nameFormatter{arg: arg}, nil })
+	f, err := r.Get("custom=a=b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// everything after the first = is the argument
+	if nf, ok := f.(nameFormatter); !ok || nf.arg != "a=b" {
+		t.Errorf("Get(custom=a=b) = %#v, want the custom formatter with argument a=b", f)
+	}
+	if got := r.Names(); len(got) != 5 || got[0] != "custom" {
+		t.Errorf("Names() after Register = %v", got)
+	}
+}
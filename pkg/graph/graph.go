@@ -0,0 +1,171 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	// register sha256 for go-digest
+	_ "crypto/sha256"
+
+	"github.com/blacktop/graboid/pkg/image"
+	"github.com/opencontainers/go-digest"
+)
+
+var (
+	// ErrNoCommonBase is returned when two images share no layers
+	ErrNoCommonBase = errors.New("images share no base layer")
+	// ErrUnknownLayer is returned for layers that were not added to the graph
+	ErrUnknownLayer = errors.New("layer is not in the graph")
+)
+
+type node struct {
+	chainID  digest.Digest
+	layer    image.Layer
+	parent   *node
+	children []*node
+}
+
+// LayerGraph links the layers of images to their parent layers. Layers are
+// identified by their chain ID so images built on the same base share nodes.
+type LayerGraph struct {
+	mu      sync.Mutex
+	nodes   map[digest.Digest]*node
+	byLayer map[image.Layer]*node
+}
+
+// NewLayerGraph creates an empty layer graph
+func NewLayerGraph() *LayerGraph {
+	return &LayerGraph{
+		nodes:   make(map[digest.Digest]*node),
+		byLayer: make(map[image.Layer]*node),
+	}
+}
+
+// chainIDs returns the layers of the image tar from the base layer up with their chain IDs
+func chainIDs(t *image.Tar) ([]image.Layer, []digest.Digest, error) {
+	layers, err := t.LayerChain()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ids := make([]digest.Digest, len(layers))
+	for idx := range layers {
+		diffID, err := t.DiffID(idx)
+		if err != nil {
+			return nil, nil, err
+		}
+		if idx == 0 {
+			ids[idx] = diffID
+		} else {
+			ids[idx] = digest.FromString(ids[idx-1].String() + " " + diffID.String())
+		}
+	}
+	return layers, ids, nil
+}
+
+// AddImage inserts the layers of the image tar t described by img into the graph.
+// img may be nil if the config is already attached to t.
+func (g *LayerGraph) AddImage(img *image.Image, t *image.Tar) error {
+	if img != nil && img != t.Config {
+		if err := t.AttachImage(img); err != nil {
+			return err
+		}
+	}
+	layers, ids, err := chainIDs(t)
+	if err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var parent *node
+	for idx, layer := range layers {
+		n, ok := g.nodes[ids[idx]]
+		if !ok {
+			n = &node{chainID: ids[idx], layer: layer, parent: parent}
+			g.nodes[ids[idx]] = n
+			if parent != nil {
+				parent.children = append(parent.children, n)
+			}
+		}
+		g.byLayer[layer] = n
+		parent = n
+	}
+	return nil
+}
+
+// Ancestors returns the parent chain of l starting with its parent and ending with the base layer
+func (g *LayerGraph) Ancestors(l image.Layer) []image.Layer {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	n, ok := g.byLayer[l]
+	if !ok {
+		return nil
+	}
+	var ancestors []image.Layer
+	for p := n.parent; p != nil; p = p.parent {
+		ancestors = append(ancestors, p.layer)
+	}
+	return ancestors
+}
+
+// Children returns the layers built directly on top of l
+func (g *LayerGraph) Children(l image.Layer) []image.Layer {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	n, ok := g.byLayer[l]
+	if !ok {
+		return nil
+	}
+	children := make([]image.Layer, len(n.children))
+	for idx, child := range n.children {
+		children[idx] = child.layer
+	}
+	return children
+}
+
+// ChainID returns the chain ID identifying l and all the layers below it
+func (g *LayerGraph) ChainID(l image.Layer) (digest.Digest, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	n, ok := g.byLayer[l]
+	if !ok {
+		return "", ErrUnknownLayer
+	}
+	return n.chainID, nil
+}
+
+// CommonBase returns the top most layer the images a and b are both built on
+func (g *LayerGraph) CommonBase(a, b *image.Tar) (image.Layer, error) {
+	layersA, idsA, err := chainIDs(a)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get layers of first image: %w", err)
+	}
+	_, idsB, err := chainIDs(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get layers of second image: %w", err)
+	}
+
+	common := -1
+	for idx := 0; idx < len(idsA) && idx < len(idsB); idx++ {
+		if idsA[idx] != idsB[idx] {
+			break
+		}
+		common = idx
+	}
+	if common < 0 {
+		return nil, ErrNoCommonBase
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if n, ok := g.nodes[idsA[common]]; ok {
+		return n.layer, nil
+	}
+	return layersA[common], nil
+}
@@ -0,0 +1,151 @@
+package graph
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/blacktop/graboid/internal/testimage"
+	"github.com/blacktop/graboid/pkg/image"
+	"github.com/opencontainers/go-digest"
+)
+
+func layerChain(t *testing.T, repo *image.Tar) []image.Layer {
+	t.Helper()
+	layers, err := repo.LayerChain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return layers
+}
+
+var (
+	baseLayer = testimage.Layer{Command: "ADD rootfs /", Files: map[string]string{"etc/passwd": "root:x:0:0", "bin/sh": "#!sh"}}
+	libsLayer = testimage.Layer{Command: "RUN apk add libc", Files: map[string]string{"lib/libc.so": "libc"}}
+	appA      = testimage.Layer{Command: "COPY app-a /app", Files: map[string]string{"app/a": "a"}}
+	appB      = testimage.Layer{Command: "COPY app-b /app", Files: map[string]string{"app/b": "b"}}
+	otherBase = testimage.Layer{Command: "ADD other /", Files: map[string]string{"etc/os-release": "other"}}
+)
+
+func TestLayerGraphSharedBase(t *testing.T) {
+	repoA := testimage.NewRepo(t, baseLayer, libsLayer, appA)
+	repoB := testimage.NewRepo(t, baseLayer, libsLayer, appB)
+	g := NewLayerGraph()
+	for _, repo := range []*image.Tar{repoA, repoB} {
+		if err := g.AddImage(nil, repo); err != nil {
+			t.Fatal(err)
+		}
+	}
+	layersA := layerChain(t, repoA)
+	layersB := layerChain(t, repoB)
+
+	// the base layers of b share the nodes added for a
+	if got := g.Ancestors(layersB[2]); !reflect.DeepEqual(got, []image.Layer{layersA[1], layersA[0]}) {
+		t.Errorf("Ancestors() of b's top layer = %v, want a's libs and base layers", got)
+	}
+	if got := g.Ancestors(layersA[0]); len(got) != 0 {
+		t.Errorf("Ancestors() of the base layer = %v", got)
+	}
+	if got := g.Children(layersA[1]); !reflect.DeepEqual(got, []image.Layer{layersA[2], layersB[2]}) {
+		t.Errorf("Children() of the libs layer = %v, want both app layers", got)
+	}
+	if got := g.Children(layersB[0]); !reflect.DeepEqual(got, []image.Layer{layersA[1]}) {
+		t.Errorf("Children() of the base layer = %v, want only the libs layer", got)
+	}
+
+	base, err := g.CommonBase(repoA, repoB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if base != layersA[1] {
+		t.Errorf("CommonBase() = %v, want the libs layer", base)
+	}
+	if base, err := g.CommonBase(repoA, repoA); err != nil || base != layersA[2] {
+		t.Errorf("CommonBase() of an image with itself = %v, %v, want its top layer", base, err)
+	}
+
+	// adding an image again doesn't duplicate its nodes
+	if err := g.AddImage(nil, repoA); err != nil {
+		t.Fatal(err)
+	}
+	if got := g.Children(layersA[1]); len(got) != 2 {
+		t.Errorf("Children() after adding an image twice = %v", got)
+	}
+}
+
+func TestLayerGraphChainID(t *testing.T) {
+	repo := testimage.NewRepo(t, baseLayer, libsLayer, appA)
+	g := NewLayerGraph()
+	if err := g.AddImage(nil, repo); err != nil {
+		t.Fatal(err)
+	}
+	layers := layerChain(t, repo)
+	diffIDs := repo.Config.RootFS.DiffIDs
+
+	// chain IDs as defined by the OCI image spec
+	want := []digest.Digest{digest.Digest(diffIDs[0])}
+	for _, diffID := range diffIDs[1:] {
+		want = append(want, digest.FromString(want[len(want)-1].String()+" "+string(diffID)))
+	}
+	for idx, layer := range layers {
+		got, err := g.ChainID(layer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want[idx] {
+			t.Errorf("ChainID() of layer %d = %s, want %s", idx, got, want[idx])
+		}
+	}
+
+	// the same layer on a different base has another chain ID
+	other := testimage.NewRepo(t, otherBase, appA)
+	if err := g.AddImage(nil, other); err != nil {
+		t.Fatal(err)
+	}
+	otherLayers := layerChain(t, other)
+	if got, _ := g.ChainID(otherLayers[1]); got == want[2] {
+		t.Errorf("app layer on another base has the same chain ID %s", got)
+	}
+}
+
+func TestLayerGraphNoCommonBase(t *testing.T) {
+	repoA := testimage.NewRepo(t, baseLayer, appA)
+	repoB := testimage.NewRepo(t, otherBase, appA)
+	g := NewLayerGraph()
+	for _, repo := range []*image.Tar{repoA, repoB} {
+		if err := g.AddImage(nil, repo); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if base, err := g.CommonBase(repoA, repoB); !errors.Is(err, ErrNoCommonBase) {
+		t.Errorf("CommonBase() = %v, %v, want ErrNoCommonBase", base, err)
+	}
+}
+
+func TestLayerGraphUnknownLayer(t *testing.T) {
+	g := NewLayerGraph()
+	layer := layerChain(t, testimage.NewRepo(t, baseLayer))[0]
+	if _, err := g.ChainID(layer); !errors.Is(err, ErrUnknownLayer) {
+		t.Errorf("ChainID() of an unknown layer = %v, want ErrUnknownLayer", err)
+	}
+	if got := g.Ancestors(layer); got != nil {
+		t.Errorf("Ancestors() of an unknown layer = %v", got)
+	}
+	if got := g.Children(layer); got != nil {
+		t.Errorf("Children() of an unknown layer = %v", got)
+	}
+}
+
+func TestLayerGraphAddImageConfig(t *testing.T) {
+	repo := testimage.NewRepo(t, baseLayer, appA)
+	g := NewLayerGraph()
+	if err := g.AddImage(&image.Image{RootFS: &image.ImageRootFS{Type: "layers"}}, repo); err == nil {
+		t.Error("AddImage() with a config missing the tar's layers succeeded")
+	}
+	if err := g.AddImage(nil, &image.Tar{}); !errors.Is(err, image.ErrNoImageConfig) {
+		t.Errorf("AddImage() without a config = %v, want ErrNoImageConfig", err)
+	}
+	if _, err := g.CommonBase(repo, &image.Tar{}); !errors.Is(err, image.ErrNoImageConfig) {
+		t.Errorf("CommonBase() without a config = %v, want ErrNoImageConfig", err)
+	}
+}
@@ -0,0 +1,63 @@
+package image
+
+import (
+	"fmt"
+	"time"
+)
+
+// now is the clock Age reads
+var now = time.Now
+
+// Age returns the time since the image was created
+func (img *Image) Age() time.Duration {
+	return now().Sub(img.Created)
+}
+
+// IsStale returns true if the image is older than maxAge
+func (img *Image) IsStale(maxAge time.Duration) bool {
+	return img.Age() > maxAge
+}
+
+// CreatedHuman returns the age of the image like docker images shows it
+// (e.g. 2 days ago)
+func (img *Image) CreatedHuman() string {
+	if img.Created.IsZero() {
+		return "unknown"
+	}
+	return humanDuration(img.Age())
+}
+
+// humanDuration formats d in its largest whole unit
+func humanDuration(d time.Duration) string {
+	if d < 0 {
+		return "in the future"
+	}
+
+	const (
+		day   = 24 * time.Hour
+		month = 30 * day
+		year  = 365 * day
+	)
+	switch {
+	case d < time.Minute:
+		return "less than a minute ago"
+	case d < time.Hour:
+		return ago(int(d/time.Minute), "minute")
+	case d < day:
+		return ago(int(d/time.Hour), "hour")
+	case d < 2*7*day:
+		return ago(int(d/day), "day")
+	case d < 2*month:
+		return ago(int(d/(7*day)), "week")
+	case d < year:
+		return ago(int(d/month), "month")
+	}
+	return ago(int(d/year), "year")
+}
+
+func ago(n int, unit string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s ago", unit)
+	}
+	return fmt.Sprintf("%d %ss ago", n, unit)
+}
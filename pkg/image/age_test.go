@@ -0,0 +1,76 @@
+package image
+
+import (
+	"testing"
+	"time"
+)
+
+// fixedNow makes Age read t until the returned func restores the clock
+func fixedNow(t time.Time) func() {
+	saved := now
+	now = func() time.Time { return t }
+	return func() { now = saved }
+}
+
+func TestImageAge(t *testing.T) {
+	clock := time.Date(2020, 6, 15, 12, 0, 0, 0, time.UTC)
+	defer fixedNow(clock)()
+
+	img := &Image{Created: clock.Add(-36 * time.Hour)}
+	if got := img.Age(); got != 36*time.Hour {
+		t.Errorf("Age() = %v, want 36h", got)
+	}
+	tests := []struct {
+		maxAge time.Duration
+		stale  bool
+	}{
+		{maxAge: 24 * time.Hour, stale: true},
+		{maxAge: 36 * time.Hour, stale: false},
+		{maxAge: 48 * time.Hour, stale: false},
+	}
+	for _, tt := range tests {
+		if got := img.IsStale(tt.maxAge); got != tt.stale {
+			t.Errorf("IsStale(%v) = %v, want %v", tt.maxAge, got, tt.stale)
+		}
+	}
+}
+
+func TestImageCreatedHuman(t *testing.T) {
+	clock := time.Date(2020, 6, 15, 12, 0, 0, 0, time.UTC)
+	defer fixedNow(clock)()
+
+	const day = 24 * time.Hour
+	tests := []struct {
+		age  time.Duration
+		want string
+	}{
+		{age: 0, want: "less than a minute ago"},
+		{age: 59 * time.Second, want: "less than a minute ago"},
+		{age: time.Minute, want: "1 minute ago"},
+		{age: 45 * time.Minute, want: "45 minutes ago"},
+		{age: time.Hour, want: "1 hour ago"},
+		{age: 23*time.Hour + 59*time.Minute, want: "23 hours ago"},
+		{age: day, want: "1 day ago"},
+		{age: 2 * day, want: "2 days ago"},
+		{age: 13 * day, want: "13 days ago"},
+		{age: 14 * day, want: "2 weeks ago"},
+		{age: 59 * day, want: "8 weeks ago"},
+		{age: 60 * day, want: "2 months ago"},
+		{age: 364 * day, want: "12 months ago"},
+		{age: 365 * day, want: "1 year ago"},
+		{age: 3 * 365 * day, want: "3 years ago"},
+		{age: -time.Hour, want: "in the future"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want+"/"+tt.age.String(), func(t *testing.T) {
+			img := &Image{Created: clock.Add(-tt.age)}
+			if got := img.CreatedHuman(); got != tt.want {
+				t.Errorf("CreatedHuman() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if got := (&Image{}).CreatedHuman(); got != "unknown" {
+		t.Errorf("CreatedHuman() without a created time = %q, want %q", got, "unknown")
+	}
+}
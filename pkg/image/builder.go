@@ -0,0 +1,94 @@
+package image
+
+import (
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/opencontainers/go-digest"
+)
+
+// ImageBuilder builds Image configs
+type ImageBuilder struct {
+	img Image
+}
+
+// NewImageBuilder creates a builder for a linux/amd64 image created now with no layers
+func NewImageBuilder() *ImageBuilder {
+	return &ImageBuilder{
+		img: Image{
+			Created:      time.Now().UTC().Truncate(time.Second),
+			OS:           "linux",
+			Architecture: "amd64",
+			RootFS:       &ImageRootFS{Type: rootFSTypeLayers},
+		},
+	}
+}
+
+// WithOS sets the operating system the image runs on
+func (b *ImageBuilder) WithOS(os string) *ImageBuilder {
+	b.img.OS = os
+	return b
+}
+
+// WithArchitecture sets the CPU architecture the image runs on
+func (b *ImageBuilder) WithArchitecture(arch string) *ImageBuilder {
+	b.img.Architecture = arch
+	return b
+}
+
+// WithVariant sets the CPU variant (e.g. v8 for arm64)
+func (b *ImageBuilder) WithVariant(variant string) *ImageBuilder {
+	b.img.Variant = variant
+	return b
+}
+
+// WithConfig sets the container config of the image
+func (b *ImageBuilder) WithConfig(cfg *container.Config) *ImageBuilder {
+	b.img.Config = cfg
+	return b
+}
+
+// WithCreated sets the creation time of the image
+func (b *ImageBuilder) WithCreated(created time.Time) *ImageBuilder {
+	b.img.Created = created
+	return b
+}
+
+// WithAuthor sets the author of the image
+func (b *ImageBuilder) WithAuthor(author string) *ImageBuilder {
+	b.img.Author = author
+	return b
+}
+
+// WithDockerVersion sets the version of docker that built the image
+func (b *ImageBuilder) WithDockerVersion(version string) *ImageBuilder {
+	b.img.DockerVersion = version
+	return b
+}
+
+// AddLayer appends the layer with the uncompressed digest d
+func (b *ImageBuilder) AddLayer(d digest.Digest) *ImageBuilder {
+	b.img.RootFS.DiffIDs = append(b.img.RootFS.DiffIDs, DiffID(d))
+	return b
+}
+
+// AddHistory appends a build history entry
+func (b *ImageBuilder) AddHistory(entry HistoryEntry) *ImageBuilder {
+	b.img.History = append(b.img.History, entry)
+	return b
+}
+
+// Build validates the image and returns it with its raw JSON set
+func (b *ImageBuilder) Build() (*Image, error) {
+	img := b.img.Clone()
+	if err := img.validate(); err != nil {
+		return nil, err
+	}
+
+	rawJSON, err := canonicalJSON(img)
+	if err != nil {
+		return nil, err
+	}
+	img.rawJSON = rawJSON
+	return img, nil
+}
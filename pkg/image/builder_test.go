@@ -0,0 +1,162 @@
+package image
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestImageBuilder(t *testing.T) {
+	created := time.Date(2020, 9, 13, 12, 26, 40, 0, time.UTC)
+	base, app := digest.FromString("base layer"), digest.FromString("app layer")
+
+	img, err := NewImageBuilder().
+		WithOS("linux").
+		WithArchitecture("arm64").
+		WithVariant("v8").
+		WithCreated(created).
+		WithAuthor("graboid").
+		WithDockerVersion("19.03.12").
+		WithConfig(&container.Config{Env: []string{"PATH=/usr/bin"}, Cmd: []string{"/bin/sh"}, Labels: map[string]string{"version": "1.0"}}).
+		AddLayer(base).
+		AddHistory(HistoryEntry{Created: created, CreatedBy: "/bin/sh -c #(nop) ADD file:abc in / "}).
+		AddLayer(app).
+		AddHistory(HistoryEntry{Created: created, CreatedBy: "/bin/sh -c #(nop)  CMD [\"/bin/sh\"]", EmptyLayer: true}).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if img.RawJSON() == nil {
+		t.Fatal("Build() did not set the raw JSON")
+	}
+	if d, _ := img.ConfigDigest(); d != digest.FromBytes(img.RawJSON()) {
+		t.Errorf("ConfigDigest() = %s, want the digest of the raw JSON", d)
+	}
+
+	parsed, err := NewFromJSON(img.RawJSON())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, img) {
+		t.Errorf("NewFromJSON() of the built image = %+v, want %+v", parsed, img)
+	}
+
+	// the raw JSON is what marshaling the parsed image gives
+	var fromRaw, fromParsed interface{}
+	marshaled, err := json.Marshal(parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	json.Unmarshal(img.RawJSON(), &fromRaw)
+	json.Unmarshal(marshaled, &fromParsed)
+	if !reflect.DeepEqual(fromRaw, fromParsed) {
+		t.Errorf("raw JSON %s does not match the image %s", img.RawJSON(), marshaled)
+	}
+
+	if got := parsed.Platform().String(); got != "linux/arm64/v8" {
+		t.Errorf("parsed image is for %s", got)
+	}
+	want := []DiffID{DiffID(base), DiffID(app)}
+	if !reflect.DeepEqual(parsed.RootFS.DiffIDs, want) || parsed.RootFS.Type != "layers" {
+		t.Errorf("parsed rootfs = %+v, want the two layers", parsed.RootFS)
+	}
+	if !parsed.Created.Equal(created) || parsed.Author != "graboid" || parsed.DockerVersion != "19.03.12" || len(parsed.History) != 2 {
+		t.Errorf("parsed image = %+v", parsed)
+	}
+}
+
+func TestImageBuilderDefaults(t *testing.T) {
+	before := time.Now().Add(-time.Second)
+	img, err := NewImageBuilder().Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.OS != "linux" || img.Architecture != "amd64" {
+		t.Errorf("default platform = %s/%s", img.OS, img.Architecture)
+	}
+	if img.Created.Before(before) || img.Created.After(time.Now()) || img.Created.Location() != time.UTC {
+		t.Errorf("default created = %s, want now in UTC", img.Created)
+	}
+	if img.RootFS == nil || img.RootFS.Type != "layers" || len(img.RootFS.DiffIDs) != 0 {
+		t.Errorf("default rootfs = %+v", img.RootFS)
+	}
+	if _, err := NewFromJSONStrict(img.RawJSON()); err != nil {
+		t.Errorf("NewFromJSONStrict() of an image without layers = %v", err)
+	}
+}
+
+func TestImageBuilderValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		build  func(*ImageBuilder) *ImageBuilder
+		fields []string
+	}{
+		{
+			name:   "empty os",
+			build:  func(b *ImageBuilder) *ImageBuilder { return b.WithOS("") },
+			fields: []string{"os"},
+		},
+		{
+			name:   "empty architecture and zero created",
+			build:  func(b *ImageBuilder) *ImageBuilder { return b.WithArchitecture("").WithCreated(time.Time{}) },
+			fields: []string{"created", "architecture"},
+		},
+		{
+			name: "invalid diff id",
+			build: func(b *ImageBuilder) *ImageBuilder {
+				return b.AddLayer(digest.FromString("ok")).AddLayer("sha256:short")
+			},
+			fields: []string{"rootfs.diff_ids[1]"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := tt.build(NewImageBuilder()).Build()
+			var ve *ValidationError
+			if !errors.As(err, &ve) || img != nil {
+				t.Fatalf("Build() = %v, %v, want a ValidationError", img, err)
+			}
+			for _, field := range tt.fields {
+				if !ve.Has(field) {
+					t.Errorf("ValidationError %v does not flag %s", ve, field)
+				}
+			}
+			if len(ve.Fields) != len(tt.fields) {
+				t.Errorf("ValidationError flags %v, want only %v", ve.Fields, tt.fields)
+			}
+		})
+	}
+}
+
+func TestImageBuilderReuse(t *testing.T) {
+	b := NewImageBuilder().AddLayer(digest.FromString("base layer"))
+	first, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := b.AddLayer(digest.FromString("app layer")).WithAuthor("second").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first.RootFS.DiffIDs) != 1 || first.Author != "" {
+		t.Errorf("building again changed the first image to %+v", first)
+	}
+	if len(second.RootFS.DiffIDs) != 2 {
+		t.Errorf("second image has %d layers, want 2", len(second.RootFS.DiffIDs))
+	}
+
+	first.RootFS.DiffIDs[0] = ""
+	third, err := b.Build()
+	if err != nil {
+		t.Fatalf("changing a built image changed the builder: %v", err)
+	}
+	if third.RootFS.DiffIDs[0] != DiffID(digest.FromString("base layer")) {
+		t.Errorf("third image has diff IDs %v", third.RootFS.DiffIDs)
+	}
+}
@@ -0,0 +1,88 @@
+package image
+
+import (
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+)
+
+// Clone returns a deep copy of the image that can be modified without
+// affecting the original. The clone has no raw JSON as it no longer matches
+// once modified, so it is marshaled from its fields.
+func (img *Image) Clone() *Image {
+	if img == nil {
+		return nil
+	}
+
+	clone := *img
+	clone.rawJSON = nil
+	clone.ContainerConfig = *cloneContainerConfig(&img.ContainerConfig)
+	clone.Config = cloneContainerConfig(img.Config)
+	if img.History != nil {
+		clone.History = append([]HistoryEntry(nil), img.History...)
+	}
+	if img.RootFS != nil {
+		rootfs := *img.RootFS
+		rootfs.DiffIDs = append([]DiffID(nil), img.RootFS.DiffIDs...)
+		clone.RootFS = &rootfs
+	}
+	clone.Annotations = cloneStringMap(img.Annotations)
+
+	return &clone
+}
+
+// cloneContainerConfig deep copies cfg, the value fields are copied with
+// the struct and every slice, map and pointer is copied below it
+func cloneContainerConfig(cfg *container.Config) *container.Config {
+	if cfg == nil {
+		return nil
+	}
+
+	clone := *cfg
+	if cfg.ExposedPorts != nil {
+		clone.ExposedPorts = make(nat.PortSet, len(cfg.ExposedPorts))
+		for port := range cfg.ExposedPorts {
+			clone.ExposedPorts[port] = struct{}{}
+		}
+	}
+	clone.Env = cloneStrings(cfg.Env)
+	clone.Cmd = cloneStrings(cfg.Cmd)
+	if cfg.Healthcheck != nil {
+		healthcheck := *cfg.Healthcheck
+		healthcheck.Test = cloneStrings(cfg.Healthcheck.Test)
+		clone.Healthcheck = &healthcheck
+	}
+	if cfg.Volumes != nil {
+		clone.Volumes = make(map[string]struct{}, len(cfg.Volumes))
+		for volume := range cfg.Volumes {
+			clone.Volumes[volume] = struct{}{}
+		}
+	}
+	clone.Entrypoint = cloneStrings(cfg.Entrypoint)
+	clone.OnBuild = cloneStrings(cfg.OnBuild)
+	clone.Labels = cloneStringMap(cfg.Labels)
+	if cfg.StopTimeout != nil {
+		timeout := *cfg.StopTimeout
+		clone.StopTimeout = &timeout
+	}
+	clone.Shell = cloneStrings(cfg.Shell)
+
+	return &clone
+}
+
+func cloneStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	return append([]string{}, s...)
+}
+
+func cloneStringMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	clone := make(map[string]string, len(m))
+	for key, value := range m {
+		clone[key] = value
+	}
+	return clone
+}
@@ -0,0 +1,74 @@
+package image
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+)
+
+func testImage() *Image {
+	timeout := 10
+	return &Image{
+		ContainerConfig: container.Config{Cmd: []string{"/bin/sh", "-c", "make"}, Env: []string{"PATH=/bin"}},
+		Config: &container.Config{
+			Env:          []string{"PATH=/usr/bin", "HOME=/root"},
+			Cmd:          []string{"nginx"},
+			Entrypoint:   []string{"/entrypoint.sh"},
+			Shell:        []string{"/bin/sh", "-c"},
+			OnBuild:      []string{"RUN make"},
+			ExposedPorts: nat.PortSet{"80/tcp": {}},
+			Volumes:      map[string]struct{}{"/data": {}},
+			Labels:       map[string]string{"maintainer": "graboid"},
+			Healthcheck:  &container.HealthConfig{Test: []string{"CMD", "true"}},
+			StopTimeout:  &timeout,
+		},
+		History:     []HistoryEntry{{CreatedBy: "ADD rootfs /"}, {CreatedBy: "CMD nginx", EmptyLayer: true}},
+		RootFS:      &ImageRootFS{Type: rootFSTypeLayers, DiffIDs: []DiffID{"sha256:a"}},
+		Annotations: map[string]string{"org.opencontainers.image.title": "test"},
+	}
+}
+
+func TestCloneIsEqual(t *testing.T) {
+	img := testImage()
+	if clone := img.Clone(); !reflect.DeepEqual(clone, img) {
+		t.Errorf("Clone() = %+v, want %+v", clone, img)
+	}
+	if (*Image)(nil).Clone() != nil {
+		t.Error("Clone() of nil image is not nil")
+	}
+}
+
+func TestCloneIsIndependent(t *testing.T) {
+	mutations := map[string]func(img *Image){
+		"Config.Env":               func(img *Image) { img.Config.Env[0] = "PATH=/evil"; img.Config.Env = append(img.Config.Env, "X=1") },
+		"Config.Cmd":               func(img *Image) { img.Config.Cmd[0] = "sh" },
+		"Config.Entrypoint":        func(img *Image) { img.Config.Entrypoint[0] = "/bin/false" },
+		"Config.Shell":             func(img *Image) { img.Config.Shell[1] = "-x" },
+		"Config.OnBuild":           func(img *Image) { img.Config.OnBuild[0] = "RUN rm -rf /" },
+		"Config.ExposedPorts":      func(img *Image) { img.Config.ExposedPorts["22/tcp"] = struct{}{} },
+		"Config.Volumes":           func(img *Image) { delete(img.Config.Volumes, "/data") },
+		"Config.Labels":            func(img *Image) { img.Config.Labels["maintainer"] = "someone else" },
+		"Config.Healthcheck":       func(img *Image) { img.Config.Healthcheck.Test[1] = "false"; img.Config.Healthcheck.Retries = 3 },
+		"Config.StopTimeout":       func(img *Image) { *img.Config.StopTimeout = 0 },
+		"ContainerConfig.Cmd":      func(img *Image) { img.ContainerConfig.Cmd[2] = "make install" },
+		"ContainerConfig.Env":      func(img *Image) { img.ContainerConfig.Env[0] = "PATH=/evil" },
+		"History":                  func(img *Image) { img.History[0].CreatedBy = "RUN evil" },
+		"History append":           func(img *Image) { img.History = append(img.History[:1], HistoryEntry{CreatedBy: "RUN evil"}) },
+		"RootFS.DiffIDs":           func(img *Image) { img.RootFS.DiffIDs[0] = "sha256:b" },
+		"Annotations":              func(img *Image) { img.Annotations["org.opencontainers.image.title"] = "changed" },
+		"Config replaced":          func(img *Image) { img.Config.User = "nobody" },
+		"ContainerConfig replaced": func(img *Image) { img.ContainerConfig.User = "nobody" },
+	}
+	for name, mutate := range mutations {
+		t.Run(name, func(t *testing.T) {
+			img := testImage()
+			clone := img.Clone()
+			mutate(clone)
+			if !reflect.DeepEqual(img, testImage()) {
+				t.Errorf("mutating the clone's %s changed the original", name)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package image
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"reflect"
+)
+
+// Equal returns true if both images describe the same artifact. The layer
+// DiffIDs are compared first and then the SHA256 of the raw config JSON.
+func (img *Image) Equal(other *Image) bool {
+	if img == nil || other == nil {
+		return img == other
+	}
+	if !img.RootFS.equal(other.RootFS) {
+		return false
+	}
+	a, err := img.configJSON()
+	if err != nil {
+		return false
+	}
+	b, err := other.configJSON()
+	if err != nil {
+		return false
+	}
+	sumA := sha256.Sum256(a)
+	sumB := sha256.Sum256(b)
+	return bytes.Equal(sumA[:], sumB[:])
+}
+
+// SemanticallyEquivalent returns true if both images have the same layers,
+// platform and runtime config, ignoring metadata like Comment, Author or DockerVersion.
+func (img *Image) SemanticallyEquivalent(other *Image) bool {
+	if img == nil || other == nil {
+		return img == other
+	}
+	if !img.RootFS.equal(other.RootFS) {
+		return false
+	}
+	if img.Architecture != other.Architecture || img.OS != other.OS {
+		return false
+	}
+	return reflect.DeepEqual(img.Config, other.Config)
+}
+
+func (rootfs *ImageRootFS) equal(other *ImageRootFS) bool {
+	if rootfs == nil || other == nil {
+		return rootfs == other
+	}
+	if rootfs.Type != other.Type || len(rootfs.DiffIDs) != len(other.DiffIDs) {
+		return false
+	}
+	for idx := range rootfs.DiffIDs {
+		if rootfs.DiffIDs[idx] != other.DiffIDs[idx] {
+			return false
+		}
+	}
+	return true
+}
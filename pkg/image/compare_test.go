@@ -0,0 +1,69 @@
+package image
+
+import "testing"
+
+func TestImageEqual(t *testing.T) {
+	base := `{"architecture":"amd64","os":"linux","author":"a","rootfs":{"type":"layers","diff_ids":["sha256:` + testHex + `"]}}`
+	parse := func(s string) *Image {
+		img, err := NewFromJSON([]byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return img
+	}
+
+	tests := []struct {
+		name       string
+		a, b       *Image
+		equal      bool
+		equivalent bool
+	}{
+		{name: "both nil", equal: true, equivalent: true},
+		{name: "one nil", a: parse(base), equal: false, equivalent: false},
+		{name: "same JSON", a: parse(base), b: parse(base), equal: true, equivalent: true},
+		{
+			name:       "same layers, different metadata",
+			a:          parse(base),
+			b:          parse(`{"architecture":"amd64","os":"linux","author":"b","comment":"rebuilt","docker_version":"20.10","rootfs":{"type":"layers","diff_ids":["sha256:` + testHex + `"]}}`),
+			equal:      false,
+			equivalent: true,
+		},
+		{
+			name:       "same layers, different platform",
+			a:          parse(base),
+			b:          parse(`{"architecture":"arm64","os":"linux","author":"a","rootfs":{"type":"layers","diff_ids":["sha256:` + testHex + `"]}}`),
+			equal:      false,
+			equivalent: false,
+		},
+		{
+			name:       "same layers, different runtime config",
+			a:          parse(base),
+			b:          parse(`{"architecture":"amd64","os":"linux","author":"a","config":{"Cmd":["sh"]},"rootfs":{"type":"layers","diff_ids":["sha256:` + testHex + `"]}}`),
+			equal:      false,
+			equivalent: false,
+		},
+		{
+			name:       "different layers",
+			a:          parse(base),
+			b:          parse(`{"architecture":"amd64","os":"linux","author":"a","rootfs":{"type":"layers","diff_ids":[]}}`),
+			equal:      false,
+			equivalent: false,
+		},
+		{name: "nil rootfs both", a: &Image{OS: "linux"}, b: &Image{OS: "linux"}, equal: true, equivalent: true},
+		{name: "nil rootfs one", a: &Image{OS: "linux"}, b: parse(base), equal: false, equivalent: false},
+		{name: "nil rootfs different metadata", a: &Image{OS: "linux", Author: "a"}, b: &Image{OS: "linux", Author: "b"}, equal: false, equivalent: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.Equal(tt.b); got != tt.equal {
+				t.Errorf("Equal() = %t, want %t", got, tt.equal)
+			}
+			if got := tt.b.Equal(tt.a); got != tt.equal {
+				t.Errorf("reversed Equal() = %t, want %t", got, tt.equal)
+			}
+			if got := tt.a.SemanticallyEquivalent(tt.b); got != tt.equivalent {
+				t.Errorf("SemanticallyEquivalent() = %t, want %t", got, tt.equivalent)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package image
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// ContainerConfigDiff returns what changed from config a to config b as
+// human-readable lines like "Env: added FOO=bar" or "ExposedPorts: removed
+// 8080/tcp", in the field order of container.Config. Comparing an image's
+// ContainerConfig with its Config shows what the build step committed.
+func ContainerConfigDiff(a, b container.Config) []string {
+	d := &configDiff{}
+
+	d.str("Hostname", a.Hostname, b.Hostname)
+	d.str("Domainname", a.Domainname, b.Domainname)
+	d.str("User", a.User, b.User)
+	d.bool("AttachStdin", a.AttachStdin, b.AttachStdin)
+	d.bool("AttachStdout", a.AttachStdout, b.AttachStdout)
+	d.bool("AttachStderr", a.AttachStderr, b.AttachStderr)
+	d.set("ExposedPorts", portSet(a), portSet(b))
+	d.bool("Tty", a.Tty, b.Tty)
+	d.bool("OpenStdin", a.OpenStdin, b.OpenStdin)
+	d.bool("StdinOnce", a.StdinOnce, b.StdinOnce)
+	d.env(a.Env, b.Env)
+	d.list("Cmd", a.Cmd, b.Cmd)
+	d.healthcheck(a.Healthcheck, b.Healthcheck)
+	d.bool("ArgsEscaped", a.ArgsEscaped, b.ArgsEscaped)
+	d.str("Image", a.Image, b.Image)
+	d.set("Volumes", volumeSet(a), volumeSet(b))
+	d.str("WorkingDir", a.WorkingDir, b.WorkingDir)
+	d.list("Entrypoint", a.Entrypoint, b.Entrypoint)
+	d.bool("NetworkDisabled", a.NetworkDisabled, b.NetworkDisabled)
+	d.str("MacAddress", a.MacAddress, b.MacAddress)
+	d.list("OnBuild", a.OnBuild, b.OnBuild)
+	d.labels(a.Labels, b.Labels)
+	d.str("StopSignal", a.StopSignal, b.StopSignal)
+	d.stopTimeout(a.StopTimeout, b.StopTimeout)
+	d.list("Shell", a.Shell, b.Shell)
+
+	return d.lines
+}
+
+// configDiff collects the difference lines of ContainerConfigDiff
+type configDiff struct {
+	lines []string
+}
+
+func (d *configDiff) add(field, format string, args ...interface{}) {
+	d.lines = append(d.lines, field+": "+fmt.Sprintf(format, args...))
+}
+
+func (d *configDiff) str(field, a, b string) {
+	if a != b {
+		d.add(field, "changed %q to %q", a, b)
+	}
+}
+
+func (d *configDiff) bool(field string, a, b bool) {
+	if a != b {
+		d.add(field, "changed %t to %t", a, b)
+	}
+}
+
+// list compares ordered slices like Cmd as a whole
+func (d *configDiff) list(field string, a, b []string) {
+	if len(a) == len(b) {
+		equal := true
+		for idx := range a {
+			if a[idx] != b[idx] {
+				equal = false
+				break
+			}
+		}
+		if equal {
+			return
+		}
+	}
+	d.add(field, "changed %s to %s", formatList(a), formatList(b))
+}
+
+// set compares unordered sets like ExposedPorts member by member
+func (d *configDiff) set(field string, a, b map[string]bool) {
+	for _, key := range sortedKeys(a) {
+		if !b[key] {
+			d.add(field, "removed %s", key)
+		}
+	}
+	for _, key := range sortedKeys(b) {
+		if !a[key] {
+			d.add(field, "added %s", key)
+		}
+	}
+}
+
+// env compares the variables by name so a changed value is one line
+func (d *configDiff) env(a, b []string) {
+	before := make(map[string]string, len(a))
+	for _, kv := range a {
+		before[envKey(kv)] = kv
+	}
+	after := make(map[string]string, len(b))
+	for _, kv := range b {
+		after[envKey(kv)] = kv
+	}
+
+	for _, kv := range a {
+		if _, ok := after[envKey(kv)]; !ok {
+			d.add("Env", "removed %s", kv)
+		}
+	}
+	for _, kv := range b {
+		old, ok := before[envKey(kv)]
+		switch {
+		case !ok:
+			d.add("Env", "added %s", kv)
+		case old != kv:
+			d.add("Env", "changed %s to %s", old, kv)
+		}
+	}
+}
+
+func (d *configDiff) labels(a, b map[string]string) {
+	keys := make(map[string]bool, len(a)+len(b))
+	for key := range a {
+		keys[key] = true
+	}
+	for key := range b {
+		keys[key] = true
+	}
+
+	for _, key := range sortedKeys(keys) {
+		old, inA := a[key]
+		value, inB := b[key]
+		switch {
+		case !inB:
+			d.add("Labels", "removed %s=%s", key, old)
+		case !inA:
+			d.add("Labels", "added %s=%s", key, value)
+		case old != value:
+			d.add("Labels", "changed %s=%s to %s=%s", key, old, key, value)
+		}
+	}
+}
+
+func (d *configDiff) healthcheck(a, b *container.HealthConfig) {
+	switch {
+	case a == nil && b == nil:
+		return
+	case a == nil:
+		d.add("Healthcheck", "added %s", formatList(b.Test))
+		return
+	case b == nil:
+		d.add("Healthcheck", "removed %s", formatList(a.Test))
+		return
+	}
+
+	d.list("Healthcheck.Test", a.Test, b.Test)
+	if a.Interval != b.Interval {
+		d.add("Healthcheck.Interval", "changed %s to %s", a.Interval, b.Interval)
+	}
+	if a.Timeout != b.Timeout {
+		d.add("Healthcheck.Timeout", "changed %s to %s", a.Timeout, b.Timeout)
+	}
+	if a.Retries != b.Retries {
+		d.add("Healthcheck.Retries", "changed %d to %d", a.Retries, b.Retries)
+	}
+}
+
+func (d *configDiff) stopTimeout(a, b *int) {
+	format := func(timeout *int) string {
+		if timeout == nil {
+			return "unset"
+		}
+		return fmt.Sprintf("%ds", *timeout)
+	}
+	if format(a) != format(b) {
+		d.add("StopTimeout", "changed %s to %s", format(a), format(b))
+	}
+}
+
+// formatList formats a slice like the exec form of a Dockerfile instruction
+func formatList(list []string) string {
+	quoted := make([]string, len(list))
+	for idx, s := range list {
+		quoted[idx] = fmt.Sprintf("%q", s)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+func portSet(cfg container.Config) map[string]bool {
+	ports := make(map[string]bool, len(cfg.ExposedPorts))
+	for port := range cfg.ExposedPorts {
+		ports[string(port)] = true
+	}
+	return ports
+}
+
+func volumeSet(cfg container.Config) map[string]bool {
+	volumes := make(map[string]bool, len(cfg.Volumes))
+	for volume := range cfg.Volumes {
+		volumes[volume] = true
+	}
+	return volumes
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
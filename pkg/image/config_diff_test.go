@@ -0,0 +1,168 @@
+package image
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+)
+
+func intPtr(n int) *int { return &n }
+
+func TestContainerConfigDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b container.Config
+		want []string
+	}{
+		{
+			name: "equal",
+			a:    container.Config{User: "app", Env: []string{"A=1"}, Cmd: []string{"sh"}, Labels: map[string]string{"a": "1"}},
+			b:    container.Config{User: "app", Env: []string{"A=1"}, Cmd: []string{"sh"}, Labels: map[string]string{"a": "1"}},
+		},
+		{
+			name: "strings",
+			a:    container.Config{Hostname: "build", User: "root", WorkingDir: "/"},
+			b:    container.Config{Hostname: "build", User: "app", WorkingDir: "/app", StopSignal: "SIGTERM"},
+			want: []string{`User: changed "root" to "app"`, `WorkingDir: changed "/" to "/app"`, `StopSignal: changed "" to "SIGTERM"`},
+		},
+		{
+			name: "bools",
+			a:    container.Config{AttachStdout: true, Tty: true},
+			b:    container.Config{AttachStdout: false, Tty: true, ArgsEscaped: true},
+			want: []string{"AttachStdout: changed true to false", "ArgsEscaped: changed false to true"},
+		},
+		{
+			name: "env",
+			a:    container.Config{Env: []string{"PATH=/usr/bin", "LANG=C", "DEBUG=1"}},
+			b:    container.Config{Env: []string{"PATH=/usr/local/bin:/usr/bin", "LANG=C", "FOO=bar"}},
+			want: []string{"Env: removed DEBUG=1", "Env: changed PATH=/usr/bin to PATH=/usr/local/bin:/usr/bin", "Env: added FOO=bar"},
+		},
+		{
+			name: "ordered slices",
+			a:    container.Config{Cmd: []string{"nginx"}, Entrypoint: []string{"/entrypoint.sh"}, Shell: []string{"/bin/sh", "-c"}},
+			b:    container.Config{Cmd: []string{"nginx", "-g", "daemon off;"}, Entrypoint: []string{"/entrypoint.sh"}, Shell: []string{"-c", "/bin/sh"}},
+			want: []string{
+				`Cmd: changed ["nginx"] to ["nginx", "-g", "daemon off;"]`,
+				`Shell: changed ["/bin/sh", "-c"] to ["-c", "/bin/sh"]`,
+			},
+		},
+		{
+			name: "onbuild cleared",
+			a:    container.Config{OnBuild: []string{"RUN make"}},
+			b:    container.Config{},
+			want: []string{`OnBuild: changed ["RUN make"] to []`},
+		},
+		{
+			name: "port and volume sets",
+			a: container.Config{
+				ExposedPorts: nat.PortSet{"8080/tcp": {}, "443/tcp": {}},
+				Volumes:      map[string]struct{}{"/data": {}},
+			},
+			b: container.Config{
+				ExposedPorts: nat.PortSet{"443/tcp": {}, "53/udp": {}},
+				Volumes:      map[string]struct{}{"/data": {}, "/cache": {}},
+			},
+			want: []string{"ExposedPorts: removed 8080/tcp", "ExposedPorts: added 53/udp", "Volumes: added /cache"},
+		},
+		{
+			name: "labels",
+			a:    container.Config{Labels: map[string]string{"maintainer": "someone", "version": "1.0"}},
+			b:    container.Config{Labels: map[string]string{"version": "1.1", "vendor": "graboid"}},
+			want: []string{"Labels: removed maintainer=someone", "Labels: added vendor=graboid", "Labels: changed version=1.0 to version=1.1"},
+		},
+		{
+			name: "healthcheck added",
+			b:    container.Config{Healthcheck: &container.HealthConfig{Test: []string{"CMD", "curl", "-f", "http://localhost/"}}},
+			want: []string{`Healthcheck: added ["CMD", "curl", "-f", "http://localhost/"]`},
+		},
+		{
+			name: "healthcheck removed",
+			a:    container.Config{Healthcheck: &container.HealthConfig{Test: []string{"NONE"}}},
+			want: []string{`Healthcheck: removed ["NONE"]`},
+		},
+		{
+			name: "healthcheck fields",
+			a:    container.Config{Healthcheck: &container.HealthConfig{Test: []string{"CMD-SHELL", "true"}, Interval: 30 * time.Second, Timeout: 5 * time.Second, Retries: 3}},
+			b:    container.Config{Healthcheck: &container.HealthConfig{Test: []string{"CMD-SHELL", "true"}, Interval: time.Minute, Timeout: 5 * time.Second, Retries: 5}},
+			want: []string{"Healthcheck.Interval: changed 30s to 1m0s", "Healthcheck.Retries: changed 3 to 5"},
+		},
+		{
+			name: "stop timeout",
+			a:    container.Config{StopTimeout: intPtr(10)},
+			b:    container.Config{StopTimeout: intPtr(30)},
+			want: []string{"StopTimeout: changed 10s to 30s"},
+		},
+		{
+			name: "stop timeout unset",
+			a:    container.Config{StopTimeout: intPtr(10)},
+			want: []string{"StopTimeout: changed 10s to unset"},
+		},
+		{
+			name: "equal stop timeouts",
+			a:    container.Config{StopTimeout: intPtr(10)},
+			b:    container.Config{StopTimeout: intPtr(10)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ContainerConfigDiff(tt.a, tt.b); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ContainerConfigDiff() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContainerConfigDiffEveryField(t *testing.T) {
+	// a config with every field set differs from the empty one in every field
+	full := container.Config{
+		Hostname:        "host",
+		Domainname:      "example.com",
+		User:            "app",
+		AttachStdin:     true,
+		AttachStdout:    true,
+		AttachStderr:    true,
+		ExposedPorts:    nat.PortSet{"80/tcp": {}},
+		Tty:             true,
+		OpenStdin:       true,
+		StdinOnce:       true,
+		Env:             []string{"A=1"},
+		Cmd:             []string{"sh"},
+		Healthcheck:     &container.HealthConfig{Test: []string{"NONE"}},
+		ArgsEscaped:     true,
+		Image:           "sha256:abc",
+		Volumes:         map[string]struct{}{"/data": {}},
+		WorkingDir:      "/app",
+		Entrypoint:      []string{"/entrypoint.sh"},
+		NetworkDisabled: true,
+		MacAddress:      "02:42:ac:11:00:02",
+		OnBuild:         []string{"RUN make"},
+		Labels:          map[string]string{"a": "1"},
+		StopSignal:      "SIGTERM",
+		StopTimeout:     intPtr(10),
+		Shell:           []string{"/bin/bash", "-c"},
+	}
+	typ := reflect.TypeOf(full)
+	val := reflect.ValueOf(full)
+	for idx := 0; idx < typ.NumField(); idx++ {
+		if val.Field(idx).IsZero() {
+			t.Fatalf("field %s of the full config is not set", typ.Field(idx).Name)
+		}
+	}
+
+	lines := ContainerConfigDiff(container.Config{}, full)
+	if len(lines) != typ.NumField() {
+		t.Fatalf("ContainerConfigDiff() = %q, want a line per field", lines)
+	}
+	for idx, line := range lines {
+		field := typ.Field(idx).Name
+		if len(line) <= len(field) || line[:len(field)+2] != field+": " {
+			t.Errorf("line %d = %q, want a difference of %s", idx, line, field)
+		}
+	}
+	if lines := ContainerConfigDiff(full, full); len(lines) != 0 {
+		t.Errorf("ContainerConfigDiff() of equal configs = %q", lines)
+	}
+}
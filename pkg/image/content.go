@@ -0,0 +1,75 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/wagoodman/dive/filetree"
+)
+
+// sniffLen is the number of bytes needed to detect a content type
+const sniffLen = 512
+
+// ErrNotRegularFile is returned when content is requested for a directory or link
+var ErrNotRegularFile = errors.New("not a regular file")
+
+var magicTypes = []struct {
+	magic    []byte
+	mimeType string
+}{
+	{[]byte("\x7fELF"), "application/x-elf"},
+	{[]byte("\xCA\xFE\xBA\xBE"), "application/java-vm"},
+}
+
+var shebangTypes = []struct {
+	interpreter []byte
+	mimeType    string
+}{
+	{[]byte("python"), "text/x-python"},
+	{[]byte("perl"), "text/x-perl"},
+	{[]byte("ruby"), "text/x-ruby"},
+	{[]byte("node"), "application/javascript"},
+	{[]byte("sh"), "text/x-shellscript"},
+}
+
+// DetectContentType returns the MIME type of data using magic bytes for
+// executables and scripts before falling back to http.DetectContentType
+func DetectContentType(data []byte) string {
+	if len(data) > sniffLen {
+		data = data[:sniffLen]
+	}
+	for _, mt := range magicTypes {
+		if bytes.HasPrefix(data, mt.magic) {
+			return mt.mimeType
+		}
+	}
+	if bytes.HasPrefix(data, []byte("#!")) {
+		line := data
+		if end := bytes.IndexByte(data, '\n'); end >= 0 {
+			line = data[:end]
+		}
+		for _, st := range shebangTypes {
+			if bytes.Contains(line, st.interpreter) {
+				return st.mimeType
+			}
+		}
+		return "text/x-script"
+	}
+	return http.DetectContentType(data)
+}
+
+// ContentType returns the MIME type of the file node reading its content from r
+func ContentType(node *filetree.FileNode, r io.Reader) (string, error) {
+	if node == nil || FileIsDir(node) || node.Data.FileInfo.TypeFlag == tar.TypeSymlink || node.Data.FileInfo.TypeFlag == tar.TypeLink {
+		return "", ErrNotRegularFile
+	}
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	return DetectContentType(buf[:n]), nil
+}
@@ -0,0 +1,117 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/wagoodman/dive/filetree"
+)
+
+func TestDetectContentType(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{name: "elf", data: "\x7fELF\x02\x01\x01\x00", want: "application/x-elf"},
+		{name: "java class", data: "\xCA\xFE\xBA\xBE\x00\x00\x00\x34", want: "application/java-vm"},
+		{name: "sh", data: "#!/bin/sh\nset -e\n", want: "text/x-shellscript"},
+		{name: "bash via env", data: "#!/usr/bin/env bash\n", want: "text/x-shellscript"},
+		{name: "python", data: "#!/usr/bin/python3\nimport os\n", want: "text/x-python"},
+		{name: "perl", data: "#!/usr/bin/perl -w\n", want: "text/x-perl"},
+		{name: "ruby", data: "#!/usr/bin/env ruby", want: "text/x-ruby"},
+		{name: "node", data: "#!/usr/bin/env node\n", want: "application/javascript"},
+		{name: "other interpreter", data: "#!/usr/bin/awk -f\n", want: "text/x-script"},
+		{name: "interpreter after first line", data: "#!/usr/bin/awk -f\n# not python\n", want: "text/x-script"},
+		{name: "gzip", data: "\x1f\x8b\x08\x00\x00\x00", want: "application/x-gzip"},
+		{name: "text", data: "root:x:0:0:root:/root:/bin/sh\n", want: "text/plain; charset=utf-8"},
+		{name: "empty", data: "", want: "text/plain; charset=utf-8"},
+		{name: "magic past sniff length", data: strings.Repeat("a", sniffLen) + "\x7fELF", want: "text/plain; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectContentType([]byte(tt.data)); got != tt.want {
+				t.Errorf("DetectContentType() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContentType(t *testing.T) {
+	l := newTestLayer(t, 0,
+		dir("bin"),
+		regular("bin/busybox", 8),
+		symlink("bin/sh", "busybox"),
+		filetree.FileInfo{Path: "bin/ash", TypeFlag: tar.TypeLink, Linkname: "bin/busybox"},
+		regular("usr/lib/libc.so", 8),
+	)
+	tests := []struct {
+		path string
+		want string
+		err  error
+	}{
+		{path: "/bin/busybox", want: "application/x-elf"},
+		{path: "/bin", err: ErrNotRegularFile},
+		{path: "/usr", err: ErrNotRegularFile},
+		{path: "/bin/sh", err: ErrNotRegularFile},
+		{path: "/bin/ash", err: ErrNotRegularFile},
+	}
+	for _, tt := range tests {
+		node, ok := l.FileByPath(tt.path)
+		if !ok {
+			t.Fatalf("FileByPath(%q) not found", tt.path)
+		}
+		got, err := ContentType(node, strings.NewReader("\x7fELF\x02\x01\x01\x00"))
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("ContentType(%s) = %q, %v, want %q, %v", tt.path, got, err, tt.want, tt.err)
+		}
+	}
+	if _, err := ContentType(nil, strings.NewReader("")); !errors.Is(err, ErrNotRegularFile) {
+		t.Errorf("ContentType(nil) = %v, want ErrNotRegularFile", err)
+	}
+
+	errRead := errors.New("read failed")
+	node, _ := l.FileByPath("/bin/busybox")
+	if _, err := ContentType(node, &failingReader{err: errRead}); !errors.Is(err, errRead) {
+		t.Errorf("ContentType() with a failing reader = %v, want %v", err, errRead)
+	}
+}
+
+// failingReader returns err from every read
+type failingReader struct {
+	err error
+}
+
+func (r *failingReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+func BenchmarkDetectContentType(b *testing.B) {
+	samples := map[string][]byte{
+		"elf":    append([]byte("\x7fELF"), make([]byte, sniffLen)...),
+		"script": []byte("#!/usr/bin/env python3\n" + strings.Repeat("print('x')\n", 100)),
+		"html":   []byte("<!DOCTYPE html><html>" + strings.Repeat("<p>x</p>", 100)),
+		"binary": bytes.Repeat([]byte{0x00, 0xff}, sniffLen),
+	}
+	for name, data := range samples {
+		b.Run(name, func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				DetectContentType(data)
+			}
+		})
+	}
+}
+
+func BenchmarkContentType(b *testing.B) {
+	node := filetree.NewNode(nil, "busybox", regular("bin/busybox", 1<<20))
+	data := append([]byte("\x7fELF"), make([]byte, 1<<20)...)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if _, err := ContentType(node, bytes.NewReader(data)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
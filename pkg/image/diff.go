@@ -0,0 +1,81 @@
+package image
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/wagoodman/dive/filetree"
+)
+
+// LayerDiff lists the files that changed between two layers
+type LayerDiff struct {
+	Added    []*filetree.FileNode
+	Removed  []*filetree.FileNode
+	Modified []*filetree.FileNode
+}
+
+// IsEmpty returns true if no files changed
+func (ld LayerDiff) IsEmpty() bool {
+	return len(ld.Added) == 0 && len(ld.Removed) == 0 && len(ld.Modified) == 0
+}
+
+// String returns the diff with one "+", "-" or "~" prefixed path per line
+func (ld LayerDiff) String() string {
+	var sb strings.Builder
+	for _, node := range ld.Added {
+		fmt.Fprintf(&sb, "+ %s\n", node.Path())
+	}
+	for _, node := range ld.Removed {
+		fmt.Fprintf(&sb, "- %s\n", node.Path())
+	}
+	for _, node := range ld.Modified {
+		fmt.Fprintf(&sb, "~ %s\n", node.Path())
+	}
+	return sb.String()
+}
+
+// diffLayers compares the base layer to the target layer. Files whited out
+// in target count as removed.
+func diffLayers(base, target Layer) LayerDiff {
+	var diff LayerDiff
+	whitedOut := make(map[*filetree.FileNode]bool)
+
+	target.Walk(func(node *filetree.FileNode) error {
+		if node.IsWhiteout() {
+			if removed, ok := base.FileByPath(node.Path()); ok {
+				diff.Removed = append(diff.Removed, removed)
+				whitedOut[removed] = true
+			}
+			return nil
+		}
+		prev, ok := base.FileByPath(node.Path())
+		if !ok {
+			diff.Added = append(diff.Added, node)
+			return nil
+		}
+		if FileIsDir(prev) && FileIsDir(node) {
+			return nil
+		}
+		if FileIsDir(prev) != FileIsDir(node) ||
+			FileSize(prev) != FileSize(node) ||
+			// the content hash doesn't cover where a symlink points
+			prev.Data.FileInfo.Linkname != node.Data.FileInfo.Linkname ||
+			prev.Data.FileInfo.Compare(node.Data.FileInfo) == filetree.Modified {
+			diff.Modified = append(diff.Modified, node)
+		}
+		return nil
+	})
+
+	base.Walk(func(node *filetree.FileNode) error {
+		if node.IsWhiteout() {
+			return nil
+		}
+		// files removed by a whiteout are already accounted for
+		if _, ok := target.FileByPath(node.Path()); !ok && !whitedOut[node] {
+			diff.Removed = append(diff.Removed, node)
+		}
+		return nil
+	})
+
+	return diff
+}
@@ -0,0 +1,97 @@
+package image
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/wagoodman/dive/filetree"
+)
+
+func TestLayerDiff(t *testing.T) {
+	base := []filetree.FileInfo{
+		dir("etc"),
+		regular("etc/passwd", 100),
+		regular("etc/motd", 20),
+		regular("usr/lib/libssl.so", 3000),
+		symlink("bin/sh", "busybox"),
+	}
+	tests := []struct {
+		name                     string
+		target                   []filetree.FileInfo
+		added, removed, modified []string
+	}{
+		{name: "identical", target: base},
+		{
+			name:   "added",
+			target: append(append([]filetree.FileInfo{}, base...), regular("etc/hosts", 10)),
+			added:  []string{"/etc/hosts"},
+		},
+		{
+			name:     "modified size",
+			target:   []filetree.FileInfo{dir("etc"), regular("etc/passwd", 100), regular("etc/motd", 20), regular("usr/lib/libssl.so", 3100), symlink("bin/sh", "busybox")},
+			modified: []string{"/usr/lib/libssl.so"},
+		},
+		{
+			name:     "modified symlink target",
+			target:   []filetree.FileInfo{dir("etc"), regular("etc/passwd", 100), regular("etc/motd", 20), regular("usr/lib/libssl.so", 3000), symlink("bin/sh", "bash")},
+			modified: []string{"/bin/sh"},
+		},
+		{
+			name:     "file replaced by directory",
+			target:   []filetree.FileInfo{dir("etc"), regular("etc/passwd", 100), dir("etc/motd"), regular("usr/lib/libssl.so", 3000), symlink("bin/sh", "busybox")},
+			modified: []string{"/etc/motd"},
+		},
+		{
+			name:    "missing",
+			target:  []filetree.FileInfo{dir("etc"), regular("etc/passwd", 100), regular("etc/motd", 20), symlink("bin/sh", "busybox")},
+			removed: []string{"/usr", "/usr/lib", "/usr/lib/libssl.so"},
+		},
+		{
+			name:    "whiteouts",
+			target:  []filetree.FileInfo{dir("etc"), regular("etc/passwd", 100), regular("etc/.wh.motd", 0), regular("usr/lib/.wh.libssl.so", 0), symlink("bin/sh", "busybox")},
+			removed: []string{"/etc/motd", "/usr/lib/libssl.so"},
+		},
+		{
+			name:    "whiteout of a missing file",
+			target:  append(append([]filetree.FileInfo{}, base...), regular("etc/.wh.shadow", 0)),
+			removed: nil,
+		},
+		{
+			name:     "whiteout and replacement",
+			target:   []filetree.FileInfo{dir("etc"), regular("etc/passwd", 100), regular("etc/.wh.motd", 0), regular("usr/lib/libssl.so", 3100), symlink("bin/sh", "busybox")},
+			removed:  []string{"/etc/motd"},
+			modified: []string{"/usr/lib/libssl.so"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := newTestLayer(t, 0, base...).Diff(newTestLayer(t, 1, tt.target...))
+			if got := paths(diff.Added); !reflect.DeepEqual(got, tt.added) {
+				t.Errorf("Added = %v, want %v", got, tt.added)
+			}
+			if got := paths(diff.Removed); !reflect.DeepEqual(got, tt.removed) {
+				t.Errorf("Removed = %v, want %v", got, tt.removed)
+			}
+			if got := paths(diff.Modified); !reflect.DeepEqual(got, tt.modified) {
+				t.Errorf("Modified = %v, want %v", got, tt.modified)
+			}
+			empty := len(tt.added) == 0 && len(tt.removed) == 0 && len(tt.modified) == 0
+			if diff.IsEmpty() != empty {
+				t.Errorf("IsEmpty() = %t, want %t", diff.IsEmpty(), empty)
+			}
+		})
+	}
+}
+
+func TestLayerDiffString(t *testing.T) {
+	base := newTestLayer(t, 0, regular("etc/motd", 20), regular("etc/passwd", 100))
+	target := newTestLayer(t, 1, regular("etc/.wh.motd", 0), regular("etc/passwd", 200), regular("etc/hosts", 10))
+
+	want := "+ /etc/hosts\n- /etc/motd\n~ /etc/passwd\n"
+	if got := base.Diff(target).String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if got := base.Diff(base).String(); got != "" {
+		t.Errorf("String() of an empty diff = %q", got)
+	}
+}
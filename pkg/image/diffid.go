@@ -0,0 +1,68 @@
+package image
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	// register sha256 for go-digest
+	_ "crypto/sha256"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// DiffIDStrings returns the diff IDs of the layers as strings
+func (rootfs *ImageRootFS) DiffIDStrings() []string {
+	if rootfs == nil {
+		return nil
+	}
+	ids := make([]string, len(rootfs.DiffIDs))
+	for idx, id := range rootfs.DiffIDs {
+		ids[idx] = id.String()
+	}
+	return ids
+}
+
+// String returns the diff ID in the sha256:<hex> format
+func (d DiffID) String() string {
+	return string(d)
+}
+
+// Algorithm returns the hash algorithm of the diff ID, sha256 for current images
+func (d DiffID) Algorithm() string {
+	if idx := strings.Index(string(d), ":"); idx >= 0 {
+		return string(d[:idx])
+	}
+	return ""
+}
+
+// Hex returns the hash of the diff ID without the algorithm prefix
+func (d DiffID) Hex() string {
+	return string(d[strings.Index(string(d), ":")+1:])
+}
+
+// Validate checks the diff ID is a well formed digest of a supported algorithm
+func (d DiffID) Validate() error {
+	return digest.Digest(d).Validate()
+}
+
+// DiffIDFromReader reads the uncompressed layer tar r to the end and returns
+// its diff ID and the number of bytes read
+func DiffIDFromReader(r io.Reader) (DiffID, int64, error) {
+	digester := digest.Canonical.Digester()
+	size, err := io.Copy(digester.Hash(), r)
+	if err != nil {
+		return "", size, err
+	}
+	return DiffID(digester.Digest()), size, nil
+}
+
+// DiffIDFromFile returns the diff ID and size of the uncompressed layer tar at path
+func DiffIDFromFile(path string) (DiffID, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	return DiffIDFromReader(f)
+}
@@ -0,0 +1,133 @@
+package image
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffIDFromReader(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want DiffID
+	}{
+		{name: "empty", data: "", want: "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{name: "data", data: "hello", want: "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, size, err := DiffIDFromReader(strings.NewReader(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want || size != int64(len(tt.data)) {
+				t.Errorf("DiffIDFromReader() = %s, %d, want %s, %d", got, size, tt.want, len(tt.data))
+			}
+			if got.String() != string(tt.want) {
+				t.Errorf("String() = %q, want %q", got.String(), tt.want)
+			}
+		})
+	}
+
+	errRead := errors.New("read failed")
+	got, size, err := DiffIDFromReader(io.MultiReader(strings.NewReader("abc"), &failingReader{err: errRead}))
+	if !errors.Is(err, errRead) || got != "" || size != 3 {
+		t.Errorf("DiffIDFromReader() of a failing reader = %q, %d, %v, want the bytes read and %v", got, size, err, errRead)
+	}
+}
+
+func TestDiffIDFromFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diffid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "layer.tar")
+	if err := ioutil.WriteFile(path, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, size, err := DiffIDFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := DiffID("sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"); got != want || size != 5 {
+		t.Errorf("DiffIDFromFile() = %s, %d, want %s, 5", got, size, want)
+	}
+
+	if _, _, err := DiffIDFromFile(filepath.Join(dir, "missing.tar")); !os.IsNotExist(err) {
+		t.Errorf("DiffIDFromFile() of a missing file = %v, want a not exist error", err)
+	}
+}
+
+func TestDiffIDParts(t *testing.T) {
+	tests := []struct {
+		id        DiffID
+		algorithm string
+		hex       string
+	}{
+		{id: "sha256:" + testHex, algorithm: "sha256", hex: testHex},
+		{id: "sha512:abc", algorithm: "sha512", hex: "abc"},
+		{id: testHex, algorithm: "", hex: testHex},
+		{id: "", algorithm: "", hex: ""},
+	}
+	for _, tt := range tests {
+		if got := tt.id.Algorithm(); got != tt.algorithm {
+			t.Errorf("Algorithm(%q) = %q, want %q", tt.id, got, tt.algorithm)
+		}
+		if got := tt.id.Hex(); got != tt.hex {
+			t.Errorf("Hex(%q) = %q, want %q", tt.id, got, tt.hex)
+		}
+	}
+}
+
+func TestDiffIDValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		id    DiffID
+		valid bool
+	}{
+		{name: "sha256", id: "sha256:" + testHex, valid: true},
+		{name: "truncated", id: DiffID("sha256:" + testHex[:63])},
+		{name: "too long", id: DiffID("sha256:" + testHex + "0")},
+		{name: "wrong algorithm", id: DiffID("md5:" + testHex)},
+		{name: "no algorithm", id: DiffID(testHex)},
+		{name: "non hex", id: DiffID("sha256:" + testHex[:63] + "g")},
+		{name: "upper case hex", id: DiffID("sha256:" + strings.ToUpper(testHex))},
+		{name: "empty", id: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.id.Validate(); (err == nil) != tt.valid {
+				t.Errorf("Validate(%q) = %v, want valid %t", tt.id, err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestImageRootFSDiffIDStrings(t *testing.T) {
+	img, err := NewFromJSON([]byte(`{"rootfs":{"type":"layers","diff_ids":["sha256:` + testHex + `","sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the exported field is the accessor
+	rootfs := img.RootFS
+	want := []string{"sha256:" + testHex, "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"}
+	if got := rootfs.DiffIDStrings(); !reflect.DeepEqual(got, want) || rootfs.Type != "layers" {
+		t.Errorf("DiffIDStrings() = %v of %s rootfs, want %v", got, rootfs.Type, want)
+	}
+
+	if got := (&ImageRootFS{Type: "layers"}).DiffIDStrings(); got == nil || len(got) != 0 {
+		t.Errorf("DiffIDStrings() without layers = %#v, want an empty slice", got)
+	}
+	var none *ImageRootFS
+	if got := none.DiffIDStrings(); got != nil {
+		t.Errorf("DiffIDStrings() of a nil rootfs = %v, want nil", got)
+	}
+}
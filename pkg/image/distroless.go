@@ -0,0 +1,123 @@
+package image
+
+import (
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/wagoodman/dive/filetree"
+)
+
+// labelBaseName is the OCI annotation naming the base image
+const labelBaseName = "org.opencontainers.image.base.name"
+
+var (
+	// packageManagers are the commands whose use in the history shows the image has a distro
+	packageManagers = []string{"apt-get", "apt ", "apk ", "yum ", "dnf ", "microdnf "}
+	// shells are the binaries distroless images don't have
+	shells = []string{"sh", "bash"}
+	// baseImageArgs are the build args commonly used for the base image of FROM
+	baseImageArgs = []string{"BASE_IMAGE", "BASEIMAGE", "BASE", "FROM_IMAGE", "BUILDER_IMAGE", "RUNTIME_IMAGE"}
+)
+
+// IsDistroless returns true if the config and history look like a distroless
+// image: a linux image with no SHELL set that never ran a package manager.
+// Use Tar.IsDistroless to also check the layers have no shell.
+func (img *Image) IsDistroless() bool {
+	if img.OS != "linux" {
+		return false
+	}
+	if img.Config != nil && len(img.Config.Shell) > 0 {
+		return false
+	}
+	for _, h := range img.History {
+		createdBy := h.CreatedBy + " "
+		for _, pm := range packageManagers {
+			if strings.Contains(createdBy, pm) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// IsDistroless is Image.IsDistroless also requiring that no bin directory of
+// the merged layers has a sh or bash
+func (i *Tar) IsDistroless() bool {
+	if i.Config == nil || !i.Config.IsDistroless() {
+		return false
+	}
+	merged, err := i.Flatten()
+	if err != nil {
+		return false
+	}
+
+	hasShell := false
+	merged.Walk(func(node *filetree.FileNode) error {
+		p := node.Path()
+		if path.Base(path.Dir(p)) != "bin" || FileIsDir(node) {
+			return nil
+		}
+		for _, shell := range shells {
+			if path.Base(p) == shell {
+				hasShell = true
+			}
+		}
+		return nil
+	})
+	return !hasShell
+}
+
+// BaseImage returns the name of the image this one was built from when it is
+// known, from the org.opencontainers.image.base.name label or else from a
+// base image build arg (BASE_IMAGE, BASE, ...) recorded in the history
+func (img *Image) BaseImage() string {
+	if name, ok := img.Label(labelBaseName); ok && len(name) > 0 {
+		return name
+	}
+
+	for _, h := range img.History {
+		args := buildArgs(h.CreatedBy)
+		for _, key := range baseImageArgs {
+			if value, ok := args[key]; ok && len(value) > 0 {
+				return value
+			}
+		}
+	}
+	return ""
+}
+
+// buildArgs returns the build args set by an ARG history entry or
+// recorded in the "|N KEY=VALUE ..." prefix of a RUN entry
+func buildArgs(createdBy string) map[string]string {
+	args := make(map[string]string)
+	createdBy = strings.TrimSpace(createdBy)
+
+	if strings.HasPrefix(createdBy, "|") {
+		fields := strings.Fields(createdBy)
+		count, err := strconv.Atoi(strings.TrimPrefix(fields[0], "|"))
+		if err != nil {
+			return args
+		}
+		for idx := 1; idx <= count && idx < len(fields); idx++ {
+			setArg(args, fields[idx])
+		}
+		return args
+	}
+
+	createdBy = strings.TrimSpace(strings.TrimPrefix(createdBy, shellPrefix))
+	createdBy = strings.TrimSpace(strings.TrimPrefix(createdBy, nopPrefix))
+	fields := strings.Fields(createdBy)
+	if len(fields) > 1 && strings.ToUpper(fields[0]) == "ARG" {
+		for _, field := range fields[1:] {
+			setArg(args, field)
+		}
+	}
+	return args
+}
+
+func setArg(args map[string]string, kv string) {
+	if idx := strings.Index(kv, "="); idx > 0 {
+		args[strings.ToUpper(kv[:idx])] = strings.Trim(kv[idx+1:], `"'`)
+	}
+}
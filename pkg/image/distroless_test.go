@@ -0,0 +1,137 @@
+package image
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// distrolessImage looks like gcr.io/distroless/static with an app copied on top
+func distrolessImage() *Image {
+	return &Image{
+		OS:           "linux",
+		Architecture: "amd64",
+		Config:       &container.Config{Entrypoint: []string{"/app"}, User: "65532"},
+		History: []HistoryEntry{
+			{CreatedBy: "bazel build ...", Author: "Bazel"},
+			{CreatedBy: "COPY /src/app /app # buildkit", Comment: "buildkit.dockerfile.v0"},
+		},
+		RootFS: &ImageRootFS{Type: "layers", DiffIDs: []DiffID{"sha256:" + testHex, "sha256:" + testHex}},
+	}
+}
+
+// ubuntuImage is an app installed with apt-get on top of ubuntu
+func ubuntuImage() *Image {
+	return &Image{
+		OS:           "linux",
+		Architecture: "amd64",
+		Config:       &container.Config{Cmd: []string{"/bin/bash"}},
+		History: []HistoryEntry{
+			{CreatedBy: "/bin/sh -c #(nop) ADD file:4f15c4475fbafb3fe335ae4e4e1ed9fc2a1a898a1e1b2c3f4d5e6f7a8b9c0d1e in / "},
+			{CreatedBy: "/bin/sh -c #(nop)  CMD [\"/bin/bash\"]", EmptyLayer: true},
+			{CreatedBy: "|1 BASE_IMAGE=ubuntu:20.04 /bin/sh -c apt-get update && apt-get install -y curl"},
+		},
+		RootFS: &ImageRootFS{Type: "layers", DiffIDs: []DiffID{"sha256:" + testHex, "sha256:" + testHex}},
+	}
+}
+
+func TestImageIsDistroless(t *testing.T) {
+	tests := []struct {
+		name string
+		img  func() *Image
+		want bool
+	}{
+		{name: "distroless", img: distrolessImage, want: true},
+		{name: "ubuntu", img: ubuntuImage, want: false},
+		{name: "no config", img: func() *Image { img := distrolessImage(); img.Config = nil; return img }, want: true},
+		{name: "windows", img: func() *Image { img := distrolessImage(); img.OS = "windows"; return img }, want: false},
+		{name: "shell", img: func() *Image { img := distrolessImage(); img.Config.Shell = []string{"/bin/sh", "-c"}; return img }, want: false},
+		{name: "apk", img: func() *Image {
+			img := distrolessImage()
+			img.History = append(img.History, HistoryEntry{CreatedBy: "RUN /bin/sh -c apk add --no-cache ca-certificates # buildkit"})
+			return img
+		}, want: false},
+		{name: "yum at the end", img: func() *Image {
+			img := distrolessImage()
+			img.History = append(img.History, HistoryEntry{CreatedBy: "/bin/sh -c yum"})
+			return img
+		}, want: false},
+		// words merely starting like a package manager are not one
+		{name: "apkg tool", img: func() *Image {
+			img := distrolessImage()
+			img.History = append(img.History, HistoryEntry{CreatedBy: "COPY apkg /usr/bin/apkg # buildkit"})
+			return img
+		}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.img().IsDistroless(); got != tt.want {
+				t.Errorf("IsDistroless() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTarIsDistroless(t *testing.T) {
+	distroless := newTestLayer(t, 0, dir("etc"), regular("etc/passwd", 100), dir("usr/bin"), regular("usr/bin/shasum", 10))
+	app := newTestLayer(t, 1, regular("app", 4096))
+	ubuntu := newTestLayer(t, 0, dir("bin"), regular("bin/bash", 1000), symlink("bin/sh", "bash"), regular("usr/bin/apt-get", 100))
+
+	tests := []struct {
+		name   string
+		img    *Image
+		layers []Layer
+		want   bool
+	}{
+		{name: "distroless", img: distrolessImage(), layers: []Layer{distroless, app}, want: true},
+		{name: "ubuntu", img: ubuntuImage(), layers: []Layer{ubuntu, app}, want: false},
+		// the config looks distroless but a layer adds a shell
+		{name: "distroless config with a shell", img: distrolessImage(), layers: []Layer{ubuntu, app}, want: false},
+		{name: "shell in a deeper bin", img: distrolessImage(), layers: []Layer{distroless, newTestLayer(t, 1, regular("usr/local/bin/sh", 10))}, want: false},
+		{name: "shell deleted", img: distrolessImage(), layers: []Layer{ubuntu, newTestLayer(t, 1, regular("bin/.wh.bash", 0), regular("bin/.wh.sh", 0))}, want: true},
+		{name: "no config", layers: []Layer{distroless, app}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := &Tar{Layers: tt.layers}
+			if tt.img != nil {
+				if err := i.AttachImage(tt.img); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := i.IsDistroless(); got != tt.want {
+				t.Errorf("IsDistroless() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImageBaseImage(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		history []string
+		want    string
+	}{
+		{name: "ubuntu run args", history: []string{"/bin/sh -c #(nop) ADD file:abc in / ", "|1 BASE_IMAGE=ubuntu:20.04 /bin/sh -c apt-get update"}, want: "ubuntu:20.04"},
+		{name: "arg entry", history: []string{"/bin/sh -c #(nop)  ARG base=\"golang:1.15-alpine\""}, want: "golang:1.15-alpine"},
+		{name: "buildkit arg", history: []string{"ARG RUNTIME_IMAGE=gcr.io/distroless/static"}, want: "gcr.io/distroless/static"},
+		{name: "first arg wins", history: []string{"|2 FROM_IMAGE=alpine:3.12 VERSION=1 /bin/sh -c make", "|1 BASE=debian /bin/sh -c make"}, want: "alpine:3.12"},
+		{name: "args after the count are the command", history: []string{"|1 VERSION=1 /bin/sh -c BASE=debian make"}, want: ""},
+		{name: "empty arg", history: []string{"ARG BASE_IMAGE="}, want: ""},
+		{name: "label wins", labels: map[string]string{labelBaseName: "docker.io/library/ubuntu:20.04"}, history: []string{"ARG BASE_IMAGE=debian"}, want: "docker.io/library/ubuntu:20.04"},
+		{name: "no base", history: []string{"bazel build ..."}, want: ""},
+		{name: "invalid count", history: []string{"|x BASE_IMAGE=ubuntu /bin/sh -c make"}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := &Image{Config: &container.Config{Labels: tt.labels}}
+			for _, createdBy := range tt.history {
+				img.History = append(img.History, HistoryEntry{CreatedBy: createdBy})
+			}
+			if got := img.BaseImage(); got != tt.want {
+				t.Errorf("BaseImage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
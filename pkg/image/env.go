@@ -0,0 +1,26 @@
+package image
+
+import "strings"
+
+// Env returns the image's environment variables keyed by name. Entries
+// without a "=" get an empty value and later definitions of a key win.
+func (img *Image) Env() map[string]string {
+	env := make(map[string]string)
+	if img.Config == nil {
+		return env
+	}
+	for _, kv := range img.Config.Env {
+		if idx := strings.Index(kv, "="); idx >= 0 {
+			env[kv[:idx]] = kv[idx+1:]
+		} else {
+			env[kv] = ""
+		}
+	}
+	return env
+}
+
+// EnvVar returns the value of the environment variable key
+func (img *Image) EnvVar(key string) (string, bool) {
+	value, ok := img.Env()[key]
+	return value, ok
+}
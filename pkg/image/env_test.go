@@ -0,0 +1,84 @@
+package image
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestImageEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		env  []string
+		want map[string]string
+	}{
+		{
+			name: "key value",
+			env:  []string{"PATH=/usr/local/bin:/usr/bin", "LANG=C.UTF-8"},
+			want: map[string]string{"PATH": "/usr/local/bin:/usr/bin", "LANG": "C.UTF-8"},
+		},
+		{
+			name: "key without value",
+			env:  []string{"DEBUG", "EMPTY="},
+			want: map[string]string{"DEBUG": "", "EMPTY": ""},
+		},
+		{
+			name: "equals in value",
+			env:  []string{"OPTS=-Dfoo=bar -Dbaz=qux", "URL=http://host/?a=b"},
+			want: map[string]string{"OPTS": "-Dfoo=bar -Dbaz=qux", "URL": "http://host/?a=b"},
+		},
+		{
+			name: "last definition wins",
+			env:  []string{"VERSION=1", "OTHER=x", "VERSION=2"},
+			want: map[string]string{"VERSION": "2", "OTHER": "x"},
+		},
+		{
+			name: "empty",
+			env:  []string{},
+			want: map[string]string{},
+		},
+		{
+			name: "nil",
+			want: map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := &Image{Config: &container.Config{Env: tt.env}}
+			if got := img.Env(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Env() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImageEnvNoConfig(t *testing.T) {
+	img := &Image{}
+	if env := img.Env(); env == nil || len(env) != 0 {
+		t.Errorf("Env() = %#v, want an empty map", env)
+	}
+	if value, ok := img.EnvVar("PATH"); ok || value != "" {
+		t.Errorf("EnvVar() = %q, %t", value, ok)
+	}
+}
+
+func TestImageEnvVar(t *testing.T) {
+	img := &Image{Config: &container.Config{Env: []string{"HOME=/root", "DEBUG", "JAVA_OPTS=-Xmx=1g", "HOME=/home/app"}}}
+	tests := []struct {
+		key   string
+		value string
+		ok    bool
+	}{
+		{key: "HOME", value: "/home/app", ok: true},
+		{key: "DEBUG", value: "", ok: true},
+		{key: "JAVA_OPTS", value: "-Xmx=1g", ok: true},
+		{key: "MISSING", value: "", ok: false},
+		{key: "home", value: "", ok: false},
+	}
+	for _, tt := range tests {
+		if value, ok := img.EnvVar(tt.key); value != tt.value || ok != tt.ok {
+			t.Errorf("EnvVar(%q) = %q, %t, want %q, %t", tt.key, value, ok, tt.value, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package image
+
+import (
+	"archive/tar"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/wagoodman/dive/filetree"
+)
+
+// paxXattr prefixes the PAX records holding extended attributes
+const paxXattr = "SCHILY.xattr."
+
+// File is the metadata of a layer entry as recorded in its tar header.
+//
+// The filetree nodes returned by Layer.Tree only keep what dive's FileInfo
+// has (path, type, link target, size, mode, uid and gid). Callers that need
+// the device numbers or xattrs to extract a layer correctly should read the
+// layer tar and use FileFromTarHeader.
+//
+// FileFromNode converts a node for code moving from FileSize, FileMode and
+// FileIsDir to File. Devmajor, Devminor and Xattrs are left empty.
+type File struct {
+	Name     string
+	Typeflag byte
+	Size     int64
+	Mode     os.FileMode
+	ModTime  time.Time
+	UID      int
+	GID      int
+	Linkname string // target of symlinks and hardlinks
+	Devmajor int64
+	Devminor int64
+	Xattrs   map[string]string
+}
+
+// FileFromTarHeader returns the File described by hdr
+func FileFromTarHeader(hdr *tar.Header) File {
+	f := File{
+		Name:     hdr.Name,
+		Typeflag: hdr.Typeflag,
+		Size:     hdr.Size,
+		Mode:     hdr.FileInfo().Mode(),
+		ModTime:  hdr.ModTime,
+		UID:      hdr.Uid,
+		GID:      hdr.Gid,
+		Linkname: hdr.Linkname,
+		Devmajor: hdr.Devmajor,
+		Devminor: hdr.Devminor,
+	}
+	for k, v := range hdr.Xattrs {
+		f.setXattr(k, v)
+	}
+	for k, v := range hdr.PAXRecords {
+		if strings.HasPrefix(k, paxXattr) {
+			f.setXattr(strings.TrimPrefix(k, paxXattr), v)
+		}
+	}
+	return f
+}
+
+// FileFromNode returns the File of a filetree node, the tree does not record
+// modification times, device numbers or xattrs
+func FileFromNode(node *filetree.FileNode) File {
+	info := node.Data.FileInfo
+	return File{
+		Name:     info.Path,
+		Typeflag: info.TypeFlag,
+		Size:     info.Size,
+		Mode:     info.Mode,
+		UID:      info.Uid,
+		GID:      info.Gid,
+		Linkname: info.Linkname,
+	}
+}
+
+func (f *File) setXattr(k, v string) {
+	if f.Xattrs == nil {
+		f.Xattrs = make(map[string]string)
+	}
+	f.Xattrs[k] = v
+}
+
+// IsDir returns true for directories
+func (f File) IsDir() bool {
+	return f.Typeflag == tar.TypeDir
+}
+
+// IsSymlink returns true for symbolic links
+func (f File) IsSymlink() bool {
+	return f.Typeflag == tar.TypeSymlink
+}
+
+// IsHardlink returns true for hardlinks to another entry of the layer
+func (f File) IsHardlink() bool {
+	return f.Typeflag == tar.TypeLink
+}
+
+// IsDevice returns true for character and block devices
+func (f File) IsDevice() bool {
+	return f.Typeflag == tar.TypeChar || f.Typeflag == tar.TypeBlock
+}
+
+// IsWhiteout returns true if the entry marks a file deleted from a lower layer
+func (f File) IsWhiteout() bool {
+	return IsWhiteout(f.Name)
+}
+
+// IsOpaqueWhiteout returns true if the entry marks its directory as opaque
+func (f File) IsOpaqueWhiteout() bool {
+	return IsOpaqueWhiteout(f.Name)
+}
+
+// WhiteoutTarget returns the path the whiteout deletes or an empty string
+func (f File) WhiteoutTarget() string {
+	return WhiteoutTarget(f.Name)
+}
+
+// FileSize returns the size of the file or 0 for a nil node
+func FileSize(node *filetree.FileNode) int64 {
+	if node == nil {
+		return 0
+	}
+	return node.Data.FileInfo.Size
+}
+
+// FileMode returns the mode of the file or 0 for a nil node
+func FileMode(node *filetree.FileNode) os.FileMode {
+	if node == nil {
+		return 0
+	}
+	return node.Data.FileInfo.Mode
+}
+
+// FileIsDir returns true for directory entries and for the parent directories
+// the filetree creates implicitly for entries without their own tar header
+func FileIsDir(node *filetree.FileNode) bool {
+	return node != nil && (node.Data.FileInfo.IsDir || len(node.Children) > 0)
+}
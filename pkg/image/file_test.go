@@ -0,0 +1,131 @@
+package image
+
+import (
+	"archive/tar"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/wagoodman/dive/filetree"
+)
+
+func TestFileFromTarHeader(t *testing.T) {
+	mtime := time.Unix(1600000000, 0)
+	tests := []struct {
+		name string
+		hdr  *tar.Header
+		want File
+	}{
+		{
+			name: "regular",
+			hdr:  &tar.Header{Name: "etc/passwd", Typeflag: tar.TypeReg, Size: 42, Mode: 0644, ModTime: mtime, Uid: 1000, Gid: 100},
+			want: File{Name: "etc/passwd", Typeflag: tar.TypeReg, Size: 42, Mode: 0644, ModTime: mtime, UID: 1000, GID: 100},
+		},
+		{
+			name: "symlink",
+			hdr:  &tar.Header{Name: "bin/sh", Typeflag: tar.TypeSymlink, Linkname: "busybox", Mode: 0777},
+			want: File{Name: "bin/sh", Typeflag: tar.TypeSymlink, Linkname: "busybox", Mode: os.ModeSymlink | 0777},
+		},
+		{
+			name: "device",
+			hdr:  &tar.Header{Name: "dev/null", Typeflag: tar.TypeChar, Devmajor: 1, Devminor: 3, Mode: 0666},
+			want: File{Name: "dev/null", Typeflag: tar.TypeChar, Devmajor: 1, Devminor: 3, Mode: os.ModeDevice | os.ModeCharDevice | 0666},
+		},
+		{
+			name: "xattrs",
+			hdr: &tar.Header{
+				Name:       "usr/bin/ping",
+				Typeflag:   tar.TypeReg,
+				Mode:       0755,
+				PAXRecords: map[string]string{"SCHILY.xattr.security.capability": "cap", "comment": "ignored"},
+			},
+			want: File{Name: "usr/bin/ping", Typeflag: tar.TypeReg, Mode: 0755, Xattrs: map[string]string{"security.capability": "cap"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FileFromTarHeader(tt.hdr); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FileFromTarHeader() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileKinds(t *testing.T) {
+	tests := []struct {
+		file                               File
+		dir, symlink, hardlink, device, wh bool
+		target                             string
+	}{
+		{file: File{Name: "etc/", Typeflag: tar.TypeDir}, dir: true},
+		{file: File{Name: "bin/sh", Typeflag: tar.TypeSymlink}, symlink: true},
+		{file: File{Name: "bin/ls", Typeflag: tar.TypeLink}, hardlink: true},
+		{file: File{Name: "dev/sda", Typeflag: tar.TypeBlock}, device: true},
+		{file: File{Name: "etc/.wh.motd", Typeflag: tar.TypeReg}, wh: true, target: "etc/motd"},
+		{file: File{Name: "var/.wh..wh..opq", Typeflag: tar.TypeReg}, wh: true, target: "var"},
+	}
+	for _, tt := range tests {
+		f := tt.file
+		if f.IsDir() != tt.dir || f.IsSymlink() != tt.symlink || f.IsHardlink() != tt.hardlink || f.IsDevice() != tt.device {
+			t.Errorf("%s: kinds = %t %t %t %t", f.Name, f.IsDir(), f.IsSymlink(), f.IsHardlink(), f.IsDevice())
+		}
+		if f.IsWhiteout() != tt.wh {
+			t.Errorf("%s: IsWhiteout() = %t, want %t", f.Name, f.IsWhiteout(), tt.wh)
+		}
+		if got := f.WhiteoutTarget(); got != tt.target {
+			t.Errorf("%s: WhiteoutTarget() = %q, want %q", f.Name, got, tt.target)
+		}
+	}
+}
+
+func TestFileFromNode(t *testing.T) {
+	node := &filetree.FileNode{Data: filetree.NodeData{FileInfo: filetree.FileInfo{
+		Path: "bin/sh", TypeFlag: tar.TypeSymlink, Linkname: "busybox", Size: 0, Mode: os.ModeSymlink | 0777, Uid: 0, Gid: 0,
+	}}}
+	want := File{Name: "bin/sh", Typeflag: tar.TypeSymlink, Linkname: "busybox", Mode: os.ModeSymlink | 0777}
+	if got := FileFromNode(node); !reflect.DeepEqual(got, want) {
+		t.Errorf("FileFromNode() = %+v, want %+v", got, want)
+	}
+}
+
+func TestFileAccessors(t *testing.T) {
+	l := newTestLayer(t, 0,
+		dir("bin"),
+		regular("bin/busybox", 1024),
+		symlink("bin/sh", "busybox"),
+		regular("usr/lib/libc.so", 512),
+	)
+	tests := []struct {
+		path  string
+		size  int64
+		mode  os.FileMode
+		isDir bool
+	}{
+		{path: "/bin", mode: os.ModeDir | 0755, isDir: true},
+		{path: "/bin/busybox", size: 1024, mode: 0644},
+		{path: "/bin/sh", mode: os.ModeSymlink | 0777},
+		// parents without their own tar header are still directories
+		{path: "/usr/lib", isDir: true},
+		{path: "/usr/lib/libc.so", size: 512, mode: 0644},
+	}
+	for _, tt := range tests {
+		node, ok := l.FileByPath(tt.path)
+		if !ok {
+			t.Fatalf("FileByPath(%q) not found", tt.path)
+		}
+		if got := FileSize(node); got != tt.size {
+			t.Errorf("FileSize(%s) = %d, want %d", tt.path, got, tt.size)
+		}
+		if got := FileMode(node); got != tt.mode {
+			t.Errorf("FileMode(%s) = %v, want %v", tt.path, got, tt.mode)
+		}
+		if got := FileIsDir(node); got != tt.isDir {
+			t.Errorf("FileIsDir(%s) = %t, want %t", tt.path, got, tt.isDir)
+		}
+	}
+
+	if FileSize(nil) != 0 || FileMode(nil) != 0 || FileIsDir(nil) {
+		t.Errorf("nil node = %d, %v, %t, want zero values", FileSize(nil), FileMode(nil), FileIsDir(nil))
+	}
+}
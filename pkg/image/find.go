@@ -0,0 +1,62 @@
+package image
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/wagoodman/dive/filetree"
+)
+
+// regexPrefix marks a FindFiles pattern as a regular expression
+const regexPrefix = "re:"
+
+// ErrInvalidPattern is returned when a FindFiles pattern does not compile
+var ErrInvalidPattern = errors.New("invalid pattern")
+
+// compileMatcher returns a function matching file paths against pattern.
+// Patterns prefixed with "re:" are regular expressions matched against the full path,
+// any other pattern is a glob matched against the full path when it contains
+// a "/" (with or without the leading slash) or else against the file name.
+func compileMatcher(pattern string) (func(p string) bool, error) {
+	if strings.HasPrefix(pattern, regexPrefix) {
+		re, err := regexp.Compile(strings.TrimPrefix(pattern, regexPrefix))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPattern, err)
+		}
+		return re.MatchString, nil
+	}
+
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPattern, err)
+	}
+	if strings.Contains(pattern, "/") {
+		pattern = strings.TrimPrefix(pattern, "/")
+		return func(p string) bool {
+			matched, _ := path.Match(pattern, strings.TrimPrefix(p, "/"))
+			return matched
+		}, nil
+	}
+	return func(p string) bool {
+		matched, _ := path.Match(pattern, path.Base(p))
+		return matched
+	}, nil
+}
+
+func findFiles(layer Layer, pattern string) ([]*filetree.FileNode, error) {
+	match, err := compileMatcher(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []*filetree.FileNode
+	err = layer.Walk(func(node *filetree.FileNode) error {
+		if !node.IsWhiteout() && match(node.Path()) {
+			found = append(found, node)
+		}
+		return nil
+	})
+	return found, err
+}
@@ -0,0 +1,73 @@
+package image
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestLayerFindFiles(t *testing.T) {
+	l := newTestLayer(t, 0,
+		dir("etc"),
+		regular("etc/passwd", 10),
+		regular("etc/shadow", 10),
+		regular("etc/ssl/private/server.key", 10),
+		regular("root/.ssh/id_rsa", 10),
+		regular("app/config/.env", 10),
+		regular("app/.env.production", 10),
+		regular("app/.wh.old.key", 0),
+	)
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{pattern: "*.key", want: []string{"/etc/ssl/private/server.key"}},
+		{pattern: "id_*", want: []string{"/root/.ssh/id_rsa"}},
+		{pattern: ".env*", want: []string{"/app/.env.production", "/app/config/.env"}},
+		{pattern: "passw?", want: []string{"/etc/passwd"}},
+		{pattern: "[ps][ah]*", want: []string{"/etc/passwd", "/etc/shadow"}},
+		{pattern: "/etc/*", want: []string{"/etc/passwd", "/etc/shadow", "/etc/ssl"}},
+		{pattern: "etc/*", want: []string{"/etc/passwd", "/etc/shadow", "/etc/ssl"}},
+		{pattern: "/etc/*/*/*.key", want: []string{"/etc/ssl/private/server.key"}},
+		{pattern: "shadow", want: []string{"/etc/shadow"}},
+		{pattern: "re:\\.(key|pem)$", want: []string{"/etc/ssl/private/server.key"}},
+		{pattern: "re:^/root/", want: []string{"/root/.ssh", "/root/.ssh/id_rsa"}},
+		{pattern: "re:/\\.env", want: []string{"/app/.env.production", "/app/config/.env"}},
+		{pattern: "*.old"},
+		{pattern: "re:nomatch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			found, err := l.FindFiles(tt.pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := paths(found); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindFiles(%q) = %v, want %v", tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLayerFindFilesInvalidPattern(t *testing.T) {
+	l := newTestLayer(t, 0, regular("etc/passwd", 10))
+	for _, pattern := range []string{"[", "etc/[a-", "re:(", "re:[z-a]"} {
+		if _, err := l.FindFiles(pattern); !errors.Is(err, ErrInvalidPattern) {
+			t.Errorf("FindFiles(%q) = %v, want ErrInvalidPattern", pattern, err)
+		}
+	}
+}
+
+// BenchmarkFindFiles matches patterns against a 50,000 file layer
+func BenchmarkFindFiles(b *testing.B) {
+	l := benchmarkLayer(b, 50000)
+	for _, pattern := range []string{"file0000*", "/usr/share/dir01?/*", "re:file[0-9]+7$"} {
+		b.Run(pattern, func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				if _, err := l.FindFiles(pattern); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package image
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+// ErrConfigNotFound is returned when the tarball has no entry at the config path
+var ErrConfigNotFound = errors.New("image config not found in tarball")
+
+// NewFromTar reads the image config at configPath (e.g. <hex>.json) of the
+// docker save tarball (optionally gzipped) at tarPath
+func NewFromTar(tarPath, configPath string) (*Image, error) {
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, err := NewFromTarReader(f, configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", tarPath, err)
+	}
+	return img, nil
+}
+
+// NewFromTarReader reads the tarball (optionally gzipped) from r up to the
+// entry at configPath and creates the Image from its json
+func NewFromTarReader(r io.Reader, configPath string) (*Image, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = br
+	}
+
+	want := path.Clean("/" + configPath)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%w: %s", ErrConfigNotFound, configPath)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if path.Clean("/"+hdr.Name) != want || hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		rawJSON, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		return NewFromJSON(rawJSON)
+	}
+}
@@ -0,0 +1,118 @@
+package image
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dockerSave is a docker save tarball of graboid/test:latest made of a
+// busybox layer and a layer adding /app/hello.txt
+const (
+	dockerSave       = "testdata/docker-save.tar"
+	dockerSaveConfig = "e556c36f0a55502c385ea6cb0f17514dca0025bb3c78fd53a46dfc3fe3d8d214.json"
+)
+
+func checkDockerSaveConfig(t *testing.T, img *Image) {
+	t.Helper()
+	if img.Architecture != "amd64" || img.OS != "linux" {
+		t.Errorf("platform = %s/%s, want linux/amd64", img.OS, img.Architecture)
+	}
+	if want := time.Date(2020, 9, 13, 12, 26, 40, 0, time.UTC); !img.Created.Equal(want) {
+		t.Errorf("Created = %v, want %v", img.Created, want)
+	}
+	if img.Config == nil || img.Config.WorkingDir != "/app" {
+		t.Errorf("Config = %+v, want WorkingDir /app", img.Config)
+	}
+	if len(img.History) != 3 || len(img.RootFS.DiffIDs) != 2 {
+		t.Errorf("got %d history entries and %d diff IDs, want 3 and 2", len(img.History), len(img.RootFS.DiffIDs))
+	}
+	if !bytes.Contains(img.RawJSON(), []byte(`"WorkingDir":"/app"`)) {
+		t.Errorf("RawJSON() = %s, want the config json", img.RawJSON())
+	}
+}
+
+func TestNewFromTar(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fromtar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	raw, err := ioutil.ReadFile(dockerSave)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(raw)
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	gzipped := filepath.Join(dir, "docker-save.tar.gz")
+	if err := ioutil.WriteFile(gzipped, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		tarPath    string
+		configPath string
+	}{
+		{name: "tar", tarPath: dockerSave, configPath: dockerSaveConfig},
+		{name: "gzipped", tarPath: gzipped, configPath: dockerSaveConfig},
+		{name: "dot slash", tarPath: dockerSave, configPath: "./" + dockerSaveConfig},
+		{name: "leading slash", tarPath: dockerSave, configPath: "/" + dockerSaveConfig},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := NewFromTar(tt.tarPath, tt.configPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkDockerSaveConfig(t, img)
+		})
+	}
+}
+
+func TestNewFromTarReader(t *testing.T) {
+	raw, err := ioutil.ReadFile(dockerSave)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := NewFromTarReader(bytes.NewReader(raw), dockerSaveConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDockerSaveConfig(t, img)
+}
+
+func TestNewFromTarErrors(t *testing.T) {
+	if _, err := NewFromTar("testdata/missing.tar", dockerSaveConfig); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("NewFromTar() of a missing tarball error = %v, want %v", err, os.ErrNotExist)
+	}
+
+	// directories and layer metadata are not image configs
+	for _, configPath := range []string{"missing.json", "398cfa9b5a6793e6710051d9bfe678282142fbdda71af0ee4b9972351459c737"} {
+		_, err := NewFromTar(dockerSave, configPath)
+		if !errors.Is(err, ErrConfigNotFound) {
+			t.Errorf("NewFromTar(%q) error = %v, want %v", configPath, err, ErrConfigNotFound)
+		}
+		if err != nil && !strings.Contains(err.Error(), dockerSave) {
+			t.Errorf("NewFromTar(%q) error = %v, want the tarball path", configPath, err)
+		}
+	}
+
+	if _, err := NewFromTar(dockerSave, "repositories"); err == nil {
+		t.Error("NewFromTar() of a file that is not an image config succeeded")
+	}
+	if _, err := NewFromTarReader(strings.NewReader(strings.Repeat("not a tar", 100)), dockerSaveConfig); err == nil {
+		t.Error("NewFromTarReader() of something that is not a tar succeeded")
+	}
+}
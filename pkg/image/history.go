@@ -0,0 +1,109 @@
+package image
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	shellPrefix = "/bin/sh -c "
+	nopPrefix   = "#(nop) "
+	// buildKitSuffix is appended by BuildKit to RUN and COPY history entries
+	buildKitSuffix   = "# buildkit"
+	buildKitComment  = "buildkit.dockerfile.v0"
+	commandTypeShell = "RUN"
+)
+
+var dockerfileInstructions = []string{
+	"ADD", "ARG", "CMD", "COPY", "ENTRYPOINT", "ENV", "EXPOSE", "HEALTHCHECK",
+	"LABEL", "MAINTAINER", "ONBUILD", "RUN", "SHELL", "STOPSIGNAL", "USER",
+	"VOLUME", "WORKDIR",
+}
+
+// HistorySummary returns a copy of the image build history
+func (img *Image) HistorySummary() []HistoryEntry {
+	history := make([]HistoryEntry, len(img.History))
+	copy(history, img.History)
+	return history
+}
+
+// AddHistory appends entry to the image history keeping it sorted by creation time
+func (img *Image) AddHistory(entry HistoryEntry) {
+	img.History = append(img.History, entry)
+	sort.SliceStable(img.History, func(a, b int) bool {
+		return img.History[a].Created.Before(img.History[b].Created)
+	})
+	img.rawJSON = nil
+}
+
+// ClearHistory removes all the build history from the image
+func (img *Image) ClearHistory() {
+	img.History = nil
+	img.rawJSON = nil
+}
+
+// Duration returns the time between the history entry and the next one
+func (h HistoryEntry) Duration(next HistoryEntry) time.Duration {
+	return next.Created.Sub(h.Created)
+}
+
+// BuildDuration returns the time from the first to the last history entry
+func (img *Image) BuildDuration() time.Duration {
+	if len(img.History) < 2 {
+		return 0
+	}
+	return img.History[0].Duration(img.History[len(img.History)-1])
+}
+
+// SlowestStep returns the history entry that took the longest to build and
+// how long it took. An entry is created when its step finishes so a step
+// took the time since the previous entry, the first one can't be timed.
+func (img *Image) SlowestStep() (HistoryEntry, time.Duration) {
+	var (
+		slowest HistoryEntry
+		longest time.Duration
+	)
+	for idx := 1; idx < len(img.History); idx++ {
+		if d := img.History[idx-1].Duration(img.History[idx]); d > longest {
+			slowest, longest = img.History[idx], d
+		}
+	}
+	return slowest, longest
+}
+
+// IsBuildKit returns true if the history entry was created by BuildKit
+func (h HistoryEntry) IsBuildKit() bool {
+	return h.Comment == buildKitComment || strings.HasSuffix(strings.TrimSpace(h.CreatedBy), buildKitSuffix)
+}
+
+// CommandType returns the Dockerfile instruction (RUN, COPY, ENV, ...) that created the history entry
+func (h HistoryEntry) CommandType() string {
+	createdBy := strings.TrimSpace(h.CreatedBy)
+	if len(createdBy) == 0 {
+		return ""
+	}
+
+	// RUN steps with build args are prefixed by the arg count, e.g. "|1 FOO=bar /bin/sh -c ..."
+	if strings.HasPrefix(createdBy, "|") {
+		return commandTypeShell
+	}
+
+	if strings.HasPrefix(createdBy, shellPrefix) {
+		createdBy = strings.TrimSpace(strings.TrimPrefix(createdBy, shellPrefix))
+		if !strings.HasPrefix(createdBy, nopPrefix) {
+			return commandTypeShell
+		}
+		createdBy = strings.TrimSpace(strings.TrimPrefix(createdBy, nopPrefix))
+	}
+
+	// BuildKit and #(nop) entries start with the instruction itself
+	instruction := strings.ToUpper(strings.Fields(createdBy)[0])
+	for _, known := range dockerfileInstructions {
+		if instruction == known {
+			return known
+		}
+	}
+
+	return commandTypeShell
+}
@@ -0,0 +1,178 @@
+package image
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHistoryEntryCommandType(t *testing.T) {
+	tests := []struct {
+		createdBy string
+		want      string
+	}{
+		{createdBy: "/bin/sh -c #(nop) ADD file:1234 in / ", want: "ADD"},
+		{createdBy: "/bin/sh -c #(nop)  CMD [\"/bin/sh\"]", want: "CMD"},
+		{createdBy: "/bin/sh -c #(nop) COPY dir:abc in /app ", want: "COPY"},
+		{createdBy: "/bin/sh -c #(nop)  ENV PATH=/usr/local/bin:/usr/bin", want: "ENV"},
+		{createdBy: "/bin/sh -c #(nop)  LABEL maintainer=someone", want: "LABEL"},
+		{createdBy: "/bin/sh -c #(nop)  EXPOSE 80", want: "EXPOSE"},
+		{createdBy: "/bin/sh -c #(nop) WORKDIR /app", want: "WORKDIR"},
+		{createdBy: "/bin/sh -c #(nop)  ENTRYPOINT [\"nginx\"]", want: "ENTRYPOINT"},
+		{createdBy: "/bin/sh -c apt-get update && apt-get install -y curl", want: "RUN"},
+		{createdBy: "|2 VERSION=1.0 TARGET=x /bin/sh -c make", want: "RUN"},
+		{createdBy: "RUN /bin/sh -c apk add --no-cache git # buildkit", want: "RUN"},
+		{createdBy: "COPY /src /app # buildkit", want: "COPY"},
+		{createdBy: "ENV FOO=bar", want: "ENV"},
+		{createdBy: "make install", want: "RUN"},
+		{createdBy: "  ", want: ""},
+		{createdBy: "", want: ""},
+	}
+	for _, tt := range tests {
+		if got := (HistoryEntry{CreatedBy: tt.createdBy}).CommandType(); got != tt.want {
+			t.Errorf("CommandType(%q) = %q, want %q", tt.createdBy, got, tt.want)
+		}
+	}
+}
+
+func TestHistoryEntryIsBuildKit(t *testing.T) {
+	tests := []struct {
+		entry HistoryEntry
+		want  bool
+	}{
+		{entry: HistoryEntry{CreatedBy: "RUN /bin/sh -c make # buildkit"}, want: true},
+		{entry: HistoryEntry{CreatedBy: "COPY . /app # buildkit  "}, want: true},
+		{entry: HistoryEntry{CreatedBy: "ENV FOO=bar", Comment: "buildkit.dockerfile.v0"}, want: true},
+		{entry: HistoryEntry{CreatedBy: "/bin/sh -c make"}},
+		{entry: HistoryEntry{CreatedBy: "/bin/sh -c #(nop)  CMD [\"sh\"]"}},
+		{entry: HistoryEntry{CreatedBy: "/bin/sh -c echo buildkit"}},
+	}
+	for _, tt := range tests {
+		if got := tt.entry.IsBuildKit(); got != tt.want {
+			t.Errorf("IsBuildKit(%+v) = %t, want %t", tt.entry, got, tt.want)
+		}
+	}
+}
+
+func TestHistorySummaryIsACopy(t *testing.T) {
+	img := &Image{History: []HistoryEntry{{CreatedBy: "ADD rootfs /"}, {CreatedBy: "CMD sh"}}}
+	summary := img.HistorySummary()
+	if len(summary) != 2 || summary[1].CreatedBy != "CMD sh" {
+		t.Fatalf("HistorySummary() = %+v", summary)
+	}
+	summary[0].CreatedBy = "changed"
+	if img.History[0].CreatedBy != "ADD rootfs /" {
+		t.Error("modifying the summary changed the image history")
+	}
+	if got := (&Image{}).HistorySummary(); len(got) != 0 {
+		t.Errorf("HistorySummary() without history = %+v", got)
+	}
+}
+
+func TestImageAddHistory(t *testing.T) {
+	img, err := NewFromJSON([]byte(validConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := img.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	img.AddHistory(HistoryEntry{CreatedBy: "/bin/sh -c make", Created: base.Add(time.Hour)})
+	img.AddHistory(HistoryEntry{CreatedBy: "/bin/sh -c #(nop) ADD file:rootfs in /", Created: base})
+	img.AddHistory(HistoryEntry{CreatedBy: "/bin/sh -c make install", Created: base.Add(time.Hour)})
+
+	if img.RawJSON() != nil {
+		t.Error("AddHistory() kept the raw JSON")
+	}
+	var got []string
+	for _, entry := range img.History {
+		got = append(got, entry.CreatedBy)
+	}
+	want := []string{"/bin/sh -c #(nop) ADD file:rootfs in /", "/bin/sh -c make", "/bin/sh -c make install"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("History = %v, want %v sorted by creation keeping the order of equal times", got, want)
+	}
+
+	first, err := img.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(first, before) {
+		t.Error("MarshalJSON() returned the stale raw JSON")
+	}
+	second, err := img.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first, second) {
+		t.Errorf("MarshalJSON() is not consistent: %s, %s", first, second)
+	}
+	parsed, err := NewFromJSON(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed.History) != 3 || parsed.History[2].CreatedBy != "/bin/sh -c make install" {
+		t.Errorf("parsed history = %+v", parsed.History)
+	}
+}
+
+func TestImageClearHistory(t *testing.T) {
+	img, err := NewFromJSON([]byte(`{"rootfs": {"type": "layers"}, "history": [{"created_by": "/bin/sh -c make"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img.ClearHistory()
+	if len(img.History) != 0 || img.RawJSON() != nil {
+		t.Errorf("ClearHistory() left history %+v and raw JSON %s", img.History, img.RawJSON())
+	}
+	raw, err := img.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, []byte("make")) {
+		t.Errorf("MarshalJSON() after ClearHistory() = %s", raw)
+	}
+}
+
+func TestImageBuildDuration(t *testing.T) {
+	start := time.Date(2020, 9, 13, 12, 0, 0, 0, time.UTC)
+	img := &Image{History: []HistoryEntry{
+		{Created: start, CreatedBy: "/bin/sh -c #(nop) ADD file:abc in / "},
+		{Created: start.Add(2 * time.Second), CreatedBy: "/bin/sh -c #(nop)  ENV PATH=/usr/bin"},
+		{Created: start.Add(95 * time.Second), CreatedBy: "/bin/sh -c apt-get update && apt-get install -y curl"},
+		{Created: start.Add(125 * time.Second), CreatedBy: "/bin/sh -c #(nop) COPY dir:def in /app "},
+		{Created: start.Add(126 * time.Second), CreatedBy: "/bin/sh -c #(nop)  CMD [\"/app/run\"]", EmptyLayer: true},
+	}}
+
+	steps := []time.Duration{2 * time.Second, 93 * time.Second, 30 * time.Second, time.Second}
+	for idx, want := range steps {
+		if got := img.History[idx].Duration(img.History[idx+1]); got != want {
+			t.Errorf("Duration() of step %d = %s, want %s", idx+1, got, want)
+		}
+	}
+	if got := img.History[1].Duration(img.History[0]); got != -2*time.Second {
+		t.Errorf("Duration() to an earlier entry = %s, want -2s", got)
+	}
+
+	if got := img.BuildDuration(); got != 126*time.Second {
+		t.Errorf("BuildDuration() = %s, want 2m6s", got)
+	}
+	slowest, d := img.SlowestStep()
+	if !reflect.DeepEqual(slowest, img.History[2]) || d != 93*time.Second {
+		t.Errorf("SlowestStep() = %q, %s, want the apt-get step taking 1m33s", slowest.CreatedBy, d)
+	}
+
+	for _, history := range [][]HistoryEntry{nil, img.History[:1]} {
+		short := &Image{History: history}
+		if got := short.BuildDuration(); got != 0 {
+			t.Errorf("BuildDuration() of %d entries = %s, want 0", len(history), got)
+		}
+		if slowest, d := short.SlowestStep(); !reflect.DeepEqual(slowest, HistoryEntry{}) || d != 0 {
+			t.Errorf("SlowestStep() of %d entries = %+v, %s, want nothing", len(history), slowest, d)
+		}
+	}
+}
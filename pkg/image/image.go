@@ -49,7 +49,7 @@ func Parse(r io.Reader) (*Tar, error) {
 					if err != nil {
 						return nil, err
 					}
-					var manifests []Manifest
+					var manifests Manifests
 					if err := json.Unmarshal(rawJSON, &manifests); err != nil {
 						return nil, err
 					}
@@ -78,16 +78,20 @@ func Parse(r io.Reader) (*Tar, error) {
 
 	nonEmptyLayerIdx := 0 // TODO
 
-	for _, history := range i.Config.History {
+	for historyIdx, history := range i.Config.History {
 		if !history.EmptyLayer {
 			for _, tree := range i.RefTrees {
 				if strings.Contains(i.Manifest.Layers[nonEmptyLayerIdx], tree.Name) {
 					history.Size = tree.FileSize
+					i.Config.History[historyIdx].Size = tree.FileSize
 					i.Layers[nonEmptyLayerIdx] = &dockerLayer{
 						history: history,
 						index:   nonEmptyLayerIdx,
 						tree:    tree,
 						tarPath: i.Manifest.Layers[nonEmptyLayerIdx],
+						opaque:  i.opaque[tree],
+						// windows layers have case-insensitive paths
+						caseInsensitive: strings.EqualFold(i.Config.OS, "windows"),
 					}
 				}
 			}
@@ -108,6 +112,12 @@ func (i *Tar) processLayerTar(name string, layerIdx uint, reader io.Reader) erro
 	}
 
 	for _, element := range fileInfos {
+		if IsOpaqueWhiteout(element.Path) {
+			if i.opaque == nil {
+				i.opaque = make(map[*filetree.FileTree][]string)
+			}
+			i.opaque[tree] = append(i.opaque[tree], WhiteoutTarget(element.Path))
+		}
 		tree.FileSize += uint64(element.Size)
 
 		_, _, err := tree.AddPath(element.Path, element)
@@ -270,7 +280,7 @@ func (i *Tar) Nodes() []*widgets.TreeNode {
 					if child.Data.FileInfo.TypeFlag == tar.TypeSymlink || child.Data.FileInfo.TypeFlag == tar.TypeLink {
 						display += " → " + child.Data.FileInfo.Linkname
 					}
-					display += fmt.Sprintf(" (%s)", humanize.Bytes(uint64(child.Data.FileInfo.Size)))
+					display += fmt.Sprintf(" (%s)", humanize.Bytes(uint64(FileSize(child))))
 					treeNodes = append(treeNodes, &widgets.TreeNode{
 						Value: nodeValue(display),
 						// Nodes: child.Children,
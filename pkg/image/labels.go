@@ -0,0 +1,22 @@
+package image
+
+// Labels returns the image's labels merged over its OCI annotations.
+// The map is never nil.
+func (img *Image) Labels() map[string]string {
+	labels := make(map[string]string)
+	for key, value := range img.Annotations {
+		labels[key] = value
+	}
+	if img.Config != nil {
+		for key, value := range img.Config.Labels {
+			labels[key] = value
+		}
+	}
+	return labels
+}
+
+// Label returns the value of the label or annotation key
+func (img *Image) Label(key string) (string, bool) {
+	value, ok := img.Labels()[key]
+	return value, ok
+}
@@ -0,0 +1,93 @@
+package image
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestImageLabels(t *testing.T) {
+	tests := []struct {
+		name string
+		img  *Image
+		want map[string]string
+	}{
+		{
+			name: "nil config",
+			img:  &Image{},
+			want: map[string]string{},
+		},
+		{
+			name: "nil labels",
+			img:  &Image{Config: &container.Config{}},
+			want: map[string]string{},
+		},
+		{
+			name: "config labels",
+			img:  &Image{Config: &container.Config{Labels: map[string]string{"maintainer": "someone", "version": "1.0"}}},
+			want: map[string]string{"maintainer": "someone", "version": "1.0"},
+		},
+		{
+			name: "annotations without config",
+			img:  &Image{Annotations: map[string]string{"org.opencontainers.image.source": "https://github.com/blacktop/graboid"}},
+			want: map[string]string{"org.opencontainers.image.source": "https://github.com/blacktop/graboid"},
+		},
+		{
+			name: "labels win over annotations",
+			img: &Image{
+				Config: &container.Config{Labels: map[string]string{"org.opencontainers.image.version": "2.0"}},
+				Annotations: map[string]string{
+					"org.opencontainers.image.version": "1.0",
+					"org.opencontainers.image.title":   "graboid",
+				},
+			},
+			want: map[string]string{"org.opencontainers.image.version": "2.0", "org.opencontainers.image.title": "graboid"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.img.Labels()
+			if got == nil {
+				t.Fatal("Labels() = nil")
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Labels() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImageLabelsCopy(t *testing.T) {
+	img := &Image{Config: &container.Config{Labels: map[string]string{"version": "1.0"}}}
+	img.Labels()["version"] = "changed"
+	if value, _ := img.Label("version"); value != "1.0" {
+		t.Errorf("changing the Labels() map changed the image label to %q", value)
+	}
+}
+
+func TestImageLabel(t *testing.T) {
+	img := &Image{
+		Config:      &container.Config{Labels: map[string]string{"empty": "", "version": "2.0"}},
+		Annotations: map[string]string{"version": "1.0", "title": "graboid"},
+	}
+	tests := []struct {
+		key   string
+		value string
+		ok    bool
+	}{
+		{key: "version", value: "2.0", ok: true},
+		{key: "title", value: "graboid", ok: true},
+		{key: "empty", value: "", ok: true},
+		{key: "missing", value: "", ok: false},
+	}
+	for _, tt := range tests {
+		if value, ok := img.Label(tt.key); value != tt.value || ok != tt.ok {
+			t.Errorf("Label(%q) = %q, %t, want %q, %t", tt.key, value, ok, tt.value, tt.ok)
+		}
+	}
+
+	if value, ok := (&Image{}).Label("version"); ok || value != "" {
+		t.Errorf("Label() without config = %q, %t", value, ok)
+	}
+}
@@ -1,7 +1,10 @@
 package image
 
 import (
+	"archive/tar"
 	"fmt"
+	"path"
+	"sort"
 	"strings"
 
 	"github.com/dustin/go-humanize"
@@ -20,16 +23,29 @@ type Layer interface {
 	Index() int
 	Command() string
 	Size() uint64
+	TotalSize() int64
+	WhiteoutFiles() []File
+	FileByPath(path string) (*filetree.FileNode, bool)
+	Walk(fn WalkFunc) error
+	Diff(other Layer) LayerDiff
+	FindFiles(pattern string) ([]*filetree.FileNode, error)
 	Tree() *filetree.FileTree
+	ExportJSON() ([]byte, error)
 	String() string
 }
 
 // dockerLayer represents a Docker image layer and metadata
 type dockerLayer struct {
 	tarPath string
-	history imageHistory
+	history HistoryEntry
 	index   int
 	tree    *filetree.FileTree
+	// opaque lists the directories whose lower layer contents this layer hides
+	opaque []string
+
+	caseInsensitive bool
+	// files is a lazily built path index of tree, dropped whenever the tree is handed out by Tree
+	files map[string]*filetree.FileNode
 }
 
 func (dockerLayer *dockerLayer) TarID() string {
@@ -49,8 +65,110 @@ func (dockerLayer *dockerLayer) Size() uint64 {
 	return dockerLayer.history.Size
 }
 
-// Tree returns the file tree representing the current dockerLayer.
+// TotalSize returns the number of bytes the layer's files will use once extracted.
+// Whiteout entries delete files from lower layers so they add nothing.
+func (dockerLayer *dockerLayer) TotalSize() int64 {
+	var total int64
+	dockerLayer.tree.VisitDepthChildFirst(func(node *filetree.FileNode) error {
+		if !node.IsWhiteout() && !node.Data.FileInfo.IsDir {
+			total += FileSize(node)
+		}
+		return nil
+	}, nil)
+	return total
+}
+
+// WhiteoutFiles returns the whiteout entries of the layer followed by its
+// opaque whiteouts, which the filetree drops so they are rebuilt from opaque.
+func (dockerLayer *dockerLayer) WhiteoutFiles() []File {
+	var whiteouts []File
+	dockerLayer.tree.VisitDepthChildFirst(func(node *filetree.FileNode) error {
+		if node.IsWhiteout() {
+			whiteouts = append(whiteouts, FileFromNode(node))
+		}
+		return nil
+	}, nil)
+	for _, dir := range dockerLayer.opaque {
+		whiteouts = append(whiteouts, File{Name: path.Join(dir, opaqueWhiteout), Typeflag: tar.TypeReg})
+	}
+	return whiteouts
+}
+
+// FileByPath returns the file at path in the layer. The path is cleaned
+// before lookup so "etc/passwd", "/etc/./passwd" and "/etc/passwd" are the same.
+// The index is rebuilt after Tree was called as the tree may have been modified.
+func (dockerLayer *dockerLayer) FileByPath(path string) (*filetree.FileNode, bool) {
+	if dockerLayer.files == nil {
+		dockerLayer.indexFiles()
+	}
+	node, ok := dockerLayer.files[dockerLayer.normalizePath(path)]
+	if ok && !dockerLayer.inTree(node) {
+		// removed through a tree obtained before the index was built
+		dockerLayer.indexFiles()
+		node, ok = dockerLayer.files[dockerLayer.normalizePath(path)]
+	}
+	return node, ok
+}
+
+// inTree returns true if node is still attached to the layer's tree
+func (dockerLayer *dockerLayer) inTree(node *filetree.FileNode) bool {
+	for ; node.Parent != nil; node = node.Parent {
+		if node.Parent.Children[node.Name] != node {
+			return false
+		}
+	}
+	return node == dockerLayer.tree.Root
+}
+
+func (dockerLayer *dockerLayer) normalizePath(p string) string {
+	p = path.Clean("/" + p)
+	if dockerLayer.caseInsensitive {
+		p = strings.ToLower(p)
+	}
+	return p
+}
+
+func (dockerLayer *dockerLayer) indexFiles() {
+	dockerLayer.files = make(map[string]*filetree.FileNode, dockerLayer.tree.Size)
+	dockerLayer.tree.VisitDepthChildFirst(func(node *filetree.FileNode) error {
+		// whiteout paths are reported without their prefix so skip them
+		if !node.IsWhiteout() {
+			dockerLayer.files[dockerLayer.normalizePath(node.Path())] = node
+		}
+		return nil
+	}, nil)
+}
+
+// Walk visits every file in the layer starting from each root entry
+func (dockerLayer *dockerLayer) Walk(fn WalkFunc) error {
+	visited := make(map[*filetree.FileNode]bool)
+	var names []string
+	for name := range dockerLayer.tree.Root.Children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := walk(dockerLayer.tree.Root.Children[name], fn, visited); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Diff returns the files added, removed or modified in other relative to this layer
+func (dockerLayer *dockerLayer) Diff(other Layer) LayerDiff {
+	return diffLayers(dockerLayer, other)
+}
+
+// FindFiles returns the files whose path matches the glob or "re:" prefixed regex pattern
+func (dockerLayer *dockerLayer) FindFiles(pattern string) ([]*filetree.FileNode, error) {
+	return findFiles(dockerLayer, pattern)
+}
+
+// Tree returns the file tree representing the current dockerLayer. Callers
+// may modify it so the path index of FileByPath is dropped.
 func (dockerLayer *dockerLayer) Tree() *filetree.FileTree {
+	dockerLayer.files = nil
 	return dockerLayer.tree
 }
 
@@ -0,0 +1,138 @@
+package image
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"time"
+
+	"github.com/wagoodman/dive/filetree"
+)
+
+// SerializableFileInfo is the JSON form of a layer file's tar metadata. It implements os.FileInfo.
+type SerializableFileInfo struct {
+	Path      string      `json:"path"`
+	TypeFlag  byte        `json:"type"`
+	Linkname  string      `json:"linkname,omitempty"`
+	FileSize  int64       `json:"size"`
+	FileMode  os.FileMode `json:"mode"`
+	UID       int         `json:"uid"`
+	GID       int         `json:"gid"`
+	Directory bool        `json:"dir,omitempty"`
+}
+
+// NewSerializableFileInfo copies the metadata of a filetree FileInfo
+func NewSerializableFileInfo(info filetree.FileInfo) SerializableFileInfo {
+	return SerializableFileInfo{
+		Path:      info.Path,
+		TypeFlag:  info.TypeFlag,
+		Linkname:  info.Linkname,
+		FileSize:  info.Size,
+		FileMode:  info.Mode,
+		UID:       info.Uid,
+		GID:       info.Gid,
+		Directory: info.IsDir,
+	}
+}
+
+// Name returns the base name of the file
+func (fi SerializableFileInfo) Name() string { return path.Base(fi.Path) }
+
+// Size returns the size of the file in bytes
+func (fi SerializableFileInfo) Size() int64 { return fi.FileSize }
+
+// Mode returns the file mode bits
+func (fi SerializableFileInfo) Mode() os.FileMode { return fi.FileMode }
+
+// ModTime returns the zero time since layer trees do not record modification times
+func (fi SerializableFileInfo) ModTime() time.Time { return time.Time{} }
+
+// IsDir reports whether the file is a directory
+func (fi SerializableFileInfo) IsDir() bool { return fi.Directory || fi.TypeFlag == tar.TypeDir }
+
+// Sys returns nil
+func (fi SerializableFileInfo) Sys() interface{} { return nil }
+
+// FileInfo converts back to a filetree FileInfo. The content hash is not serialized
+// so content changes between a reloaded and a parsed layer are only seen through the size.
+func (fi SerializableFileInfo) FileInfo() filetree.FileInfo {
+	return filetree.FileInfo{
+		Path:     fi.Path,
+		TypeFlag: fi.TypeFlag,
+		Linkname: fi.Linkname,
+		Size:     fi.FileSize,
+		Mode:     fi.FileMode,
+		Uid:      fi.UID,
+		Gid:      fi.GID,
+		IsDir:    fi.Directory,
+	}
+}
+
+type layerJSON struct {
+	TarPath         string                 `json:"tar_path"`
+	Index           int                    `json:"index"`
+	History         HistoryEntry           `json:"history"`
+	CaseInsensitive bool                   `json:"case_insensitive,omitempty"`
+	TreeName        string                 `json:"tree_name,omitempty"`
+	FileSize        uint64                 `json:"file_size"`
+	Files           []SerializableFileInfo `json:"files"`
+	Opaque          []string               `json:"opaque,omitempty"`
+}
+
+// ExportJSON serializes the layer and the metadata of its files (not their contents)
+func (dockerLayer *dockerLayer) ExportJSON() ([]byte, error) {
+	lj := layerJSON{
+		TarPath:         dockerLayer.tarPath,
+		Index:           dockerLayer.index,
+		History:         dockerLayer.history,
+		CaseInsensitive: dockerLayer.caseInsensitive,
+		Files:           []SerializableFileInfo{},
+		Opaque:          dockerLayer.opaque,
+	}
+	if dockerLayer.tree != nil {
+		lj.TreeName = dockerLayer.tree.Name
+		lj.FileSize = dockerLayer.tree.FileSize
+		err := Walk(dockerLayer.tree.Root, func(node *filetree.FileNode) error {
+			// the root and implicitly created parent dirs have no tar entry
+			if node.Data.FileInfo.Path != "" {
+				lj.Files = append(lj.Files, NewSerializableFileInfo(node.Data.FileInfo))
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(lj)
+}
+
+// LayerFromJSON loads a layer serialized with ExportJSON
+func LayerFromJSON(data []byte) (Layer, error) {
+	var lj layerJSON
+	if err := json.Unmarshal(data, &lj); err != nil {
+		return nil, err
+	}
+	if lj.TarPath == "" {
+		return nil, errors.New("layer JSON has no tar_path")
+	}
+
+	tree := filetree.NewFileTree()
+	tree.Name = lj.TreeName
+	tree.FileSize = lj.FileSize
+	for _, fi := range lj.Files {
+		if _, _, err := tree.AddPath(fi.Path, fi.FileInfo()); err != nil {
+			return nil, err
+		}
+	}
+
+	return &dockerLayer{
+		tarPath:         lj.TarPath,
+		history:         lj.History,
+		index:           lj.Index,
+		tree:            tree,
+		opaque:          lj.Opaque,
+		caseInsensitive: lj.CaseInsensitive,
+	}, nil
+}
@@ -0,0 +1,106 @@
+package image
+
+import (
+	"archive/tar"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/wagoodman/dive/filetree"
+)
+
+// layerFiles returns the serializable metadata of every tar entry of the layer by path
+func layerFiles(t *testing.T, layer Layer) map[string]SerializableFileInfo {
+	t.Helper()
+	files := make(map[string]SerializableFileInfo)
+	err := Walk(layer.Tree().Root, func(node *filetree.FileNode) error {
+		if node.Data.FileInfo.Path != "" {
+			files[node.Path()] = NewSerializableFileInfo(node.Data.FileInfo)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestLayerJSONRoundTrip(t *testing.T) {
+	files := []filetree.FileInfo{
+		dir("etc"),
+		regular("etc/passwd", 1024),
+		{Path: "etc/shadow", TypeFlag: tar.TypeReg, Size: 512, Mode: 0640, Uid: 0, Gid: 42},
+		symlink("etc/localtime", "/usr/share/zoneinfo/UTC"),
+		dir("dev"),
+		{Path: "dev/null", TypeFlag: tar.TypeChar, Mode: os.ModeDevice | os.ModeCharDevice | 0666},
+		{Path: "dev/sda", TypeFlag: tar.TypeBlock, Mode: os.ModeDevice | 0660, Gid: 6},
+		{Path: "dev/initctl", TypeFlag: tar.TypeFifo, Mode: os.ModeNamedPipe | 0600},
+		{Path: "bin/sh", TypeFlag: tar.TypeLink, Linkname: "bin/busybox", Mode: 0755, Uid: 1000, Gid: 1000},
+		{Path: "var/.wh.cache", TypeFlag: tar.TypeReg},
+		{Path: "opt/.wh..wh..opq", TypeFlag: tar.TypeReg},
+	}
+	layer := newTestLayer(t, 2, files...)
+	layer.caseInsensitive = true
+
+	rawJSON, err := layer.ExportJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LayerFromJSON(rawJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := loaded.(*dockerLayer)
+
+	if got.tarPath != layer.tarPath || got.index != layer.index || got.history != layer.history {
+		t.Errorf("LayerFromJSON() = %s %d %+v, want %s %d %+v", got.tarPath, got.index, got.history, layer.tarPath, layer.index, layer.history)
+	}
+	if got.tree.Name != layer.tree.Name || got.tree.FileSize != layer.tree.FileSize || !got.caseInsensitive {
+		t.Errorf("tree = %q %d, case insensitive %t", got.tree.Name, got.tree.FileSize, got.caseInsensitive)
+	}
+	if !reflect.DeepEqual(got.opaque, []string{"opt"}) {
+		t.Errorf("opaque = %v, want [opt]", got.opaque)
+	}
+
+	// the opaque whiteout has no node, the layer only keeps it in opaque
+	want := layerFiles(t, layer)
+	if len(want) != len(files)-1 {
+		t.Fatalf("test layer has %d files, want %d", len(want), len(files)-1)
+	}
+	if gotFiles := layerFiles(t, got); !reflect.DeepEqual(gotFiles, want) {
+		t.Errorf("files = %+v, want %+v", gotFiles, want)
+	}
+}
+
+func TestLayerJSONEmpty(t *testing.T) {
+	rawJSON, err := newTestLayer(t, 0).ExportJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer, err := LayerFromJSON(rawJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files := layerFiles(t, layer); len(files) != 0 {
+		t.Errorf("files = %v, want none", files)
+	}
+}
+
+func TestLayerFromJSONInvalid(t *testing.T) {
+	for _, data := range []string{``, `{`, `{"files": []}`} {
+		if _, err := LayerFromJSON([]byte(data)); err == nil {
+			t.Errorf("LayerFromJSON(%q) succeeded, want an error", data)
+		}
+	}
+}
+
+func TestSerializableFileInfo(t *testing.T) {
+	fi := NewSerializableFileInfo(filetree.FileInfo{Path: "/dev/null", TypeFlag: tar.TypeChar, Size: 0, Mode: os.ModeDevice | os.ModeCharDevice | 0666})
+	var info os.FileInfo = fi
+	if info.Name() != "null" || info.IsDir() || info.Mode()&os.ModeCharDevice == 0 || info.Sys() != nil {
+		t.Errorf("os.FileInfo = %s %t %v", info.Name(), info.IsDir(), info.Mode())
+	}
+	if !NewSerializableFileInfo(dir("etc")).IsDir() {
+		t.Error("IsDir() of a directory = false")
+	}
+}
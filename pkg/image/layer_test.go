@@ -0,0 +1,248 @@
+package image
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/wagoodman/dive/filetree"
+)
+
+// regular returns the synthetic file info of a regular file
+func regular(path string, size int64) filetree.FileInfo {
+	return filetree.FileInfo{Path: path, TypeFlag: tar.TypeReg, Size: size, Mode: 0644}
+}
+
+// dir returns the synthetic file info of a directory
+func dir(path string) filetree.FileInfo {
+	return filetree.FileInfo{Path: path, TypeFlag: tar.TypeDir, Mode: os.ModeDir | 0755, IsDir: true}
+}
+
+// symlink returns the synthetic file info of a symlink
+func symlink(path, target string) filetree.FileInfo {
+	return filetree.FileInfo{Path: path, TypeFlag: tar.TypeSymlink, Linkname: target, Mode: os.ModeSymlink | 0777}
+}
+
+// newTestLayer builds the layer at index from synthetic file infos like Parse does from a layer tar
+func newTestLayer(t *testing.T, index int, files ...filetree.FileInfo) *dockerLayer {
+	t.Helper()
+	tree := filetree.NewFileTree()
+	tree.Name = "layer.tar"
+	var opaque []string
+	for _, info := range files {
+		if IsOpaqueWhiteout(info.Path) {
+			opaque = append(opaque, WhiteoutTarget(info.Path))
+		}
+		tree.FileSize += uint64(info.Size)
+		if _, _, err := tree.AddPath(info.Path, info); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &dockerLayer{
+		tarPath: string(rune('a'+index)) + "/layer.tar",
+		history: HistoryEntry{CreatedBy: "/bin/sh -c #(nop) layer", Size: tree.FileSize},
+		index:   index,
+		tree:    tree,
+		opaque:  opaque,
+	}
+}
+
+func paths(nodes []*filetree.FileNode) []string {
+	var out []string
+	for _, node := range nodes {
+		out = append(out, node.Path())
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestLayerTotalSize(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []filetree.FileInfo
+		want  int64
+	}{
+		{name: "empty"},
+		{name: "files", files: []filetree.FileInfo{dir("etc"), regular("etc/passwd", 100), regular("etc/group", 50)}, want: 150},
+		{name: "whiteouts add nothing", files: []filetree.FileInfo{regular("bin/sh", 1000), regular("etc/.wh.motd", 0), regular(".wh.tmp", 7)}, want: 1000},
+		{name: "implicit parents", files: []filetree.FileInfo{regular("usr/lib/libc.so", 2000)}, want: 2000},
+		{name: "symlinks", files: []filetree.FileInfo{regular("bin/busybox", 500), symlink("bin/sh", "busybox")}, want: 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newTestLayer(t, 0, tt.files...).TotalSize(); got != tt.want {
+				t.Errorf("TotalSize() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLayerWhiteoutFiles(t *testing.T) {
+	l := newTestLayer(t, 1,
+		regular("etc/.wh.motd", 0),
+		regular(".wh.tmp", 0),
+		regular("etc/hostname", 8),
+		regular("var/.wh..wh..opq", 0),
+		regular(".wh..wh..opq", 0),
+	)
+	var got []string
+	for _, f := range l.WhiteoutFiles() {
+		if !f.IsWhiteout() {
+			t.Errorf("WhiteoutFiles() returned %s which is no whiteout", f.Name)
+		}
+		got = append(got, f.Name+" -> "+f.WhiteoutTarget())
+	}
+	sort.Strings(got)
+	want := []string{".wh..wh..opq -> .", ".wh.tmp -> tmp", "etc/.wh.motd -> etc/motd", "var/.wh..wh..opq -> var"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("WhiteoutFiles() = %v, want %v", got, want)
+	}
+}
+
+func TestLayerFileByPath(t *testing.T) {
+	l := newTestLayer(t, 0, dir("etc"), regular("etc/passwd", 10), regular("usr/bin/env", 20), regular("etc/.wh.motd", 0))
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/etc/passwd", want: "/etc/passwd"},
+		{path: "etc/passwd", want: "/etc/passwd"},
+		{path: "/etc/./passwd", want: "/etc/passwd"},
+		{path: "/usr/lib/../bin/env", want: "/usr/bin/env"},
+		{path: "../../etc/passwd", want: "/etc/passwd"},
+		{path: "//etc//passwd/", want: "/etc/passwd"},
+		{path: "/etc", want: "/etc"},
+		{path: "/usr/bin", want: "/usr/bin"},
+		{path: "/ETC/PASSWD"},
+		{path: "/etc/shadow"},
+		// the whiteout entry is not the file it deletes
+		{path: "/etc/motd"},
+	}
+	for _, tt := range tests {
+		node, ok := l.FileByPath(tt.path)
+		if ok != (tt.want != "") {
+			t.Errorf("FileByPath(%q) found = %t", tt.path, ok)
+			continue
+		}
+		if ok && node.Path() != tt.want {
+			t.Errorf("FileByPath(%q) = %s, want %s", tt.path, node.Path(), tt.want)
+		}
+	}
+}
+
+func TestLayerFileByPathCaseInsensitive(t *testing.T) {
+	l := newTestLayer(t, 0, regular("Windows/System32/cmd.exe", 10))
+	l.caseInsensitive = true
+	for _, p := range []string{"/Windows/System32/cmd.exe", "windows/system32/CMD.EXE"} {
+		if _, ok := l.FileByPath(p); !ok {
+			t.Errorf("FileByPath(%q) not found in a case-insensitive layer", p)
+		}
+	}
+}
+
+func TestLayerFileByPathInvalidated(t *testing.T) {
+	l := newTestLayer(t, 0, regular("etc/passwd", 10))
+	if _, ok := l.FileByPath("/etc/group"); ok {
+		t.Fatal("found a file before it was added")
+	}
+
+	if _, _, err := l.Tree().AddPath("etc/group", regular("etc/group", 5)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := l.FileByPath("/etc/group"); !ok {
+		t.Error("FileByPath() uses a stale index after a file was added")
+	}
+
+	node, _ := l.FileByPath("/etc/passwd")
+	if err := node.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := l.FileByPath("/etc/passwd"); ok {
+		t.Error("FileByPath() uses a stale index after a file was removed")
+	}
+}
+
+func TestLayerFileByPathRemoveThenAdd(t *testing.T) {
+	l := newTestLayer(t, 0, regular("etc/passwd", 10), regular("etc/group", 5))
+	old, ok := l.FileByPath("/etc/passwd")
+	if !ok {
+		t.Fatal("passwd not found")
+	}
+
+	// the tree keeps its size when a file is replaced by another
+	tree := l.Tree()
+	size := tree.Size
+	if err := tree.RemovePath("/etc/passwd"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := tree.AddPath("etc/shadow", regular("etc/shadow", 10)); err != nil {
+		t.Fatal(err)
+	}
+	if tree.Size != size {
+		t.Fatalf("tree size changed from %d to %d", size, tree.Size)
+	}
+
+	if node, ok := l.FileByPath("/etc/passwd"); ok {
+		t.Errorf("FileByPath() returned the removed %s", node.Path())
+	}
+	if _, ok := l.FileByPath("/etc/shadow"); !ok {
+		t.Error("FileByPath() missed the added file")
+	}
+	if node, _ := l.FileByPath("/etc/group"); node == old {
+		t.Error("FileByPath() mixed up the nodes")
+	}
+
+	// a tree held from before the index was built still can't leave removed files in it
+	if err := tree.RemovePath("/etc/group"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := l.FileByPath("/etc/group"); ok {
+		t.Error("FileByPath() returned a file removed through a held tree")
+	}
+}
+
+// benchmarkLayer returns a layer holding files spread over 100 directories
+func benchmarkLayer(b *testing.B, files int) *dockerLayer {
+	tree := filetree.NewFileTree()
+	for idx := 0; idx < files; idx++ {
+		p := fmt.Sprintf("usr/share/dir%03d/file%05d", idx%100, idx)
+		if _, _, err := tree.AddPath(p, regular(p, 1)); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return &dockerLayer{tree: tree}
+}
+
+// BenchmarkFileByPath looks files up in a 10,000 file layer through the path index
+func BenchmarkFileByPath(b *testing.B) {
+	l := benchmarkLayer(b, 10000)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if _, ok := l.FileByPath(fmt.Sprintf("/usr/share/dir%03d/file%05d", n%100, n%10000)); !ok {
+			b.Fatal("file not found")
+		}
+	}
+}
+
+// BenchmarkFileByPathScan is the linear scan FileByPath replaces
+func BenchmarkFileByPathScan(b *testing.B) {
+	l := benchmarkLayer(b, 10000)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		want := fmt.Sprintf("/usr/share/dir%03d/file%05d", n%100, n%10000)
+		found := false
+		l.tree.VisitDepthChildFirst(func(node *filetree.FileNode) error {
+			if node.Path() == want {
+				found = true
+			}
+			return nil
+		}, nil)
+		if !found {
+			b.Fatal("file not found")
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package image
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+)
+
+var (
+	// ErrNoPlatformMatch is returned when no manifest matches the requested platform
+	ErrNoPlatformMatch = errors.New("no manifest matches platform")
+	// ErrAmbiguousPlatform is returned when several manifests match the requested platform
+	ErrAmbiguousPlatform = errors.New("more than one manifest matches platform")
+)
+
+// canonicalJSON re-encodes v as JSON with sorted keys and no extra whitespace
+func canonicalJSON(v interface{}) ([]byte, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	if err := json.Unmarshal(raw, &generic); err != nil {
+		return nil, err
+	}
+	return json.Marshal(generic)
+}
+
+// Digest returns the SHA256 digest of the canonical JSON form of the manifest
+func (m Manifest) Digest() (digest.Digest, error) {
+	raw, err := canonicalJSON(m)
+	if err != nil {
+		return "", err
+	}
+	return digest.FromBytes(raw), nil
+}
+
+// DigestMap returns the manifests keyed by their content digest
+func (ms Manifests) DigestMap() map[digest.Digest]Manifest {
+	digests := make(map[digest.Digest]Manifest, len(ms))
+	for _, m := range ms {
+		d, err := m.Digest()
+		if err != nil {
+			continue
+		}
+		digests[d] = m
+	}
+	return digests
+}
+
+// ForPlatform returns the manifest whose image matches the platform p.
+// When there is no exact match a platform without a variant matches any
+// variant of the same os/arch, so linux/arm will select linux/arm/v7.
+func (ms Manifests) ForPlatform(p Platform) (*Manifest, error) {
+	platforms := make([]*Platform, len(ms))
+	for idx := range ms {
+		platforms[idx] = ms[idx].Platform
+	}
+	idx, err := MatchPlatform(platforms, p)
+	if err != nil {
+		return nil, err
+	}
+	return &ms[idx], nil
+}
+
+// noneRepo is the group of manifests without any RepoTags, like docker's <none>
+const noneRepo = "<none>"
+
+// repoName returns the repository part of a name:tag reference
+func repoName(repoTag string) string {
+	if idx := strings.LastIndex(repoTag, ":"); idx > strings.LastIndex(repoTag, "/") {
+		return repoTag[:idx]
+	}
+	return repoTag
+}
+
+// GroupByRepo groups the manifests by the repository of their RepoTags.
+// Manifests without RepoTags are grouped under "<none>".
+func (ms Manifests) GroupByRepo() map[string]Manifests {
+	groups := make(map[string]Manifests)
+	for _, m := range ms {
+		if len(m.RepoTags) == 0 {
+			groups[noneRepo] = append(groups[noneRepo], m)
+			continue
+		}
+		seen := make(map[string]bool)
+		for _, tag := range m.RepoTags {
+			repo := repoName(tag)
+			if !seen[repo] {
+				groups[repo] = append(groups[repo], m)
+				seen[repo] = true
+			}
+		}
+	}
+	return groups
+}
+
+// Tags returns the RepoTags of all the manifests
+func (ms Manifests) Tags() []string {
+	var tags []string
+	for _, m := range ms {
+		tags = append(tags, m.RepoTags...)
+	}
+	return tags
+}
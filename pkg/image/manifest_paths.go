@@ -0,0 +1,58 @@
+package image
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// ErrMalformedLayerPath is returned for manifest paths that do not name a blob by its digest
+var ErrMalformedLayerPath = errors.New("malformed layer path")
+
+// blobPathDigest returns the digest a manifest path refers to. It understands the
+// <hex>/layer.tar and sha256:<hex>/layer.tar paths of docker save, the <hex>.tar and
+// <hex>.json paths of graboid and docker save configs and the blobs/sha256/<hex> paths
+// of OCI layouts.
+func blobPathDigest(p string) (digest.Digest, error) {
+	clean := strings.TrimPrefix(path.Clean("/"+p), "/")
+
+	var candidate string
+	if parts := strings.Split(clean, "/"); len(parts) == 3 && parts[0] == "blobs" {
+		candidate = parts[1] + ":" + parts[2]
+	} else {
+		candidate = parts[0]
+		if ext := path.Ext(candidate); ext == ".tar" || ext == ".json" {
+			candidate = strings.TrimSuffix(candidate, ext)
+		}
+		if !strings.Contains(candidate, ":") {
+			candidate = digest.Canonical.String() + ":" + candidate
+		}
+	}
+
+	d, err := digest.Parse(candidate)
+	if err != nil {
+		return "", fmt.Errorf("%w: %q: %v", ErrMalformedLayerPath, p, err)
+	}
+	return d, nil
+}
+
+// LayerDigests returns the digests the manifest's layer paths start with
+func (m Manifest) LayerDigests() ([]digest.Digest, error) {
+	digests := make([]digest.Digest, 0, len(m.Layers))
+	for _, layer := range m.Layers {
+		d, err := blobPathDigest(layer)
+		if err != nil {
+			return nil, err
+		}
+		digests = append(digests, d)
+	}
+	return digests, nil
+}
+
+// ConfigDigest returns the digest of the manifest's config path
+func (m Manifest) ConfigDigest() (digest.Digest, error) {
+	return blobPathDigest(m.Config)
+}
@@ -0,0 +1,68 @@
+package image
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	layerHex  = "24839d45ca455f36659219281e0f2304520b92347eb536ad5cc7b4dbb8163588"
+	configHex = "e556c36f3b9d8a7f2c1b0e9d8c7b6a5f4e3d2c1b0a9f8e7d6c5b4a3f2e1d0c9b"
+)
+
+func TestManifestLayerDigests(t *testing.T) {
+	tests := []struct {
+		name   string
+		layers []string
+		want   []digest.Digest
+	}{
+		{name: "docker save", layers: []string{layerHex + "/layer.tar"}, want: []digest.Digest{"sha256:" + layerHex}},
+		{name: "docker save with algorithm", layers: []string{"sha256:" + layerHex + "/layer.tar"}, want: []digest.Digest{"sha256:" + layerHex}},
+		{name: "graboid", layers: []string{layerHex + ".tar", "./" + configHex + ".tar"}, want: []digest.Digest{"sha256:" + layerHex, "sha256:" + configHex}},
+		{name: "oci layout", layers: []string{"blobs/sha256/" + layerHex}, want: []digest.Digest{"sha256:" + layerHex}},
+		{name: "no layers", want: []digest.Digest{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Manifest{Layers: tt.layers}.LayerDigests()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LayerDigests() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManifestLayerDigestsMalformed(t *testing.T) {
+	for _, layer := range []string{
+		"",
+		"layer.tar",
+		"abc123/layer.tar",
+		layerHex[:63] + "/layer.tar",
+		"md5:" + layerHex + "/layer.tar",
+		"layers/" + layerHex + "/layer.tar",
+		"blobs/sha256/" + layerHex[:10],
+		layerHex + ".tar.gz",
+	} {
+		m := Manifest{Layers: []string{layerHex + "/layer.tar", layer}}
+		if got, err := m.LayerDigests(); !errors.Is(err, ErrMalformedLayerPath) || got != nil {
+			t.Errorf("LayerDigests() of %q = %v, %v, want %v", layer, got, err, ErrMalformedLayerPath)
+		}
+	}
+}
+
+func TestManifestConfigDigest(t *testing.T) {
+	for _, config := range []string{configHex + ".json", "blobs/sha256/" + configHex} {
+		if d, err := (Manifest{Config: config}).ConfigDigest(); err != nil || d != "sha256:"+configHex {
+			t.Errorf("ConfigDigest() of %q = %s, %v", config, d, err)
+		}
+	}
+	if _, err := (Manifest{Config: "config.json"}).ConfigDigest(); !errors.Is(err, ErrMalformedLayerPath) {
+		t.Errorf("ConfigDigest() = %v, want %v", err, ErrMalformedLayerPath)
+	}
+}
@@ -0,0 +1,172 @@
+package image
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+)
+
+func TestManifestDigest(t *testing.T) {
+	tests := []struct {
+		name string
+		m    Manifest
+		json string
+	}{
+		{
+			name: "full",
+			m:    Manifest{Config: "abc.json", Layers: []string{"a/layer.tar", "b/layer.tar"}, RepoTags: []string{"alpine:3.18"}},
+			json: `{"Config":"abc.json","Layers":["a/layer.tar","b/layer.tar"],"RepoTags":["alpine:3.18"]}`,
+		},
+		{name: "empty layers", m: Manifest{Config: "abc.json", Layers: []string{}}, json: `{"Config":"abc.json"}`},
+		{name: "empty config", m: Manifest{Layers: []string{"a/layer.tar"}}, json: `{"Layers":["a/layer.tar"]}`},
+		{name: "empty", json: `{}`},
+		{
+			name: "platform keys sorted",
+			m:    Manifest{Config: "abc.json", Platform: &Platform{OS: "linux", Arch: "arm64"}},
+			json: `{"Config":"abc.json","Platform":{"architecture":"arm64","os":"linux"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := tt.m.Digest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := digest.FromString(tt.json); d != want {
+				t.Errorf("Digest() = %s, want %s of %s", d, want, tt.json)
+			}
+		})
+	}
+}
+
+func TestManifestsDigestMap(t *testing.T) {
+	ms := Manifests{
+		{Config: "a.json", RepoTags: []string{"a:latest"}},
+		{Config: "b.json"},
+		{Config: "a.json", RepoTags: []string{"a:latest"}},
+	}
+	digests := ms.DigestMap()
+	if len(digests) != 2 {
+		t.Fatalf("DigestMap() has %d entries, want 2 as identical manifests share a digest", len(digests))
+	}
+	for _, m := range ms {
+		d, err := m.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, ok := digests[d]; !ok || got.Config != m.Config {
+			t.Errorf("DigestMap()[%s] = %+v, want %+v", d, got, m)
+		}
+	}
+}
+
+func TestManifestsForPlatform(t *testing.T) {
+	ms := Manifests{
+		{Config: "amd64.json", Platform: &Platform{OS: "linux", Arch: "amd64"}},
+		{Config: "armv6.json", Platform: &Platform{OS: "linux", Arch: "arm", Variant: "v6"}},
+		{Config: "armv7.json", Platform: &Platform{OS: "linux", Arch: "arm", Variant: "v7"}},
+		{Config: "arm64.json", Platform: &Platform{OS: "linux", Arch: "arm64", Variant: "v8"}},
+		{Config: "windows.json", Platform: &Platform{OS: "windows", Arch: "amd64", OSVersion: "10.0.17763.1"}},
+		{Config: "unknown.json"},
+	}
+
+	tests := []struct {
+		platform string
+		want     string
+		err      error
+	}{
+		{platform: "linux/amd64", want: "amd64.json"},
+		{platform: "linux/arm/v7", want: "armv7.json"},
+		{platform: "linux/arm/v6", want: "armv6.json"},
+		{platform: "linux/arm64", want: "arm64.json"},
+		{platform: "windows/amd64", want: "windows.json"},
+		{platform: "linux/arm", err: ErrAmbiguousPlatform},
+		{platform: "linux/arm/v5", err: ErrNoPlatformMatch},
+		{platform: "linux/s390x", err: ErrNoPlatformMatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.platform, func(t *testing.T) {
+			p, err := ParsePlatform(tt.platform)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m, err := ms.ForPlatform(p)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Errorf("ForPlatform() error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Config != tt.want {
+				t.Errorf("ForPlatform() = %s, want %s", m.Config, tt.want)
+			}
+			if m != &ms[indexOf(ms, tt.want)] {
+				t.Error("ForPlatform() returned a copy instead of the manifest")
+			}
+		})
+	}
+
+	// fuzzy matching picks the only variant there is
+	armv7 := Manifests{ms[0], ms[2]}
+	if m, err := armv7.ForPlatform(Platform{OS: "linux", Arch: "arm"}); err != nil || m.Config != "armv7.json" {
+		t.Errorf("ForPlatform(linux/arm) = %v, %v, want armv7.json", m, err)
+	}
+}
+
+func indexOf(ms Manifests, config string) int {
+	for idx := range ms {
+		if ms[idx].Config == config {
+			return idx
+		}
+	}
+	return -1
+}
+
+// fiveImages is a docker save manifest of five images, one of them untagged
+var fiveImages = Manifests{
+	{Config: "a.json", RepoTags: []string{"alpine:3.12", "alpine:latest"}},
+	{Config: "b.json", RepoTags: []string{"alpine:3.11"}},
+	{Config: "c.json", RepoTags: []string{"localhost:5000/team/app:v1", "team/app:v1"}},
+	{Config: "d.json", RepoTags: []string{"localhost:5000/team/app:v2"}},
+	{Config: "e.json"},
+}
+
+func TestManifestsGroupByRepo(t *testing.T) {
+	groups := fiveImages.GroupByRepo()
+	want := map[string][]string{
+		"alpine":                  {"a.json", "b.json"},
+		"localhost:5000/team/app": {"c.json", "d.json"},
+		"team/app":                {"c.json"},
+		"<none>":                  {"e.json"},
+	}
+	if len(groups) != len(want) {
+		t.Errorf("GroupByRepo() has the repos %v, want %v", groups, want)
+	}
+	for repo, configs := range want {
+		var got []string
+		for _, m := range groups[repo] {
+			got = append(got, m.Config)
+		}
+		if !reflect.DeepEqual(got, configs) {
+			t.Errorf("GroupByRepo()[%q] = %v, want %v", repo, got, configs)
+		}
+	}
+	if got := (Manifests{}).GroupByRepo(); len(got) != 0 {
+		t.Errorf("GroupByRepo() of no manifests = %v", got)
+	}
+}
+
+func TestManifestsTags(t *testing.T) {
+	want := []string{"alpine:3.12", "alpine:latest", "alpine:3.11", "localhost:5000/team/app:v1", "team/app:v1", "localhost:5000/team/app:v2"}
+	if got := fiveImages.Tags(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Tags() = %v, want %v", got, want)
+	}
+	if got := (Manifests{{Config: "e.json"}}).Tags(); len(got) != 0 {
+		t.Errorf("Tags() of an untagged image = %v", got)
+	}
+}
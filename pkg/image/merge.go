@@ -0,0 +1,100 @@
+package image
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Merge returns a copy of the image with overlay applied on top of it.
+// Env vars and labels of overlay win over the image's, exposed ports and
+// volumes are unioned and the entrypoint and cmd of overlay replace the
+// image's when set. The layers of overlay are stacked on the image's.
+func (img *Image) Merge(overlay *Image) (*Image, error) {
+	if overlay == nil {
+		return nil, errors.New("nothing to merge, overlay image is nil")
+	}
+	if len(img.OS) > 0 && len(overlay.OS) > 0 && img.OS != overlay.OS {
+		return nil, fmt.Errorf("can't merge %s image into %s image", overlay.OS, img.OS)
+	}
+	if len(img.Architecture) > 0 && len(overlay.Architecture) > 0 && img.Architecture != overlay.Architecture {
+		return nil, fmt.Errorf("can't merge %s image into %s image", overlay.Architecture, img.Architecture)
+	}
+
+	merged := img.Clone()
+	if oc := cloneContainerConfig(overlay.Config); oc != nil {
+		mc := merged.Config
+		if mc == nil {
+			merged.Config = oc
+		} else {
+			mc.Env = mergeEnv(mc.Env, oc.Env)
+			if len(oc.Labels) > 0 {
+				if mc.Labels == nil {
+					mc.Labels = make(map[string]string, len(oc.Labels))
+				}
+				for key, value := range oc.Labels {
+					mc.Labels[key] = value
+				}
+			}
+			if mc.ExposedPorts == nil {
+				mc.ExposedPorts = oc.ExposedPorts
+			} else {
+				for port, value := range oc.ExposedPorts {
+					mc.ExposedPorts[port] = value
+				}
+			}
+			if mc.Volumes == nil {
+				mc.Volumes = oc.Volumes
+			} else {
+				for volume, value := range oc.Volumes {
+					mc.Volumes[volume] = value
+				}
+			}
+			if oc.Entrypoint != nil {
+				mc.Entrypoint = oc.Entrypoint
+			}
+			if oc.Cmd != nil {
+				mc.Cmd = oc.Cmd
+			}
+		}
+	}
+
+	if overlay.RootFS != nil {
+		if merged.RootFS == nil {
+			merged.RootFS = &ImageRootFS{Type: overlay.RootFS.Type}
+		}
+		merged.RootFS.DiffIDs = append(merged.RootFS.DiffIDs, overlay.RootFS.DiffIDs...)
+	}
+	merged.rawJSON = nil
+
+	return merged, nil
+}
+
+// mergeEnv returns base with the variables of overlay set, overridden variables keep their position
+func mergeEnv(base, overlay []string) []string {
+	if len(overlay) == 0 {
+		return base
+	}
+
+	merged := append([]string(nil), base...)
+	position := make(map[string]int, len(merged))
+	for idx, kv := range merged {
+		position[envKey(kv)] = idx
+	}
+	for _, kv := range overlay {
+		if idx, ok := position[envKey(kv)]; ok {
+			merged[idx] = kv
+			continue
+		}
+		position[envKey(kv)] = len(merged)
+		merged = append(merged, kv)
+	}
+	return merged
+}
+
+func envKey(kv string) string {
+	if idx := strings.Index(kv, "="); idx >= 0 {
+		return kv[:idx]
+	}
+	return kv
+}
@@ -0,0 +1,203 @@
+package image
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+)
+
+func TestImageMerge(t *testing.T) {
+	base := func() *Image {
+		return &Image{
+			OS:           "linux",
+			Architecture: "amd64",
+			Config: &container.Config{
+				Env:          []string{"PATH=/usr/bin", "LANG=C", "DEBUG"},
+				Labels:       map[string]string{"maintainer": "someone", "version": "1.0"},
+				ExposedPorts: nat.PortSet{"80/tcp": {}},
+				Volumes:      map[string]struct{}{"/data": {}},
+				Entrypoint:   []string{"/docker-entrypoint.sh"},
+				Cmd:          []string{"nginx"},
+			},
+			RootFS: &ImageRootFS{Type: "layers", DiffIDs: []DiffID{"sha256:base"}},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		base    *Image
+		overlay *Image
+		want    *Image
+	}{
+		{
+			name: "everything",
+			base: base(),
+			overlay: &Image{
+				Config: &container.Config{
+					Env:          []string{"LANG=en_US.UTF-8", "APP=1", "DEBUG=1"},
+					Labels:       map[string]string{"version": "2.0", "app": "web"},
+					ExposedPorts: nat.PortSet{"80/tcp": {}, "443/tcp": {}},
+					Volumes:      map[string]struct{}{"/logs": {}},
+					Entrypoint:   []string{"/app/run"},
+					Cmd:          []string{},
+				},
+				RootFS: &ImageRootFS{Type: "layers", DiffIDs: []DiffID{"sha256:app", "sha256:config"}},
+			},
+			want: &Image{
+				OS:           "linux",
+				Architecture: "amd64",
+				Config: &container.Config{
+					// overridden variables keep their position
+					Env:          []string{"PATH=/usr/bin", "LANG=en_US.UTF-8", "DEBUG=1", "APP=1"},
+					Labels:       map[string]string{"maintainer": "someone", "version": "2.0", "app": "web"},
+					ExposedPorts: nat.PortSet{"80/tcp": {}, "443/tcp": {}},
+					Volumes:      map[string]struct{}{"/data": {}, "/logs": {}},
+					Entrypoint:   []string{"/app/run"},
+					// an empty cmd is set and clears the base cmd
+					Cmd: []string{},
+				},
+				RootFS: &ImageRootFS{Type: "layers", DiffIDs: []DiffID{"sha256:base", "sha256:app", "sha256:config"}},
+			},
+		},
+		{
+			name:    "unset entrypoint and cmd keep the base",
+			base:    base(),
+			overlay: &Image{Config: &container.Config{Env: []string{"APP=1"}}},
+			want: func() *Image {
+				img := base()
+				img.Config.Env = append(img.Config.Env, "APP=1")
+				return img
+			}(),
+		},
+		{
+			name: "base without labels, ports and volumes",
+			base: &Image{Config: &container.Config{Cmd: []string{"sh"}}},
+			overlay: &Image{Config: &container.Config{
+				Labels:       map[string]string{"app": "web"},
+				ExposedPorts: nat.PortSet{"8080/tcp": {}},
+				Volumes:      map[string]struct{}{"/logs": {}},
+			}},
+			want: &Image{Config: &container.Config{
+				Cmd:          []string{"sh"},
+				Labels:       map[string]string{"app": "web"},
+				ExposedPorts: nat.PortSet{"8080/tcp": {}},
+				Volumes:      map[string]struct{}{"/logs": {}},
+			}},
+		},
+		{
+			name:    "nil base config",
+			base:    &Image{OS: "linux", RootFS: &ImageRootFS{Type: "layers", DiffIDs: []DiffID{"sha256:base"}}},
+			overlay: &Image{Config: &container.Config{Env: []string{"APP=1"}, Cmd: []string{"run"}}},
+			want: &Image{
+				OS:     "linux",
+				Config: &container.Config{Env: []string{"APP=1"}, Cmd: []string{"run"}},
+				RootFS: &ImageRootFS{Type: "layers", DiffIDs: []DiffID{"sha256:base"}},
+			},
+		},
+		{
+			name:    "nil overlay config",
+			base:    base(),
+			overlay: &Image{RootFS: &ImageRootFS{Type: "layers", DiffIDs: []DiffID{"sha256:app"}}},
+			want: func() *Image {
+				img := base()
+				img.RootFS.DiffIDs = append(img.RootFS.DiffIDs, "sha256:app")
+				return img
+			}(),
+		},
+		{
+			name:    "nil configs",
+			base:    &Image{OS: "linux"},
+			overlay: &Image{Architecture: "arm64"},
+			want:    &Image{OS: "linux"},
+		},
+		{
+			name:    "nil base rootfs",
+			base:    &Image{},
+			overlay: &Image{RootFS: &ImageRootFS{Type: "layers", DiffIDs: []DiffID{"sha256:app"}}},
+			want:    &Image{RootFS: &ImageRootFS{Type: "layers", DiffIDs: []DiffID{"sha256:app"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, err := json.Marshal(tt.base)
+			if err != nil {
+				t.Fatal(err)
+			}
+			overlayBefore, err := json.Marshal(tt.overlay)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := tt.base.Merge(tt.overlay)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				gotJSON, _ := json.Marshal(got)
+				wantJSON, _ := json.Marshal(tt.want)
+				t.Errorf("Merge() = %s, want %s", gotJSON, wantJSON)
+			}
+
+			// changing the merged image changes neither input
+			if got.Config != nil {
+				got.Config.Env = append(got.Config.Env[:0], "CHANGED=1")
+				if got.Config.Labels != nil {
+					got.Config.Labels["changed"] = "1"
+				}
+				if got.Config.ExposedPorts != nil {
+					got.Config.ExposedPorts["1/tcp"] = struct{}{}
+				}
+				if got.Config.Volumes != nil {
+					got.Config.Volumes["/changed"] = struct{}{}
+				}
+			}
+			if got.RootFS != nil && len(got.RootFS.DiffIDs) > 0 {
+				got.RootFS.DiffIDs[0] = "sha256:changed"
+			}
+			after, _ := json.Marshal(tt.base)
+			overlayAfter, _ := json.Marshal(tt.overlay)
+			if string(before) != string(after) || string(overlayBefore) != string(overlayAfter) {
+				t.Errorf("changing the merged image changed its inputs:\nbase %s -> %s\noverlay %s -> %s", before, after, overlayBefore, overlayAfter)
+			}
+		})
+	}
+}
+
+func TestImageMergeInvalidatesRawJSON(t *testing.T) {
+	img, err := NewFromJSON([]byte(`{"os":"linux","architecture":"amd64","config":{"Env":["PATH=/usr/bin"]},"rootfs":{"type":"layers","diff_ids":[]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged, err := img.Merge(&Image{Config: &container.Config{Env: []string{"APP=1"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.RawJSON() != nil {
+		t.Errorf("RawJSON() of the merged image = %s, want nil", merged.RawJSON())
+	}
+	if img.RawJSON() == nil {
+		t.Error("Merge() cleared the RawJSON of the base image")
+	}
+}
+
+func TestImageMergeErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		base    *Image
+		overlay *Image
+	}{
+		{name: "nil overlay", base: &Image{}, overlay: nil},
+		{name: "os", base: &Image{OS: "linux"}, overlay: &Image{OS: "windows"}},
+		{name: "architecture", base: &Image{Architecture: "amd64"}, overlay: &Image{Architecture: "arm64"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := tt.base.Merge(tt.overlay); err == nil {
+				t.Errorf("Merge() = %+v, want an error", got)
+			}
+		})
+	}
+}
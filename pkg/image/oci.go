@@ -0,0 +1,90 @@
+package image
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	// MediaTypeOCIManifest is the media type of an OCI image manifest
+	MediaTypeOCIManifest = "application/vnd.oci.image.manifest.v1+json"
+	// MediaTypeOCIConfig is the media type of an OCI image config
+	MediaTypeOCIConfig = "application/vnd.oci.image.config.v1+json"
+	// MediaTypeOCILayer is the media type of a gzipped OCI layer
+	MediaTypeOCILayer = "application/vnd.oci.image.layer.v1.tar+gzip"
+	// MediaTypeOCILayerZstd is the media type of a zstd compressed OCI layer
+	MediaTypeOCILayerZstd = "application/vnd.oci.image.layer.v1.tar+zstd"
+	// MediaTypeDockerManifest is the media type of a Docker v2 schema 2 manifest
+	MediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+	// MediaTypeDockerConfig is the media type of a Docker image config
+	MediaTypeDockerConfig = "application/vnd.docker.container.image.v1+json"
+	// MediaTypeDockerLayer is the media type of a gzipped Docker layer
+	MediaTypeDockerLayer = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+	// MediaTypeOCIIndex is the media type of an OCI image index
+	MediaTypeOCIIndex = "application/vnd.oci.image.index.v1+json"
+	// MediaTypeDockerManifestList is the media type of a Docker manifest list
+	MediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+)
+
+// ErrUnknownManifest is returned when manifest JSON matches no known schema
+var ErrUnknownManifest = errors.New("unknown manifest schema")
+
+// Descriptor describes the content a manifest references
+type Descriptor struct {
+	MediaType    string            `json:"mediaType"`
+	Digest       digest.Digest     `json:"digest"`
+	Size         int64             `json:"size"`
+	URLs         []string          `json:"urls,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Platform     *Platform         `json:"platform,omitempty"`
+}
+
+// OCIManifest is an OCI image manifest (v1.1) as served by registries
+type OCIManifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        Descriptor        `json:"config"`
+	Layers        []Descriptor      `json:"layers"`
+	Subject       *Descriptor       `json:"subject,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// ParseManifestAuto detects the schema of the manifest JSON and returns
+// either Manifests (docker save manifest.json) or *OCIManifest
+func ParseManifestAuto(data []byte) (interface{}, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, ErrUnknownManifest
+	}
+
+	switch trimmed[0] {
+	case '[':
+		var manifests Manifests
+		if err := json.Unmarshal(trimmed, &manifests); err != nil {
+			return nil, err
+		}
+		return manifests, nil
+	case '{':
+		m := &OCIManifest{}
+		if err := json.Unmarshal(trimmed, m); err != nil {
+			return nil, err
+		}
+		if m.SchemaVersion != 2 {
+			return nil, fmt.Errorf("%w: schemaVersion %d", ErrUnknownManifest, m.SchemaVersion)
+		}
+		switch m.MediaType {
+		case "", MediaTypeOCIManifest, MediaTypeDockerManifest:
+			return m, nil
+		default:
+			return nil, fmt.Errorf("%w: mediaType %s", ErrUnknownManifest, m.MediaType)
+		}
+	}
+
+	return nil, ErrUnknownManifest
+}
@@ -0,0 +1,92 @@
+package image
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseManifestAutoOCI(t *testing.T) {
+	m := &OCIManifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeOCIManifest,
+		ArtifactType:  "application/vnd.example+type",
+		Config:        Descriptor{MediaType: MediaTypeOCIConfig, Digest: "sha256:" + testHex, Size: 123},
+		Layers: []Descriptor{
+			{MediaType: MediaTypeOCILayer, Digest: "sha256:" + testHex, Size: 456, Annotations: map[string]string{"org.opencontainers.image.title": "layer"}},
+			{MediaType: MediaTypeOCILayerZstd, Digest: "sha256:" + testHex, Size: 789, URLs: []string{"https://example.com/layer"}},
+		},
+		Subject:     &Descriptor{MediaType: MediaTypeOCIManifest, Digest: "sha256:" + testHex, Size: 10},
+		Annotations: map[string]string{"org.opencontainers.image.created": "2020-01-01T00:00:00Z"},
+	}
+	raw, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := ParseManifestAuto(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := parsed.(*OCIManifest)
+	if !ok {
+		t.Fatalf("ParseManifestAuto() = %T, want *OCIManifest", parsed)
+	}
+	if !reflect.DeepEqual(got, m) {
+		t.Errorf("round trip = %+v, want %+v", got, m)
+	}
+
+	again, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != string(raw) {
+		t.Errorf("re-marshaled manifest differs:\n%s\n%s", again, raw)
+	}
+}
+
+func TestParseManifestAutoDocker(t *testing.T) {
+	ms := Manifests{{Config: "abc.json", Layers: []string{"a/layer.tar"}, RepoTags: []string{"alpine:3.18"}}}
+	raw, err := json.Marshal(ms)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := ParseManifestAuto(append([]byte("\n  "), raw...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := parsed.(Manifests)
+	if !ok {
+		t.Fatalf("ParseManifestAuto() = %T, want Manifests", parsed)
+	}
+	if !reflect.DeepEqual(got, ms) {
+		t.Errorf("round trip = %+v, want %+v", got, ms)
+	}
+}
+
+func TestParseManifestAutoDockerV2(t *testing.T) {
+	raw := `{"schemaVersion":2,"mediaType":"` + MediaTypeDockerManifest + `","config":{"mediaType":"` + MediaTypeDockerConfig + `","digest":"sha256:` + testHex + `","size":1},"layers":[]}`
+	parsed, err := ParseManifestAuto([]byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, ok := parsed.(*OCIManifest); !ok || m.Config.MediaType != MediaTypeDockerConfig {
+		t.Errorf("ParseManifestAuto() = %#v", parsed)
+	}
+}
+
+func TestParseManifestAutoUnknown(t *testing.T) {
+	for _, raw := range []string{
+		"",
+		"   ",
+		`"manifest"`,
+		`{"schemaVersion":1,"name":"library/alpine"}`,
+		`{"schemaVersion":2,"mediaType":"` + MediaTypeOCIIndex + `","manifests":[]}`,
+	} {
+		if _, err := ParseManifestAuto([]byte(raw)); !errors.Is(err, ErrUnknownManifest) {
+			t.Errorf("ParseManifestAuto(%q) error = %v, want ErrUnknownManifest", raw, err)
+		}
+	}
+}
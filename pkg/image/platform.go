@@ -0,0 +1,151 @@
+package image
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// Platform describes the platform an image is built to run on
+type Platform struct {
+	OS        string `json:"os"`
+	Arch      string `json:"architecture"`
+	Variant   string `json:"variant,omitempty"`
+	OSVersion string `json:"os.version,omitempty"`
+}
+
+// Platform returns the platform of the image
+func (img *Image) Platform() Platform {
+	return Platform{
+		OS:        img.OS,
+		Arch:      img.Architecture,
+		Variant:   img.Variant,
+		OSVersion: img.OSVersion,
+	}
+}
+
+// String returns the platform in os/arch[/variant] format
+func (p Platform) String() string {
+	s := p.OS + "/" + p.Arch
+	if len(p.Variant) > 0 {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// ParsePlatform parses a platform in os/arch[/variant] format
+func ParsePlatform(s string) (Platform, error) {
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(s)), "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return Platform{}, fmt.Errorf("invalid platform %q: expected os/arch[/variant]", s)
+	}
+	for _, part := range parts {
+		if len(part) == 0 {
+			return Platform{}, fmt.Errorf("invalid platform %q: empty component", s)
+		}
+	}
+
+	p := Platform{OS: parts[0], Arch: parts[1]}
+	if len(parts) == 3 {
+		p.Variant = parts[2]
+	}
+	return p, nil
+}
+
+// MatchPlatform returns the index of the platform matching p. When there is no
+// exact match a platform without a variant matches any variant of the same
+// os/arch and the other way around. arm64 v8 is the same as no variant.
+// Nil platforms never match.
+func MatchPlatform(platforms []*Platform, p Platform) (int, error) {
+	var exact, fuzzy []int
+
+	for idx, candidate := range platforms {
+		if candidate == nil {
+			continue
+		}
+		if !strings.EqualFold(candidate.OS, p.OS) || !strings.EqualFold(candidate.Arch, p.Arch) {
+			continue
+		}
+		if len(p.OSVersion) > 0 && candidate.OSVersion != p.OSVersion {
+			continue
+		}
+		want, got := normalizeVariant(p.Arch, p.Variant), normalizeVariant(candidate.Arch, candidate.Variant)
+		if want == got {
+			exact = append(exact, idx)
+		} else if len(want) == 0 || len(got) == 0 {
+			fuzzy = append(fuzzy, idx)
+		}
+	}
+
+	matches := exact
+	if len(matches) == 0 {
+		matches = fuzzy
+	}
+	switch len(matches) {
+	case 0:
+		return -1, fmt.Errorf("%w: %s", ErrNoPlatformMatch, p)
+	case 1:
+		return matches[0], nil
+	default:
+		return -1, fmt.Errorf("%w: %s", ErrAmbiguousPlatform, p)
+	}
+}
+
+// normalizeVariant returns the lower case variant, arm64 only has v8 so
+// images often leave it out
+func normalizeVariant(arch, variant string) string {
+	variant = strings.ToLower(variant)
+	if strings.EqualFold(arch, "arm64") && variant == "v8" {
+		return ""
+	}
+	return variant
+}
+
+// DefaultPlatform returns the platform of the host. macOS hosts run linux
+// containers in a VM so they default to linux like docker does.
+func DefaultPlatform() Platform {
+	p := Platform{OS: runtime.GOOS, Arch: runtime.GOARCH}
+	if p.OS == "darwin" {
+		p.OS = "linux"
+	}
+
+	switch p.Arch {
+	case "arm":
+		p.Variant = armVariant()
+	case "arm64":
+		p.Variant = "v8"
+	}
+
+	return p
+}
+
+// armVariant returns the 32-bit arm variant from GOARM or /proc/cpuinfo
+func armVariant() string {
+	if goarm := os.Getenv("GOARM"); len(goarm) > 0 {
+		return "v" + goarm
+	}
+
+	f, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return "v7"
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) != "CPU architecture" {
+			continue
+		}
+		switch arch := strings.TrimSpace(parts[1]); arch {
+		case "5", "6", "7":
+			return "v" + arch
+		case "8", "AArch64":
+			// 32-bit userland on a 64-bit cpu
+			return "v7"
+		}
+	}
+	return "v7"
+}
@@ -0,0 +1,160 @@
+package image
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+)
+
+func TestMatchPlatform(t *testing.T) {
+	platforms := func(ps ...string) []*Platform {
+		var out []*Platform
+		for _, s := range ps {
+			if s == "" {
+				out = append(out, nil)
+				continue
+			}
+			p, err := ParsePlatform(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out = append(out, &p)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name      string
+		platforms []*Platform
+		want      string
+		idx       int
+		err       error
+	}{
+		{name: "exact", platforms: platforms("linux/amd64", "linux/arm64"), want: "linux/arm64", idx: 1},
+		{name: "arm64 v8 wanted, no variant listed", platforms: platforms("linux/amd64", "linux/arm64"), want: "linux/arm64/v8", idx: 1},
+		{name: "arm64 wanted, v8 listed", platforms: platforms("linux/amd64", "linux/arm64/v8"), want: "linux/arm64", idx: 1},
+		{name: "arm64 v8 both", platforms: platforms("linux/arm64/v8"), want: "linux/arm64/v8", idx: 0},
+		{name: "arm exact variant preferred", platforms: platforms("linux/arm/v6", "linux/arm/v7"), want: "linux/arm/v7", idx: 1},
+		{name: "arm any variant", platforms: platforms("linux/arm/v7"), want: "linux/arm", idx: 0},
+		{name: "arm candidate without variant", platforms: platforms("linux/arm"), want: "linux/arm/v7", idx: 0},
+		{name: "arm variant mismatch", platforms: platforms("linux/arm/v6"), want: "linux/arm/v7", err: ErrNoPlatformMatch},
+		{name: "arm ambiguous", platforms: platforms("linux/arm/v6", "linux/arm/v7"), want: "linux/arm", err: ErrAmbiguousPlatform},
+		{name: "case insensitive", platforms: platforms("linux/arm64/V8"), want: "linux/arm64/v8", idx: 0},
+		{name: "nil skipped", platforms: platforms("", "linux/amd64"), want: "linux/amd64", idx: 1},
+		{name: "no match", platforms: platforms("linux/amd64"), want: "windows/amd64", err: ErrNoPlatformMatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParsePlatform(tt.want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			idx, err := MatchPlatform(tt.platforms, p)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("MatchPlatform() error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if idx != tt.idx {
+				t.Errorf("MatchPlatform() = %d, want %d", idx, tt.idx)
+			}
+		})
+	}
+}
+
+// distList are the GOOS/GOARCH pairs of go tool dist list
+var distList = []string{
+	"aix/ppc64", "android/386", "android/amd64", "android/arm", "android/arm64",
+	"darwin/386", "darwin/amd64", "darwin/arm", "darwin/arm64", "dragonfly/amd64",
+	"freebsd/386", "freebsd/amd64", "freebsd/arm", "freebsd/arm64", "illumos/amd64", "js/wasm",
+	"linux/386", "linux/amd64", "linux/arm", "linux/arm64", "linux/mips", "linux/mips64",
+	"linux/mips64le", "linux/mipsle", "linux/ppc64", "linux/ppc64le", "linux/riscv64", "linux/s390x",
+	"netbsd/386", "netbsd/amd64", "netbsd/arm", "netbsd/arm64", "openbsd/386", "openbsd/amd64",
+	"openbsd/arm", "openbsd/arm64", "plan9/386", "plan9/amd64", "plan9/arm", "solaris/amd64",
+	"windows/386", "windows/amd64", "windows/arm",
+}
+
+func TestParsePlatformDistList(t *testing.T) {
+	for _, s := range distList {
+		p, err := ParsePlatform(s)
+		if err != nil {
+			t.Errorf("ParsePlatform(%q) = %v", s, err)
+			continue
+		}
+		if len(p.Variant) > 0 {
+			t.Errorf("ParsePlatform(%q) has variant %q", s, p.Variant)
+		}
+		if got := p.String(); got != s {
+			t.Errorf("ParsePlatform(%q).String() = %q", s, got)
+		}
+	}
+}
+
+func TestParsePlatform(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Platform
+		err  bool
+	}{
+		{s: "linux/arm/v7", want: Platform{OS: "linux", Arch: "arm", Variant: "v7"}},
+		{s: "linux/arm64/v8", want: Platform{OS: "linux", Arch: "arm64", Variant: "v8"}},
+		{s: " Linux/AMD64 ", want: Platform{OS: "linux", Arch: "amd64"}},
+		{s: "", err: true},
+		{s: "linux", err: true},
+		{s: "linux/", err: true},
+		{s: "/amd64", err: true},
+		{s: "linux//v7", err: true},
+		{s: "linux/arm/", err: true},
+		{s: "linux/arm/v7/extra", err: true},
+	}
+	for _, tt := range tests {
+		p, err := ParsePlatform(tt.s)
+		if tt.err {
+			if err == nil {
+				t.Errorf("ParsePlatform(%q) = %+v, want an error", tt.s, p)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParsePlatform(%q) = %v", tt.s, err)
+			continue
+		}
+		if p != tt.want {
+			t.Errorf("ParsePlatform(%q) = %+v, want %+v", tt.s, p, tt.want)
+		}
+	}
+
+	if got := (Platform{OS: "linux", Arch: "arm", Variant: "v7"}).String(); got != "linux/arm/v7" {
+		t.Errorf("String() = %q, want linux/arm/v7", got)
+	}
+}
+
+func TestImagePlatform(t *testing.T) {
+	img := &Image{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763.1", Variant: ""}
+	want := Platform{OS: "windows", Arch: "amd64", OSVersion: "10.0.17763.1"}
+	if got := img.Platform(); got != want {
+		t.Errorf("Platform() = %+v, want %+v", got, want)
+	}
+
+	img = &Image{OS: "linux", Architecture: "arm", Variant: "v7"}
+	if got := img.Platform().String(); got != "linux/arm/v7" {
+		t.Errorf("Platform() = %s, want linux/arm/v7", got)
+	}
+}
+
+func TestDefaultPlatform(t *testing.T) {
+	p := DefaultPlatform()
+	if p.OS == "darwin" {
+		t.Error("DefaultPlatform() is darwin, images run in a linux VM")
+	}
+	if p.Arch != runtime.GOARCH {
+		t.Errorf("DefaultPlatform() arch = %s, want %s", p.Arch, runtime.GOARCH)
+	}
+	if _, err := ParsePlatform(p.String()); err != nil {
+		t.Errorf("DefaultPlatform() %s does not parse: %v", p, err)
+	}
+}
@@ -0,0 +1,54 @@
+package image
+
+import (
+	"errors"
+	"time"
+)
+
+// epoch is the timestamp reproducible builds (SOURCE_DATE_EPOCH=0) set
+var epoch = time.Unix(0, 0).UTC()
+
+// Reproducible returns true if the image has no build timestamps or
+// hostnames that change on every build: it and all its history entries were
+// created at the Unix epoch and neither the config nor the container config
+// sets a hostname or domain name.
+func (img *Image) Reproducible() bool {
+	if !img.Created.Equal(epoch) {
+		return false
+	}
+	for _, h := range img.History {
+		if !h.Created.Equal(epoch) {
+			return false
+		}
+	}
+	if img.Config != nil && (len(img.Config.Hostname) > 0 || len(img.Config.Domainname) > 0) {
+		return false
+	}
+	if len(img.ContainerConfig.Hostname) > 0 || len(img.ContainerConfig.Domainname) > 0 {
+		return false
+	}
+	return true
+}
+
+// ReproducibleVersion returns a copy of the image with every timestamp set
+// to the Unix epoch and the hostnames cleared so images built from the same
+// content compare equal
+func (img *Image) ReproducibleVersion() (*Image, error) {
+	if img == nil {
+		return nil, errors.New("image is nil")
+	}
+
+	clone := img.Clone()
+	clone.Created = epoch
+	for idx := range clone.History {
+		clone.History[idx].Created = epoch
+	}
+	if clone.Config != nil {
+		clone.Config.Hostname = ""
+		clone.Config.Domainname = ""
+	}
+	clone.ContainerConfig.Hostname = ""
+	clone.ContainerConfig.Domainname = ""
+
+	return clone, nil
+}
@@ -0,0 +1,96 @@
+package image
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+func loadImage(t *testing.T, name string) *Image {
+	t.Helper()
+	rawJSON, err := ioutil.ReadFile(filepath.Join("testdata", name+".config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := NewFromJSONStrict(rawJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func TestImageReproducible(t *testing.T) {
+	epochImage := func() *Image {
+		return &Image{Created: epoch, History: []HistoryEntry{{Created: epoch}, {Created: time.Unix(0, 0)}}, Config: &container.Config{}}
+	}
+	tests := []struct {
+		name string
+		img  *Image
+		want bool
+	}{
+		{name: "reproducible fixture", img: loadImage(t, "reproducible"), want: true},
+		{name: "non-reproducible fixture", img: loadImage(t, "non-reproducible"), want: false},
+		{name: "container hostname fixture", img: loadImage(t, "container-hostname"), want: false},
+		{name: "epoch", img: epochImage(), want: true},
+		{name: "no config", img: &Image{Created: epoch}, want: true},
+		{name: "zero created", img: &Image{}, want: false},
+		{name: "created", img: func() *Image { img := epochImage(); img.Created = epoch.Add(time.Second); return img }(), want: false},
+		{name: "history created", img: func() *Image { img := epochImage(); img.History[1].Created = time.Now(); return img }(), want: false},
+		{name: "hostname", img: func() *Image { img := epochImage(); img.Config.Hostname = "3b2a6c1d9e8f"; return img }(), want: false},
+		{name: "domainname", img: func() *Image { img := epochImage(); img.Config.Domainname = "example.com"; return img }(), want: false},
+		{name: "container domainname", img: func() *Image { img := epochImage(); img.ContainerConfig.Domainname = "example.com"; return img }(), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.img.Reproducible(); got != tt.want {
+				t.Errorf("Reproducible() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImageReproducibleVersion(t *testing.T) {
+	img := loadImage(t, "non-reproducible")
+	before, err := json.Marshal(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clone, err := img.ReproducibleVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !clone.Reproducible() {
+		t.Errorf("ReproducibleVersion() = %+v, want a reproducible image", clone)
+	}
+	if clone.ContainerConfig.Hostname != "" || clone.RawJSON() != nil {
+		t.Errorf("ReproducibleVersion() kept the container hostname %q or raw JSON", clone.ContainerConfig.Hostname)
+	}
+	if after, _ := json.Marshal(img); string(after) != string(before) || img.Reproducible() {
+		t.Error("ReproducibleVersion() changed the original image")
+	}
+
+	// images only differing in timestamps and hostnames are equal once reproducible
+	rebuilt := img.Clone()
+	rebuilt.Created = time.Now()
+	rebuilt.History[0].Created = time.Now()
+	rebuilt.ContainerConfig.Hostname = "f00dcafe0000"
+	rebuiltClone, err := rebuilt.ReproducibleVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := json.Marshal(clone)
+	b, _ := json.Marshal(rebuiltClone)
+	if string(a) != string(b) {
+		t.Errorf("reproducible versions differ:\n%s\n%s", a, b)
+	}
+
+	var nilImage *Image
+	if _, err := nilImage.ReproducibleVersion(); err == nil {
+		t.Error("ReproducibleVersion() of a nil image succeeded")
+	}
+}
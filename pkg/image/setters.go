@@ -0,0 +1,28 @@
+package image
+
+import "github.com/docker/docker/api/types/container"
+
+// SetConfig sets the runtime config of the image and drops the cached JSON
+// so RawJSON and MarshalJSON don't return the config from before the change
+func (img *Image) SetConfig(cfg *container.Config) {
+	img.Config = cfg
+	img.rawJSON = nil
+}
+
+// SetAuthor sets the author of the image
+func (img *Image) SetAuthor(author string) {
+	img.Author = author
+	img.rawJSON = nil
+}
+
+// SetComment sets the commit message of the image
+func (img *Image) SetComment(comment string) {
+	img.Comment = comment
+	img.rawJSON = nil
+}
+
+// SetDockerVersion sets the version of docker that built the image
+func (img *Image) SetDockerVersion(v string) {
+	img.DockerVersion = v
+	img.rawJSON = nil
+}
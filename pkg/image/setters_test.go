@@ -0,0 +1,107 @@
+package image
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestImageSetters(t *testing.T) {
+	tests := []struct {
+		name  string
+		set   func(img *Image)
+		check func(t *testing.T, img *Image)
+	}{
+		{
+			name: "SetConfig",
+			set:  func(img *Image) { img.SetConfig(&container.Config{User: "app", Env: []string{"FOO=bar"}}) },
+			check: func(t *testing.T, img *Image) {
+				if img.Config == nil || img.Config.User != "app" || len(img.Config.Env) != 1 || img.Config.Env[0] != "FOO=bar" {
+					t.Errorf("config = %+v, want user app with FOO=bar", img.Config)
+				}
+			},
+		},
+		{
+			name: "SetConfig nil",
+			set:  func(img *Image) { img.SetConfig(nil) },
+			check: func(t *testing.T, img *Image) {
+				if img.Config != nil {
+					t.Errorf("config = %+v, want none", img.Config)
+				}
+			},
+		},
+		{
+			name: "SetAuthor",
+			set:  func(img *Image) { img.SetAuthor("someone <someone@example.com>") },
+			check: func(t *testing.T, img *Image) {
+				if img.Author != "someone <someone@example.com>" {
+					t.Errorf("author = %q", img.Author)
+				}
+			},
+		},
+		{
+			name: "SetComment",
+			set:  func(img *Image) { img.SetComment("squashed") },
+			check: func(t *testing.T, img *Image) {
+				if img.Comment != "squashed" {
+					t.Errorf("comment = %q", img.Comment)
+				}
+			},
+		},
+		{
+			name: "SetDockerVersion",
+			set:  func(img *Image) { img.SetDockerVersion("24.0.7") },
+			check: func(t *testing.T, img *Image) {
+				if img.DockerVersion != "24.0.7" {
+					t.Errorf("docker version = %q", img.DockerVersion)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := NewFromJSON([]byte(validConfig))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if img.RawJSON() == nil {
+				t.Fatal("parsed image has no raw JSON")
+			}
+
+			tt.set(img)
+			if img.RawJSON() != nil {
+				t.Errorf("%s() kept the raw JSON", tt.name)
+			}
+			tt.check(t, img)
+
+			// the marshaled config has the change and the rest of the image
+			rawJSON, err := img.MarshalJSON()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var parsed Image
+			if err := json.Unmarshal(rawJSON, &parsed); err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, &parsed)
+			if parsed.Architecture != "amd64" || parsed.OS != "linux" || parsed.RootFS == nil {
+				t.Errorf("MarshalJSON() = %s, want the other fields kept", rawJSON)
+			}
+		})
+	}
+}
+
+func TestImageSettersWithoutRawJSON(t *testing.T) {
+	img := &Image{}
+	img.SetAuthor("someone")
+	img.SetComment("built by hand")
+	img.SetDockerVersion("20.10.0")
+	img.SetConfig(&container.Config{WorkingDir: "/app"})
+	if img.RawJSON() != nil {
+		t.Error("setters created raw JSON")
+	}
+	if img.Author != "someone" || img.Comment != "built by hand" || img.DockerVersion != "20.10.0" || img.Config.WorkingDir != "/app" {
+		t.Errorf("image = %+v, want every setter applied", img)
+	}
+}
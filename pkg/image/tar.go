@@ -0,0 +1,231 @@
+package image
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/wagoodman/dive/filetree"
+)
+
+var (
+	// ErrNoImageConfig is returned when an operation requires the image config
+	ErrNoImageConfig = errors.New("no image config attached")
+	// ErrMissingContent is returned when a layer's content is not in the image tar
+	ErrMissingContent = errors.New("layer content missing from image tar")
+)
+
+// FromImage creates a Tar from an image config and the layers its RootFS.DiffIDs describe
+func FromImage(img *Image, layers []Layer) (*Tar, error) {
+	i := &Tar{Layers: layers}
+	if err := i.AttachImage(img); err != nil {
+		return nil, err
+	}
+
+	for _, layer := range layers {
+		if layer == nil {
+			continue
+		}
+		i.RefTrees = append(i.RefTrees, layer.Tree())
+		i.SizeBytes += layer.Size()
+	}
+	i.DockerVersion = img.DockerVersion
+	if !img.Created.IsZero() {
+		i.Created = img.Created.String()
+	}
+
+	return i, nil
+}
+
+// ImageConfig returns the image config linked to the tar or nil if there is none
+func (i *Tar) ImageConfig() *Image {
+	return i.Config
+}
+
+// DiffID returns the uncompressed layer digest of the layer at layerIndex
+func (i *Tar) DiffID(layerIndex int) (digest.Digest, error) {
+	if i.Config == nil || i.Config.RootFS == nil {
+		return "", ErrNoImageConfig
+	}
+	if layerIndex < 0 || layerIndex >= len(i.Config.RootFS.DiffIDs) {
+		return "", fmt.Errorf("layer index %d out of range, image has %d layers", layerIndex, len(i.Config.RootFS.DiffIDs))
+	}
+	return digest.Digest(i.Config.RootFS.DiffIDs[layerIndex]), nil
+}
+
+// AttachImage links the image config to the tar after checking that it
+// describes the same number of layers
+func (i *Tar) AttachImage(img *Image) error {
+	if img == nil || img.RootFS == nil {
+		return ErrNoImageConfig
+	}
+	if len(img.RootFS.DiffIDs) != len(i.Layers) {
+		return fmt.Errorf("image has %d diff_ids but tar has %d layers", len(img.RootFS.DiffIDs), len(i.Layers))
+	}
+	i.Config = img
+	return nil
+}
+
+// LayerChain returns the layers from the base layer to the top most layer in
+// the order of the manifest, which docker keeps in line with RootFS.DiffIDs.
+// The layers carry no diff IDs so only their count is checked against the config.
+func (i *Tar) LayerChain() ([]Layer, error) {
+	if i.Config == nil || i.Config.RootFS == nil {
+		return nil, ErrNoImageConfig
+	}
+	if len(i.Config.RootFS.DiffIDs) != len(i.Layers) {
+		return nil, fmt.Errorf("image has %d diff_ids but tar has %d layers", len(i.Config.RootFS.DiffIDs), len(i.Layers))
+	}
+
+	chain := make([]Layer, len(i.Layers))
+	copy(chain, i.Layers)
+	for idx, layer := range chain {
+		if layer == nil {
+			return nil, fmt.Errorf("layer %d (%s) was not found in the tar", idx, i.Config.RootFS.DiffIDs[idx])
+		}
+	}
+
+	return chain, nil
+}
+
+// WriteLayerTar streams the uncompressed tar of layer from the image tar.gz r to w
+func (i *Tar) WriteLayerTar(r io.Reader, layer Layer, w io.Writer) error {
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	layerPath := layer.TarID() + ".tar"
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break // End of archive
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg || hdr.Name != layerPath {
+			continue
+		}
+
+		lgz, err := gzip.NewReader(tr)
+		if err != nil {
+			return err
+		}
+		defer lgz.Close()
+
+		_, err = io.Copy(w, lgz)
+		return err
+	}
+
+	return fmt.Errorf("%w: %s", ErrMissingContent, layerPath)
+}
+
+// Flatten merges the layers from base to top applying whiteouts and opaque
+// directories and returns a single layer representing the final filesystem of the image.
+func (i *Tar) Flatten() (Layer, error) {
+	chain, err := i.LayerChain()
+	if err != nil {
+		return nil, err
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("image has no layers to flatten")
+	}
+
+	tree := filetree.NewFileTree()
+	tree.Name = "<flattened>"
+
+	for _, layer := range chain {
+		if dl, ok := layer.(*dockerLayer); ok {
+			for _, dir := range dl.opaque {
+				if existing, err := tree.GetNode(path.Clean("/" + dir)); err == nil {
+					for _, child := range existing.Children {
+						child.Remove()
+					}
+				}
+			}
+		}
+		err := layer.Walk(func(node *filetree.FileNode) error {
+			if node.IsWhiteout() {
+				if existing, err := tree.GetNode(node.Path()); err == nil {
+					existing.Remove()
+				}
+				return SkipDir
+			}
+			// a file replacing a directory hides everything below it
+			if existing, err := tree.GetNode(node.Path()); err == nil && !FileIsDir(node) && len(existing.Children) > 0 {
+				existing.Remove()
+			}
+			_, _, err := tree.AddPath(node.Path(), node.Data.FileInfo)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tree.VisitDepthChildFirst(func(node *filetree.FileNode) error {
+		tree.FileSize += uint64(FileSize(node))
+		return nil
+	}, nil)
+
+	return &dockerLayer{
+		tarPath: chain[0].TarID() + ".tar",
+		history: HistoryEntry{
+			CreatedBy: "<flattened>",
+			Size:      tree.FileSize,
+		},
+		index:           0,
+		tree:            tree,
+		caseInsensitive: strings.EqualFold(i.Config.OS, "windows"),
+	}, nil
+}
+
+// TotalSize returns the sum of the sizes of all the layers
+func (i *Tar) TotalSize() int64 {
+	var total int64
+	for _, layer := range i.Layers {
+		if layer != nil {
+			total += int64(layer.Size())
+		}
+	}
+	return total
+}
+
+// UniqueSize returns the size of the layers not shared with any of the others.
+// Layers are considered shared when they have the same command and size.
+func (i *Tar) UniqueSize(others []*Tar) int64 {
+	type layerKey struct {
+		command string
+		size    uint64
+	}
+
+	shared := make(map[layerKey]bool)
+	for _, other := range others {
+		if other == nil || other == i {
+			continue
+		}
+		for _, layer := range other.Layers {
+			if layer != nil {
+				shared[layerKey{layer.Command(), layer.Size()}] = true
+			}
+		}
+	}
+
+	var unique int64
+	for _, layer := range i.Layers {
+		if layer != nil && !shared[layerKey{layer.Command(), layer.Size()}] {
+			unique += int64(layer.Size())
+		}
+	}
+	return unique
+}
@@ -0,0 +1,325 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/wagoodman/dive/filetree"
+)
+
+func imageWithLayers(n int) *Image {
+	img := &Image{OS: "linux", Architecture: "amd64", RootFS: &ImageRootFS{Type: rootFSTypeLayers}}
+	for idx := 0; idx < n; idx++ {
+		img.RootFS.DiffIDs = append(img.RootFS.DiffIDs, DiffID("sha256:"+testHex))
+	}
+	return img
+}
+
+func TestTarAttachImage(t *testing.T) {
+	i := &Tar{Layers: []Layer{newTestLayer(t, 0), newTestLayer(t, 1)}}
+
+	if err := i.AttachImage(nil); !errors.Is(err, ErrNoImageConfig) {
+		t.Errorf("AttachImage(nil) = %v, want ErrNoImageConfig", err)
+	}
+	if err := i.AttachImage(&Image{}); !errors.Is(err, ErrNoImageConfig) {
+		t.Errorf("AttachImage() without rootfs = %v, want ErrNoImageConfig", err)
+	}
+	if err := i.AttachImage(imageWithLayers(3)); err == nil {
+		t.Error("AttachImage() accepted an image with more diff_ids than layers")
+	}
+	if i.ImageConfig() != nil {
+		t.Error("a failed AttachImage() linked the image")
+	}
+
+	img := imageWithLayers(2)
+	if err := i.AttachImage(img); err != nil {
+		t.Fatal(err)
+	}
+	if i.ImageConfig() != img {
+		t.Error("ImageConfig() does not return the attached image")
+	}
+}
+
+func TestTarLayerChain(t *testing.T) {
+	base, middle, top := newTestLayer(t, 0), newTestLayer(t, 1), newTestLayer(t, 2)
+	i := &Tar{Layers: []Layer{base, middle, top}}
+
+	if _, err := i.LayerChain(); !errors.Is(err, ErrNoImageConfig) {
+		t.Errorf("LayerChain() without image = %v, want ErrNoImageConfig", err)
+	}
+	if err := i.AttachImage(imageWithLayers(3)); err != nil {
+		t.Fatal(err)
+	}
+
+	chain, err := i.LayerChain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for idx, want := range []Layer{base, middle, top} {
+		if chain[idx] != want {
+			t.Errorf("chain[%d] = layer %d, want layer %d", idx, chain[idx].Index(), want.Index())
+		}
+	}
+	chain[0] = top
+	if i.Layers[0] != base {
+		t.Error("LayerChain() returned the tar's layers instead of a copy")
+	}
+
+	i.Layers[1] = nil
+	if _, err := i.LayerChain(); err == nil {
+		t.Error("LayerChain() accepted a missing layer")
+	}
+	i.Layers = i.Layers[:2]
+	if _, err := i.LayerChain(); err == nil {
+		t.Error("LayerChain() accepted a layer count differing from the diff_ids")
+	}
+}
+
+// imageTarGz returns a gzipped tar holding the files, layer tars are gzipped like graboid writes them
+func imageTarGz(t *testing.T, files map[string][]byte) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		data := files[name]
+		if strings.HasSuffix(name, ".tar") {
+			var layer bytes.Buffer
+			lgz := gzip.NewWriter(&layer)
+			lgz.Write(data)
+			lgz.Close()
+			data = layer.Bytes()
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(data))}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write(data)
+	}
+	tw.Close()
+	gz.Close()
+	return &buf
+}
+
+func TestTarWriteLayerTar(t *testing.T) {
+	layerTar := []byte("uncompressed layer tar")
+	i := &Tar{}
+	l := newTestLayer(t, 0)
+
+	var out bytes.Buffer
+	err := i.WriteLayerTar(imageTarGz(t, map[string][]byte{
+		"manifest.json": []byte("[]"),
+		"b/layer.tar":   []byte("another layer"),
+		l.tarPath:       layerTar,
+	}), l, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), layerTar) {
+		t.Errorf("WriteLayerTar() = %q, want %q", out.Bytes(), layerTar)
+	}
+
+	err = i.WriteLayerTar(imageTarGz(t, map[string][]byte{"b/layer.tar": []byte("another layer")}), l, ioutil.Discard)
+	if !errors.Is(err, ErrMissingContent) {
+		t.Errorf("WriteLayerTar() of a missing layer = %v, want ErrMissingContent", err)
+	}
+}
+
+// flatten returns the paths of the flattened layers ordered from the base up
+func flatten(t *testing.T, layers ...[]filetree.FileInfo) []string {
+	t.Helper()
+	i := &Tar{}
+	for idx, files := range layers {
+		i.Layers = append(i.Layers, newTestLayer(t, idx, files...))
+	}
+	if err := i.AttachImage(imageWithLayers(len(layers))); err != nil {
+		t.Fatal(err)
+	}
+	flat, err := i.Flatten()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nodes []*filetree.FileNode
+	flat.Walk(func(node *filetree.FileNode) error {
+		nodes = append(nodes, node)
+		return nil
+	})
+	return paths(nodes)
+}
+
+func TestTarFlatten(t *testing.T) {
+	base := []filetree.FileInfo{dir("etc"), regular("etc/passwd", 100), regular("etc/motd", 20), dir("var/cache"), regular("var/cache/apt", 500)}
+	tests := []struct {
+		name   string
+		layers [][]filetree.FileInfo
+		want   []string
+	}{
+		{
+			name:   "single layer",
+			layers: [][]filetree.FileInfo{base},
+			want:   []string{"/etc", "/etc/motd", "/etc/passwd", "/var", "/var/cache", "/var/cache/apt"},
+		},
+		{
+			name:   "whiteouts",
+			layers: [][]filetree.FileInfo{base, {regular("etc/.wh.motd", 0), regular("var/.wh.cache", 0)}},
+			want:   []string{"/etc", "/etc/passwd", "/var"},
+		},
+		{
+			name:   "re-added after whiteout",
+			layers: [][]filetree.FileInfo{base, {regular("etc/.wh.motd", 0)}, {regular("etc/motd", 30)}},
+			want:   []string{"/etc", "/etc/motd", "/etc/passwd", "/var", "/var/cache", "/var/cache/apt"},
+		},
+		{
+			name:   "opaque directory",
+			layers: [][]filetree.FileInfo{base, {regular("var/cache/.wh..wh..opq", 0), regular("var/cache/pip", 10)}},
+			want:   []string{"/etc", "/etc/motd", "/etc/passwd", "/var", "/var/cache", "/var/cache/pip"},
+		},
+		{
+			name:   "opaque root",
+			layers: [][]filetree.FileInfo{base, {regular(".wh..wh..opq", 0), regular("app", 10)}},
+			want:   []string{"/app"},
+		},
+		{
+			name:   "file replaces directory",
+			layers: [][]filetree.FileInfo{base, {regular("var/cache", 5)}},
+			want:   []string{"/etc", "/etc/motd", "/etc/passwd", "/var", "/var/cache"},
+		},
+		{
+			name:   "empty layers",
+			layers: [][]filetree.FileInfo{nil, base, nil},
+			want:   []string{"/etc", "/etc/motd", "/etc/passwd", "/var", "/var/cache", "/var/cache/apt"},
+		},
+		{
+			name:   "only empty layers",
+			layers: [][]filetree.FileInfo{nil, nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := flatten(t, tt.layers...); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Flatten() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTarFlattenLayer(t *testing.T) {
+	i := &Tar{Layers: []Layer{
+		newTestLayer(t, 0, regular("etc/passwd", 100), regular("etc/motd", 20)),
+		newTestLayer(t, 1, regular("etc/motd", 30), regular("etc/.wh.passwd", 0)),
+	}}
+	if _, err := i.Flatten(); !errors.Is(err, ErrNoImageConfig) {
+		t.Errorf("Flatten() without image = %v, want ErrNoImageConfig", err)
+	}
+	if err := i.AttachImage(imageWithLayers(2)); err != nil {
+		t.Fatal(err)
+	}
+
+	flat, err := i.Flatten()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := flat.Command(); got != "<flattened>" {
+		t.Errorf("Command() = %q, want <flattened>", got)
+	}
+	if got := flat.TarID(); got != "a/layer" {
+		t.Errorf("TarID() = %q, want the base layer's a/layer", got)
+	}
+	if got := flat.TotalSize(); got != 30 {
+		t.Errorf("TotalSize() = %d, want 30", got)
+	}
+	if len(i.Layers[0].(*dockerLayer).tree.Root.Children["etc"].Children) != 2 {
+		t.Error("Flatten() modified the base layer")
+	}
+
+	empty := &Tar{}
+	if err := empty.AttachImage(imageWithLayers(0)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := empty.Flatten(); err == nil {
+		t.Error("Flatten() of an image without layers succeeded")
+	}
+}
+
+func TestTarProcessLayerTarOpaque(t *testing.T) {
+	var layer bytes.Buffer
+	gz := gzip.NewWriter(&layer)
+	tw := tar.NewWriter(gz)
+	for _, name := range []string{"var/cache/", "var/cache/.wh..wh..opq", "var/cache/pip", ".wh..wh..opq"} {
+		hdr := &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644}
+		if strings.HasSuffix(name, "/") {
+			hdr.Typeflag, hdr.Mode = tar.TypeDir, 0755
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+	gz.Close()
+
+	i := &Tar{}
+	if err := i.processLayerTar("a/layer.tar", 0, &layer); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := i.opaque[i.RefTrees[0]], []string{"var/cache", "."}; !reflect.DeepEqual(got, want) {
+		t.Errorf("opaque directories = %v, want %v", got, want)
+	}
+}
+
+// historyLayer returns an empty layer at index created by command with size bytes
+func historyLayer(t *testing.T, index int, command string, size uint64) Layer {
+	t.Helper()
+	l := newTestLayer(t, index)
+	l.history = HistoryEntry{CreatedBy: command, Size: size}
+	return l
+}
+
+func TestTarSizes(t *testing.T) {
+	base := historyLayer(t, 0, "/bin/sh -c #(nop) ADD file:rootfs in / ", 5000)
+	runtime := historyLayer(t, 1, "/bin/sh -c apk add python3", 3000)
+
+	app := &Tar{Layers: []Layer{base, runtime, historyLayer(t, 2, "/bin/sh -c #(nop) COPY dir:app in /app ", 200)}}
+	worker := &Tar{Layers: []Layer{
+		historyLayer(t, 0, "/bin/sh -c #(nop) ADD file:rootfs in / ", 5000),
+		historyLayer(t, 1, "/bin/sh -c apk add python3", 3000),
+		historyLayer(t, 2, "/bin/sh -c #(nop) COPY dir:worker in /app ", 100),
+	}}
+	// same command as the runtime layer but a different size is not shared
+	tool := &Tar{Layers: []Layer{base, historyLayer(t, 1, "/bin/sh -c apk add python3", 3500), nil}}
+
+	tests := []struct {
+		name   string
+		tar    *Tar
+		others []*Tar
+		total  int64
+		unique int64
+	}{
+		{name: "no others", tar: app, total: 8200, unique: 8200},
+		{name: "shares two layers", tar: app, others: []*Tar{worker, tool}, total: 8200, unique: 200},
+		{name: "itself is ignored", tar: app, others: []*Tar{app, nil}, total: 8200, unique: 8200},
+		{name: "shares only the size matching layer", tar: tool, others: []*Tar{app, worker}, total: 8500, unique: 3500},
+		{name: "worker", tar: worker, others: []*Tar{app, tool}, total: 8100, unique: 100},
+		{name: "empty", tar: &Tar{}, others: []*Tar{app}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.tar.TotalSize(); got != tt.total {
+				t.Errorf("TotalSize() = %d, want %d", got, tt.total)
+			}
+			if got := tt.tar.UniqueSize(tt.others); got != tt.unique {
+				t.Errorf("UniqueSize() = %d, want %d", got, tt.unique)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package image
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"time"
@@ -10,7 +11,11 @@ import (
 	"github.com/wagoodman/dive/filetree"
 )
 
-type diffID digest.Digest
+// rootFSTypeLayers is the only rootfs type of image configs
+const rootFSTypeLayers = "layers"
+
+// DiffID is the digest of an uncompressed layer tar
+type DiffID digest.Digest
 
 // Image is the image's config object
 type Image struct {
@@ -28,7 +33,7 @@ type Image struct {
 	ContainerConfig container.Config `json:"container_config,omitempty"`
 	// DockerVersion specifies the version of Docker that was used to build the image
 	DockerVersion string         `json:"docker_version,omitempty"`
-	History       []imageHistory `json:"history,omitempty"`
+	History       []HistoryEntry `json:"history,omitempty"`
 	// Author is the name of the author that was specified when committing the image
 	Author string `json:"author,omitempty"`
 	// Config is the configuration of the container received from the client
@@ -37,21 +42,30 @@ type Image struct {
 	Architecture string `json:"architecture,omitempty"`
 	// OS is the operating system used to build and run the image
 	OS string `json:"os,omitempty"`
+	// OSVersion is the version of the operating system (windows only)
+	OSVersion string `json:"os.version,omitempty"`
+	// Variant is the variant of the CPU architecture (e.g. v7 for arm)
+	Variant string `json:"variant,omitempty"`
 	// Size is the total size of the image including all layers it is composed of
-	Size   int64        `json:",omitempty"`
-	RootFS *imageRootFS `json:"rootfs,omitempty"`
+	Size int64 `json:",omitempty"`
+	// RootFS describes the layers of the image
+	RootFS *ImageRootFS `json:"rootfs,omitempty"`
+	// Annotations are the OCI manifest annotations of the image, they are not part of the config
+	Annotations map[string]string `json:"-"`
 
 	// rawJSON caches the immutable JSON associated with this image.
 	rawJSON []byte
 }
 
-type imageRootFS struct {
+// ImageRootFS lists the layers of the image by diff ID from the base layer up
+type ImageRootFS struct {
 	Type      string   `json:"type"`
-	DiffIDs   []diffID `json:"diff_ids,omitempty"`
+	DiffIDs   []DiffID `json:"diff_ids,omitempty"`
 	BaseLayer string   `json:"base_layer,omitempty"`
 }
 
-type imageHistory struct {
+// HistoryEntry is a single step of the image build history
+type HistoryEntry struct {
 	ID         string
 	Size       uint64
 	Created    time.Time `json:"created"`
@@ -66,6 +80,49 @@ func (img *Image) RawJSON() []byte {
 	return img.rawJSON
 }
 
+// MarshalJSON returns the raw JSON the image was parsed from so that
+// parsing and marshaling an image is lossless. Images without raw JSON
+// are marshaled from their fields.
+func (img *Image) MarshalJSON() ([]byte, error) {
+	if img.rawJSON != nil {
+		return img.rawJSON, nil
+	}
+	// alias drops the MarshalJSON method to avoid recursing
+	type alias Image
+	return json.Marshal((*alias)(img))
+}
+
+// configJSON returns the raw JSON of the image or its canonical JSON when
+// the image was not parsed from JSON
+func (img *Image) configJSON() ([]byte, error) {
+	if img.rawJSON != nil {
+		return img.rawJSON, nil
+	}
+	return canonicalJSON(img)
+}
+
+// ConfigDigest returns the content-addressable digest of the image config
+func (img *Image) ConfigDigest() (digest.Digest, error) {
+	raw, err := img.configJSON()
+	if err != nil {
+		return "", err
+	}
+	return digest.FromBytes(raw), nil
+}
+
+// ShortID returns the first 12 hex characters of the config digest like docker does
+func (img *Image) ShortID() string {
+	d, err := img.ConfigDigest()
+	if err != nil {
+		return ""
+	}
+	id := d.Hex()
+	if len(id) > 12 {
+		id = id[:12]
+	}
+	return id
+}
+
 // NewFromJSON creates an Image configuration from json.
 func NewFromJSON(src []byte) (*Image, error) {
 	img := &Image{}
@@ -79,13 +136,40 @@ func NewFromJSON(src []byte) (*Image, error) {
 	return img, nil
 }
 
+// NewFromJSONContext creates an Image configuration from json and returns
+// ctx.Err() if ctx is done before the json has been decoded.
+func NewFromJSONContext(ctx context.Context, src []byte) (*Image, error) {
+	type result struct {
+		img *Image
+		err error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		img, err := NewFromJSON(src)
+		done <- result{img: img, err: err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-done:
+		return res.img, res.err
+	}
+}
+
 // Manifest is the image manifest struct
 type Manifest struct {
 	Config   string   `json:"Config,omitempty"`
 	Layers   []string `json:"Layers,omitempty"`
 	RepoTags []string `json:"RepoTags,omitempty"`
+	// Platform is the platform of the image config, populated during pull
+	Platform *Platform `json:"Platform,omitempty"`
 }
 
+// Manifests is the list of image manifests found in an image tar's manifest.json
+type Manifests []Manifest
+
 // Tar is the image's tar object
 type Tar struct {
 	Tag           string
@@ -97,4 +181,7 @@ type Tar struct {
 	RefTrees      []*filetree.FileTree
 	SizeBytes     uint64
 	UserSizeByes  uint64 // this is all bytes except for the base image
+
+	// opaque holds the opaque directories of each layer tree, the filetree drops their markers
+	opaque map[*filetree.FileTree][]string
 }
@@ -0,0 +1,28 @@
+//go:build go1.18
+// +build go1.18
+
+package image
+
+import (
+	"bytes"
+	"testing"
+)
+
+func FuzzImageMarshalJSON(f *testing.F) {
+	f.Add([]byte(validConfig))
+	f.Add([]byte(`{"rootfs":{"type":"layers","diff_ids":[]}}`))
+	f.Add([]byte(`{"architecture":"arm64","variant":"v8","os":"linux","config":{"Env":["PATH=/bin"]},"rootfs":{"type":"layers"},"history":[{"created_by":"/bin/sh -c #(nop) CMD [\"sh\"]","empty_layer":true}]}`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		img, err := NewFromJSON(data)
+		if err != nil {
+			return
+		}
+		raw, err := img.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(raw, data) {
+			t.Errorf("MarshalJSON() = %q, want the parsed %q", raw, data)
+		}
+	})
+}
@@ -0,0 +1,177 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/opencontainers/go-digest"
+)
+
+// largeConfig returns an image config of about size bytes made of history entries
+func largeConfig(size int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers"},"history":[`)
+	for idx := 0; buf.Len() < size; idx++ {
+		if idx > 0 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(&buf, `{"created":"2020-01-01T00:00:00Z","created_by":"/bin/sh -c #(nop) RUN step %d","empty_layer":true}`, idx)
+	}
+	buf.WriteString(`]}`)
+	return buf.Bytes()
+}
+
+func TestNewFromJSONContext(t *testing.T) {
+	img, err := NewFromJSONContext(context.Background(), []byte(validConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.OS != "linux" || string(img.RawJSON()) != validConfig {
+		t.Errorf("NewFromJSONContext() = %+v", img)
+	}
+
+	if _, err := NewFromJSONContext(context.Background(), []byte(`{}`)); err == nil {
+		t.Error("NewFromJSONContext() did not return the NewFromJSON error")
+	}
+}
+
+func TestNewFromJSONContextCancelled(t *testing.T) {
+	if testing.Short() {
+		t.Skip("decodes a 50 MB config")
+	}
+	src := largeConfig(50 << 20)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	img, err := NewFromJSONContext(ctx, src)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("NewFromJSONContext() error = %v, want context.Canceled", err)
+	}
+	if img != nil {
+		t.Error("NewFromJSONContext() returned an image after it was cancelled")
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := NewFromJSONContext(ctx, src); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("NewFromJSONContext() error = %v, want context.DeadlineExceeded", err)
+	}
+
+}
+
+func TestImageConfigDigest(t *testing.T) {
+	first, err := NewFromJSON([]byte(validConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewFromJSON([]byte(validConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d1, err := first.ConfigDigest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d2, err := second.ConfigDigest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d1 != d2 {
+		t.Errorf("parsing the same JSON twice gave digests %s and %s", d1, d2)
+	}
+	if want := digest.FromString(validConfig); d1 != want {
+		t.Errorf("ConfigDigest() = %s, want the digest of the raw JSON %s", d1, want)
+	}
+	if d, _ := first.ConfigDigest(); d != d1 {
+		t.Errorf("ConfigDigest() changed between calls: %s, %s", d1, d)
+	}
+	if got := first.ShortID(); got != d1.Hex()[:12] {
+		t.Errorf("ShortID() = %q, want %q", got, d1.Hex()[:12])
+	}
+}
+
+func TestImageConfigDigestProgrammatic(t *testing.T) {
+	build := func() *Image {
+		return &Image{
+			OS:           "linux",
+			Architecture: "amd64",
+			Config:       &container.Config{Env: []string{"PATH=/bin"}, Labels: map[string]string{"b": "2", "a": "1"}},
+			RootFS:       &ImageRootFS{Type: rootFSTypeLayers, DiffIDs: []DiffID{DiffID("sha256:" + testHex)}},
+		}
+	}
+	d1, err := build().ConfigDigest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d2, err := build().ConfigDigest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d1 != d2 || d1.Validate() != nil {
+		t.Errorf("equal images gave digests %s and %s", d1, d2)
+	}
+
+	changed := build()
+	changed.Architecture = "arm64"
+	if d, _ := changed.ConfigDigest(); d == d1 {
+		t.Error("ConfigDigest() did not change with the config")
+	}
+	if got := build().ShortID(); len(got) != 12 || got != d1.Hex()[:12] {
+		t.Errorf("ShortID() = %q, want %q", got, d1.Hex()[:12])
+	}
+}
+
+func TestImageMarshalJSON(t *testing.T) {
+	img, err := NewFromJSON([]byte(validConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := img.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(raw) != validConfig {
+		t.Errorf("MarshalJSON() = %s, want the parsed JSON %s", raw, validConfig)
+	}
+
+	// encoding/json compacts the output of marshalers
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, []byte(validConfig)); err != nil {
+		t.Fatal(err)
+	}
+	raw, err = json.Marshal(struct{ Image *Image }{img})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"Image":` + compact.String() + `}`; string(raw) != want {
+		t.Errorf("json.Marshal() = %s, want %s", raw, want)
+	}
+}
+
+func TestImageMarshalJSONProgrammatic(t *testing.T) {
+	img := &Image{OS: "linux", Architecture: "arm64", Variant: "v8", RootFS: &ImageRootFS{Type: rootFSTypeLayers, DiffIDs: []DiffID{DiffID("sha256:" + testHex)}}}
+	raw, err := json.Marshal(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := NewFromJSON(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.OS != img.OS || parsed.Architecture != img.Architecture || parsed.Variant != img.Variant || len(parsed.RootFS.DiffIDs) != 1 {
+		t.Errorf("NewFromJSON(json.Marshal()) = %+v, want %+v", parsed, img)
+	}
+	again, err := parsed.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again, raw) {
+		t.Errorf("MarshalJSON() after a round trip = %s, want %s", again, raw)
+	}
+}
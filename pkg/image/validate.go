@@ -0,0 +1,153 @@
+package image
+
+import (
+	_ "crypto/sha256" // register sha256 for digest validation
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// repoTagRegexp matches a [registry[:port]/]name:tag image reference
+var repoTagRegexp = regexp.MustCompile(`^(?:[a-zA-Z0-9.-]+(?::[0-9]+)?/)?[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*:[a-zA-Z0-9_][a-zA-Z0-9_.-]{0,127}$`)
+
+// FieldError describes a single field that failed validation
+type FieldError struct {
+	Field  string
+	Reason string
+}
+
+func (fe FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", fe.Field, fe.Reason)
+}
+
+// ValidationError is returned when an image config fails strict validation
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (ve *ValidationError) Error() string {
+	var reasons []string
+	for _, fe := range ve.Fields {
+		reasons = append(reasons, fe.Error())
+	}
+	return "invalid image JSON: " + strings.Join(reasons, ", ")
+}
+
+// Has returns true if the given field failed validation
+func (ve *ValidationError) Has(field string) bool {
+	for _, fe := range ve.Fields {
+		if fe.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+func (ve *ValidationError) add(field, reason string) {
+	ve.Fields = append(ve.Fields, FieldError{Field: field, Reason: reason})
+}
+
+// NewFromJSONStrict creates an Image configuration from json and validates
+// that all the fields required to identify and run the image are present.
+func NewFromJSONStrict(src []byte) (*Image, error) {
+	img, err := NewFromJSON(src)
+	if err != nil {
+		return img, err
+	}
+	if err := img.validate(); err != nil {
+		return img, err
+	}
+	return img, nil
+}
+
+func (img *Image) validate() error {
+	ve := &ValidationError{}
+
+	if img.Created.IsZero() {
+		ve.add("created", "must be set")
+	}
+	if len(img.Architecture) == 0 {
+		ve.add("architecture", "must not be empty")
+	}
+	if len(img.OS) == 0 {
+		ve.add("os", "must not be empty")
+	}
+	img.RootFS.validate(ve)
+
+	if len(ve.Fields) > 0 {
+		return ve
+	}
+	return nil
+}
+
+// Validate checks the rootfs is set, its type is layers and every diff ID is a valid digest
+func (rootfs *ImageRootFS) Validate() error {
+	ve := &ValidationError{}
+	rootfs.validate(ve)
+	if len(ve.Fields) > 0 {
+		return ve
+	}
+	return nil
+}
+
+func (rootfs *ImageRootFS) validate(ve *ValidationError) {
+	if rootfs == nil {
+		ve.add("rootfs", "must be set")
+		return
+	}
+	if rootfs.Type != rootFSTypeLayers {
+		ve.add("rootfs.type", fmt.Sprintf("must be %q", rootFSTypeLayers))
+	}
+	for idx, id := range rootfs.DiffIDs {
+		if err := id.Validate(); err != nil {
+			ve.add(fmt.Sprintf("rootfs.diff_ids[%d]", idx), err.Error())
+		}
+	}
+}
+
+// ManifestValidationError is returned when a manifest fails validation
+type ManifestValidationError struct {
+	ValidationError
+}
+
+func (mve *ManifestValidationError) Error() string {
+	var reasons []string
+	for _, fe := range mve.Fields {
+		reasons = append(reasons, fe.Error())
+	}
+	return "invalid manifest: " + strings.Join(reasons, ", ")
+}
+
+// Validate checks that the manifest references a config, has no empty or
+// duplicate layers and that every repo tag is in name:tag format
+func (m *Manifest) Validate() error {
+	mve := &ManifestValidationError{}
+
+	if len(m.Config) == 0 {
+		mve.add("Config", "must not be empty")
+	}
+
+	seen := make(map[string]bool, len(m.Layers))
+	for idx, layer := range m.Layers {
+		field := fmt.Sprintf("Layers[%d]", idx)
+		if len(layer) == 0 {
+			mve.add(field, "must not be empty")
+			continue
+		}
+		if seen[layer] {
+			mve.add(field, fmt.Sprintf("duplicate layer %s", layer))
+		}
+		seen[layer] = true
+	}
+
+	for idx, tag := range m.RepoTags {
+		if !repoTagRegexp.MatchString(tag) {
+			mve.add(fmt.Sprintf("RepoTags[%d]", idx), fmt.Sprintf("%q is not in name:tag format", tag))
+		}
+	}
+
+	if len(mve.Fields) > 0 {
+		return mve
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package image
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const validConfig = `{
+	"architecture": "amd64",
+	"os": "linux",
+	"created": "2020-01-01T00:00:00Z",
+	"rootfs": {"type": "layers", "diff_ids": ["sha256:` + testHex + `"]}
+}`
+
+const testHex = "5f70bf18a086007016e948b04aed3b82103a36bea41755b6cddfaf10ace3c6ef"
+
+func TestNewFromJSONStrict(t *testing.T) {
+	tests := []struct {
+		name   string
+		json   string
+		fields []string
+	}{
+		{name: "valid", json: validConfig},
+		{
+			name:   "missing fields",
+			json:   `{"rootfs": {"type": "layers"}}`,
+			fields: []string{"created", "architecture", "os"},
+		},
+		{
+			name:   "bad rootfs",
+			json:   `{"architecture": "arm64", "os": "linux", "created": "2020-01-01T00:00:00Z", "rootfs": {"type": "tar", "diff_ids": ["sha256:abc", "md5:` + testHex + `", "sha256:` + testHex + `"]}}`,
+			fields: []string{"rootfs.type", "rootfs.diff_ids[0]", "rootfs.diff_ids[1]"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := NewFromJSONStrict([]byte(tt.json))
+			if len(tt.fields) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if img.Architecture != "amd64" {
+					t.Errorf("parsed %+v", img)
+				}
+				return
+			}
+
+			var ve *ValidationError
+			if !errors.As(err, &ve) {
+				t.Fatalf("NewFromJSONStrict() error = %v, want a ValidationError", err)
+			}
+			if len(ve.Fields) != len(tt.fields) {
+				t.Errorf("failed fields %v, want %v", ve.Fields, tt.fields)
+			}
+			for _, field := range tt.fields {
+				if !ve.Has(field) {
+					t.Errorf("%s did not fail validation: %v", field, ve)
+				}
+			}
+		})
+	}
+}
+
+func TestNewFromJSONStrictNoRootFS(t *testing.T) {
+	if _, err := NewFromJSONStrict([]byte(`{"architecture": "amd64", "os": "linux"}`)); err == nil {
+		t.Error("NewFromJSONStrict() accepted a config without rootfs")
+	}
+}
+
+func TestNewFromJSONIsLenient(t *testing.T) {
+	if _, err := NewFromJSON([]byte(`{"rootfs": {"type": "layers"}}`)); err != nil {
+		t.Errorf("NewFromJSON() = %v, only strict mode checks the fields", err)
+	}
+}
+
+func TestManifestValidate(t *testing.T) {
+	valid := Manifest{
+		Config:   testHex + ".json",
+		RepoTags: []string{"alpine:3.12", "localhost:5000/library/alpine:latest"},
+		Layers:   []string{"a/layer.tar", "b/layer.tar"},
+	}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+	if err := (&Manifest{Config: "config.json"}).Validate(); err != nil {
+		t.Errorf("Validate() of a manifest without layers or tags = %v", err)
+	}
+}
+
+func TestManifestValidateAllProblems(t *testing.T) {
+	m := &Manifest{
+		RepoTags: []string{"alpine:3.12", "alpine", "Alpine:latest", "alpine:-bad"},
+		Layers:   []string{"a/layer.tar", "", "b/layer.tar", "a/layer.tar"},
+	}
+	err := m.Validate()
+	var mve *ManifestValidationError
+	if !errors.As(err, &mve) {
+		t.Fatalf("Validate() = %v, want a ManifestValidationError", err)
+	}
+
+	want := []string{"Config", "Layers[1]", "Layers[3]", "RepoTags[1]", "RepoTags[2]", "RepoTags[3]"}
+	if len(mve.Fields) != len(want) {
+		t.Fatalf("Validate() = %v, want errors for %v", err, want)
+	}
+	for idx, field := range want {
+		if mve.Fields[idx].Field != field {
+			t.Errorf("Fields[%d] = %v, want an error for %s", idx, mve.Fields[idx], field)
+		}
+	}
+	if !strings.HasPrefix(err.Error(), "invalid manifest: Config: must not be empty, ") {
+		t.Errorf("Error() = %q", err.Error())
+	}
+}
+
+func TestImageRootFSValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		rootfs *ImageRootFS
+		fields []string
+	}{
+		{name: "valid", rootfs: &ImageRootFS{Type: "layers", DiffIDs: []DiffID{"sha256:" + testHex}}},
+		{name: "no layers", rootfs: &ImageRootFS{Type: "layers"}},
+		{name: "nil", rootfs: nil, fields: []string{"rootfs"}},
+		{name: "type", rootfs: &ImageRootFS{Type: "tar"}, fields: []string{"rootfs.type"}},
+		{
+			name:   "diff ids",
+			rootfs: &ImageRootFS{Type: "layers", DiffIDs: []DiffID{"sha256:" + testHex, "sha256:abc", DiffID(testHex)}},
+			fields: []string{"rootfs.diff_ids[1]", "rootfs.diff_ids[2]"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rootfs.Validate()
+			if len(tt.fields) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			var ve *ValidationError
+			if !errors.As(err, &ve) || len(ve.Fields) != len(tt.fields) {
+				t.Fatalf("Validate() = %v, want a ValidationError for %v", err, tt.fields)
+			}
+			for _, field := range tt.fields {
+				if !ve.Has(field) {
+					t.Errorf("%s did not fail validation: %v", field, ve)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package image
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/wagoodman/dive/filetree"
+)
+
+// SkipDir can be returned by a WalkFunc to skip the children of the visited node
+var SkipDir = errors.New("skip this directory")
+
+// WalkFunc is called for every node visited by Walk
+type WalkFunc func(node *filetree.FileNode) error
+
+// Walk visits node and then each of its children depth-first in name order.
+// It returns the first error returned by fn other than SkipDir.
+// Nodes are visited at most once so malformed trees cannot loop forever.
+func Walk(node *filetree.FileNode, fn WalkFunc) error {
+	return walk(node, fn, make(map[*filetree.FileNode]bool))
+}
+
+func walk(node *filetree.FileNode, fn WalkFunc, visited map[*filetree.FileNode]bool) error {
+	if node == nil || visited[node] {
+		return nil
+	}
+	visited[node] = true
+
+	if err := fn(node); err != nil {
+		if err == SkipDir {
+			return nil
+		}
+		return err
+	}
+
+	var names []string
+	for name := range node.Children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := walk(node.Children[name], fn, visited); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package image
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/wagoodman/dive/filetree"
+)
+
+func TestWalk(t *testing.T) {
+	l := newTestLayer(t, 0, regular("b/2", 1), regular("a/1", 1), regular("b/1", 1), regular("c", 1))
+
+	var visited []string
+	err := Walk(l.tree.Root.Children["b"], func(node *filetree.FileNode) error {
+		visited = append(visited, node.Path())
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"/b", "/b/1", "/b/2"}; !reflect.DeepEqual(visited, want) {
+		t.Errorf("Walk() visited %v, want %v", visited, want)
+	}
+}
+
+func TestLayerWalk(t *testing.T) {
+	l := newTestLayer(t, 0, regular("b/2", 1), regular("a/1", 1), regular("b/1", 1), regular("c", 1))
+
+	tests := []struct {
+		name string
+		fn   func(node *filetree.FileNode) error
+		want []string
+		err  error
+	}{
+		{
+			name: "all",
+			want: []string{"/a", "/a/1", "/b", "/b/1", "/b/2", "/c"},
+		},
+		{
+			name: "skip dir",
+			fn: func(node *filetree.FileNode) error {
+				if node.Path() == "/a" {
+					return SkipDir
+				}
+				return nil
+			},
+			want: []string{"/a", "/b", "/b/1", "/b/2", "/c"},
+		},
+		{
+			name: "error stops the walk",
+			fn: func(node *filetree.FileNode) error {
+				if node.Path() == "/b/1" {
+					return errTest
+				}
+				return nil
+			},
+			want: []string{"/a", "/a/1", "/b", "/b/1"},
+			err:  errTest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var visited []string
+			err := l.Walk(func(node *filetree.FileNode) error {
+				visited = append(visited, node.Path())
+				if tt.fn != nil {
+					return tt.fn(node)
+				}
+				return nil
+			})
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Walk() error = %v, want %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(visited, tt.want) {
+				t.Errorf("Walk() visited %v, want %v", visited, tt.want)
+			}
+		})
+	}
+}
+
+var errTest = errors.New("test error")
+
+func TestWalkCycle(t *testing.T) {
+	l := newTestLayer(t, 0, regular("a/b/c", 1))
+	a := l.tree.Root.Children["a"]
+	b := a.Children["b"]
+	// children pointing back to their parents must not loop forever
+	b.Children["loop"] = a
+	b.Children["self"] = b
+	a.Children["root"] = l.tree.Root
+
+	visits := make(map[*filetree.FileNode]int)
+	if err := l.Walk(func(node *filetree.FileNode) error {
+		visits[node]++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for node, n := range visits {
+		if n != 1 {
+			t.Errorf("%s visited %d times", node.Name, n)
+		}
+	}
+	if visits[a] != 1 || visits[b] != 1 || visits[b.Children["c"]] != 1 {
+		t.Errorf("Walk() did not visit every node once: %v", visits)
+	}
+}
@@ -0,0 +1,44 @@
+package image
+
+import (
+	"path"
+	"strings"
+)
+
+const (
+	whiteoutPrefix = ".wh."
+	opaqueWhiteout = ".wh..wh..opq"
+)
+
+// IsWhiteout returns true if the tar entry name marks a file deleted from a
+// lower layer. Names whose target would be the directory itself or its
+// parent (.wh.. and .wh...) are not whiteouts.
+func IsWhiteout(name string) bool {
+	base := path.Base(name)
+	if !strings.HasPrefix(base, whiteoutPrefix) {
+		return false
+	}
+	switch strings.TrimPrefix(base, whiteoutPrefix) {
+	case "", ".", "..":
+		return false
+	}
+	return true
+}
+
+// IsOpaqueWhiteout returns true if the tar entry name marks its directory as opaque
+func IsOpaqueWhiteout(name string) bool {
+	return path.Base(name) == opaqueWhiteout
+}
+
+// WhiteoutTarget returns the path deleted by the whiteout entry name or an
+// empty string if name is not a whiteout. For opaque whiteouts this is the
+// directory whose lower layer contents are hidden.
+func WhiteoutTarget(name string) string {
+	if IsOpaqueWhiteout(name) {
+		return path.Dir(name)
+	}
+	if !IsWhiteout(name) {
+		return ""
+	}
+	return path.Join(path.Dir(name), strings.TrimPrefix(path.Base(name), whiteoutPrefix))
+}
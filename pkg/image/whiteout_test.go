@@ -0,0 +1,45 @@
+package image
+
+import "testing"
+
+func TestWhiteout(t *testing.T) {
+	tests := []struct {
+		name     string
+		whiteout bool
+		opaque   bool
+		target   string
+	}{
+		{name: ".wh.file", whiteout: true, target: "file"},
+		{name: "etc/.wh.motd", whiteout: true, target: "etc/motd"},
+		{name: "./etc/.wh.motd", whiteout: true, target: "etc/motd"},
+		{name: "etc/.wh..hidden", whiteout: true, target: "etc/.hidden"},
+		{name: "var/.wh..wh..opq", whiteout: true, opaque: true, target: "var"},
+		{name: ".wh..wh..opq", whiteout: true, opaque: true, target: "."},
+		{name: ""},
+		{name: ".wh."},
+		{name: "etc/.wh."},
+		{name: ".wh"},
+		{name: ".whfile"},
+		{name: "etc/.wh"},
+		{name: "file.wh.txt"},
+		{name: ".wh.dir/file"},
+		// the target would be the whiteout's directory or its parent
+		{name: ".wh.."},
+		{name: ".wh..."},
+		{name: "etc/.wh.."},
+		{name: "etc/.wh..."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsWhiteout(tt.name); got != tt.whiteout {
+				t.Errorf("IsWhiteout() = %t, want %t", got, tt.whiteout)
+			}
+			if got := IsOpaqueWhiteout(tt.name); got != tt.opaque {
+				t.Errorf("IsOpaqueWhiteout() = %t, want %t", got, tt.opaque)
+			}
+			if got := WhiteoutTarget(tt.name); got != tt.target {
+				t.Errorf("WhiteoutTarget() = %q, want %q", got, tt.target)
+			}
+		})
+	}
+}
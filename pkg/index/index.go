@@ -0,0 +1,142 @@
+package index
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/blacktop/graboid/pkg/image"
+	"github.com/opencontainers/go-digest"
+)
+
+// ErrNotIndex is returned when parsing JSON that is not an image index
+var ErrNotIndex = errors.New("not an image index")
+
+// Index is an OCI image index (or Docker manifest list) listing a manifest per platform
+type Index struct {
+	SchemaVersion int
+	MediaType     string
+	Manifests     []IndexEntry
+	Annotations   map[string]string
+}
+
+// IndexEntry is the descriptor of a manifest in the index.
+// Entries of non-image artifacts like attestations have no platform.
+type IndexEntry struct {
+	MediaType   string
+	Size        int64
+	Digest      digest.Digest
+	Platform    image.Platform
+	Annotations map[string]string
+}
+
+// HasPlatform returns true if the entry says what platform its manifest is for
+func (e IndexEntry) HasPlatform() bool {
+	return e.Platform != image.Platform{}
+}
+
+// Descriptor returns the entry as an image descriptor
+func (e IndexEntry) Descriptor() image.Descriptor {
+	desc := image.Descriptor{
+		MediaType:   e.MediaType,
+		Digest:      e.Digest,
+		Size:        e.Size,
+		Annotations: e.Annotations,
+	}
+	if e.HasPlatform() {
+		p := e.Platform
+		desc.Platform = &p
+	}
+	return desc
+}
+
+// rawIndex is the JSON form of an Index
+type rawIndex struct {
+	SchemaVersion int                `json:"schemaVersion"`
+	MediaType     string             `json:"mediaType,omitempty"`
+	Manifests     []image.Descriptor `json:"manifests"`
+	Annotations   map[string]string  `json:"annotations,omitempty"`
+}
+
+// ParseIndex parses an OCI image index or Docker manifest list
+func ParseIndex(data []byte) (*Index, error) {
+	var raw rawIndex
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	if raw.SchemaVersion != 2 {
+		return nil, fmt.Errorf("%w: unsupported schema version %d", ErrNotIndex, raw.SchemaVersion)
+	}
+	switch raw.MediaType {
+	case "", image.MediaTypeOCIIndex, image.MediaTypeDockerManifestList:
+	default:
+		return nil, fmt.Errorf("%w: media type is %s", ErrNotIndex, raw.MediaType)
+	}
+	if raw.Manifests == nil {
+		return nil, fmt.Errorf("%w: no manifests key", ErrNotIndex)
+	}
+
+	idx := &Index{
+		SchemaVersion: raw.SchemaVersion,
+		MediaType:     raw.MediaType,
+		Manifests:     make([]IndexEntry, len(raw.Manifests)),
+		Annotations:   raw.Annotations,
+	}
+	for i, desc := range raw.Manifests {
+		if err := desc.Digest.Validate(); err != nil {
+			return nil, fmt.Errorf("manifest %d: %w", i, err)
+		}
+		entry := IndexEntry{
+			MediaType:   desc.MediaType,
+			Size:        desc.Size,
+			Digest:      desc.Digest,
+			Annotations: desc.Annotations,
+		}
+		if desc.Platform != nil {
+			entry.Platform = *desc.Platform
+		}
+		idx.Manifests[i] = entry
+	}
+	return idx, nil
+}
+
+// ForPlatform returns the entry of the manifest built for p. A platform
+// without a variant matches any variant of the same os/arch when there is
+// no exact match.
+func (idx *Index) ForPlatform(p image.Platform) (*IndexEntry, error) {
+	platforms := make([]*image.Platform, len(idx.Manifests))
+	for i := range idx.Manifests {
+		if idx.Manifests[i].HasPlatform() {
+			platforms[i] = &idx.Manifests[i].Platform
+		}
+	}
+	i, err := image.MatchPlatform(platforms, p)
+	if err != nil {
+		return nil, err
+	}
+	return &idx.Manifests[i], nil
+}
+
+// MarshalJSON returns the index in the OCI JSON format, entries without a platform have no platform key
+func (idx *Index) MarshalJSON() ([]byte, error) {
+	raw := rawIndex{
+		SchemaVersion: idx.SchemaVersion,
+		MediaType:     idx.MediaType,
+		Manifests:     make([]image.Descriptor, len(idx.Manifests)),
+		Annotations:   idx.Annotations,
+	}
+	for i, entry := range idx.Manifests {
+		raw.Manifests[i] = entry.Descriptor()
+	}
+	return json.Marshal(raw)
+}
+
+// UnmarshalJSON parses the index like ParseIndex
+func (idx *Index) UnmarshalJSON(data []byte) error {
+	parsed, err := ParseIndex(data)
+	if err != nil {
+		return err
+	}
+	*idx = *parsed
+	return nil
+}
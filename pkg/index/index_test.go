@@ -0,0 +1,194 @@
+package index
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/blacktop/graboid/pkg/image"
+)
+
+func loadIndex(t *testing.T, name string) *Index {
+	t.Helper()
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err := ParseIndex(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return idx
+}
+
+func TestParseIndex(t *testing.T) {
+	tests := []struct {
+		fixture   string
+		mediaType string
+		platforms []string
+	}{
+		{
+			fixture:   "alpine.manifest-list.json",
+			mediaType: image.MediaTypeDockerManifestList,
+			platforms: []string{"linux/amd64", "linux/arm/v6", "linux/arm/v7", "linux/arm64/v8", "linux/386", "linux/ppc64le", "linux/s390x"},
+		},
+		{
+			fixture:   "buildkit.index.json",
+			mediaType: image.MediaTypeOCIIndex,
+			platforms: []string{"linux/amd64", "linux/arm64", "unknown/unknown", "unknown/unknown"},
+		},
+		{
+			fixture:   "windows.manifest-list.json",
+			mediaType: image.MediaTypeDockerManifestList,
+			platforms: []string{"windows/amd64", "windows/amd64", "linux/amd64"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			idx := loadIndex(t, tt.fixture)
+			if idx.SchemaVersion != 2 || idx.MediaType != tt.mediaType {
+				t.Errorf("parsed schema %d %s, want 2 %s", idx.SchemaVersion, idx.MediaType, tt.mediaType)
+			}
+			var platforms []string
+			for _, entry := range idx.Manifests {
+				platforms = append(platforms, entry.Platform.String())
+				if err := entry.Digest.Validate(); err != nil || entry.Size == 0 || entry.MediaType == "" {
+					t.Errorf("entry %+v is incomplete", entry)
+				}
+			}
+			if !reflect.DeepEqual(platforms, tt.platforms) {
+				t.Errorf("platforms = %v, want %v", platforms, tt.platforms)
+			}
+		})
+	}
+
+	idx := loadIndex(t, "buildkit.index.json")
+	attestation := idx.Manifests[2]
+	if attestation.Annotations["vnd.docker.reference.type"] != "attestation-manifest" ||
+		attestation.Annotations["vnd.docker.reference.digest"] != idx.Manifests[0].Digest.String() {
+		t.Errorf("attestation annotations = %v", attestation.Annotations)
+	}
+	if idx.Annotations["org.opencontainers.image.created"] != "2023-06-15T10:21:52Z" {
+		t.Errorf("index annotations = %v", idx.Annotations)
+	}
+	if got := loadIndex(t, "windows.manifest-list.json").Manifests[1].Platform.OSVersion; got != "10.0.20348.1726" {
+		t.Errorf("os.version = %q, want 10.0.20348.1726", got)
+	}
+}
+
+func TestIndexForPlatform(t *testing.T) {
+	tests := []struct {
+		fixture  string
+		platform image.Platform
+		want     int
+		err      error
+	}{
+		{fixture: "alpine.manifest-list.json", platform: image.Platform{OS: "linux", Arch: "amd64"}, want: 0},
+		{fixture: "alpine.manifest-list.json", platform: image.Platform{OS: "linux", Arch: "arm", Variant: "v7"}, want: 2},
+		// arm64 v8 is the same as no variant
+		{fixture: "alpine.manifest-list.json", platform: image.Platform{OS: "linux", Arch: "arm64"}, want: 3},
+		{fixture: "alpine.manifest-list.json", platform: image.Platform{OS: "linux", Arch: "arm"}, err: image.ErrAmbiguousPlatform},
+		{fixture: "alpine.manifest-list.json", platform: image.Platform{OS: "linux", Arch: "riscv64"}, err: image.ErrNoPlatformMatch},
+		{fixture: "buildkit.index.json", platform: image.Platform{OS: "linux", Arch: "arm64", Variant: "v8"}, want: 1},
+		{fixture: "buildkit.index.json", platform: image.Platform{OS: "windows", Arch: "amd64"}, err: image.ErrNoPlatformMatch},
+		{fixture: "windows.manifest-list.json", platform: image.Platform{OS: "windows", Arch: "amd64", OSVersion: "10.0.17763.4377"}, want: 0},
+		{fixture: "windows.manifest-list.json", platform: image.Platform{OS: "windows", Arch: "amd64"}, err: image.ErrAmbiguousPlatform},
+		{fixture: "windows.manifest-list.json", platform: image.Platform{OS: "linux", Arch: "amd64"}, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture+" "+tt.platform.String(), func(t *testing.T) {
+			idx := loadIndex(t, tt.fixture)
+			entry, err := idx.ForPlatform(tt.platform)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Errorf("ForPlatform() = %+v, %v, want %v", entry, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entry != &idx.Manifests[tt.want] {
+				t.Errorf("ForPlatform() = %s, want manifest %d %s", entry.Digest, tt.want, idx.Manifests[tt.want].Digest)
+			}
+		})
+	}
+}
+
+func TestIndexMarshalJSON(t *testing.T) {
+	for _, fixture := range []string{"alpine.manifest-list.json", "buildkit.index.json", "windows.manifest-list.json"} {
+		t.Run(fixture, func(t *testing.T) {
+			idx := loadIndex(t, fixture)
+			data, err := json.Marshal(idx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var parsed Index
+			if err := json.Unmarshal(data, &parsed); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(&parsed, idx) {
+				t.Errorf("round trip = %+v, want %+v", parsed, idx)
+			}
+
+			// the JSON is the same as the fixture's up to formatting and key order
+			raw, err := ioutil.ReadFile(filepath.Join("testdata", fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want, got interface{}
+			json.Unmarshal(raw, &want)
+			json.Unmarshal(data, &got)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("MarshalJSON() = %s, want %s", data, raw)
+			}
+		})
+	}
+
+	idx := &Index{SchemaVersion: 2, MediaType: image.MediaTypeOCIIndex, Manifests: []IndexEntry{{MediaType: image.MediaTypeOCIManifest, Size: 10, Digest: loadIndex(t, "buildkit.index.json").Manifests[0].Digest}}}
+	data, err := idx.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "platform") || strings.Contains(string(data), "annotations") {
+		t.Errorf("MarshalJSON() of an entry without platform and annotations = %s", data)
+	}
+}
+
+func TestParseIndexErrors(t *testing.T) {
+	digest := `"sha256:5f70bf18a086007016e948b04aed3b82103a36bea41755b6cddfaf10ace3c6ef"`
+	tests := []struct {
+		name     string
+		json     string
+		notIndex bool
+		errStr   string
+	}{
+		{name: "schema 1", json: `{"schemaVersion":1,"name":"library/alpine","fsLayers":[]}`, notIndex: true},
+		{name: "image manifest", json: `{"schemaVersion":2,"mediaType":"` + image.MediaTypeOCIManifest + `","config":{},"layers":[]}`, notIndex: true},
+		{name: "no manifests", json: `{"schemaVersion":2,"mediaType":"` + image.MediaTypeOCIIndex + `"}`, notIndex: true},
+		{name: "invalid digest", json: `{"schemaVersion":2,"manifests":[{"mediaType":"` + image.MediaTypeOCIManifest + `","digest":"sha256:abc","size":1},{"digest":` + digest + `}]}`, errStr: "manifest 0"},
+		{name: "not json", json: `<html>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idx, err := ParseIndex([]byte(tt.json))
+			if err == nil {
+				t.Fatalf("ParseIndex() = %+v, want an error", idx)
+			}
+			if errors.Is(err, ErrNotIndex) != tt.notIndex {
+				t.Errorf("ParseIndex() = %v, want ErrNotIndex %t", err, tt.notIndex)
+			}
+			if !strings.Contains(err.Error(), tt.errStr) {
+				t.Errorf("ParseIndex() = %v, want it to mention %q", err, tt.errStr)
+			}
+		})
+	}
+
+	if _, err := ParseIndex([]byte(`{"schemaVersion":2,"manifests":[]}`)); err != nil {
+		t.Errorf("ParseIndex() of an empty index = %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package inspect
+
+import (
+	"archive/tar"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/blacktop/graboid/pkg/extract"
+	"github.com/blacktop/graboid/pkg/image"
+	"github.com/wagoodman/dive/filetree"
+)
+
+// elfHeaderLen is the length of the ELF header up to and including e_machine
+const elfHeaderLen = 20
+
+// elfArches maps ELF machines to GOARCH style names
+var elfArches = map[elf.Machine]string{
+	elf.EM_386:     "386",
+	elf.EM_X86_64:  "amd64",
+	elf.EM_ARM:     "arm",
+	elf.EM_AARCH64: "arm64",
+	elf.EM_MIPS:    "mips",
+	elf.EM_PPC:     "ppc",
+	elf.EM_PPC64:   "ppc64",
+	elf.EM_S390:    "s390x",
+	elf.EM_RISCV:   "riscv64",
+}
+
+// BinaryInfo is an ELF binary of the image
+type BinaryInfo struct {
+	Path     string
+	IsSetUID bool
+	IsSetGID bool
+	// Arch is the GOARCH style architecture of the binary (e.g. amd64) or the ELF machine when unknown
+	Arch string
+}
+
+// FindBinaries returns the ELF binaries of the final filesystem of repo
+// sorted by path. The repo only has the file metadata so the contents are
+// read from the layer tars (optionally compressed) ordered from the base layer up.
+func FindBinaries(repo *image.Tar, layers []io.Reader) ([]BinaryInfo, error) {
+	merged, err := repo.Flatten()
+	if err != nil {
+		return nil, err
+	}
+
+	// the arch of every ELF file, later layers replace the files of earlier ones
+	arches := make(map[string]string)
+	for idx, layer := range layers {
+		if err := scanELF(layer, arches); err != nil {
+			return nil, fmt.Errorf("failed to read layer %d: %w", idx, err)
+		}
+	}
+
+	var binaries []BinaryInfo
+	merged.Walk(func(node *filetree.FileNode) error {
+		arch, ok := arches[node.Path()]
+		if !ok || image.FileIsDir(node) || (node.Data.FileInfo.TypeFlag != tar.TypeReg && node.Data.FileInfo.TypeFlag != tar.TypeRegA) {
+			return nil
+		}
+		mode := image.FileMode(node)
+		binaries = append(binaries, BinaryInfo{
+			Path:     node.Path(),
+			IsSetUID: mode&os.ModeSetuid != 0,
+			IsSetGID: mode&os.ModeSetgid != 0,
+			Arch:     arch,
+		})
+		return nil
+	})
+	sort.Slice(binaries, func(a, b int) bool {
+		return binaries[a].Path < binaries[b].Path
+	})
+
+	return binaries, nil
+}
+
+// scanELF records the arch of the ELF files of the layer tar read from r and
+// forgets the files the layer replaces with something else
+func scanELF(r io.Reader, arches map[string]string) error {
+	r, err := extract.Decompress(r)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, elfHeaderLen)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := path.Clean("/" + hdr.Name)
+		delete(arches, name)
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+		n, err := io.ReadFull(tr, header)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return err
+		}
+		if arch, ok := elfArch(header[:n]); ok {
+			arches[name] = arch
+		}
+	}
+}
+
+// elfArch returns the arch of the ELF header, e_machine is at offset 18 in
+// the byte order given by EI_DATA
+func elfArch(header []byte) (string, bool) {
+	if len(header) < elfHeaderLen || string(header[:4]) != elf.ELFMAG {
+		return "", false
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	if elf.Data(header[elf.EI_DATA]) == elf.ELFDATA2MSB {
+		order = binary.BigEndian
+	}
+	machine := elf.Machine(order.Uint16(header[18:20]))
+	if arch, ok := elfArches[machine]; ok {
+		return arch, true
+	}
+	return machine.String(), true
+}
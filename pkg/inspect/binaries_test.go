@@ -0,0 +1,149 @@
+package inspect
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/blacktop/graboid/internal/testimage"
+)
+
+// elfHeader returns the first bytes of an ELF file for machine
+func elfHeader(machine elf.Machine, bigEndian bool) string {
+	header := make([]byte, elfHeaderLen+12)
+	copy(header, elf.ELFMAG)
+	header[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	header[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	var order binary.ByteOrder = binary.LittleEndian
+	if bigEndian {
+		header[elf.EI_DATA] = byte(elf.ELFDATA2MSB)
+		order = binary.BigEndian
+	}
+	header[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	order.PutUint16(header[16:18], uint16(elf.ET_EXEC))
+	order.PutUint16(header[18:20], uint16(machine))
+	return string(header)
+}
+
+// layerReaders returns the gzipped tars of the layers
+func layerReaders(t testing.TB, layers []testimage.Layer) []io.Reader {
+	t.Helper()
+	readers := make([]io.Reader, 0, len(layers))
+	for _, layer := range layers {
+		layerTar, _ := testimage.GzipTar(t, layer.Files, layer.Modes)
+		readers = append(readers, bytes.NewReader(layerTar))
+	}
+	return readers
+}
+
+func TestFindBinaries(t *testing.T) {
+	layers := []testimage.Layer{
+		{Command: "/bin/sh -c #(nop) ADD file:rootfs in / ", Files: map[string]string{
+			"bin/busybox":      elfHeader(elf.EM_X86_64, false),
+			"bin/su":           elfHeader(elf.EM_AARCH64, false),
+			"usr/bin/wall":     elfHeader(elf.EM_S390, true),
+			"lib/libc.so":      elfHeader(elf.EM_RISCV, false),
+			"opt/sparc":        elfHeader(elf.EM_SPARC, false),
+			"etc/passwd":       "root:x:0:0:root:/root:/bin/sh\n",
+			"etc/magic":        elf.ELFMAG,
+			"usr/bin/replaced": elfHeader(elf.EM_X86_64, false),
+			"usr/bin/deleted":  elfHeader(elf.EM_X86_64, false),
+			"usr/bin/upgraded": "#!/bin/sh\nexit 0\n",
+		}, Modes: map[string]int64{
+			"bin/busybox":  0755,
+			"bin/su":       04755,
+			"usr/bin/wall": 02755,
+		}},
+		{Command: "/bin/sh -c apk upgrade", Files: map[string]string{
+			"usr/bin/replaced":    "#!/bin/sh\nexec busybox\n",
+			"usr/bin/.wh.deleted": "",
+			"usr/bin/upgraded":    elfHeader(elf.EM_386, false),
+		}},
+	}
+	repo := testimage.NewRepo(t, layers...)
+
+	binaries, err := FindBinaries(repo, layerReaders(t, layers))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []BinaryInfo{
+		{Path: "/bin/busybox", Arch: "amd64"},
+		{Path: "/bin/su", IsSetUID: true, Arch: "arm64"},
+		{Path: "/lib/libc.so", Arch: "riscv64"},
+		{Path: "/opt/sparc", Arch: "EM_SPARC"},
+		{Path: "/usr/bin/upgraded", Arch: "386"},
+		{Path: "/usr/bin/wall", IsSetGID: true, Arch: "s390x"},
+	}
+	if !reflect.DeepEqual(binaries, want) {
+		t.Errorf("FindBinaries() = %+v, want %+v", binaries, want)
+	}
+}
+
+func TestFindBinariesLayerError(t *testing.T) {
+	layers := []testimage.Layer{{Files: map[string]string{"bin/sh": elfHeader(elf.EM_X86_64, false)}}}
+	repo := testimage.NewRepo(t, layers...)
+
+	readers := []io.Reader{bytes.NewReader([]byte{0x1f, 0x8b, 0, 0})}
+	if _, err := FindBinaries(repo, readers); err == nil {
+		t.Error("FindBinaries() with a corrupt layer succeeded")
+	}
+}
+
+func TestElfArch(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		arch   string
+		ok     bool
+	}{
+		{name: "little endian", header: elfHeader(elf.EM_ARM, false), arch: "arm", ok: true},
+		{name: "big endian", header: elfHeader(elf.EM_PPC64, true), arch: "ppc64", ok: true},
+		{name: "mips big endian", header: elfHeader(elf.EM_MIPS, true), arch: "mips", ok: true},
+		{name: "truncated", header: elfHeader(elf.EM_X86_64, false)[:elfHeaderLen-1]},
+		{name: "not elf", header: "MZ" + elfHeader(elf.EM_X86_64, false)[2:]},
+		{name: "empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			arch, ok := elfArch([]byte(tt.header))
+			if arch != tt.arch || ok != tt.ok {
+				t.Errorf("elfArch() = %q, %v, want %q, %v", arch, ok, tt.arch, tt.ok)
+			}
+		})
+	}
+}
+
+// BenchmarkFindBinaries scans a 5,000 file image with 1,000 binaries
+func BenchmarkFindBinaries(b *testing.B) {
+	layers := make([]testimage.Layer, 5)
+	for idx := range layers {
+		layers[idx].Files = make(map[string]string)
+		for n := 0; n < 1000; n++ {
+			name := fmt.Sprintf("layer%d/dir%02d/file%03d", idx, n%50, n)
+			if n%5 == 0 {
+				layers[idx].Files[name] = elfHeader(elf.EM_X86_64, false)
+				continue
+			}
+			layers[idx].Files[name] = "#!/bin/sh\nexit 0\n"
+		}
+	}
+	repo := testimage.NewRepo(b, layers...)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		readers := layerReaders(b, layers)
+		b.StartTimer()
+		binaries, err := FindBinaries(repo, readers)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(binaries) != 1000 {
+			b.Fatalf("found %d binaries, want 1000", len(binaries))
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package inspect
+
+import (
+	"sort"
+
+	"github.com/blacktop/graboid/pkg/image"
+)
+
+// ConfigDiff is the difference between two image configs. Env and labels are
+// KEY=VALUE entries, a changed value shows up as removed and added.
+type ConfigDiff struct {
+	AddedEnv          []string
+	RemovedEnv        []string
+	AddedLabels       []string
+	RemovedLabels     []string
+	EntrypointChanged bool
+	CmdChanged        bool
+	OldEntrypoint     []string
+	NewEntrypoint     []string
+}
+
+// CompareConfigs returns what changed in the config of b compared to a
+func CompareConfigs(a, b *image.Image) ConfigDiff {
+	var diff ConfigDiff
+
+	diff.AddedEnv, diff.RemovedEnv = diffMaps(a.Env(), b.Env())
+	diff.AddedLabels, diff.RemovedLabels = diffMaps(a.Labels(), b.Labels())
+
+	var oldCmd, newCmd []string
+	if a.Config != nil {
+		diff.OldEntrypoint = a.Config.Entrypoint
+		oldCmd = a.Config.Cmd
+	}
+	if b.Config != nil {
+		diff.NewEntrypoint = b.Config.Entrypoint
+		newCmd = b.Config.Cmd
+	}
+	diff.EntrypointChanged = !equalStrings(diff.OldEntrypoint, diff.NewEntrypoint)
+	diff.CmdChanged = !equalStrings(oldCmd, newCmd)
+
+	return diff
+}
+
+// IsEmpty returns true if the configs are the same
+func (d ConfigDiff) IsEmpty() bool {
+	return len(d.AddedEnv) == 0 && len(d.RemovedEnv) == 0 &&
+		len(d.AddedLabels) == 0 && len(d.RemovedLabels) == 0 &&
+		!d.EntrypointChanged && !d.CmdChanged
+}
+
+// diffMaps returns the sorted KEY=VALUE entries only in b and only in a
+func diffMaps(a, b map[string]string) (added, removed []string) {
+	for key, value := range b {
+		if old, ok := a[key]; !ok || old != value {
+			added = append(added, key+"="+value)
+		}
+	}
+	for key, value := range a {
+		if now, ok := b[key]; !ok || now != value {
+			removed = append(removed, key+"="+value)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx := range a {
+		if a[idx] != b[idx] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,151 @@
+package inspect
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/blacktop/graboid/pkg/image"
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestCompareConfigs(t *testing.T) {
+	base := func() *container.Config {
+		return &container.Config{
+			Env:        []string{"PATH=/usr/bin", "LANG=C"},
+			Labels:     map[string]string{"maintainer": "someone", "version": "1.0"},
+			Entrypoint: []string{"/docker-entrypoint.sh"},
+			Cmd:        []string{"nginx", "-g", "daemon off;"},
+		}
+	}
+
+	tests := []struct {
+		name  string
+		a, b  *image.Image
+		want  ConfigDiff
+		empty bool
+	}{
+		{
+			name:  "unchanged",
+			a:     &image.Image{Config: base()},
+			b:     &image.Image{Config: base()},
+			want:  ConfigDiff{OldEntrypoint: []string{"/docker-entrypoint.sh"}, NewEntrypoint: []string{"/docker-entrypoint.sh"}},
+			empty: true,
+		},
+		{
+			name: "only a label changed",
+			a:    &image.Image{Config: base()},
+			b: func() *image.Image {
+				cfg := base()
+				cfg.Labels = map[string]string{"maintainer": "someone", "version": "1.1"}
+				return &image.Image{Config: cfg}
+			}(),
+			want: ConfigDiff{
+				AddedLabels:   []string{"version=1.1"},
+				RemovedLabels: []string{"version=1.0"},
+				OldEntrypoint: []string{"/docker-entrypoint.sh"},
+				NewEntrypoint: []string{"/docker-entrypoint.sh"},
+			},
+		},
+		{
+			name: "only env changed",
+			a:    &image.Image{Config: base()},
+			b: func() *image.Image {
+				cfg := base()
+				cfg.Env = []string{"PATH=/usr/local/bin:/usr/bin", "NGINX_VERSION=1.19"}
+				return &image.Image{Config: cfg}
+			}(),
+			want: ConfigDiff{
+				AddedEnv:      []string{"NGINX_VERSION=1.19", "PATH=/usr/local/bin:/usr/bin"},
+				RemovedEnv:    []string{"LANG=C", "PATH=/usr/bin"},
+				OldEntrypoint: []string{"/docker-entrypoint.sh"},
+				NewEntrypoint: []string{"/docker-entrypoint.sh"},
+			},
+		},
+		{
+			name: "entrypoint and cmd changed",
+			a:    &image.Image{Config: base()},
+			b: func() *image.Image {
+				cfg := base()
+				cfg.Entrypoint = []string{"/bin/sh", "-c"}
+				cfg.Cmd = []string{"nginx"}
+				return &image.Image{Config: cfg}
+			}(),
+			want: ConfigDiff{
+				EntrypointChanged: true,
+				CmdChanged:        true,
+				OldEntrypoint:     []string{"/docker-entrypoint.sh"},
+				NewEntrypoint:     []string{"/bin/sh", "-c"},
+			},
+		},
+		{
+			name: "cmd argument order",
+			a:    &image.Image{Config: &container.Config{Cmd: []string{"-a", "-b"}}},
+			b:    &image.Image{Config: &container.Config{Cmd: []string{"-b", "-a"}}},
+			want: ConfigDiff{CmdChanged: true},
+		},
+		{
+			name:  "both nil config",
+			a:     &image.Image{},
+			b:     &image.Image{},
+			want:  ConfigDiff{},
+			empty: true,
+		},
+		{
+			name: "config added",
+			a:    &image.Image{},
+			b:    &image.Image{Config: base()},
+			want: ConfigDiff{
+				AddedEnv:          []string{"LANG=C", "PATH=/usr/bin"},
+				AddedLabels:       []string{"maintainer=someone", "version=1.0"},
+				EntrypointChanged: true,
+				CmdChanged:        true,
+				NewEntrypoint:     []string{"/docker-entrypoint.sh"},
+			},
+		},
+		{
+			name: "config removed",
+			a:    &image.Image{Config: base()},
+			b:    &image.Image{},
+			want: ConfigDiff{
+				RemovedEnv:        []string{"LANG=C", "PATH=/usr/bin"},
+				RemovedLabels:     []string{"maintainer=someone", "version=1.0"},
+				EntrypointChanged: true,
+				CmdChanged:        true,
+				OldEntrypoint:     []string{"/docker-entrypoint.sh"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CompareConfigs(tt.a, tt.b)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CompareConfigs() = %+v, want %+v", got, tt.want)
+			}
+			if empty := got.IsEmpty(); empty != tt.empty {
+				t.Errorf("IsEmpty() = %t, want %t", empty, tt.empty)
+			}
+		})
+	}
+}
+
+func TestConfigDiffIsEmpty(t *testing.T) {
+	tests := []struct {
+		name string
+		diff ConfigDiff
+		want bool
+	}{
+		{name: "zero", diff: ConfigDiff{}, want: true},
+		{name: "same entrypoint", diff: ConfigDiff{OldEntrypoint: []string{"sh"}, NewEntrypoint: []string{"sh"}}, want: true},
+		{name: "added env", diff: ConfigDiff{AddedEnv: []string{"A=1"}}, want: false},
+		{name: "removed env", diff: ConfigDiff{RemovedEnv: []string{"A=1"}}, want: false},
+		{name: "added label", diff: ConfigDiff{AddedLabels: []string{"a=1"}}, want: false},
+		{name: "removed label", diff: ConfigDiff{RemovedLabels: []string{"a=1"}}, want: false},
+		{name: "entrypoint", diff: ConfigDiff{EntrypointChanged: true}, want: false},
+		{name: "cmd", diff: ConfigDiff{CmdChanged: true}, want: false},
+	}
+	for _, tt := range tests {
+		if got := tt.diff.IsEmpty(); got != tt.want {
+			t.Errorf("%s: IsEmpty() = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
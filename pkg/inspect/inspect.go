@@ -0,0 +1,113 @@
+package inspect
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/blacktop/graboid/pkg/image"
+	"github.com/docker/docker/api/types/container"
+)
+
+// RootFS is the rootfs section of docker inspect output
+type RootFS struct {
+	Type   string
+	Layers []string `json:",omitempty"`
+}
+
+// InspectionReport mirrors the image object printed by docker inspect
+type InspectionReport struct {
+	ID              string `json:"Id"`
+	RepoTags        []string
+	RepoDigests     []string
+	Parent          string
+	Comment         string
+	Created         time.Time
+	Container       string
+	ContainerConfig *container.Config
+	DockerVersion   string
+	Author          string
+	Config          *container.Config
+	Architecture    string
+	Variant         string `json:",omitempty"`
+	Os              string
+	OsVersion       string `json:",omitempty"`
+	Size            int64
+	RootFS          RootFS
+
+	// the fields below are parsed from Config for convenience and are not part of the docker inspect output
+
+	ExposedPorts []string          `json:"-"`
+	Volumes      []string          `json:"-"`
+	Env          []string          `json:"-"`
+	Labels       map[string]string `json:"-"`
+	Entrypoint   []string          `json:"-"`
+	Cmd          []string          `json:"-"`
+	WorkingDir   string            `json:"-"`
+	User         string            `json:"-"`
+}
+
+// Inspect builds the docker inspect report of the image config
+func Inspect(img *image.Image) InspectionReport {
+	report := InspectionReport{
+		ID:              img.ID,
+		RepoTags:        []string{},
+		RepoDigests:     []string{},
+		Parent:          img.Parent,
+		Comment:         img.Comment,
+		Created:         img.Created,
+		Container:       img.Container,
+		ContainerConfig: &img.ContainerConfig,
+		DockerVersion:   img.DockerVersion,
+		Author:          img.Author,
+		Config:          img.Config,
+		Architecture:    img.Architecture,
+		Variant:         img.Variant,
+		Os:              img.OS,
+		OsVersion:       img.OSVersion,
+		Size:            img.Size,
+	}
+
+	// docker uses the config digest as the image ID
+	if d, err := img.ConfigDigest(); err == nil {
+		report.ID = d.String()
+	}
+
+	if img.RootFS != nil {
+		report.RootFS.Type = img.RootFS.Type
+		report.RootFS.Layers = img.RootFS.DiffIDStrings()
+	}
+
+	if cfg := img.Config; cfg != nil {
+		for port := range cfg.ExposedPorts {
+			report.ExposedPorts = append(report.ExposedPorts, string(port))
+		}
+		sort.Strings(report.ExposedPorts)
+		for volume := range cfg.Volumes {
+			report.Volumes = append(report.Volumes, volume)
+		}
+		sort.Strings(report.Volumes)
+		report.Env = cfg.Env
+		report.Labels = cfg.Labels
+		report.Entrypoint = cfg.Entrypoint
+		report.Cmd = cfg.Cmd
+		report.WorkingDir = cfg.WorkingDir
+		report.User = cfg.User
+	}
+
+	return report
+}
+
+// MarshalJSON returns the report in the format of a docker inspect image object
+// (docker inspect prints a JSON array of these)
+func (r InspectionReport) MarshalJSON() ([]byte, error) {
+	type report InspectionReport
+	out := report(r)
+	if out.RepoTags == nil {
+		out.RepoTags = []string{}
+	}
+	if out.RepoDigests == nil {
+		out.RepoDigests = []string{}
+	}
+	return json.Marshal(out)
+}
@@ -0,0 +1,108 @@
+package inspect
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/blacktop/graboid/pkg/image"
+)
+
+// daemonKeys are docker inspect keys about the local docker storage that an image config can't know
+var daemonKeys = []string{"GraphDriver", "Metadata"}
+
+func loadImage(t *testing.T, name string) *image.Image {
+	t.Helper()
+	rawJSON, err := ioutil.ReadFile(filepath.Join("testdata", name+".config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := image.NewFromJSON(rawJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func TestInspectMarshalJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		size int64 // the daemon adds up the layer sizes
+	}{
+		{name: "nginx", size: 142560184},
+		{name: "scratch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := loadImage(t, tt.name)
+			img.Size = tt.size
+
+			rawJSON, err := json.Marshal([]InspectionReport{Inspect(img)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []map[string]interface{}
+			if err := json.Unmarshal(rawJSON, &got); err != nil {
+				t.Fatal(err)
+			}
+
+			fixture, err := ioutil.ReadFile(filepath.Join("testdata", tt.name+".inspect.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want []map[string]interface{}
+			if err := json.Unmarshal(fixture, &want); err != nil {
+				t.Fatal(err)
+			}
+			for _, key := range daemonKeys {
+				delete(want[0], key)
+			}
+
+			for key, value := range want[0] {
+				if !reflect.DeepEqual(got[0][key], value) {
+					t.Errorf("%s = %v, want %v", key, got[0][key], value)
+				}
+			}
+			for key := range got[0] {
+				if _, ok := want[0][key]; !ok {
+					t.Errorf("unexpected key %s", key)
+				}
+			}
+		})
+	}
+}
+
+func TestInspect(t *testing.T) {
+	report := Inspect(loadImage(t, "nginx"))
+
+	if want := []string{"443/tcp", "80/tcp"}; !reflect.DeepEqual(report.ExposedPorts, want) {
+		t.Errorf("ExposedPorts = %v, want %v", report.ExposedPorts, want)
+	}
+	if want := []string{"/var/cache/nginx", "/var/log/nginx"}; !reflect.DeepEqual(report.Volumes, want) {
+		t.Errorf("Volumes = %v, want %v", report.Volumes, want)
+	}
+	if len(report.Env) != 2 || report.Env[1] != "NGINX_VERSION=1.25.1" {
+		t.Errorf("Env = %v", report.Env)
+	}
+	if report.Labels["maintainer"] != "NGINX Docker Maintainers <docker-maint@nginx.com>" {
+		t.Errorf("Labels = %v", report.Labels)
+	}
+	if want := []string{"/docker-entrypoint.sh"}; !reflect.DeepEqual(report.Entrypoint, want) {
+		t.Errorf("Entrypoint = %v, want %v", report.Entrypoint, want)
+	}
+	if want := []string{"nginx", "-g", "daemon off;"}; !reflect.DeepEqual(report.Cmd, want) {
+		t.Errorf("Cmd = %v, want %v", report.Cmd, want)
+	}
+	if report.WorkingDir != "/usr/share/nginx/html" || report.User != "" {
+		t.Errorf("WorkingDir = %q, User = %q", report.WorkingDir, report.User)
+	}
+}
+
+func TestInspectNoConfig(t *testing.T) {
+	report := Inspect(loadImage(t, "scratch"))
+	if report.ExposedPorts != nil || report.Env != nil || report.Cmd != nil || report.Config != nil {
+		t.Errorf("Inspect() of an image without config = %+v", report)
+	}
+}
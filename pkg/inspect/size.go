@@ -0,0 +1,114 @@
+package inspect
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/blacktop/graboid/pkg/image"
+	"github.com/dustin/go-humanize"
+	"github.com/wagoodman/dive/filetree"
+)
+
+// topFiles is the number of largest files kept in a SizeReport
+const topFiles = 20
+
+// LayerSizeEntry is the size a layer adds to the image
+type LayerSizeEntry struct {
+	Index   int
+	Command string
+	Size    int64
+	// Cumulative is the size of the image up to and including the layer
+	Cumulative int64
+	total      int64
+}
+
+// PercentOfTotal returns the share of the image size added by the layer
+func (e LayerSizeEntry) PercentOfTotal() float64 {
+	if e.total == 0 {
+		return 0
+	}
+	return float64(e.Size) / float64(e.total) * 100
+}
+
+// FileSizeEntry is a file of the image and the layer that added it
+type FileSizeEntry struct {
+	Path  string
+	Size  int64
+	Layer int
+}
+
+// SizeReport attributes the size of an image to its layers and largest files
+type SizeReport struct {
+	TotalBytes int64
+	Layers     []LayerSizeEntry
+	TopFiles   []FileSizeEntry
+}
+
+// SizeBreakdown returns the size of every layer of repo with the command that
+// created it and the 20 largest files across all layers
+func SizeBreakdown(repo *image.Tar) SizeReport {
+	var report SizeReport
+	for idx, layer := range repo.Layers {
+		if layer == nil {
+			continue
+		}
+		size := int64(layer.Size())
+		report.TotalBytes += size
+		report.Layers = append(report.Layers, LayerSizeEntry{
+			Index:      idx,
+			Command:    layer.Command(),
+			Size:       size,
+			Cumulative: report.TotalBytes,
+		})
+
+		layer.Walk(func(node *filetree.FileNode) error {
+			if !node.IsWhiteout() && !image.FileIsDir(node) {
+				report.TopFiles = append(report.TopFiles, FileSizeEntry{
+					Path:  node.Path(),
+					Size:  image.FileSize(node),
+					Layer: idx,
+				})
+			}
+			return nil
+		})
+	}
+	for idx := range report.Layers {
+		report.Layers[idx].total = report.TotalBytes
+	}
+
+	sort.SliceStable(report.TopFiles, func(a, b int) bool {
+		return report.TopFiles[a].Size > report.TopFiles[b].Size
+	})
+	if len(report.TopFiles) > topFiles {
+		report.TopFiles = report.TopFiles[:topFiles]
+	}
+
+	return report
+}
+
+// Table returns the report as human readable tables of the layers and the largest files
+func (r SizeReport) Table() string {
+	var buf bytes.Buffer
+
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LAYER\tSIZE\tCUMULATIVE\t%\tCOMMAND")
+	for _, l := range r.Layers {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%.1f\t%s\n", l.Index, humanize.Bytes(uint64(l.Size)), humanize.Bytes(uint64(l.Cumulative)), l.PercentOfTotal(), l.Command)
+	}
+	fmt.Fprintf(w, "TOTAL\t%s\n", humanize.Bytes(uint64(r.TotalBytes)))
+	w.Flush()
+
+	if len(r.TopFiles) > 0 {
+		buf.WriteString("\n")
+		w = tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SIZE\tLAYER\tFILE")
+		for _, f := range r.TopFiles {
+			fmt.Fprintf(w, "%s\t%d\t%s\n", humanize.Bytes(uint64(f.Size)), f.Layer, f.Path)
+		}
+		w.Flush()
+	}
+
+	return buf.String()
+}
@@ -0,0 +1,121 @@
+package inspect
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/blacktop/graboid/internal/testimage"
+)
+
+func TestSizeBreakdown(t *testing.T) {
+	repo := testimage.NewRepo(t,
+		testimage.Layer{Command: "/bin/sh -c #(nop) ADD file:rootfs in / ", Files: map[string]string{
+			"etc/passwd": strings.Repeat("p", 100),
+			"bin/sh":     strings.Repeat("s", 300),
+		}},
+		testimage.Layer{Command: "/bin/sh -c apt-get install -y libbig", Files: map[string]string{
+			"usr/lib/libbig.so": strings.Repeat("b", 5000),
+			"usr/lib/small":     strings.Repeat("x", 10),
+		}},
+		testimage.Layer{Command: "/bin/sh -c #(nop) COPY file:app in /app ", Files: map[string]string{
+			"app/run":        strings.Repeat("r", 2000),
+			"etc/.wh.passwd": "",
+		}},
+	)
+	report := SizeBreakdown(repo)
+
+	if report.TotalBytes != 7410 {
+		t.Errorf("TotalBytes = %d, want 7410", report.TotalBytes)
+	}
+	wantLayers := []struct {
+		command          string
+		size, cumulative int64
+		percent          float64
+	}{
+		{command: "#(nop) ADD file:rootfs in / ", size: 400, cumulative: 400, percent: 5.4},
+		{command: "apt-get install -y libbig", size: 5010, cumulative: 5410, percent: 67.6},
+		{command: "#(nop) COPY file:app in /app ", size: 2000, cumulative: 7410, percent: 27.0},
+	}
+	if len(report.Layers) != len(wantLayers) {
+		t.Fatalf("Layers = %+v, want %d layers", report.Layers, len(wantLayers))
+	}
+	for idx, want := range wantLayers {
+		got := report.Layers[idx]
+		if got.Index != idx || got.Command != want.command || got.Size != want.size || got.Cumulative != want.cumulative {
+			t.Errorf("Layers[%d] = %+v, want %+v", idx, got, want)
+		}
+		if p := got.PercentOfTotal(); math.Abs(p-want.percent) > 0.05 {
+			t.Errorf("Layers[%d].PercentOfTotal() = %.2f, want %.1f", idx, p, want.percent)
+		}
+	}
+
+	// whiteouts and directories are not files of the image
+	wantFiles := []FileSizeEntry{
+		{Path: "/usr/lib/libbig.so", Size: 5000, Layer: 1},
+		{Path: "/app/run", Size: 2000, Layer: 2},
+		{Path: "/bin/sh", Size: 300, Layer: 0},
+		{Path: "/etc/passwd", Size: 100, Layer: 0},
+		{Path: "/usr/lib/small", Size: 10, Layer: 1},
+	}
+	if !reflect.DeepEqual(report.TopFiles, wantFiles) {
+		t.Errorf("TopFiles = %+v, want %+v", report.TopFiles, wantFiles)
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded SizeReport
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.TotalBytes != report.TotalBytes || len(decoded.Layers) != 3 || decoded.Layers[1].Command != wantLayers[1].command || !reflect.DeepEqual(decoded.TopFiles, wantFiles) {
+		t.Errorf("JSON round trip = %+v, want %+v", decoded, report)
+	}
+
+	table := report.Table()
+	for _, want := range []string{
+		"LAYER  SIZE",
+		"1      5.0 kB  5.4 kB      67.6  apt-get install -y libbig",
+		"TOTAL  7.4 kB",
+		"5.0 kB  1      /usr/lib/libbig.so",
+	} {
+		if !strings.Contains(table, want) {
+			t.Errorf("Table() = \n%s\nwant a line with %q", table, want)
+		}
+	}
+}
+
+func TestSizeBreakdownTopFiles(t *testing.T) {
+	files := make(map[string]string)
+	for idx := 1; idx <= 25; idx++ {
+		files[fmt.Sprintf("data/%02d", idx)] = strings.Repeat("d", idx)
+	}
+	report := SizeBreakdown(testimage.NewRepo(t, testimage.Layer{Command: "COPY data /data", Files: files}))
+
+	if len(report.TopFiles) != topFiles {
+		t.Fatalf("TopFiles has %d entries, want %d", len(report.TopFiles), topFiles)
+	}
+	for idx, f := range report.TopFiles {
+		if want := int64(25 - idx); f.Size != want || f.Path != fmt.Sprintf("/data/%02d", want) {
+			t.Errorf("TopFiles[%d] = %+v, want /data/%02d of %d bytes", idx, f, want, want)
+		}
+	}
+}
+
+func TestSizeBreakdownEmpty(t *testing.T) {
+	report := SizeBreakdown(testimage.NewRepo(t, testimage.Layer{Command: "CMD sh"}))
+	if report.TotalBytes != 0 || len(report.TopFiles) != 0 || len(report.Layers) != 1 {
+		t.Fatalf("SizeBreakdown() of an empty layer = %+v", report)
+	}
+	if p := report.Layers[0].PercentOfTotal(); p != 0 {
+		t.Errorf("PercentOfTotal() of an empty image = %f, want 0", p)
+	}
+	if strings.Contains(report.Table(), "FILE") {
+		t.Errorf("Table() lists files of an empty image:\n%s", report.Table())
+	}
+}
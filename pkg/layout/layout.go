@@ -0,0 +1,288 @@
+package layout
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/blacktop/graboid/pkg/extract"
+	"github.com/blacktop/graboid/pkg/image"
+	"github.com/blacktop/graboid/pkg/oci"
+	"github.com/blacktop/graboid/pkg/tarball"
+)
+
+// ErrUnknownFormat is returned by OpenAny for paths that are neither a docker tarball nor an OCI layout
+var ErrUnknownFormat = errors.New("unknown image source format")
+
+// SourceManifest is an image of a Source
+type SourceManifest struct {
+	// RepoTags are the names the image is tagged with, if any
+	RepoTags []string
+	// LayerCount is the number of layers of the image
+	LayerCount int
+
+	docker *image.Manifest
+	oci    *image.OCIManifest
+}
+
+// Source is a collection of images like a docker tarball or an OCI layout
+type Source interface {
+	// Manifests returns the images of the source
+	Manifests() ([]SourceManifest, error)
+	// Config returns the parsed image config of the manifest
+	Config(m SourceManifest) (*image.Image, error)
+	// LayerReader returns a reader for the uncompressed tar of the manifest's nth layer
+	LayerReader(m SourceManifest, index int) (io.ReadCloser, error)
+	// Close releases the source
+	Close() error
+}
+
+// manifestFile lists the images of a docker save tarball or directory
+const manifestFile = "manifest.json"
+
+// OpenAny opens path as an OCI layout if it is a directory with an oci-layout
+// file, as an extracted docker tarball if it is a directory with a
+// manifest.json and as a docker tarball if it is a file with a manifest.json
+func OpenAny(path string) (Source, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		if _, err := os.Stat(filepath.Join(path, oci.LayoutFile)); err == nil {
+			return OpenOCI(path)
+		}
+		if _, err := os.Stat(filepath.Join(path, manifestFile)); err == nil {
+			return OpenDockerDir(path)
+		}
+		return nil, fmt.Errorf("%w: %s has no %s or %s", ErrUnknownFormat, path, oci.LayoutFile, manifestFile)
+	}
+
+	src, err := OpenTarball(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnknownFormat, err)
+	}
+	return src, nil
+}
+
+// TarballSource is a Source reading a docker save tarball
+type TarballSource struct {
+	archive *tarball.Archive
+}
+
+// OpenTarball opens the docker tarball at path
+func OpenTarball(path string) (*TarballSource, error) {
+	archive, err := tarball.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &TarballSource{archive: archive}, nil
+}
+
+// Manifests returns the images of the tarball's manifest.json
+func (s *TarballSource) Manifests() ([]SourceManifest, error) {
+	manifests := make([]SourceManifest, len(s.archive.Manifests))
+	for idx := range s.archive.Manifests {
+		m := &s.archive.Manifests[idx]
+		manifests[idx] = SourceManifest{
+			RepoTags:   m.RepoTags,
+			LayerCount: len(m.Layers),
+			docker:     m,
+		}
+	}
+	return manifests, nil
+}
+
+// Config returns the parsed image config of the manifest
+func (s *TarballSource) Config(m SourceManifest) (*image.Image, error) {
+	if m.docker == nil {
+		return nil, errors.New("manifest is not from a docker tarball")
+	}
+	return s.archive.Image(m.docker)
+}
+
+// LayerReader returns a reader for the uncompressed tar of the manifest's nth layer
+func (s *TarballSource) LayerReader(m SourceManifest, index int) (io.ReadCloser, error) {
+	if m.docker == nil {
+		return nil, errors.New("manifest is not from a docker tarball")
+	}
+	return s.archive.LayerReader(m.docker, index)
+}
+
+// Close closes the tarball
+func (s *TarballSource) Close() error {
+	return s.archive.Close()
+}
+
+// DockerDirSource is a Source reading an extracted docker save tarball
+type DockerDirSource struct {
+	dir       string
+	manifests []image.Manifest
+}
+
+// OpenDockerDir opens the extracted docker tarball in dir and parses its manifest.json
+func OpenDockerDir(dir string) (*DockerDirSource, error) {
+	rawJSON, err := ioutil.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		return nil, err
+	}
+	s := &DockerDirSource{dir: dir}
+	if err := json.Unmarshal(rawJSON, &s.manifests); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filepath.Join(dir, manifestFile), err)
+	}
+	return s, nil
+}
+
+// file returns the path of the manifest.json entry name, names can't escape the directory
+func (s *DockerDirSource) file(name string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(path.Clean("/"+name)))
+}
+
+// Manifests returns the images of the directory's manifest.json
+func (s *DockerDirSource) Manifests() ([]SourceManifest, error) {
+	manifests := make([]SourceManifest, len(s.manifests))
+	for idx := range s.manifests {
+		m := &s.manifests[idx]
+		manifests[idx] = SourceManifest{
+			RepoTags:   m.RepoTags,
+			LayerCount: len(m.Layers),
+			docker:     m,
+		}
+	}
+	return manifests, nil
+}
+
+// Config returns the parsed image config of the manifest
+func (s *DockerDirSource) Config(m SourceManifest) (*image.Image, error) {
+	if m.docker == nil {
+		return nil, errors.New("manifest is not from a docker tarball")
+	}
+	rawJSON, err := ioutil.ReadFile(s.file(m.docker.Config))
+	if err != nil {
+		return nil, err
+	}
+	return image.NewFromJSON(rawJSON)
+}
+
+// LayerReader returns a reader for the uncompressed tar of the manifest's nth layer
+func (s *DockerDirSource) LayerReader(m SourceManifest, index int) (io.ReadCloser, error) {
+	if m.docker == nil {
+		return nil, errors.New("manifest is not from a docker tarball")
+	}
+	if index < 0 || index >= len(m.docker.Layers) {
+		return nil, fmt.Errorf("layer index %d out of range, manifest has %d layers", index, len(m.docker.Layers))
+	}
+
+	f, err := os.Open(s.file(m.docker.Layers[index]))
+	if err != nil {
+		return nil, err
+	}
+	r, err := extract.Decompress(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &readCloser{Reader: r, Closer: f}, nil
+}
+
+// Close is a no-op, the files are opened one at a time
+func (s *DockerDirSource) Close() error {
+	return nil
+}
+
+// OCISource is a Source reading an OCI image layout directory
+type OCISource struct {
+	layout *oci.Layout
+}
+
+// OpenOCI opens the OCI image layout in dir
+func OpenOCI(dir string) (*OCISource, error) {
+	layout, err := oci.OpenLayout(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &OCISource{layout: layout}, nil
+}
+
+// Manifests returns the image manifests of the layout's index. They are
+// tagged with the image name of their index.json entry or else its ref name.
+func (s *OCISource) Manifests() ([]SourceManifest, error) {
+	indexed, err := s.layout.IndexedManifests()
+	if err != nil {
+		return nil, err
+	}
+
+	manifests := make([]SourceManifest, len(indexed))
+	for idx := range indexed {
+		m := &indexed[idx].Manifest
+		annotations := indexed[idx].Descriptor.Annotations
+		var repoTags []string
+		if name, ok := annotations[oci.AnnotationImageName]; ok {
+			repoTags = append(repoTags, name)
+		} else if ref, ok := annotations[oci.AnnotationRefName]; ok {
+			repoTags = append(repoTags, ref)
+		}
+		manifests[idx] = SourceManifest{
+			RepoTags:   repoTags,
+			LayerCount: len(m.Layers),
+			oci:        m,
+		}
+	}
+	return manifests, nil
+}
+
+// Config returns the parsed image config of the manifest with the manifest's annotations
+func (s *OCISource) Config(m SourceManifest) (*image.Image, error) {
+	if m.oci == nil {
+		return nil, errors.New("manifest is not from an OCI layout")
+	}
+	img, err := s.layout.Config(*m.oci)
+	if err != nil {
+		return nil, err
+	}
+	img.Annotations = m.oci.Annotations
+	return img, nil
+}
+
+// LayerReader returns a reader for the uncompressed tar of the manifest's nth layer
+func (s *OCISource) LayerReader(m SourceManifest, index int) (io.ReadCloser, error) {
+	if m.oci == nil {
+		return nil, errors.New("manifest is not from an OCI layout")
+	}
+	if index < 0 || index >= len(m.oci.Layers) {
+		return nil, fmt.Errorf("layer index %d out of range, manifest has %d layers", index, len(m.oci.Layers))
+	}
+
+	rc, err := s.layout.BlobReader(m.oci.Layers[index].Digest)
+	if err != nil {
+		return nil, err
+	}
+	r, err := extract.Decompress(rc)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	return &readCloser{Reader: r, Closer: rc}, nil
+}
+
+// Close is a no-op, layouts are read one blob at a time
+func (s *OCISource) Close() error {
+	return nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+var (
+	_ Source = (*TarballSource)(nil)
+	_ Source = (*DockerDirSource)(nil)
+	_ Source = (*OCISource)(nil)
+)
@@ -0,0 +1,266 @@
+package layout
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/blacktop/graboid/pkg/convert"
+)
+
+const (
+	dockerSave = "../tarball/testdata/docker-save.tar"
+	ociLayout  = "../oci/testdata/layout"
+)
+
+// sourceImage is what a fixture holds for one of its images
+type sourceImage struct {
+	repoTags []string
+	platform string
+	// files are the entries of each layer
+	files [][]string
+}
+
+// layerFiles returns the entry names of the manifest's nth layer
+func layerFiles(t *testing.T, src Source, m SourceManifest, index int) []string {
+	t.Helper()
+	rc, err := src.LayerReader(m, index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	var names []string
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return names
+		}
+		if err != nil {
+			t.Fatalf("layer %d: %v", index, err)
+		}
+		names = append(names, hdr.Name)
+	}
+}
+
+// extractTar writes the files of the tarball src to dir
+func extractTar(t *testing.T, src, dir string) {
+	t.Helper()
+	f, err := os.Open(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(hdr.Name))
+		if hdr.Typeflag == tar.TypeDir {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(target, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dockerDir := filepath.Join(dir, "docker-save")
+	extractTar(t, dockerSave, dockerDir)
+	converted := filepath.Join(dir, "converted")
+	if err := convert.DockerToOCI(dockerSave, converted); err != nil {
+		t.Fatal(err)
+	}
+
+	dockerSaveFiles := [][]string{
+		{"bin/", "bin/busybox", "bin/sh", "etc/", "etc/hostname", "etc/motd"},
+		{"app/", "app/hello.txt", "etc/", "etc/.wh.motd"},
+	}
+	tests := []struct {
+		name   string
+		path   string
+		format interface{}
+		images []sourceImage
+	}{
+		{
+			name:   "docker tarball",
+			path:   dockerSave,
+			format: &TarballSource{},
+			images: []sourceImage{{
+				repoTags: []string{"graboid/test:latest"},
+				platform: "linux/amd64",
+				files:    dockerSaveFiles,
+			}},
+		},
+		{
+			name:   "extracted docker tarball",
+			path:   dockerDir,
+			format: &DockerDirSource{},
+			images: []sourceImage{{
+				repoTags: []string{"graboid/test:latest"},
+				platform: "linux/amd64",
+				files:    dockerSaveFiles,
+			}},
+		},
+		{
+			name:   "converted oci layout",
+			path:   converted,
+			format: &OCISource{},
+			images: []sourceImage{{
+				repoTags: []string{"graboid/test:latest"},
+				platform: "linux/amd64",
+				files:    dockerSaveFiles,
+			}},
+		},
+		{
+			name:   "oci layout",
+			path:   ociLayout,
+			format: &OCISource{},
+			images: []sourceImage{
+				{repoTags: []string{"multi"}, platform: "linux/amd64", files: [][]string{{"etc/hostname", "etc/os-release"}}},
+				{repoTags: []string{"multi"}, platform: "linux/arm64/v8", files: [][]string{{"etc/hostname", "etc/os-release"}}},
+				{repoTags: []string{"single"}, platform: "linux/amd64", files: [][]string{{"etc/hostname", "etc/os-release"}}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, err := OpenAny(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer src.Close()
+			if reflect.TypeOf(src) != reflect.TypeOf(tt.format) {
+				t.Fatalf("OpenAny() = %T, want %T", src, tt.format)
+			}
+
+			manifests, err := src.Manifests()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(manifests) != len(tt.images) {
+				t.Fatalf("Manifests() returned %d manifests, want %d", len(manifests), len(tt.images))
+			}
+			for idx, m := range manifests {
+				want := tt.images[idx]
+				if !reflect.DeepEqual(m.RepoTags, want.repoTags) {
+					t.Errorf("manifest %d is tagged %v, want %v", idx, m.RepoTags, want.repoTags)
+				}
+				if m.LayerCount != len(want.files) {
+					t.Fatalf("manifest %d has %d layers, want %d", idx, m.LayerCount, len(want.files))
+				}
+
+				img, err := src.Config(m)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := img.Platform().String(); got != want.platform {
+					t.Errorf("manifest %d is for %s, want %s", idx, got, want.platform)
+				}
+				if len(img.RootFS.DiffIDs) != m.LayerCount {
+					t.Errorf("manifest %d config has %d diff IDs, want %d", idx, len(img.RootFS.DiffIDs), m.LayerCount)
+				}
+
+				for layer, files := range want.files {
+					if got := layerFiles(t, src, m, layer); !reflect.DeepEqual(got, files) {
+						t.Errorf("manifest %d layer %d holds %v, want %v", idx, layer, got, files)
+					}
+				}
+				if _, err := src.LayerReader(m, m.LayerCount); err == nil {
+					t.Errorf("LayerReader() past the last layer of manifest %d succeeded", idx)
+				}
+			}
+		})
+	}
+}
+
+func TestSourceForeignManifest(t *testing.T) {
+	tarSrc, err := OpenTarball(dockerSave)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tarSrc.Close()
+	ociSrc, err := OpenOCI(ociLayout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ociSrc.Close()
+
+	tarManifests, err := tarSrc.Manifests()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ociManifests, err := ociSrc.Manifests()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tarSrc.Config(ociManifests[0]); err == nil {
+		t.Error("TarballSource.Config() of an OCI manifest succeeded")
+	}
+	if _, err := tarSrc.LayerReader(ociManifests[0], 0); err == nil {
+		t.Error("TarballSource.LayerReader() of an OCI manifest succeeded")
+	}
+	if _, err := ociSrc.Config(tarManifests[0]); err == nil {
+		t.Error("OCISource.Config() of a tarball manifest succeeded")
+	}
+	if _, err := ociSrc.LayerReader(tarManifests[0], 0); err == nil {
+		t.Error("OCISource.LayerReader() of a tarball manifest succeeded")
+	}
+	dirSrc := &DockerDirSource{}
+	if _, err := dirSrc.Config(ociManifests[0]); err == nil {
+		t.Error("DockerDirSource.Config() of an OCI manifest succeeded")
+	}
+	if _, err := dirSrc.LayerReader(ociManifests[0], 0); err == nil {
+		t.Error("DockerDirSource.LayerReader() of an OCI manifest succeeded")
+	}
+	if _, err := ociSrc.LayerReader(ociManifests[0], -1); err == nil {
+		t.Error("OCISource.LayerReader() of layer -1 succeeded")
+	}
+}
+
+func TestOpenAnyUnknownFormat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	notTar := filepath.Join(dir, "image.tar")
+	if err := ioutil.WriteFile(notTar, []byte("not a tarball"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{dir, notTar} {
+		if _, err := OpenAny(path); !errors.Is(err, ErrUnknownFormat) {
+			t.Errorf("OpenAny(%s) = %v, want ErrUnknownFormat", path, err)
+		}
+	}
+	if _, err := OpenAny(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("OpenAny() of a missing path = %v, want not exist", err)
+	}
+}
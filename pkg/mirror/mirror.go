@@ -0,0 +1,211 @@
+package mirror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/apex/log"
+	"github.com/blacktop/graboid/pkg/image"
+	"github.com/blacktop/graboid/pkg/reference"
+	"github.com/blacktop/graboid/pkg/registry"
+	"github.com/opencontainers/go-digest"
+)
+
+// hubRegistry is the API host of the docker.io registry
+const hubRegistry = "registry-1.docker.io"
+
+// ErrTagExists is returned when the destination tag points at a different manifest and Overwrite is not set
+var ErrTagExists = errors.New("destination tag already exists")
+
+// SyncOptions configures Sync
+type SyncOptions struct {
+	// DryRun reports what would be copied without uploading anything
+	DryRun bool
+	// ProgressWriter receives a line per blob and manifest
+	ProgressWriter io.Writer
+	// Overwrite replaces a destination tag that points at a different manifest
+	Overwrite bool
+	// Credentials looks up the credentials of both registries
+	Credentials registry.CredentialFunc
+	// ClientOptions are applied to the source and destination registry clients
+	ClientOptions []registry.ClientOption
+}
+
+// SyncStats is the outcome of a Sync
+type SyncStats struct {
+	BlobsTransferred int
+	BlobsSkipped     int
+	BytesTransferred int64
+	BytesSkipped     int64
+	Manifests        int
+}
+
+type syncer struct {
+	src, dest         *registry.Client
+	srcRepo, destRepo string
+	opts              SyncOptions
+	stats             SyncStats
+	seen              map[digest.Digest]bool
+}
+
+type index struct {
+	MediaType string             `json:"mediaType,omitempty"`
+	Manifests []image.Descriptor `json:"manifests"`
+}
+
+// Sync copies the image src to dest, only uploading the blobs dest does not already have
+func Sync(src, dest reference.Reference, opts SyncOptions) error {
+	_, err := SyncWithStats(src, dest, opts)
+	return err
+}
+
+// SyncWithStats is Sync returning how many blobs and bytes were transferred or skipped
+func SyncWithStats(src, dest reference.Reference, opts SyncOptions) (*SyncStats, error) {
+	s := &syncer{
+		src:      newClient(src, opts),
+		dest:     newClient(dest, opts),
+		srcRepo:  src.Repository,
+		destRepo: dest.Repository,
+		opts:     opts,
+		seen:     make(map[digest.Digest]bool),
+	}
+
+	srcRef := src.Tag
+	if len(src.Digest) > 0 {
+		srcRef = src.Digest.String()
+	}
+	destRef := dest.Tag
+	if len(destRef) == 0 {
+		destRef = srcRef
+	}
+
+	log.WithFields(log.Fields{
+		"src":     src.String(),
+		"dest":    dest.String(),
+		"dry-run": opts.DryRun,
+	}).Debug("syncing image")
+
+	raw, mediaType, err := s.src.GetRawManifestOrIndex(s.srcRepo + ":" + srcRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get source manifest: %w", err)
+	}
+	d := digest.FromBytes(raw)
+
+	existing, ok, err := s.dest.ManifestDigest(s.destRepo, destRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check destination manifest: %w", err)
+	}
+	if ok && existing == d {
+		s.printf("manifest %s: already up to date\n", d)
+		return &s.stats, nil
+	}
+	if ok && !opts.Overwrite {
+		return nil, fmt.Errorf("%w: %s:%s is %s", ErrTagExists, s.destRepo, destRef, existing)
+	}
+
+	if err := s.syncManifest(raw, mediaType, destRef); err != nil {
+		return nil, err
+	}
+
+	s.printf("synced %d blobs (%d bytes), skipped %d blobs (%d bytes)\n",
+		s.stats.BlobsTransferred, s.stats.BytesTransferred, s.stats.BlobsSkipped, s.stats.BytesSkipped)
+	return &s.stats, nil
+}
+
+// syncManifest copies everything the manifest or index references and then pushes it as ref
+func (s *syncer) syncManifest(raw []byte, mediaType, ref string) error {
+	switch mediaType {
+	case image.MediaTypeOCIIndex, image.MediaTypeDockerManifestList:
+		var idx index
+		if err := json.Unmarshal(raw, &idx); err != nil {
+			return err
+		}
+		for _, desc := range idx.Manifests {
+			child, childType, err := s.src.GetManifestByDigest(s.srcRepo, desc.Digest)
+			if err != nil {
+				return fmt.Errorf("failed to get manifest %s: %w", desc.Digest, err)
+			}
+			if err := s.syncManifest(child, childType, desc.Digest.String()); err != nil {
+				return err
+			}
+		}
+	default:
+		var m image.OCIManifest
+		if err := json.Unmarshal(raw, &m); err != nil {
+			return err
+		}
+		for _, desc := range append([]image.Descriptor{m.Config}, m.Layers...) {
+			if err := s.syncBlob(desc); err != nil {
+				return err
+			}
+		}
+	}
+
+	s.stats.Manifests++
+	d := digest.FromBytes(raw)
+	if s.opts.DryRun {
+		s.printf("manifest %s: would push as %s\n", d, ref)
+		return nil
+	}
+	if _, err := s.dest.PutManifest(s.destRepo, ref, raw, mediaType); err != nil {
+		return fmt.Errorf("failed to push manifest %s: %w", d, err)
+	}
+	s.printf("manifest %s: pushed as %s\n", d, ref)
+	return nil
+}
+
+// syncBlob uploads the blob unless dest already has it
+func (s *syncer) syncBlob(desc image.Descriptor) error {
+	if s.seen[desc.Digest] {
+		return nil
+	}
+	s.seen[desc.Digest] = true
+
+	exists, err := s.dest.BlobExists(s.destRepo, desc.Digest)
+	if err != nil {
+		return fmt.Errorf("failed to check blob %s: %w", desc.Digest, err)
+	}
+	if exists {
+		s.stats.BlobsSkipped++
+		s.stats.BytesSkipped += desc.Size
+		s.printf("blob %s: exists (%d bytes)\n", desc.Digest, desc.Size)
+		return nil
+	}
+
+	s.stats.BlobsTransferred++
+	s.stats.BytesTransferred += desc.Size
+	if s.opts.DryRun {
+		s.printf("blob %s: would upload (%d bytes)\n", desc.Digest, desc.Size)
+		return nil
+	}
+
+	r, err := s.src.GetBlob(s.srcRepo, desc.Digest.String())
+	if err != nil {
+		return fmt.Errorf("failed to get blob %s: %w", desc.Digest, err)
+	}
+	defer r.Close()
+
+	if err := s.dest.UploadBlob(s.destRepo, desc.Digest, r, desc.Size); err != nil {
+		return fmt.Errorf("failed to upload blob %s: %w", desc.Digest, err)
+	}
+	s.printf("blob %s: uploaded (%d bytes)\n", desc.Digest, desc.Size)
+	return nil
+}
+
+func (s *syncer) printf(format string, args ...interface{}) {
+	if s.opts.ProgressWriter != nil {
+		fmt.Fprintf(s.opts.ProgressWriter, format, args...)
+	}
+}
+
+// newClient creates a registry client for the registry of ref
+func newClient(ref reference.Reference, opts SyncOptions) *registry.Client {
+	host := ref.Registry
+	if host == reference.DefaultRegistry() {
+		host = hubRegistry
+	}
+	clientOpts := append([]registry.ClientOption{registry.WithCredentialFunc(opts.Credentials)}, opts.ClientOptions...)
+	return registry.NewClient(host, clientOpts...)
+}
@@ -0,0 +1,332 @@
+package mirror
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/blacktop/graboid/pkg/image"
+	"github.com/blacktop/graboid/pkg/reference"
+	"github.com/blacktop/graboid/pkg/registry"
+	"github.com/opencontainers/go-digest"
+)
+
+// fakeRegistry is an in memory registry that serves and accepts manifests and blobs
+type fakeRegistry struct {
+	srv *httptest.Server
+
+	mu        sync.Mutex
+	manifests map[string][]byte // repo/ref by tag and digest
+	types     map[string]string
+	blobs     map[digest.Digest][]byte
+	uploads   map[string]*bytes.Buffer
+	pushed    []digest.Digest // blobs uploaded in order
+	puts      []string        // manifest references pushed in order
+}
+
+func newFakeRegistry() *fakeRegistry {
+	r := &fakeRegistry{
+		manifests: make(map[string][]byte),
+		types:     make(map[string]string),
+		blobs:     make(map[digest.Digest][]byte),
+		uploads:   make(map[string]*bytes.Buffer),
+	}
+	r.srv = httptest.NewServer(http.HandlerFunc(r.serve))
+	return r
+}
+
+// ref returns the reference of repo:tag on the registry
+func (r *fakeRegistry) ref(repo, tag string) reference.Reference {
+	return reference.Reference{Registry: strings.TrimPrefix(r.srv.URL, "http://"), Repository: repo, Tag: tag}
+}
+
+func (r *fakeRegistry) addBlob(data []byte) image.Descriptor {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d := digest.FromBytes(data)
+	r.blobs[d] = data
+	return image.Descriptor{MediaType: image.MediaTypeOCILayer, Digest: d, Size: int64(len(data))}
+}
+
+func (r *fakeRegistry) addManifest(repo, tag, mediaType string, raw []byte) digest.Digest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d := digest.FromBytes(raw)
+	for _, ref := range []string{tag, d.String()} {
+		r.manifests[repo+"/"+ref] = raw
+		r.types[repo+"/"+ref] = mediaType
+	}
+	return d
+}
+
+func (r *fakeRegistry) manifest(repo, ref string) []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.manifests[repo+"/"+ref]
+}
+
+func (r *fakeRegistry) serve(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p := strings.TrimPrefix(req.URL.Path, "/v2/")
+	switch {
+	case strings.Contains(p, "/manifests/"):
+		parts := strings.SplitN(p, "/manifests/", 2)
+		key := parts[0] + "/" + parts[1]
+		if req.Method == http.MethodPut {
+			raw, _ := ioutil.ReadAll(req.Body)
+			d := digest.FromBytes(raw)
+			for _, ref := range []string{parts[1], d.String()} {
+				r.manifests[parts[0]+"/"+ref] = raw
+				r.types[parts[0]+"/"+ref] = req.Header.Get("Content-Type")
+			}
+			r.puts = append(r.puts, parts[1])
+			w.Header().Set("Docker-Content-Digest", d.String())
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		raw, ok := r.manifests[key]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", r.types[key])
+		w.Header().Set("Docker-Content-Digest", digest.FromBytes(raw).String())
+		w.Header().Set("Content-Length", fmt.Sprint(len(raw)))
+		if req.Method == http.MethodGet {
+			w.Write(raw)
+		}
+	case strings.Contains(p, "/blobs/uploads/"):
+		parts := strings.SplitN(p, "/blobs/uploads/", 2)
+		id := parts[1]
+		switch req.Method {
+		case http.MethodPost:
+			id = fmt.Sprint(len(r.uploads) + 1)
+			r.uploads[id] = &bytes.Buffer{}
+		case http.MethodPatch, http.MethodPut:
+			buf, ok := r.uploads[id]
+			if !ok {
+				http.NotFound(w, req)
+				return
+			}
+			buf.ReadFrom(req.Body)
+			if req.Method == http.MethodPut {
+				d := digest.Digest(req.URL.Query().Get("digest"))
+				if digest.FromBytes(buf.Bytes()) != d {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				r.blobs[d] = buf.Bytes()
+				r.pushed = append(r.pushed, d)
+				delete(r.uploads, id)
+				w.WriteHeader(http.StatusCreated)
+				return
+			}
+		}
+		w.Header().Set("Location", "/v2/"+parts[0]+"/blobs/uploads/"+id)
+		w.WriteHeader(http.StatusAccepted)
+	case strings.Contains(p, "/blobs/"):
+		d := digest.Digest(p[strings.LastIndex(p, "/")+1:])
+		data, ok := r.blobs[d]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		if req.Method == http.MethodGet {
+			w.Write(data)
+		}
+	case p == "":
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// testImage adds an image with a config and the layers to the registry
+func testImage(t *testing.T, r *fakeRegistry, repo, tag string, layers ...string) []byte {
+	t.Helper()
+	m := image.OCIManifest{
+		SchemaVersion: 2,
+		MediaType:     image.MediaTypeOCIManifest,
+		Config:        r.addBlob([]byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]}}` + tag)),
+	}
+	m.Config.MediaType = image.MediaTypeOCIConfig
+	for _, layer := range layers {
+		m.Layers = append(m.Layers, r.addBlob([]byte(layer)))
+	}
+	raw, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.addManifest(repo, tag, image.MediaTypeOCIManifest, raw)
+	return raw
+}
+
+func syncOptions(opts SyncOptions) SyncOptions {
+	opts.ClientOptions = append(opts.ClientOptions, registry.WithInsecure(true))
+	return opts
+}
+
+func TestSync(t *testing.T) {
+	src := newFakeRegistry()
+	defer src.srv.Close()
+	dest := newFakeRegistry()
+	defer dest.srv.Close()
+
+	raw := testImage(t, src, "library/app", "v1", "base layer", "app layer")
+	var m image.OCIManifest
+	json.Unmarshal(raw, &m)
+	dest.addBlob([]byte("base layer"))
+
+	var progress bytes.Buffer
+	stats, err := SyncWithStats(src.ref("library/app", "v1"), dest.ref("mirror/app", "v1"), syncOptions(SyncOptions{ProgressWriter: &progress}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := SyncStats{
+		BlobsTransferred: 2,
+		BlobsSkipped:     1,
+		BytesTransferred: m.Config.Size + int64(len("app layer")),
+		BytesSkipped:     int64(len("base layer")),
+		Manifests:        1,
+	}
+	if *stats != want {
+		t.Errorf("stats = %+v, want %+v", *stats, want)
+	}
+	if got := dest.manifest("mirror/app", "v1"); !bytes.Equal(got, raw) {
+		t.Errorf("dest manifest = %s, want %s", got, raw)
+	}
+	if len(dest.pushed) != 2 || dest.pushed[0] != m.Config.Digest || dest.pushed[1] != m.Layers[1].Digest {
+		t.Errorf("uploaded blobs = %v, want the config and the app layer", dest.pushed)
+	}
+	for _, line := range []string{
+		fmt.Sprintf("blob %s: exists (10 bytes)", m.Layers[0].Digest),
+		fmt.Sprintf("blob %s: uploaded (9 bytes)", m.Layers[1].Digest),
+		fmt.Sprintf("manifest %s: pushed as v1", digest.FromBytes(raw)),
+		fmt.Sprintf("synced 2 blobs (%d bytes), skipped 1 blobs (10 bytes)", want.BytesTransferred),
+	} {
+		if !strings.Contains(progress.String(), line+"\n") {
+			t.Errorf("progress is missing %q:\n%s", line, progress.String())
+		}
+	}
+
+	// a second sync finds the manifest and copies nothing
+	progress.Reset()
+	stats, err = SyncWithStats(src.ref("library/app", "v1"), dest.ref("mirror/app", ""), syncOptions(SyncOptions{ProgressWriter: &progress}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *stats != (SyncStats{}) || len(dest.pushed) != 2 || len(dest.puts) != 1 {
+		t.Errorf("second sync = %+v, pushed %v %v", *stats, dest.pushed, dest.puts)
+	}
+	if !strings.HasSuffix(progress.String(), "already up to date\n") {
+		t.Errorf("progress = %q", progress.String())
+	}
+}
+
+func TestSyncDryRun(t *testing.T) {
+	src := newFakeRegistry()
+	defer src.srv.Close()
+	dest := newFakeRegistry()
+	defer dest.srv.Close()
+	testImage(t, src, "library/app", "v1", "base layer", "app layer")
+	dest.addBlob([]byte("base layer"))
+
+	var progress bytes.Buffer
+	stats, err := SyncWithStats(src.ref("library/app", "v1"), dest.ref("library/app", "v1"), syncOptions(SyncOptions{DryRun: true, ProgressWriter: &progress}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.BlobsTransferred != 2 || stats.BlobsSkipped != 1 || stats.Manifests != 1 {
+		t.Errorf("stats = %+v", *stats)
+	}
+	if len(dest.pushed) != 0 || len(dest.puts) != 0 || dest.manifest("library/app", "v1") != nil {
+		t.Errorf("dry run uploaded %v and pushed %v", dest.pushed, dest.puts)
+	}
+	if !strings.Contains(progress.String(), ": would upload (9 bytes)\n") || !strings.Contains(progress.String(), ": would push as v1\n") {
+		t.Errorf("progress = %q", progress.String())
+	}
+}
+
+func TestSyncOverwrite(t *testing.T) {
+	src := newFakeRegistry()
+	defer src.srv.Close()
+	dest := newFakeRegistry()
+	defer dest.srv.Close()
+	raw := testImage(t, src, "library/app", "v1", "new layer")
+	testImage(t, dest, "library/app", "v1", "old layer")
+
+	err := Sync(src.ref("library/app", "v1"), dest.ref("library/app", "v1"), syncOptions(SyncOptions{}))
+	if !errors.Is(err, ErrTagExists) {
+		t.Fatalf("Sync() = %v, want %v", err, ErrTagExists)
+	}
+	if len(dest.pushed) != 0 {
+		t.Errorf("Sync() uploaded %v before failing", dest.pushed)
+	}
+
+	if err := Sync(src.ref("library/app", "v1"), dest.ref("library/app", "v1"), syncOptions(SyncOptions{Overwrite: true})); err != nil {
+		t.Fatal(err)
+	}
+	if got := dest.manifest("library/app", "v1"); !bytes.Equal(got, raw) {
+		t.Errorf("dest manifest = %s, want %s", got, raw)
+	}
+}
+
+func TestSyncIndex(t *testing.T) {
+	src := newFakeRegistry()
+	defer src.srv.Close()
+	dest := newFakeRegistry()
+	defer dest.srv.Close()
+
+	amd64 := testImage(t, src, "library/app", "amd64", "shared layer", "amd64 layer")
+	arm64 := testImage(t, src, "library/app", "arm64", "shared layer", "arm64 layer")
+	idx, err := json.Marshal(index{
+		MediaType: image.MediaTypeOCIIndex,
+		Manifests: []image.Descriptor{
+			{MediaType: image.MediaTypeOCIManifest, Digest: digest.FromBytes(amd64), Size: int64(len(amd64))},
+			{MediaType: image.MediaTypeOCIManifest, Digest: digest.FromBytes(arm64), Size: int64(len(arm64))},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.addManifest("library/app", "v1", image.MediaTypeOCIIndex, idx)
+
+	stats, err := SyncWithStats(src.ref("library/app", "v1"), dest.ref("library/app", "v1"), syncOptions(SyncOptions{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// two configs, two platform layers and the shared layer once
+	if stats.BlobsTransferred != 5 || stats.BlobsSkipped != 0 || stats.Manifests != 3 || len(dest.pushed) != 5 {
+		t.Errorf("stats = %+v, uploaded %d blobs", *stats, len(dest.pushed))
+	}
+	wantPuts := []string{digest.FromBytes(amd64).String(), digest.FromBytes(arm64).String(), "v1"}
+	if strings.Join(dest.puts, ",") != strings.Join(wantPuts, ",") {
+		t.Errorf("pushed manifests %v, want %v", dest.puts, wantPuts)
+	}
+	if got := dest.manifest("library/app", "v1"); !bytes.Equal(got, idx) {
+		t.Errorf("dest index = %s, want %s", got, idx)
+	}
+}
+
+func TestSyncNotFound(t *testing.T) {
+	src := newFakeRegistry()
+	defer src.srv.Close()
+	dest := newFakeRegistry()
+	defer dest.srv.Close()
+
+	err := Sync(src.ref("library/missing", "v1"), dest.ref("library/missing", "v1"), syncOptions(SyncOptions{}))
+	if !errors.Is(err, registry.ErrNotFound) {
+		t.Errorf("Sync() = %v, want %v", err, registry.ErrNotFound)
+	}
+}
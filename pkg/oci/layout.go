@@ -0,0 +1,202 @@
+package oci
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	// register sha256 for go-digest
+	_ "crypto/sha256"
+
+	"github.com/blacktop/graboid/pkg/image"
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	// LayoutFile is the file marking a directory as an OCI image layout
+	LayoutFile = "oci-layout"
+	// IndexFile is the entrypoint of an OCI image layout
+	IndexFile = "index.json"
+	// LayoutVersion is the supported imageLayoutVersion
+	LayoutVersion = "1.0.0"
+
+	// MediaTypeOCIIndex is the media type of an OCI image index
+	MediaTypeOCIIndex = image.MediaTypeOCIIndex
+	// MediaTypeDockerManifestList is the media type of a Docker manifest list
+	MediaTypeDockerManifestList = image.MediaTypeDockerManifestList
+
+	// AnnotationRefName is the index annotation holding the tag of a manifest
+	AnnotationRefName = "org.opencontainers.image.ref.name"
+	// AnnotationImageName is the index annotation containerd and docker keep the full image name in
+	AnnotationImageName = "io.containerd.image.name"
+)
+
+// ErrNotLayout is returned when a directory is not an OCI image layout
+var ErrNotLayout = errors.New("not an OCI image layout")
+
+// Index is an OCI image index
+type Index struct {
+	SchemaVersion int                `json:"schemaVersion"`
+	MediaType     string             `json:"mediaType,omitempty"`
+	Manifests     []image.Descriptor `json:"manifests"`
+	Annotations   map[string]string  `json:"annotations,omitempty"`
+}
+
+type layoutMarker struct {
+	ImageLayoutVersion string `json:"imageLayoutVersion"`
+}
+
+// Layout is an OCI image layout directory
+type Layout struct {
+	Index Index
+
+	root string
+}
+
+// OpenLayout reads the OCI image layout in dir
+func OpenLayout(dir string) (*Layout, error) {
+	rawJSON, err := ioutil.ReadFile(filepath.Join(dir, LayoutFile))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s has no %s", ErrNotLayout, dir, LayoutFile)
+	} else if err != nil {
+		return nil, err
+	}
+	var marker layoutMarker
+	if err := json.Unmarshal(rawJSON, &marker); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", LayoutFile, err)
+	}
+	if marker.ImageLayoutVersion != LayoutVersion {
+		return nil, fmt.Errorf("unsupported imageLayoutVersion %q", marker.ImageLayoutVersion)
+	}
+
+	l := &Layout{root: dir}
+
+	rawJSON, err = ioutil.ReadFile(filepath.Join(dir, IndexFile))
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(rawJSON, &l.Index); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", IndexFile, err)
+	}
+
+	return l, nil
+}
+
+// Root returns the layout directory
+func (l *Layout) Root() string {
+	return l.root
+}
+
+func (l *Layout) blobPath(d digest.Digest) string {
+	return filepath.Join(l.root, "blobs", d.Algorithm().String(), d.Hex())
+}
+
+// BlobReader opens the blob d
+func (l *Layout) BlobReader(d digest.Digest) (io.ReadCloser, error) {
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+	return os.Open(l.blobPath(d))
+}
+
+func (l *Layout) readBlob(d digest.Digest) ([]byte, error) {
+	rc, err := l.BlobReader(d)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	if got := d.Algorithm().FromBytes(data); got != d {
+		return nil, fmt.Errorf("blob %s has digest %s", d, got)
+	}
+	return data, nil
+}
+
+// IndexedManifest is an image manifest of the layout with the index.json
+// entry it was found through, which carries the tag annotations
+type IndexedManifest struct {
+	Manifest image.OCIManifest
+	// Descriptor is the entry of index.json, for manifests of nested indexes
+	// it is the entry of the index holding them
+	Descriptor image.Descriptor
+}
+
+// Manifests returns all image manifests in the index, descending into nested indexes
+func (l *Layout) Manifests() ([]image.OCIManifest, error) {
+	indexed, err := l.IndexedManifests()
+	if err != nil {
+		return nil, err
+	}
+	manifests := make([]image.OCIManifest, len(indexed))
+	for idx := range indexed {
+		manifests[idx] = indexed[idx].Manifest
+	}
+	return manifests, nil
+}
+
+// IndexedManifests returns all image manifests in the index like Manifests
+// with the index.json entries they were found through
+func (l *Layout) IndexedManifests() ([]IndexedManifest, error) {
+	var manifests []IndexedManifest
+	for _, desc := range l.Index.Manifests {
+		nested, err := l.manifests([]image.Descriptor{desc})
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range nested {
+			manifests = append(manifests, IndexedManifest{Manifest: m, Descriptor: desc})
+		}
+	}
+	return manifests, nil
+}
+
+func (l *Layout) manifests(descs []image.Descriptor) ([]image.OCIManifest, error) {
+	var manifests []image.OCIManifest
+
+	for _, desc := range descs {
+		data, err := l.readBlob(desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+
+		switch desc.MediaType {
+		case MediaTypeOCIIndex, MediaTypeDockerManifestList:
+			var index Index
+			if err := json.Unmarshal(data, &index); err != nil {
+				return nil, fmt.Errorf("failed to parse index %s: %w", desc.Digest, err)
+			}
+			nested, err := l.manifests(index.Manifests)
+			if err != nil {
+				return nil, err
+			}
+			manifests = append(manifests, nested...)
+		case image.MediaTypeOCIManifest, image.MediaTypeDockerManifest:
+			var m image.OCIManifest
+			if err := json.Unmarshal(data, &m); err != nil {
+				return nil, fmt.Errorf("failed to parse manifest %s: %w", desc.Digest, err)
+			}
+			manifests = append(manifests, m)
+		default:
+			// artifacts like signatures and attestations are not images
+			continue
+		}
+	}
+
+	return manifests, nil
+}
+
+// Config returns the parsed image config of the manifest
+func (l *Layout) Config(m image.OCIManifest) (*image.Image, error) {
+	data, err := l.readBlob(m.Config.Digest)
+	if err != nil {
+		return nil, err
+	}
+	return image.NewFromJSON(data)
+}
@@ -0,0 +1,201 @@
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// testLayout holds a "multi" index with linux/amd64 and linux/arm64/v8
+// images, a "single" linux/amd64 image and an SPDX document
+const testLayout = "testdata/layout"
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "graboid-oci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// copyLayout copies the layout in src to a temp dir
+func copyLayout(t *testing.T, src string) string {
+	t.Helper()
+	dest := tempDir(t)
+	err := filepath.Walk(src, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(src, p)
+		if fi.IsDir() {
+			return os.MkdirAll(filepath.Join(dest, rel), 0755)
+		}
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(filepath.Join(dest, rel), data, 0644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dest
+}
+
+func TestOpenLayout(t *testing.T) {
+	l, err := OpenLayout(testLayout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Root() != testLayout || len(l.Index.Manifests) != 3 {
+		t.Fatalf("OpenLayout() = %+v", l)
+	}
+	if got := l.Index.Manifests[0].Annotations[AnnotationRefName]; got != "multi" {
+		t.Errorf("first index entry is %q, want multi", got)
+	}
+
+	manifests, err := l.Manifests()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the SPDX document is not an image
+	if len(manifests) != 3 {
+		t.Fatalf("Manifests() returned %d manifests, want 3", len(manifests))
+	}
+
+	indexed, err := l.IndexedManifests()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRefs := []string{"multi", "multi", "single"}
+	if len(indexed) != len(wantRefs) {
+		t.Fatalf("IndexedManifests() returned %d manifests, want %d", len(indexed), len(wantRefs))
+	}
+	for idx, m := range indexed {
+		if got := m.Descriptor.Annotations[AnnotationRefName]; got != wantRefs[idx] {
+			t.Errorf("manifest %d was found through %q, want %q", idx, got, wantRefs[idx])
+		}
+		if !reflect.DeepEqual(m.Manifest, manifests[idx]) {
+			t.Errorf("manifest %d = %+v, want %+v", idx, m.Manifest, manifests[idx])
+		}
+	}
+
+	wantHostnames := []string{"multi-amd64\n", "multi-arm64\n", "single\n"}
+	wantPlatforms := []string{"linux/amd64", "linux/arm64/v8", "linux/amd64"}
+	for idx, m := range manifests {
+		img, err := l.Config(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := img.Platform().String(); got != wantPlatforms[idx] {
+			t.Errorf("manifest %d is for %s, want %s", idx, got, wantPlatforms[idx])
+		}
+		if len(m.Layers) != 1 || len(img.RootFS.DiffIDs) != 1 {
+			t.Fatalf("manifest %d has %d layers", idx, len(m.Layers))
+		}
+
+		rc, err := l.BlobReader(m.Layers[0].Digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gz, err := gzip.NewReader(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		layer, err := ioutil.ReadAll(gz)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := digest.FromBytes(layer); got != digest.Digest(img.RootFS.DiffIDs[0]) {
+			t.Errorf("layer %d has diff ID %s, want %s", idx, got, img.RootFS.DiffIDs[0])
+		}
+		tr := tar.NewReader(bytes.NewReader(layer))
+		if hdr, err := tr.Next(); err != nil || hdr.Name != "etc/hostname" {
+			t.Fatalf("layer %d starts with %v, %v", idx, hdr, err)
+		}
+		if hostname, _ := ioutil.ReadAll(tr); string(hostname) != wantHostnames[idx] {
+			t.Errorf("layer %d has hostname %q, want %q", idx, hostname, wantHostnames[idx])
+		}
+	}
+}
+
+func TestLayoutBlobReader(t *testing.T) {
+	l, err := OpenLayout(testLayout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.BlobReader("sha256:../../index.json"); err == nil {
+		t.Error("BlobReader() accepted an invalid digest")
+	}
+	if _, err := l.BlobReader(digest.FromString("missing")); !os.IsNotExist(err) {
+		t.Errorf("BlobReader() of a missing blob = %v", err)
+	}
+	rc, err := l.BlobReader(l.Index.Manifests[2].Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if data, _ := ioutil.ReadAll(rc); !strings.Contains(string(data), "SPDX") {
+		t.Errorf("BlobReader() = %s", data)
+	}
+}
+
+func TestOpenLayoutInvalid(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	if _, err := OpenLayout(dir); !errors.Is(err, ErrNotLayout) {
+		t.Errorf("OpenLayout() of an empty dir = %v, want ErrNotLayout", err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, LayoutFile), []byte(`{"imageLayoutVersion":"2.0.0"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenLayout(dir); err == nil || !strings.Contains(err.Error(), "2.0.0") {
+		t.Errorf("OpenLayout() of an unsupported version = %v", err)
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, LayoutFile), []byte(`{"imageLayoutVersion":"1.0.0"}`), 0644)
+	if _, err := OpenLayout(dir); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("OpenLayout() without index.json = %v", err)
+	}
+}
+
+func TestLayoutManifestsTampered(t *testing.T) {
+	dir := copyLayout(t, testLayout)
+	defer os.RemoveAll(dir)
+
+	l, err := OpenLayout(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	single := l.Index.Manifests[1].Digest
+	p := filepath.Join(dir, "blobs", "sha256", single.Hex())
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(p, append(data, ' '), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Manifests(); err == nil || !strings.Contains(err.Error(), single.String()) {
+		t.Errorf("Manifests() with a tampered manifest = %v", err)
+	}
+
+	if err := os.Remove(p); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Manifests(); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Manifests() with a missing manifest = %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+package oci
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/blacktop/graboid/pkg/image"
+	"github.com/opencontainers/go-digest"
+)
+
+// MediaTypeOCILayerTar is the media type of an uncompressed OCI layer
+const MediaTypeOCILayerTar = "application/vnd.oci.image.layer.v1.tar"
+
+// ErrDuplicateBlob is returned when writing a blob that already exists in the layout
+var ErrDuplicateBlob = errors.New("blob already exists")
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+type writeOptions struct {
+	overwrite   bool
+	annotations map[string]string
+}
+
+// WriteOption configures WriteManifest
+type WriteOption func(*writeOptions)
+
+// WithOverwrite replaces blobs that already exist instead of returning ErrDuplicateBlob
+func WithOverwrite(overwrite bool) WriteOption {
+	return func(o *writeOptions) {
+		o.overwrite = overwrite
+	}
+}
+
+// WithAnnotations sets annotations on the manifest's index.json entry (e.g. org.opencontainers.image.ref.name)
+func WithAnnotations(annotations map[string]string) WriteOption {
+	return func(o *writeOptions) {
+		o.annotations = annotations
+	}
+}
+
+// CreateLayout opens the OCI image layout in dir, initializing it if dir holds none
+func CreateLayout(dir string) (*Layout, error) {
+	if _, err := os.Stat(filepath.Join(dir, LayoutFile)); err == nil {
+		return OpenLayout(dir)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "blobs", digest.Canonical.String()), 0755); err != nil {
+		return nil, err
+	}
+
+	marker, err := json.Marshal(layoutMarker{ImageLayoutVersion: LayoutVersion})
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, LayoutFile), marker, 0644); err != nil {
+		return nil, err
+	}
+
+	l := &Layout{
+		Index: Index{SchemaVersion: 2, MediaType: MediaTypeOCIIndex, Manifests: []image.Descriptor{}},
+		root:  dir,
+	}
+	return l, l.writeIndex()
+}
+
+func (l *Layout) writeIndex() error {
+	rawIndex, err := json.MarshalIndent(l.Index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(l.root, IndexFile), rawIndex, 0644)
+}
+
+// writeBlob streams r into the layout and returns its descriptor.
+// If expected has a digest or size the content must match them.
+func (l *Layout) writeBlob(r io.Reader, expected image.Descriptor, o writeOptions) (desc image.Descriptor, err error) {
+	dir := filepath.Join(l.root, "blobs", digest.Canonical.String())
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return desc, err
+	}
+	tmp, err := ioutil.TempFile(dir, ".tmp-")
+	if err != nil {
+		return desc, err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	digester := digest.Canonical.Digester()
+	n, err := io.Copy(io.MultiWriter(tmp, digester.Hash()), r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return desc, err
+	}
+
+	desc = expected
+	desc.Digest = digester.Digest()
+	desc.Size = n
+
+	if expected.Digest != "" && expected.Digest != desc.Digest {
+		return desc, fmt.Errorf("blob digest mismatch: expected %s, got %s", expected.Digest, desc.Digest)
+	}
+	if expected.Size != 0 && expected.Size != desc.Size {
+		return desc, fmt.Errorf("blob %s size mismatch: expected %d, got %d", desc.Digest, expected.Size, desc.Size)
+	}
+
+	if _, err := os.Stat(l.blobPath(desc.Digest)); err == nil && !o.overwrite {
+		return desc, fmt.Errorf("%w: %s", ErrDuplicateBlob, desc.Digest)
+	}
+
+	return desc, os.Rename(tmp.Name(), l.blobPath(desc.Digest))
+}
+
+// layerMediaType guesses the media type of a layer from its first bytes
+func layerMediaType(br *bufio.Reader) string {
+	magic, _ := br.Peek(len(gzipMagic))
+	if bytes.Equal(magic, gzipMagic) {
+		return image.MediaTypeOCILayer
+	}
+	return MediaTypeOCILayerTar
+}
+
+// WriteManifest writes the layers, the image config and the manifest as blobs and adds the manifest to index.json.
+// Descriptors already in m.Layers must match the written layers; missing ones are filled in.
+func (l *Layout) WriteManifest(m image.OCIManifest, img *image.Image, layers []io.Reader, opts ...WriteOption) error {
+	if img == nil {
+		return image.ErrNoImageConfig
+	}
+	var o writeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if len(m.Layers) != 0 && len(m.Layers) != len(layers) {
+		return fmt.Errorf("manifest has %d layers but %d were given", len(m.Layers), len(layers))
+	}
+
+	descs := make([]image.Descriptor, len(layers))
+	for i, r := range layers {
+		var expected image.Descriptor
+		if len(m.Layers) != 0 {
+			expected = m.Layers[i]
+		}
+		br := bufio.NewReader(r)
+		if expected.MediaType == "" {
+			expected.MediaType = layerMediaType(br)
+		}
+		desc, err := l.writeBlob(br, expected, o)
+		if err != nil {
+			return fmt.Errorf("failed to write layer %d: %w", i, err)
+		}
+		descs[i] = desc
+	}
+	m.Layers = descs
+
+	// json.Marshal compacts the raw JSON so use it directly to keep the config digest
+	var err error
+	rawConfig := img.RawJSON()
+	if len(rawConfig) == 0 {
+		if rawConfig, err = json.Marshal(img); err != nil {
+			return err
+		}
+	}
+	configDesc := image.Descriptor{MediaType: m.Config.MediaType}
+	if configDesc.MediaType == "" {
+		configDesc.MediaType = image.MediaTypeOCIConfig
+	}
+	if m.Config, err = l.writeBlob(bytes.NewReader(rawConfig), configDesc, o); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+
+	if m.SchemaVersion == 0 {
+		m.SchemaVersion = 2
+	}
+	if m.MediaType == "" {
+		m.MediaType = image.MediaTypeOCIManifest
+	}
+	rawManifest, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	manifestDesc, err := l.writeBlob(bytes.NewReader(rawManifest), image.Descriptor{MediaType: m.MediaType}, o)
+	if err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if img.OS != "" || img.Architecture != "" {
+		p := img.Platform()
+		manifestDesc.Platform = &p
+	}
+	if len(o.annotations) > 0 {
+		manifestDesc.Annotations = o.annotations
+	}
+
+	manifests := l.Index.Manifests[:0]
+	for _, desc := range l.Index.Manifests {
+		if desc.Digest != manifestDesc.Digest {
+			manifests = append(manifests, desc)
+		}
+	}
+	l.Index.Manifests = append(manifests, manifestDesc)
+	if l.Index.SchemaVersion == 0 {
+		l.Index.SchemaVersion = 2
+	}
+
+	return l.writeIndex()
+}
@@ -0,0 +1,196 @@
+package oci
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/blacktop/graboid/pkg/image"
+	"github.com/opencontainers/go-digest"
+)
+
+func gzipped(t *testing.T, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	io.WriteString(gz, data)
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestLayoutWriteManifest(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	l, err := CreateLayout(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers := [][]byte{gzipped(t, "base layer"), []byte("uncompressed layer")}
+	rawConfig := []byte(`{"architecture": "arm64", "variant": "v8", "os": "linux", "rootfs": {"type": "layers", "diff_ids": []}}`)
+	img, err := image.NewFromJSON(rawConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = l.WriteManifest(image.OCIManifest{}, img, []io.Reader{bytes.NewReader(layers[0]), bytes.NewReader(layers[1])},
+		WithAnnotations(map[string]string{AnnotationRefName: "v1"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := OpenLayout(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reopened.Index.Manifests) != 1 {
+		t.Fatalf("index.json has %d manifests", len(reopened.Index.Manifests))
+	}
+	desc := reopened.Index.Manifests[0]
+	if desc.Annotations[AnnotationRefName] != "v1" || desc.Platform == nil || desc.Platform.String() != "linux/arm64/v8" {
+		t.Errorf("index entry = %+v", desc)
+	}
+
+	manifests, err := reopened.Manifests()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := manifests[0]
+	if want := digest.FromBytes(rawConfig); m.Config.Digest != want || m.Config.MediaType != image.MediaTypeOCIConfig {
+		t.Errorf("config descriptor = %+v, want the digest of the raw config %s", m.Config, want)
+	}
+	wantTypes := []string{image.MediaTypeOCILayer, MediaTypeOCILayerTar}
+	for idx, layer := range m.Layers {
+		if layer.Digest != digest.FromBytes(layers[idx]) || layer.Size != int64(len(layers[idx])) || layer.MediaType != wantTypes[idx] {
+			t.Errorf("layer %d = %+v", idx, layer)
+		}
+		rc, err := reopened.BlobReader(layer.Digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := ioutil.ReadAll(rc)
+		rc.Close()
+		if !bytes.Equal(data, layers[idx]) {
+			t.Errorf("layer %d blob differs from the written layer", idx)
+		}
+	}
+	parsed, err := reopened.Config(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := parsed.ConfigDigest(); d != m.Config.Digest {
+		t.Errorf("reopened config digest %s, want %s", d, m.Config.Digest)
+	}
+
+	tmps, _ := ioutil.ReadDir(dir + "/blobs/sha256")
+	for _, fi := range tmps {
+		if strings.HasPrefix(fi.Name(), ".tmp-") {
+			t.Errorf("temp file %s left in the layout", fi.Name())
+		}
+	}
+}
+
+func TestLayoutWriteManifestDuplicate(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	l, err := CreateLayout(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := &image.Image{OS: "linux", Architecture: "amd64"}
+	write := func(opts ...WriteOption) error {
+		return l.WriteManifest(image.OCIManifest{}, img, []io.Reader{strings.NewReader("shared layer")}, opts...)
+	}
+
+	if err := write(); err != nil {
+		t.Fatal(err)
+	}
+	if err := write(); !errors.Is(err, ErrDuplicateBlob) {
+		t.Errorf("WriteManifest() of an existing layer = %v, want ErrDuplicateBlob", err)
+	}
+	if err := write(WithOverwrite(true)); err != nil {
+		t.Errorf("WriteManifest() with overwrite = %v", err)
+	}
+	if len(l.Index.Manifests) != 1 {
+		t.Errorf("rewriting the manifest left %d index entries", len(l.Index.Manifests))
+	}
+}
+
+func TestLayoutWriteManifestMismatch(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	l, err := CreateLayout(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := &image.Image{OS: "linux", Architecture: "amd64"}
+
+	tests := []struct {
+		name   string
+		m      image.OCIManifest
+		layers []io.Reader
+	}{
+		{
+			name:   "digest",
+			m:      image.OCIManifest{Layers: []image.Descriptor{{Digest: digest.FromString("other layer")}}},
+			layers: []io.Reader{strings.NewReader("layer")},
+		},
+		{
+			name:   "size",
+			m:      image.OCIManifest{Layers: []image.Descriptor{{Digest: digest.FromString("layer"), Size: 4}}},
+			layers: []io.Reader{strings.NewReader("layer")},
+		},
+		{
+			name:   "layer count",
+			m:      image.OCIManifest{Layers: []image.Descriptor{{Digest: digest.FromString("layer")}}},
+			layers: []io.Reader{strings.NewReader("layer"), strings.NewReader("extra")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := l.WriteManifest(tt.m, img, tt.layers); err == nil {
+				t.Error("WriteManifest() accepted layers not matching the manifest")
+			}
+			if _, err := os.Stat(l.blobPath(digest.FromString("layer"))); !os.IsNotExist(err) {
+				t.Errorf("mismatched layer written to the layout: %v", err)
+			}
+		})
+	}
+	if len(l.Index.Manifests) != 0 {
+		t.Errorf("index.json has %d manifests after failed writes", len(l.Index.Manifests))
+	}
+}
+
+func TestLayoutWriteManifestNoConfig(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	l, err := CreateLayout(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.WriteManifest(image.OCIManifest{}, nil, []io.Reader{strings.NewReader("layer")}); !errors.Is(err, image.ErrNoImageConfig) {
+		t.Errorf("WriteManifest() without a config = %v, want ErrNoImageConfig", err)
+	}
+	if _, err := os.Stat(l.blobPath(digest.FromString("layer"))); !os.IsNotExist(err) {
+		t.Errorf("layer of an image without a config written to the layout: %v", err)
+	}
+}
+
+func TestCreateLayoutExisting(t *testing.T) {
+	dir := copyLayout(t, testLayout)
+	defer os.RemoveAll(dir)
+	l, err := CreateLayout(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l.Index.Manifests) != 3 {
+		t.Errorf("CreateLayout() of an existing layout has %d manifests, want 3", len(l.Index.Manifests))
+	}
+}
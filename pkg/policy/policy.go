@@ -0,0 +1,137 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/blacktop/graboid/pkg/cache"
+	"github.com/blacktop/graboid/pkg/reference"
+	"github.com/opencontainers/go-digest"
+)
+
+// ErrImageNotCached is returned by PullNever for images that are not cached
+var ErrImageNotCached = errors.New("image is not cached and the pull policy is never")
+
+// PullPolicy decides when an image is pulled from its registry
+type PullPolicy int
+
+const (
+	// PullAlways pulls the image every time
+	PullAlways PullPolicy = iota
+	// PullIfNotPresent only pulls images that are not cached
+	PullIfNotPresent
+	// PullNever only uses cached images
+	PullNever
+)
+
+func (p PullPolicy) String() string {
+	switch p {
+	case PullAlways:
+		return "always"
+	case PullIfNotPresent:
+		return "if-not-present"
+	case PullNever:
+		return "never"
+	}
+	return fmt.Sprintf("PullPolicy(%d)", int(p))
+}
+
+// ParsePullPolicy parses always, if-not-present (or IfNotPresent) and never
+func ParsePullPolicy(s string) (PullPolicy, error) {
+	switch strings.ToLower(strings.Replace(s, "-", "", -1)) {
+	case "always":
+		return PullAlways, nil
+	case "ifnotpresent", "missing":
+		return PullIfNotPresent, nil
+	case "never":
+		return PullNever, nil
+	}
+	return PullAlways, fmt.Errorf("unknown pull policy %q", s)
+}
+
+// PullDecision is what a PolicyEngine decided to do for an image
+type PullDecision int
+
+const (
+	// MustPull means the image has to be pulled from its registry
+	MustPull PullDecision = iota
+	// UseCache means the cached image is used
+	UseCache
+	// Error means the image can't be used, Apply returns why
+	Error
+)
+
+func (d PullDecision) String() string {
+	switch d {
+	case MustPull:
+		return "must-pull"
+	case UseCache:
+		return "use-cache"
+	case Error:
+		return "error"
+	}
+	return fmt.Sprintf("PullDecision(%d)", int(d))
+}
+
+// ConfigResolver returns the config digest stored for a reference, e.g. by
+// the image layout images are pulled to
+type ConfigResolver func(ref reference.Reference) (digest.Digest, bool)
+
+// PolicyEngine applies a pull policy using the config digests recorded for
+// pulled references or looked up by its Resolver
+type PolicyEngine struct {
+	Policy PullPolicy
+	// Resolver looks up the config digest of references that were not
+	// recorded, so the engine works for images pulled by an earlier process
+	Resolver ConfigResolver
+
+	mu      sync.Mutex
+	configs map[string]digest.Digest // reference -> config digest
+}
+
+// NewPolicyEngine creates a policy engine for p
+func NewPolicyEngine(p PullPolicy) *PolicyEngine {
+	return &PolicyEngine{
+		Policy:  p,
+		configs: make(map[string]digest.Digest),
+	}
+}
+
+// Record remembers the config digest of a pulled reference
+func (e *PolicyEngine) Record(ref reference.Reference, config digest.Digest) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.configs[ref.String()] = config
+}
+
+// Apply decides whether ref has to be pulled. The image is present when the
+// config digest recorded or resolved for ref is in the cache.
+func (e *PolicyEngine) Apply(ref reference.Reference, c *cache.BlobCache) (PullDecision, error) {
+	if e.Policy == PullAlways {
+		return MustPull, nil
+	}
+
+	e.mu.Lock()
+	config, ok := e.configs[ref.String()]
+	e.mu.Unlock()
+	if !ok && e.Resolver != nil {
+		config, ok = e.Resolver(ref)
+	}
+	present := ok && c != nil && c.Has(config)
+
+	switch e.Policy {
+	case PullIfNotPresent:
+		if present {
+			return UseCache, nil
+		}
+		return MustPull, nil
+	case PullNever:
+		if present {
+			return UseCache, nil
+		}
+		return Error, fmt.Errorf("%w: %s", ErrImageNotCached, ref)
+	}
+	return Error, fmt.Errorf("unknown pull policy %s", e.Policy)
+}
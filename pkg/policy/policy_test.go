@@ -0,0 +1,134 @@
+package policy
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/blacktop/graboid/pkg/cache"
+	"github.com/blacktop/graboid/pkg/reference"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestParsePullPolicy(t *testing.T) {
+	tests := map[string]PullPolicy{
+		"always":         PullAlways,
+		"Always":         PullAlways,
+		"if-not-present": PullIfNotPresent,
+		"IfNotPresent":   PullIfNotPresent,
+		"missing":        PullIfNotPresent,
+		"never":          PullNever,
+	}
+	for s, want := range tests {
+		got, err := ParsePullPolicy(s)
+		if err != nil || got != want {
+			t.Errorf("ParsePullPolicy(%q) = %v, %v, want %v", s, got, err, want)
+		}
+		if again, err := ParsePullPolicy(got.String()); err != nil || again != got {
+			t.Errorf("ParsePullPolicy(%q) = %v, %v", got.String(), again, err)
+		}
+	}
+	if _, err := ParsePullPolicy("sometimes"); err == nil {
+		t.Error("ParsePullPolicy(sometimes) succeeded")
+	}
+}
+
+func TestPolicyEngineApply(t *testing.T) {
+	dir, err := ioutil.TempDir("", "graboid-policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bc, err := cache.NewBlobCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := []byte(`{"os":"linux"}`)
+	cached := digest.FromBytes(config)
+	if err := bc.Put(cached, bytes.NewReader(config)); err != nil {
+		t.Fatal(err)
+	}
+	missing := digest.FromString("not in the cache")
+
+	ref, err := reference.Parse("alpine:3.18")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		policy   PullPolicy
+		recorded digest.Digest // "" records nothing
+		resolved digest.Digest // "" has no resolver
+		cache    *cache.BlobCache
+		want     PullDecision
+		wantErr  error
+	}{
+		{name: "always cached", policy: PullAlways, recorded: cached, cache: bc, want: MustPull},
+		{name: "always unknown", policy: PullAlways, cache: bc, want: MustPull},
+		{name: "if-not-present cached", policy: PullIfNotPresent, recorded: cached, cache: bc, want: UseCache},
+		{name: "if-not-present evicted", policy: PullIfNotPresent, recorded: missing, cache: bc, want: MustPull},
+		{name: "if-not-present unknown", policy: PullIfNotPresent, cache: bc, want: MustPull},
+		{name: "if-not-present no cache", policy: PullIfNotPresent, recorded: cached, want: MustPull},
+		{name: "if-not-present resolved", policy: PullIfNotPresent, resolved: cached, cache: bc, want: UseCache},
+		{name: "if-not-present resolved missing", policy: PullIfNotPresent, resolved: missing, cache: bc, want: MustPull},
+		{name: "never cached", policy: PullNever, recorded: cached, cache: bc, want: UseCache},
+		{name: "never resolved", policy: PullNever, resolved: cached, cache: bc, want: UseCache},
+		{name: "never evicted", policy: PullNever, recorded: missing, cache: bc, want: Error, wantErr: ErrImageNotCached},
+		{name: "never unknown", policy: PullNever, cache: bc, want: Error, wantErr: ErrImageNotCached},
+		{name: "never no cache", policy: PullNever, recorded: cached, want: Error, wantErr: ErrImageNotCached},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewPolicyEngine(tt.policy)
+			if len(tt.recorded) > 0 {
+				e.Record(ref, tt.recorded)
+			}
+			if len(tt.resolved) > 0 {
+				e.Resolver = func(r reference.Reference) (digest.Digest, bool) {
+					return tt.resolved, r.String() == ref.String()
+				}
+			}
+
+			got, err := e.Apply(ref, tt.cache)
+			if got != tt.want {
+				t.Errorf("Apply() = %v, want %v", got, tt.want)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Apply() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicyEngineRecordIsPerReference(t *testing.T) {
+	dir, err := ioutil.TempDir("", "graboid-policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bc, err := cache.NewBlobCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := []byte(`{"os":"linux"}`)
+	if err := bc.Put(digest.FromBytes(config), bytes.NewReader(config)); err != nil {
+		t.Fatal(err)
+	}
+
+	nginx, _ := reference.Parse("nginx:latest")
+	redis, _ := reference.Parse("redis:latest")
+	e := NewPolicyEngine(PullIfNotPresent)
+	e.Record(nginx, digest.FromBytes(config))
+
+	if got, _ := e.Apply(nginx, bc); got != UseCache {
+		t.Errorf("nginx: %v, want %v", got, UseCache)
+	}
+	if got, _ := e.Apply(redis, bc); got != MustPull {
+		t.Errorf("redis shares the tag of nginx but got %v", got)
+	}
+}
@@ -0,0 +1,134 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+const mb = 1000 * 1000
+
+// ProgressReporter is told about the progress of a long running operation
+type ProgressReporter interface {
+	// Start begins the operation name, totalBytes is <= 0 when the size is unknown
+	Start(name string, totalBytes int64)
+	// Update reports the total bytes complete so far
+	Update(bytesComplete int64)
+	// Done ends the operation, err is nil when it succeeded
+	Done(err error)
+}
+
+// NoopProgressReporter ignores all progress
+type NoopProgressReporter struct{}
+
+// Start does nothing
+func (NoopProgressReporter) Start(name string, totalBytes int64) {}
+
+// Update does nothing
+func (NoopProgressReporter) Update(bytesComplete int64) {}
+
+// Done does nothing
+func (NoopProgressReporter) Done(err error) {}
+
+type textReporter struct {
+	w     io.Writer
+	mu    sync.Mutex
+	name  string
+	total int64
+}
+
+// TextProgressReporter writes a line per update to w like: layer 3/7: 45.2 MB / 200.0 MB
+func TextProgressReporter(w io.Writer) ProgressReporter {
+	return &textReporter{w: w}
+}
+
+func (t *textReporter) Start(name string, totalBytes int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.name = name
+	t.total = totalBytes
+	t.line(0)
+}
+
+func (t *textReporter) Update(bytesComplete int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.line(bytesComplete)
+}
+
+func (t *textReporter) line(complete int64) {
+	if t.total > 0 {
+		fmt.Fprintf(t.w, "%s: %.1f MB / %.1f MB\n", t.name, float64(complete)/mb, float64(t.total)/mb)
+	} else {
+		fmt.Fprintf(t.w, "%s: %.1f MB\n", t.name, float64(complete)/mb)
+	}
+}
+
+func (t *textReporter) Done(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err != nil {
+		fmt.Fprintf(t.w, "%s: failed: %v\n", t.name, err)
+	} else {
+		fmt.Fprintf(t.w, "%s: done\n", t.name)
+	}
+}
+
+// Reader reports the bytes read through it to a ProgressReporter
+type Reader struct {
+	r        io.Reader
+	reporter ProgressReporter
+	n        int64
+}
+
+// NewReader wraps r to call reporter.Update as it is read
+func NewReader(r io.Reader, reporter ProgressReporter) *Reader {
+	return &Reader{r: r, reporter: reporter}
+}
+
+func (pr *Reader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	if n > 0 {
+		pr.n += int64(n)
+		pr.reporter.Update(pr.n)
+	}
+	return n, err
+}
+
+// Counter adds up bytes reported by several concurrent readers for a single reporter
+type Counter struct {
+	mu       sync.Mutex
+	reporter ProgressReporter
+	n        int64
+}
+
+// NewCounter returns a Counter reporting to reporter
+func NewCounter(reporter ProgressReporter) *Counter {
+	return &Counter{reporter: reporter}
+}
+
+// Add adds n bytes and reports the new total
+func (c *Counter) Add(n int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.n += n
+	c.reporter.Update(c.n)
+}
+
+// Reader wraps r to add the bytes read through it to the counter
+func (c *Counter) Reader(r io.Reader) io.Reader {
+	return &counterReader{r: r, c: c}
+}
+
+type counterReader struct {
+	r io.Reader
+	c *Counter
+}
+
+func (cr *counterReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	if n > 0 {
+		cr.c.Add(int64(n))
+	}
+	return n, err
+}
@@ -0,0 +1,140 @@
+package progress
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// progressLine matches the lines of TextProgressReporter
+var progressLine = regexp.MustCompile(`^(.+): (?:(\d+\.\d) MB(?: / (\d+\.\d) MB)?|done|failed: (.+))$`)
+
+type progressEntry struct {
+	name     string
+	complete float64
+	total    float64
+	done     bool
+	failed   string
+}
+
+// scanProgress parses every line TextProgressReporter wrote
+func scanProgress(t *testing.T, r io.Reader) []progressEntry {
+	t.Helper()
+	var entries []progressEntry
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		m := progressLine.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			t.Fatalf("unparseable progress line %q", scanner.Text())
+		}
+		entry := progressEntry{name: m[1], failed: m[4]}
+		switch {
+		case m[2] != "":
+			entry.complete, _ = strconv.ParseFloat(m[2], 64)
+			entry.total, _ = strconv.ParseFloat(m[3], 64)
+		case m[4] == "":
+			entry.done = true
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestTextProgressReporter(t *testing.T) {
+	var buf bytes.Buffer
+	r := TextProgressReporter(&buf)
+	r.Start("layer 3/7", 200*mb)
+	r.Update(45200 * 1000)
+	r.Update(200 * mb)
+	r.Done(nil)
+	r.Start("layer 4/7", 0)
+	r.Update(1500 * 1000)
+	r.Done(errors.New("connection reset"))
+
+	want := []progressEntry{
+		{name: "layer 3/7", total: 200},
+		{name: "layer 3/7", complete: 45.2, total: 200},
+		{name: "layer 3/7", complete: 200, total: 200},
+		{name: "layer 3/7", done: true},
+		{name: "layer 4/7"},
+		{name: "layer 4/7", complete: 1.5},
+		{name: "layer 4/7", failed: "connection reset"},
+	}
+	got := scanProgress(t, strings.NewReader(buf.String()))
+	if len(got) != len(want) {
+		t.Fatalf("got %d lines, want %d:\n%s", len(got), len(want), buf.String())
+	}
+	for idx := range want {
+		if got[idx] != want[idx] {
+			t.Errorf("line %d = %+v, want %+v", idx, got[idx], want[idx])
+		}
+	}
+	if line := strings.SplitN(buf.String(), "\n", 3)[1]; line != "layer 3/7: 45.2 MB / 200.0 MB" {
+		t.Errorf("update line = %q", line)
+	}
+}
+
+func TestReader(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := TextProgressReporter(&buf)
+	reporter.Start("blob", 3*mb)
+	data := bytes.Repeat([]byte{'x'}, 3*mb)
+	n, err := io.Copy(ioutil.Discard, NewReader(bytes.NewReader(data), reporter))
+	if err != nil || n != int64(len(data)) {
+		t.Fatalf("Copy() = %d, %v", n, err)
+	}
+
+	entries := scanProgress(t, &buf)
+	for idx := 1; idx < len(entries); idx++ {
+		if entries[idx].complete < entries[idx-1].complete {
+			t.Errorf("progress went back from %.1f to %.1f", entries[idx-1].complete, entries[idx].complete)
+		}
+	}
+	if last := entries[len(entries)-1]; last.complete != 3 {
+		t.Errorf("last update = %+v, want 3.0 MB", last)
+	}
+}
+
+// maxReporter keeps the largest update
+type maxReporter struct {
+	NoopProgressReporter
+	mu  sync.Mutex
+	max int64
+}
+
+func (m *maxReporter) Update(bytesComplete int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if bytesComplete > m.max {
+		m.max = bytesComplete
+	}
+}
+
+func TestCounter(t *testing.T) {
+	reporter := &maxReporter{}
+	c := NewCounter(reporter)
+
+	var wg sync.WaitGroup
+	for idx := 0; idx < 8; idx++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			io.Copy(ioutil.Discard, c.Reader(bytes.NewReader(make([]byte, 100*1000))))
+		}()
+	}
+	wg.Wait()
+
+	if reporter.max != 800*1000 {
+		t.Errorf("counted %d bytes, want %d", reporter.max, 800*1000)
+	}
+}
@@ -0,0 +1,236 @@
+package pull
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/apex/log"
+	"github.com/blacktop/graboid/pkg/cache"
+	blobdigest "github.com/blacktop/graboid/pkg/digest"
+	"github.com/blacktop/graboid/pkg/image"
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	layoutFile    = "oci-layout"
+	indexFile     = "index.json"
+	layoutVersion = `{"imageLayoutVersion":"1.0.0"}`
+
+	annotationRefName = "org.opencontainers.image.ref.name"
+)
+
+type ociIndex struct {
+	SchemaVersion int                `json:"schemaVersion"`
+	MediaType     string             `json:"mediaType,omitempty"`
+	Manifests     []image.Descriptor `json:"manifests"`
+}
+
+// layout is an OCI image layout directory pulled images are written to
+type layout struct {
+	root string
+	mu   sync.Mutex
+	// cache is the blobs directory of the layout seen as a blob cache for pull policies
+	cache *cache.BlobCache
+
+	blobsMu sync.Mutex
+	blobs   map[digest.Digest]*sync.Mutex // per blob locks held while fetching it
+}
+
+func newLayout(root string) (*layout, error) {
+	if err := os.MkdirAll(filepath.Join(root, "blobs", digest.Canonical.String()), 0755); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, layoutFile), []byte(layoutVersion), 0644); err != nil {
+		return nil, err
+	}
+	bc, err := cache.NewBlobCache(filepath.Join(root, "blobs"))
+	if err != nil {
+		return nil, err
+	}
+	return &layout{root: root, cache: bc, blobs: make(map[digest.Digest]*sync.Mutex)}, nil
+}
+
+func (l *layout) blobPath(d digest.Digest) string {
+	return filepath.Join(l.root, filepath.FromSlash(blobPath(d)))
+}
+
+func (l *layout) hasBlob(d digest.Digest) bool {
+	_, err := os.Stat(l.blobPath(d))
+	return err == nil
+}
+
+// writeBlob streams r into the blob d through a temporary file that is
+// renamed into place once complete and its content matches d
+func (l *layout) writeBlob(d digest.Digest, r io.Reader) (n int64, err error) {
+	if err := d.Validate(); err != nil {
+		return 0, err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(l.blobPath(d)), d.Hex()+".tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer removeOnError(tmp.Name(), &err)
+
+	vr, err := blobdigest.NewVerifyingReader(r, d)
+	if err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if n, err = io.Copy(tmp, vr); err != nil {
+		tmp.Close()
+		return n, err
+	}
+	if err = tmp.Close(); err != nil {
+		return n, err
+	}
+	if err = vr.Close(); err != nil {
+		return n, err
+	}
+
+	return n, os.Rename(tmp.Name(), l.blobPath(d))
+}
+
+// lockBlob locks the blob d so it is fetched once and returns the unlock func
+func (l *layout) lockBlob(d digest.Digest) func() {
+	l.blobsMu.Lock()
+	mu, ok := l.blobs[d]
+	if !ok {
+		mu = &sync.Mutex{}
+		l.blobs[d] = mu
+	}
+	l.blobsMu.Unlock()
+
+	mu.Lock()
+	return mu.Unlock
+}
+
+// cacheBlob copies the blob d of the layout to c
+func (l *layout) cacheBlob(c *cache.BlobCache, d digest.Digest) {
+	if c.Has(d) {
+		return
+	}
+	f, err := os.Open(l.blobPath(d))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	if err := c.Put(d, f); err != nil {
+		log.WithError(err).WithField("digest", d).Warn("failed to cache blob")
+	}
+}
+
+func removeOnError(path string, err *error) {
+	if *err != nil {
+		os.Remove(path)
+	}
+}
+
+func (l *layout) image(d digest.Digest) (*image.Image, error) {
+	rawJSON, err := ioutil.ReadFile(l.blobPath(d))
+	if err != nil {
+		return nil, err
+	}
+	return image.NewFromJSON(rawJSON)
+}
+
+// writeRawBlob writes a small blob held in memory like a manifest
+func (l *layout) writeRawBlob(raw []byte) (digest.Digest, error) {
+	d := digest.FromBytes(raw)
+	return d, ioutil.WriteFile(l.blobPath(d), raw, 0644)
+}
+
+// writeManifest writes the manifest (or index) blob and adds it to index.json under name
+func (l *layout) writeManifest(rawManifest []byte, mediaType, name string, platform *image.Platform) (image.Descriptor, error) {
+	desc := image.Descriptor{
+		MediaType:   mediaType,
+		Size:        int64(len(rawManifest)),
+		Annotations: map[string]string{annotationRefName: name},
+		Platform:    platform,
+	}
+
+	var err error
+	if desc.Digest, err = l.writeRawBlob(rawManifest); err != nil {
+		return desc, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	index := ociIndex{SchemaVersion: 2, MediaType: image.MediaTypeOCIIndex}
+	if rawIndex, err := ioutil.ReadFile(filepath.Join(l.root, indexFile)); err == nil {
+		if err := json.Unmarshal(rawIndex, &index); err != nil {
+			return desc, err
+		}
+	}
+
+	// replace the manifest previously pulled for the name
+	manifests := index.Manifests[:0]
+	for _, m := range index.Manifests {
+		if m.Annotations[annotationRefName] != name {
+			manifests = append(manifests, m)
+		}
+	}
+	index.Manifests = append(manifests, desc)
+
+	rawIndex, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return desc, err
+	}
+	return desc, ioutil.WriteFile(filepath.Join(l.root, indexFile), rawIndex, 0644)
+}
+
+// configDigest returns the config digest of the image recorded under name
+// if all its blobs are in the layout. Indexes resolve to the manifest of platform p.
+func (l *layout) configDigest(name string, p image.Platform) (digest.Digest, bool) {
+	rawIndex, err := ioutil.ReadFile(filepath.Join(l.root, indexFile))
+	if err != nil {
+		return "", false
+	}
+	var index ociIndex
+	if err := json.Unmarshal(rawIndex, &index); err != nil {
+		return "", false
+	}
+
+	for _, desc := range index.Manifests {
+		if desc.Annotations[annotationRefName] == name {
+			return l.manifestConfig(desc, p)
+		}
+	}
+	return "", false
+}
+
+// manifestConfig returns the config digest of the manifest desc if the layout has all its blobs
+func (l *layout) manifestConfig(desc image.Descriptor, p image.Platform) (digest.Digest, bool) {
+	raw, err := ioutil.ReadFile(l.blobPath(desc.Digest))
+	if err != nil {
+		return "", false
+	}
+
+	if desc.MediaType == image.MediaTypeOCIIndex || desc.MediaType == image.MediaTypeDockerManifestList {
+		index, err := parseIndex(raw, desc.MediaType)
+		if err != nil || index == nil {
+			return "", false
+		}
+		platformDesc, err := index.forPlatform(p)
+		if err != nil {
+			return "", false
+		}
+		return l.manifestConfig(platformDesc, p)
+	}
+
+	var m image.OCIManifest
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return "", false
+	}
+	for _, blob := range append([]image.Descriptor{m.Config}, m.Layers...) {
+		if !l.hasBlob(blob.Digest) {
+			return "", false
+		}
+	}
+	return m.Config.Digest, true
+}
@@ -0,0 +1,58 @@
+package pull
+
+import (
+	"fmt"
+	"sync"
+)
+
+// PullMultiple pulls the images refs into the OCI image layout dest, up to
+// opts.MaxParallelImages at once. Blobs shared by the images are only
+// downloaded once. The results are in the order of refs, images that failed
+// have their PullResult.Error set and the returned error tells how many failed.
+func PullMultiple(refs []string, dest string, opts PullOptions) ([]PullResult, error) {
+	opts = opts.withDefaults()
+
+	layout, err := newLayout(dest)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		wg      sync.WaitGroup
+		results = make([]PullResult, len(refs))
+		sem     = make(chan struct{}, opts.MaxParallelImages)
+	)
+	for idx, ref := range refs {
+		wg.Add(1)
+		go func(idx int, ref string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			res, err := pull(ref, layout, opts)
+			if err != nil {
+				results[idx] = PullResult{Ref: ref, Error: err}
+				return
+			}
+			results[idx] = *res
+		}(idx, ref)
+	}
+	wg.Wait()
+
+	var (
+		failed   int
+		firstErr error
+	)
+	for _, res := range results {
+		if res.Error != nil {
+			if failed == 0 {
+				firstErr = fmt.Errorf("%s: %w", res.Ref, res.Error)
+			}
+			failed++
+		}
+	}
+	if failed > 0 {
+		return results, fmt.Errorf("failed to pull %d of %d images, first: %w", failed, len(refs), firstErr)
+	}
+	return results, nil
+}
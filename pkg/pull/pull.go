@@ -0,0 +1,583 @@
+package pull
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/apex/log"
+	"github.com/blacktop/graboid/pkg/cache"
+	"github.com/blacktop/graboid/pkg/image"
+	"github.com/blacktop/graboid/pkg/policy"
+	"github.com/blacktop/graboid/pkg/progress"
+	"github.com/blacktop/graboid/pkg/reference"
+	"github.com/blacktop/graboid/pkg/registry"
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	defaultRegistry    = "registry-1.docker.io"
+	defaultConcurrency = 3
+)
+
+// PullOptions configures Pull
+type PullOptions struct {
+	// Concurrency is the number of layers downloaded at once (default 3)
+	Concurrency int
+	// Platform is the platform the pulled image must be built for
+	Platform image.Platform
+	// Credentials looks up the registry credentials
+	Credentials registry.CredentialFunc
+	// ProgressWriter receives a line per downloaded blob
+	ProgressWriter io.Writer
+	// Progress is told about the bytes downloaded for the whole pull
+	Progress progress.ProgressReporter
+	// ResumeDir keeps partially downloaded blobs so an interrupted pull can resume
+	ResumeDir string
+	// AllPlatforms pulls every platform of a multi-platform image
+	AllPlatforms bool
+	// Policy decides whether an image already in the destination layout is pulled again
+	Policy policy.PullPolicy
+	// FailFast cancels the remaining layer downloads on the first error
+	// instead of finishing them so they are in the layout for the next pull
+	FailFast bool
+	// ClientOptions are applied to the registry client, e.g. registry.WithProxy
+	ClientOptions []registry.ClientOption
+	// Insecure pulls from registries serving plain HTTP or self-signed certificates
+	Insecure bool
+	// MaxParallelImages is the number of images PullMultiple pulls at once (default 3)
+	MaxParallelImages int
+	// Cache is checked for blobs before downloading them and gets every downloaded blob
+	Cache *cache.BlobCache
+	// OnLayerStart is called before a layer is downloaded with the size from
+	// the manifest. It is called from the download goroutines so it must be goroutine-safe.
+	OnLayerStart func(layerIndex int, d digest.Digest, totalBytes int64)
+	// OnLayerComplete is called once a layer is in the layout and verified
+	// with the bytes downloaded, 0 for cached layers. It is called from the
+	// download goroutines so it must be goroutine-safe.
+	OnLayerComplete func(layerIndex int, d digest.Digest, bytesDownloaded int64)
+
+	// hostPlatform is set when Platform was defaulted to the host platform, it
+	// then only picks the manifest of an index and single platform images of
+	// any platform are pulled
+	hostPlatform bool
+}
+
+// LayerResult describes the download of a single layer blob
+type LayerResult struct {
+	Digest          digest.Digest
+	Size            int64
+	BytesDownloaded int64
+	CacheHit        bool
+}
+
+// PullResult describes a pulled image
+type PullResult struct {
+	Ref         string
+	OCIManifest *image.OCIManifest
+	// Manifest is the docker style manifest with paths relative to the layout
+	Manifest image.Manifest
+	Image    *image.Image
+	Layers   []LayerResult
+	// Platforms holds the result of every platform pulled with AllPlatforms,
+	// the other fields describe the one matching the requested platform
+	Platforms []PullResult
+	// Error is why PullMultiple failed to pull the image
+	Error error
+}
+
+// imageName returns the normalized reference (e.g. docker.io/library/nginx:latest) ref is recorded under in the layout
+func imageName(ref string) string {
+	if r, err := reference.Parse(ref); err == nil {
+		return r.String()
+	}
+	return ref
+}
+
+// pullTarget returns the registry host, repository and tag or digest r is
+// pulled from. Docker Hub is pulled from registry-1.docker.io and local
+// references have the LocalScheme host and the layout directory as repository.
+func pullTarget(r reference.Reference) (host, repo, tag string) {
+	tag = r.Tag
+	if len(r.Digest) > 0 {
+		tag = r.Digest.String()
+	} else if len(tag) == 0 {
+		tag = "latest"
+	}
+	if r.IsLocal() {
+		return reference.LocalScheme, filepath.Base(r.Path), tag
+	}
+
+	host = r.Registry
+	if host == reference.DefaultRegistry() {
+		host = defaultRegistry
+	}
+	return host, r.Repository, tag
+}
+
+// Pull downloads the image ref and writes it as an OCI image layout to dest.
+// Multi-platform images are resolved to opts.Platform, which defaults to the
+// host platform, unless opts.AllPlatforms is set. Single platform images must
+// match opts.Platform only when it is set.
+// local://path/to/layout references are read from an OCI image layout instead of a registry.
+func Pull(ref string, dest string, opts PullOptions) (*PullResult, error) {
+	opts = opts.withDefaults()
+
+	layout, err := newLayout(dest)
+	if err != nil {
+		return nil, err
+	}
+	return pull(ref, layout, opts)
+}
+
+// withDefaults returns the options with the defaults of unset fields filled in
+func (opts PullOptions) withDefaults() PullOptions {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = defaultConcurrency
+	}
+	if opts.MaxParallelImages <= 0 {
+		opts.MaxParallelImages = defaultConcurrency
+	}
+	if opts.Progress == nil {
+		opts.Progress = progress.NoopProgressReporter{}
+	}
+	if len(opts.Platform.OS) == 0 {
+		opts.Platform = image.DefaultPlatform()
+		opts.hostPlatform = true
+	}
+	return opts
+}
+
+// pull downloads the image ref into the layout
+func pull(ref string, layout *layout, opts PullOptions) (*PullResult, error) {
+	r, err := reference.Parse(ref)
+	if err != nil {
+		return nil, err
+	}
+	host, repo, tag := pullTarget(r)
+
+	var client source
+	if r.IsLocal() {
+		if client, err = newLocalSource(r.Path); err != nil {
+			return nil, err
+		}
+	} else {
+		clientOpts := append([]registry.ClientOption{registry.WithCredentialFunc(opts.Credentials)}, opts.ClientOptions...)
+		if opts.Insecure {
+			clientOpts = append(clientOpts, registry.WithInsecure(true))
+		}
+		client = registry.NewClient(host, clientOpts...)
+	}
+
+	log.WithFields(log.Fields{
+		"registry": host,
+		"image":    repo,
+		"tag":      tag,
+		"platform": opts.Platform,
+	}).Debug("pulling image")
+
+	manifestRef := repo + ":" + tag
+	if _, err := digest.Parse(tag); err == nil {
+		manifestRef = repo + "@" + tag
+	}
+	// images are recorded under their full reference so repos sharing a tag don't replace each other
+	name := r.String()
+
+	if host != reference.LocalScheme {
+		useLayout, err := applyPolicy(ref, layout, opts)
+		if err != nil {
+			return nil, err
+		}
+		if useLayout {
+			log.WithField("image", name).Debug("using image already in the layout")
+			if client, err = newLocalSource(layout.root); err != nil {
+				return nil, err
+			}
+			manifestRef = name
+		}
+	}
+	rawManifest, mediaType, err := client.GetRawManifestOrIndex(manifestRef)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := parseIndex(rawManifest, mediaType)
+	if err != nil {
+		return nil, err
+	}
+	if index == nil {
+		res, err := pullManifest(client, layout, repo, tag, ref, rawManifest, mediaType, opts)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := layout.writeManifest(rawManifest, res.OCIManifest.MediaType, name, res.Manifest.Platform); err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+
+	if !opts.AllPlatforms {
+		desc, err := index.forPlatform(opts.Platform)
+		if err != nil {
+			return nil, fmt.Errorf("image %s: %w", ref, err)
+		}
+		raw, mediaType, err := client.GetManifestByDigest(repo, desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+		// the manifest picked from the index must be built for the platform it is listed for
+		platformOpts := opts
+		platformOpts.hostPlatform = false
+		res, err := pullManifest(client, layout, repo, tag, ref, raw, mediaType, platformOpts)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := layout.writeManifest(raw, mediaType, name, res.Manifest.Platform); err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+
+	// pull every platform and tag the index itself
+	var results []PullResult
+	for _, desc := range index.Manifests {
+		// attestation manifests are listed with an unknown/unknown platform
+		if desc.Platform == nil || desc.Platform.OS == "unknown" {
+			continue
+		}
+		raw, mediaType, err := client.GetManifestByDigest(repo, desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+		platformOpts := opts
+		platformOpts.Platform = *desc.Platform
+		platformOpts.hostPlatform = false
+		res, err := pullManifest(client, layout, repo, tag, ref, raw, mediaType, platformOpts)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := layout.writeRawBlob(raw); err != nil {
+			return nil, err
+		}
+		results = append(results, *res)
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("image %s: index lists no platforms", ref)
+	}
+	if _, err := layout.writeManifest(rawManifest, index.MediaType, name, nil); err != nil {
+		return nil, err
+	}
+
+	platforms := make([]*image.Platform, len(results))
+	for idx := range results {
+		platforms[idx] = results[idx].Manifest.Platform
+	}
+	res := results[0]
+	if idx, err := image.MatchPlatform(platforms, opts.Platform); err == nil {
+		res = results[idx]
+	}
+	res.Platforms = results
+
+	return &res, nil
+}
+
+// applyPolicy returns true if opts.Policy lets the image ref already in the layout be used instead of pulling it
+func applyPolicy(ref string, layout *layout, opts PullOptions) (bool, error) {
+	if opts.Policy == policy.PullAlways {
+		return false, nil
+	}
+	r, err := reference.Parse(ref)
+	if err != nil {
+		return false, err
+	}
+	engine := policy.NewPolicyEngine(opts.Policy)
+	engine.Resolver = func(r reference.Reference) (digest.Digest, bool) {
+		return layout.configDigest(r.String(), opts.Platform)
+	}
+
+	decision, err := engine.Apply(r, layout.cache)
+	if decision == policy.Error {
+		return false, err
+	}
+	return decision == policy.UseCache, nil
+}
+
+// parseIndex returns the index when rawManifest is an OCI index or Docker manifest list and nil otherwise
+func parseIndex(rawManifest []byte, mediaType string) (*ociIndex, error) {
+	var index ociIndex
+	if err := json.Unmarshal(rawManifest, &index); err != nil {
+		return nil, err
+	}
+	if len(index.MediaType) == 0 {
+		index.MediaType = mediaType
+	}
+	switch index.MediaType {
+	case image.MediaTypeOCIIndex, image.MediaTypeDockerManifestList:
+		return &index, nil
+	}
+	return nil, nil
+}
+
+// forPlatform returns the descriptor of the manifest built for p
+func (index *ociIndex) forPlatform(p image.Platform) (image.Descriptor, error) {
+	platforms := make([]*image.Platform, len(index.Manifests))
+	for idx := range index.Manifests {
+		platforms[idx] = index.Manifests[idx].Platform
+	}
+	idx, err := image.MatchPlatform(platforms, p)
+	if err != nil {
+		return image.Descriptor{}, err
+	}
+	return index.Manifests[idx], nil
+}
+
+// pullManifest downloads the config and layers of a single platform manifest into the layout
+func pullManifest(client source, layout *layout, repo, tag, ref string, rawManifest []byte, mediaType string, opts PullOptions) (res *PullResult, err error) {
+	parsed, err := image.ParseManifestAuto(rawManifest)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := parsed.(*image.OCIManifest)
+	if !ok {
+		return nil, fmt.Errorf("unexpected manifest type %T", parsed)
+	}
+	if len(m.MediaType) == 0 {
+		m.MediaType = mediaType
+	}
+
+	res = &PullResult{
+		Ref:         ref,
+		OCIManifest: m,
+		Layers:      make([]LayerResult, len(m.Layers)),
+	}
+
+	total := m.Config.Size
+	for _, layer := range m.Layers {
+		total += layer.Size
+	}
+	name := "pull " + ref
+	if opts.AllPlatforms {
+		name += " " + opts.Platform.String()
+	}
+	opts.Progress.Start(name, total)
+	defer func() { opts.Progress.Done(err) }()
+	counter := progress.NewCounter(opts.Progress)
+
+	// config
+	if _, err := fetchBlob(client, layout, repo, m.Config, counter, nil, opts); err != nil {
+		return nil, err
+	}
+	res.Image, err = layout.image(m.Config.Digest)
+	if err != nil {
+		return nil, err
+	}
+	platform := res.Image.Platform()
+	if !opts.hostPlatform && len(opts.Platform.OS) > 0 && (platform.OS != opts.Platform.OS || platform.Arch != opts.Platform.Arch) {
+		return nil, fmt.Errorf("image %s is %s but %s was requested", ref, platform, opts.Platform)
+	}
+
+	// layers
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+		sem      = make(chan struct{}, opts.Concurrency)
+		stop     = make(chan struct{})
+		// serializes the lines written to opts.ProgressWriter
+		progressMu sync.Mutex
+	)
+	for idx, layer := range m.Layers {
+		wg.Add(1)
+		go func(idx int, layer image.Descriptor) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-stop:
+				return
+			}
+			defer func() { <-sem }()
+
+			if opts.OnLayerStart != nil {
+				opts.OnLayerStart(idx, layer.Digest, layer.Size)
+			}
+			lr, err := fetchBlob(client, layout, repo, layer, counter, stop, opts)
+			if err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					if opts.FailFast {
+						close(stop)
+					}
+				})
+				return
+			}
+			res.Layers[idx] = *lr
+			if opts.OnLayerComplete != nil {
+				opts.OnLayerComplete(idx, layer.Digest, lr.BytesDownloaded)
+			}
+			if opts.ProgressWriter != nil {
+				progressMu.Lock()
+				defer progressMu.Unlock()
+				fmt.Fprintf(opts.ProgressWriter, "layer %d/%d: %s (%d bytes)\n", idx+1, len(m.Layers), layer.Digest, lr.BytesDownloaded)
+			}
+		}(idx, layer)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	res.Manifest = image.Manifest{
+		Config:   blobPath(m.Config.Digest),
+		RepoTags: []string{repo + ":" + tag},
+		Platform: &platform,
+	}
+	for _, layer := range m.Layers {
+		res.Manifest.Layers = append(res.Manifest.Layers, blobPath(layer.Digest))
+	}
+
+	return res, nil
+}
+
+// fetchBlob downloads the blob described by desc into the layout unless it is already there.
+// The download is aborted once stop is closed.
+func fetchBlob(client source, layout *layout, repo string, desc image.Descriptor, counter *progress.Counter, stop <-chan struct{}, opts PullOptions) (*LayerResult, error) {
+	lr := &LayerResult{Digest: desc.Digest, Size: desc.Size}
+
+	// images pulled at once into the same layout often share blobs, only one of them downloads each
+	unlock := layout.lockBlob(desc.Digest)
+	defer unlock()
+
+	if layout.hasBlob(desc.Digest) {
+		lr.CacheHit = true
+		counter.Add(desc.Size)
+		return lr, nil
+	}
+	if opts.Cache != nil {
+		if cached, ok := opts.Cache.Get(desc.Digest); ok {
+			_, err := layout.writeBlob(desc.Digest, counter.Reader(cached))
+			cached.Close()
+			if err == nil {
+				lr.CacheHit = true
+				return lr, nil
+			}
+			log.WithError(err).WithField("digest", desc.Digest).Warn("failed to copy blob from the cache")
+		}
+	}
+	defer func() {
+		if opts.Cache != nil && layout.hasBlob(desc.Digest) {
+			layout.cacheBlob(opts.Cache, desc.Digest)
+		}
+	}()
+
+	if len(opts.ResumeDir) > 0 {
+		n, err := resumeBlob(client, layout, repo, desc, counter, stop, opts)
+		lr.BytesDownloaded = n
+		if err != nil {
+			return nil, err
+		}
+		return lr, nil
+	}
+
+	body, err := client.GetBlob(repo, desc.Digest.String())
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	n, err := layout.writeBlob(desc.Digest, &stopReader{Reader: counter.Reader(body), stop: stop})
+	if err != nil {
+		return nil, err
+	}
+	lr.BytesDownloaded = n
+
+	return lr, nil
+}
+
+// resumeBlob downloads the blob into a partial file under opts.ResumeDir,
+// continuing from where a previous attempt stopped, and moves it into the
+// layout once complete.
+func resumeBlob(client source, layout *layout, repo string, desc image.Descriptor, counter *progress.Counter, stop <-chan struct{}, opts PullOptions) (int64, error) {
+	partial := filepath.Join(opts.ResumeDir, desc.Digest.Algorithm().String(), desc.Digest.Hex()+".partial")
+	if err := os.MkdirAll(filepath.Dir(partial), 0755); err != nil {
+		return 0, err
+	}
+
+	var offset int64
+	if fi, err := os.Stat(partial); err == nil {
+		offset = fi.Size()
+	}
+
+	var downloaded int64
+	if desc.Size != 0 && offset >= desc.Size {
+		counter.Add(offset)
+	} else {
+		body, resumed, err := client.GetBlobFrom(repo, desc.Digest.String(), offset)
+		if err != nil {
+			return 0, err
+		}
+		defer body.Close()
+
+		flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		if resumed {
+			counter.Add(offset)
+		} else {
+			log.WithField("digest", desc.Digest).Debug("registry does not support resume, restarting download")
+			flags |= os.O_TRUNC
+		}
+		f, err := os.OpenFile(partial, flags, 0644)
+		if err != nil {
+			return 0, err
+		}
+		// a failed copy keeps the partial file for the next attempt
+		downloaded, err = io.Copy(f, &stopReader{Reader: counter.Reader(body), stop: stop})
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return downloaded, err
+		}
+	}
+
+	f, err := os.Open(partial)
+	if err != nil {
+		return downloaded, err
+	}
+	defer f.Close()
+
+	if _, err := layout.writeBlob(desc.Digest, f); err != nil {
+		// never resume from corrupted data
+		f.Close()
+		os.Remove(partial)
+		return downloaded, err
+	}
+	f.Close()
+
+	return downloaded, os.Remove(partial)
+}
+
+// errCancelled is returned by downloads stopped because another one failed
+var errCancelled = errors.New("download cancelled")
+
+// stopReader fails reads once stop is closed
+type stopReader struct {
+	io.Reader
+	stop <-chan struct{}
+}
+
+func (sr *stopReader) Read(p []byte) (int, error) {
+	select {
+	case <-sr.stop:
+		return 0, errCancelled
+	default:
+		return sr.Reader.Read(p)
+	}
+}
+
+// blobPath returns the path of the blob relative to the layout root
+func blobPath(d digest.Digest) string {
+	return filepath.ToSlash(filepath.Join("blobs", d.Algorithm().String(), d.Hex()))
+}
@@ -0,0 +1,939 @@
+package pull
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	blobdigest "github.com/blacktop/graboid/pkg/digest"
+	"github.com/blacktop/graboid/pkg/image"
+	"github.com/blacktop/graboid/pkg/policy"
+	"github.com/blacktop/graboid/pkg/reference"
+	"github.com/blacktop/graboid/pkg/registry"
+	"github.com/opencontainers/go-digest"
+)
+
+// fakeRegistry serves manifests and blobs like a registry v2 API without auth
+type fakeRegistry struct {
+	t   testing.TB
+	srv *httptest.Server
+
+	mu           sync.Mutex
+	manifests    map[string][]byte // repo:tag and repo@digest
+	types        map[string]string
+	blobs        map[digest.Digest][]byte
+	corrupt      map[digest.Digest]bool
+	noRange      bool
+	dropAfter    map[digest.Digest]int // closes the connection of the next download of the blob after that many bytes
+	blobHits     map[digest.Digest]int
+	manifestHits int
+	latency      time.Duration                   // added to every request
+	slow         map[digest.Digest]time.Duration // added to the downloads of the blob
+}
+
+func newFakeRegistry(t testing.TB) *fakeRegistry {
+	return newRegistryServer(t, httptest.NewTLSServer)
+}
+
+// newPlainFakeRegistry creates a fakeRegistry serving plain HTTP
+func newPlainFakeRegistry(t testing.TB) *fakeRegistry {
+	return newRegistryServer(t, httptest.NewServer)
+}
+
+func newRegistryServer(t testing.TB, newServer func(http.Handler) *httptest.Server) *fakeRegistry {
+	r := &fakeRegistry{
+		t:         t,
+		manifests: make(map[string][]byte),
+		types:     make(map[string]string),
+		blobs:     make(map[digest.Digest][]byte),
+		corrupt:   make(map[digest.Digest]bool),
+		dropAfter: make(map[digest.Digest]int),
+		blobHits:  make(map[digest.Digest]int),
+		slow:      make(map[digest.Digest]time.Duration),
+	}
+	r.srv = newServer(http.HandlerFunc(r.serve))
+	return r
+}
+
+func (r *fakeRegistry) Close() {
+	r.srv.Close()
+}
+
+func (r *fakeRegistry) host() string {
+	return r.srv.Listener.Addr().String()
+}
+
+// ref returns the reference of repo:tag on the registry
+func (r *fakeRegistry) ref(repo, tag string) string {
+	return r.host() + "/" + repo + ":" + tag
+}
+
+// opts returns pull options trusting the registry's certificate for linux/amd64
+func (r *fakeRegistry) opts() PullOptions {
+	return PullOptions{
+		Platform:      image.Platform{OS: "linux", Arch: "amd64"},
+		ClientOptions: []registry.ClientOption{registry.WithTLSConfig(r.srv.Client().Transport.(*http.Transport).TLSClientConfig)},
+	}
+}
+
+func (r *fakeRegistry) addBlob(data []byte) image.Descriptor {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d := digest.FromBytes(data)
+	r.blobs[d] = data
+	return image.Descriptor{Digest: d, Size: int64(len(data))}
+}
+
+func (r *fakeRegistry) addManifest(repo, tag string, raw []byte, mediaType string) digest.Digest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d := digest.FromBytes(raw)
+	for _, key := range []string{repo + ":" + tag, repo + "@" + d.String()} {
+		r.manifests[key] = raw
+		r.types[key] = mediaType
+	}
+	return d
+}
+
+// addImage adds a linux image with the layers (any bytes) tagged repo:tag
+func (r *fakeRegistry) addImage(repo, tag, arch string, layers ...string) (*image.OCIManifest, digest.Digest) {
+	m, raw := r.manifest(repo, arch, layers...)
+	return m, r.addManifest(repo, tag, raw, image.MediaTypeOCIManifest)
+}
+
+func (r *fakeRegistry) manifest(name, arch string, layers ...string) (*image.OCIManifest, []byte) {
+	diffIDs := make([]string, len(layers))
+	for idx, layer := range layers {
+		diffIDs[idx] = fmt.Sprintf("%q", digest.FromString(layer))
+	}
+	config := fmt.Sprintf(`{"architecture":%q,"os":"linux","config":{"Labels":{"name":%q}},"rootfs":{"type":"layers","diff_ids":[%s]}}`,
+		arch, name, strings.Join(diffIDs, ","))
+
+	m := &image.OCIManifest{SchemaVersion: 2, MediaType: image.MediaTypeOCIManifest}
+	m.Config = r.addBlob([]byte(config))
+	m.Config.MediaType = image.MediaTypeOCIConfig
+	for _, layer := range layers {
+		desc := r.addBlob([]byte(layer))
+		desc.MediaType = image.MediaTypeOCILayer
+		m.Layers = append(m.Layers, desc)
+	}
+	raw, err := json.Marshal(m)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	return m, raw
+}
+
+// addIndex adds an image index tagged repo:tag with a manifest per platform
+func (r *fakeRegistry) addIndex(repo, tag string, platforms ...image.Platform) digest.Digest {
+	index := ociIndex{SchemaVersion: 2, MediaType: image.MediaTypeOCIIndex}
+	for idx := range platforms {
+		p := platforms[idx]
+		_, raw := r.manifest(repo+"/"+p.String(), p.Arch, "layer of "+p.String())
+		d := r.addManifest(repo, p.String(), raw, image.MediaTypeOCIManifest)
+		index.Manifests = append(index.Manifests, image.Descriptor{
+			MediaType: image.MediaTypeOCIManifest,
+			Digest:    d,
+			Size:      int64(len(raw)),
+			Platform:  &p,
+		})
+	}
+	raw, err := json.Marshal(index)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	return r.addManifest(repo, tag, raw, image.MediaTypeOCIIndex)
+}
+
+func (r *fakeRegistry) hits(d digest.Digest) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.blobHits[d]
+}
+
+// delay sleeps for the latency of the request without holding the lock so requests still overlap
+func (r *fakeRegistry) delay(p string) {
+	r.mu.Lock()
+	d := r.latency
+	if idx := strings.LastIndex(p, "/blobs/"); idx >= 0 {
+		d += r.slow[digest.Digest(p[idx+len("/blobs/"):])]
+	}
+	r.mu.Unlock()
+	time.Sleep(d)
+}
+
+func (r *fakeRegistry) serve(w http.ResponseWriter, req *http.Request) {
+	p := strings.TrimPrefix(req.URL.Path, "/v2/")
+	r.delay(p)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if idx := strings.LastIndex(p, "/manifests/"); idx >= 0 {
+		r.manifestHits++
+		repo, ref := p[:idx], p[idx+len("/manifests/"):]
+		sep := ":"
+		if strings.Contains(ref, ":") {
+			sep = "@"
+		}
+		raw, ok := r.manifests[repo+sep+ref]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", r.types[repo+sep+ref])
+		w.Write(raw)
+		return
+	}
+
+	if idx := strings.LastIndex(p, "/blobs/"); idx >= 0 {
+		d := digest.Digest(p[idx+len("/blobs/"):])
+		data, ok := r.blobs[d]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		r.blobHits[d]++
+		if r.corrupt[d] {
+			data = append([]byte("corrupted "), data...)
+		}
+		if rng := req.Header.Get("Range"); len(rng) > 0 && !r.noRange {
+			offset, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rng, "bytes="), "-"))
+			if err != nil || offset > len(data) {
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, len(data)-1, len(data)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(data[offset:])
+			return
+		}
+		if n, ok := r.dropAfter[d]; ok {
+			delete(r.dropAfter, d)
+			r.drop(w, data, n)
+			return
+		}
+		w.Write(data)
+		return
+	}
+
+	http.NotFound(w, req)
+}
+
+// drop sends the first n bytes of data and closes the connection mid-transfer
+func (r *fakeRegistry) drop(w http.ResponseWriter, data []byte, n int) {
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data[:n])
+	w.(http.Flusher).Flush()
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		r.t.Error(err)
+		return
+	}
+	conn.Close()
+}
+
+func tempDir(t testing.TB) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "graboid-pull")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// readIndex returns the ref.name annotations of the layout's index.json
+func readIndex(t *testing.T, dir string) map[string]digest.Digest {
+	t.Helper()
+	raw, err := ioutil.ReadFile(dir + "/" + indexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index ociIndex
+	if err := json.Unmarshal(raw, &index); err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]digest.Digest)
+	for _, desc := range index.Manifests {
+		names[desc.Annotations[annotationRefName]] = desc.Digest
+	}
+	return names
+}
+
+func TestPull(t *testing.T) {
+	reg := newFakeRegistry(t)
+	defer reg.Close()
+	m, manifestDigest := reg.addImage("library/alpine", "3.18", "amd64", "base layer", "app layer")
+
+	dest := tempDir(t)
+	defer os.RemoveAll(dest)
+
+	res, err := Pull(reg.ref("library/alpine", "3.18"), dest, reg.opts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Image.Config.Labels["name"] != "library/alpine" {
+		t.Errorf("pulled image %v", res.Image.Config.Labels)
+	}
+	if len(res.Layers) != 2 {
+		t.Fatalf("got %d layers", len(res.Layers))
+	}
+	for idx, layer := range m.Layers {
+		if res.Layers[idx].Digest != layer.Digest || res.Layers[idx].BytesDownloaded != layer.Size {
+			t.Errorf("layer %d = %+v, want %s", idx, res.Layers[idx], layer.Digest)
+		}
+		if _, err := os.Stat(dest + "/" + blobPath(layer.Digest)); err != nil {
+			t.Errorf("layer %d not in the layout: %v", idx, err)
+		}
+	}
+	if got := readIndex(t, dest)[reg.ref("library/alpine", "3.18")]; got != manifestDigest {
+		t.Errorf("index.json records %s, want %s", got, manifestDigest)
+	}
+}
+
+func TestPullTarget(t *testing.T) {
+	const d = "sha256:4c1d9d235ce4054a6bf9e0ee1d2ede1304e8bd1a9d3b0401e7a64235a8b4ff88"
+	tests := []struct {
+		ref             string
+		host, repo, tag string
+	}{
+		{ref: "nginx", host: "registry-1.docker.io", repo: "library/nginx", tag: "latest"},
+		{ref: "docker.io/library/nginx", host: "registry-1.docker.io", repo: "library/nginx", tag: "latest"},
+		{ref: "docker.io/library/nginx:1.25", host: "registry-1.docker.io", repo: "library/nginx", tag: "1.25"},
+		{ref: "index.docker.io/bitnami/redis:7", host: "registry-1.docker.io", repo: "bitnami/redis", tag: "7"},
+		{ref: "nginx:1.25@" + d, host: "registry-1.docker.io", repo: "library/nginx", tag: d},
+		{ref: "nginx@" + d, host: "registry-1.docker.io", repo: "library/nginx", tag: d},
+		{ref: "localhost:5000/app/web:v1", host: "localhost:5000", repo: "app/web", tag: "v1"},
+		{ref: "ghcr.io/org/tool:1.0@" + d, host: "ghcr.io", repo: "org/tool", tag: d},
+		{ref: "local://testdata/layout:v2", host: "local://", repo: "layout", tag: "v2"},
+		{ref: "local://testdata/layout", host: "local://", repo: "layout", tag: "latest"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			r, err := reference.Parse(tt.ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			host, repo, tag := pullTarget(r)
+			if host != tt.host || repo != tt.repo || tag != tt.tag {
+				t.Errorf("pullTarget() = %s, %s, %s, want %s, %s, %s", host, repo, tag, tt.host, tt.repo, tt.tag)
+			}
+		})
+	}
+}
+
+func TestPullTagAndDigest(t *testing.T) {
+	reg := newFakeRegistry(t)
+	defer reg.Close()
+	m, manifestDigest := reg.addImage("library/alpine", "3.18", "amd64", "base layer")
+	// the tag moved on, the digest pins the pull to the first image
+	reg.addImage("library/alpine", "3.18", "amd64", "new base layer")
+
+	dest := tempDir(t)
+	defer os.RemoveAll(dest)
+
+	res, err := Pull(reg.ref("library/alpine", "3.18")+"@"+manifestDigest.String(), dest, reg.opts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := res.Layers[0].Digest; got != m.Layers[0].Digest {
+		t.Errorf("pulled layer %s, want %s of the pinned manifest", got, m.Layers[0].Digest)
+	}
+}
+
+func TestPullSameTagDifferentRepos(t *testing.T) {
+	reg := newFakeRegistry(t)
+	defer reg.Close()
+	reg.addImage("library/nginx", "latest", "amd64", "nginx layer")
+	reg.addImage("library/redis", "latest", "amd64", "redis layer")
+
+	dest := tempDir(t)
+	defer os.RemoveAll(dest)
+
+	refs := []string{reg.ref("library/nginx", "latest"), reg.ref("library/redis", "latest")}
+	if _, err := PullMultiple(refs, dest, reg.opts()); err != nil {
+		t.Fatal(err)
+	}
+	names := readIndex(t, dest)
+	if len(names) != 2 {
+		t.Fatalf("index.json has %v, want both images", names)
+	}
+
+	// pulling again from the layout must return each repo's own image
+	for _, repo := range []string{"library/nginx", "library/redis"} {
+		opts := reg.opts()
+		opts.Policy = policy.PullIfNotPresent
+		res, err := Pull(reg.ref(repo, "latest"), dest, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := res.Image.Config.Labels["name"]; got != repo {
+			t.Errorf("%s resolved to the image of %s", repo, got)
+		}
+	}
+}
+
+func TestPullPolicy(t *testing.T) {
+	reg := newFakeRegistry(t)
+	defer reg.Close()
+	reg.addImage("library/nginx", "latest", "amd64", "nginx layer")
+	reg.addImage("library/redis", "latest", "amd64", "redis layer")
+	nginx, redis := reg.ref("library/nginx", "latest"), reg.ref("library/redis", "latest")
+
+	dest := tempDir(t)
+	defer os.RemoveAll(dest)
+
+	withPolicy := func(p policy.PullPolicy) PullOptions {
+		opts := reg.opts()
+		opts.Policy = p
+		return opts
+	}
+
+	if _, err := Pull(nginx, dest, withPolicy(policy.PullNever)); !errors.Is(err, policy.ErrImageNotCached) {
+		t.Fatalf("never before the pull = %v, want %v", err, policy.ErrImageNotCached)
+	}
+	if _, err := Pull(nginx, dest, withPolicy(policy.PullIfNotPresent)); err != nil {
+		t.Fatal(err)
+	}
+
+	requests := func() int {
+		reg.mu.Lock()
+		defer reg.mu.Unlock()
+		return reg.manifestHits
+	}
+	before := requests()
+	for _, p := range []policy.PullPolicy{policy.PullIfNotPresent, policy.PullNever} {
+		res, err := Pull(nginx, dest, withPolicy(p))
+		if err != nil {
+			t.Fatalf("%s: %v", p, err)
+		}
+		if res.Image.Config.Labels["name"] != "library/nginx" {
+			t.Errorf("%s: got the image of %s", p, res.Image.Config.Labels["name"])
+		}
+	}
+	if got := requests(); got != before {
+		t.Errorf("the layout has the image but the registry got %d manifest requests", got-before)
+	}
+
+	if _, err := Pull(nginx, dest, withPolicy(policy.PullAlways)); err != nil {
+		t.Fatal(err)
+	}
+	if requests() == before {
+		t.Error("always did not ask the registry")
+	}
+
+	// redis:latest shares the tag of nginx:latest but is not in the layout
+	if _, err := Pull(redis, dest, withPolicy(policy.PullNever)); !errors.Is(err, policy.ErrImageNotCached) {
+		t.Errorf("never for another repo = %v, want %v", err, policy.ErrImageNotCached)
+	}
+	res, err := Pull(redis, dest, withPolicy(policy.PullIfNotPresent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Image.Config.Labels["name"] != "library/redis" {
+		t.Errorf("redis resolved to the image of %s", res.Image.Config.Labels["name"])
+	}
+
+	// a layer missing from the layout makes the image absent
+	m, _ := reg.addImage("library/broken", "1", "amd64", "kept layer", "deleted layer")
+	broken := reg.ref("library/broken", "1")
+	if _, err := Pull(broken, dest, reg.opts()); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(dest + "/" + blobPath(m.Layers[1].Digest)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Pull(broken, dest, withPolicy(policy.PullNever)); !errors.Is(err, policy.ErrImageNotCached) {
+		t.Errorf("never with a missing layer = %v, want %v", err, policy.ErrImageNotCached)
+	}
+}
+
+func TestPullRejectsCorruptBlob(t *testing.T) {
+	for _, resume := range []bool{false, true} {
+		t.Run(fmt.Sprintf("resume=%t", resume), func(t *testing.T) {
+			reg := newFakeRegistry(t)
+			defer reg.Close()
+			m, _ := reg.addImage("library/alpine", "3.18", "amd64", "base layer")
+			reg.corrupt[m.Layers[0].Digest] = true
+
+			dest := tempDir(t)
+			defer os.RemoveAll(dest)
+			opts := reg.opts()
+			if resume {
+				opts.ResumeDir = tempDir(t)
+				defer os.RemoveAll(opts.ResumeDir)
+			}
+
+			_, err := Pull(reg.ref("library/alpine", "3.18"), dest, opts)
+			var mismatch *blobdigest.ErrDigestMismatch
+			if !errors.As(err, &mismatch) {
+				t.Fatalf("Pull() error = %v, want a digest mismatch", err)
+			}
+			if mismatch.Expected != m.Layers[0].Digest {
+				t.Errorf("mismatch for %s, want %s", mismatch.Expected, m.Layers[0].Digest)
+			}
+			if _, err := os.Stat(dest + "/" + blobPath(m.Layers[0].Digest)); !os.IsNotExist(err) {
+				t.Errorf("corrupt blob written to the layout: %v", err)
+			}
+		})
+	}
+}
+
+func TestPullConcurrency(t *testing.T) {
+	reg := newFakeRegistry(t)
+	defer reg.Close()
+	layers := []string{"layer 1", "layer 2", "layer 3", "layer 4", "layer 5", "layer 6"}
+	reg.addImage("library/alpine", "3.18", "amd64", layers...)
+
+	dest := tempDir(t)
+	defer os.RemoveAll(dest)
+
+	var (
+		mu             sync.Mutex
+		active, peak   int
+		progressOutput bytes.Buffer
+	)
+	opts := reg.opts()
+	opts.Concurrency = 2
+	opts.ProgressWriter = &progressOutput
+	opts.OnLayerStart = func(int, digest.Digest, int64) {
+		mu.Lock()
+		active++
+		if active > peak {
+			peak = active
+		}
+		mu.Unlock()
+		// keep the slot so the other downloads overlap
+		time.Sleep(20 * time.Millisecond)
+	}
+	opts.OnLayerComplete = func(int, digest.Digest, int64) {
+		mu.Lock()
+		active--
+		mu.Unlock()
+	}
+
+	if _, err := Pull(reg.ref("library/alpine", "3.18"), dest, opts); err != nil {
+		t.Fatal(err)
+	}
+	if peak != opts.Concurrency {
+		t.Errorf("%d layers were downloaded at once, want %d", peak, opts.Concurrency)
+	}
+	lines := strings.Split(strings.TrimSpace(progressOutput.String()), "\n")
+	if len(lines) != len(layers) {
+		t.Fatalf("ProgressWriter got %q, want a line per layer", progressOutput.String())
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "layer ") || !strings.HasSuffix(line, " (7 bytes)") {
+			t.Errorf("unexpected progress line %q", line)
+		}
+	}
+}
+
+// layerEvent is a call of OnLayerStart or OnLayerComplete
+type layerEvent struct {
+	complete bool
+	index    int
+	digest   digest.Digest
+	bytes    int64
+}
+
+// recordLayerEvents sets the layer callbacks of opts to append to events, the
+// blob must be in dest when its layer completes
+func recordLayerEvents(t *testing.T, opts *PullOptions, dest string, events *[]layerEvent) {
+	var mu sync.Mutex
+	opts.OnLayerStart = func(idx int, d digest.Digest, total int64) {
+		mu.Lock()
+		defer mu.Unlock()
+		*events = append(*events, layerEvent{index: idx, digest: d, bytes: total})
+	}
+	opts.OnLayerComplete = func(idx int, d digest.Digest, n int64) {
+		mu.Lock()
+		defer mu.Unlock()
+		if _, err := os.Stat(filepath.Join(dest, blobPath(d))); err != nil {
+			t.Errorf("layer %d completed before it was in the layout: %v", idx, err)
+		}
+		*events = append(*events, layerEvent{complete: true, index: idx, digest: d, bytes: n})
+	}
+}
+
+func TestPullLayerCallbacks(t *testing.T) {
+	reg := newFakeRegistry(t)
+	defer reg.Close()
+	m, _ := reg.addImage("library/alpine", "3.18", "amd64", "base layer", strings.Repeat("x", 4096), "app")
+
+	for _, concurrency := range []int{1, 3} {
+		t.Run(fmt.Sprintf("concurrency=%d", concurrency), func(t *testing.T) {
+			dest := tempDir(t)
+			defer os.RemoveAll(dest)
+			opts := reg.opts()
+			opts.Concurrency = concurrency
+			var events []layerEvent
+			recordLayerEvents(t, &opts, dest, &events)
+
+			if _, err := Pull(reg.ref("library/alpine", "3.18"), dest, opts); err != nil {
+				t.Fatal(err)
+			}
+			if len(events) != 2*len(m.Layers) {
+				t.Fatalf("got events %+v, want a start and a complete per layer", events)
+			}
+			started := make(map[int]bool)
+			completed := make(map[int]bool)
+			for pos, e := range events {
+				layer := m.Layers[e.index]
+				if e.digest != layer.Digest || e.bytes != layer.Size {
+					t.Errorf("event %d = %+v, want %s with %d bytes", pos, e, layer.Digest, layer.Size)
+				}
+				if !e.complete {
+					started[e.index] = true
+					continue
+				}
+				if !started[e.index] || completed[e.index] {
+					t.Errorf("layer %d completed without starting or twice in %+v", e.index, events)
+				}
+				completed[e.index] = true
+				// one download at a time finishes a layer before the next starts
+				if concurrency == 1 && (pos == 0 || events[pos-1].complete || events[pos-1].index != e.index) {
+					t.Errorf("layer %d did not complete right after it started in %+v", e.index, events)
+				}
+			}
+		})
+	}
+}
+
+func TestPullLayerCallbacksCached(t *testing.T) {
+	reg := newFakeRegistry(t)
+	defer reg.Close()
+	m, _ := reg.addImage("library/alpine", "3.18", "amd64", "base layer", "app layer")
+
+	dest := tempDir(t)
+	defer os.RemoveAll(dest)
+	if _, err := Pull(reg.ref("library/alpine", "3.18"), dest, reg.opts()); err != nil {
+		t.Fatal(err)
+	}
+
+	// layers already in the layout still start and complete but download nothing
+	opts := reg.opts()
+	opts.Concurrency = 1
+	var events []layerEvent
+	recordLayerEvents(t, &opts, dest, &events)
+	if _, err := Pull(reg.ref("library/alpine", "3.18"), dest, opts); err != nil {
+		t.Fatal(err)
+	}
+	var want []layerEvent
+	for idx, layer := range m.Layers {
+		want = append(want,
+			layerEvent{index: idx, digest: layer.Digest, bytes: layer.Size},
+			layerEvent{complete: true, index: idx, digest: layer.Digest},
+		)
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got events %+v, want %+v", events, want)
+	}
+	for _, e := range want {
+		found := false
+		for _, got := range events {
+			found = found || got == e
+		}
+		if !found {
+			t.Errorf("events %+v are missing %+v", events, e)
+		}
+	}
+}
+
+func TestPullLayerCallbacksCorrupt(t *testing.T) {
+	reg := newFakeRegistry(t)
+	defer reg.Close()
+	m, _ := reg.addImage("library/alpine", "3.18", "amd64", "corrupt layer")
+	reg.corrupt[m.Layers[0].Digest] = true
+
+	dest := tempDir(t)
+	defer os.RemoveAll(dest)
+	opts := reg.opts()
+	var events []layerEvent
+	recordLayerEvents(t, &opts, dest, &events)
+
+	if _, err := Pull(reg.ref("library/alpine", "3.18"), dest, opts); err == nil {
+		t.Fatal("Pull() of a corrupt layer succeeded")
+	}
+	want := []layerEvent{{index: 0, digest: m.Layers[0].Digest, bytes: m.Layers[0].Size}}
+	if len(events) != 1 || events[0] != want[0] {
+		t.Errorf("got events %+v, want %+v without a complete for the unverified layer", events, want)
+	}
+}
+
+func TestPullFailFast(t *testing.T) {
+	for _, failFast := range []bool{false, true} {
+		t.Run(fmt.Sprintf("failfast=%t", failFast), func(t *testing.T) {
+			reg := newFakeRegistry(t)
+			defer reg.Close()
+			m, _ := reg.addImage("library/alpine", "3.18", "amd64", "corrupt layer", "slow layer 1", "slow layer 2", "slow layer 3")
+			reg.corrupt[m.Layers[0].Digest] = true
+			for _, layer := range m.Layers[1:] {
+				reg.slow[layer.Digest] = 100 * time.Millisecond
+			}
+
+			dest := tempDir(t)
+			defer os.RemoveAll(dest)
+			opts := reg.opts()
+			opts.FailFast = failFast
+
+			_, err := Pull(reg.ref("library/alpine", "3.18"), dest, opts)
+			var mismatch *blobdigest.ErrDigestMismatch
+			if !errors.As(err, &mismatch) || mismatch.Expected != m.Layers[0].Digest {
+				t.Fatalf("Pull() error = %v, want the digest mismatch of the corrupt layer", err)
+			}
+
+			// without fail fast the other layers are kept for the next pull
+			for idx, layer := range m.Layers[1:] {
+				_, err := os.Stat(dest + "/" + blobPath(layer.Digest))
+				if failFast && !os.IsNotExist(err) {
+					t.Errorf("slow layer %d was downloaded after the failure: %v", idx+1, err)
+				}
+				if !failFast && err != nil {
+					t.Errorf("slow layer %d was not downloaded: %v", idx+1, err)
+				}
+			}
+		})
+	}
+}
+
+// benchmarkPull pulls an image of 8 layers from a registry answering every request after 10ms
+func benchmarkPull(b *testing.B, concurrency int) {
+	reg := newFakeRegistry(b)
+	defer reg.Close()
+	layers := make([]string, 8)
+	for idx := range layers {
+		layers[idx] = fmt.Sprintf("layer %d", idx)
+	}
+	reg.addImage("library/alpine", "3.18", "amd64", layers...)
+	reg.latency = 10 * time.Millisecond
+
+	opts := reg.opts()
+	opts.Concurrency = concurrency
+	for n := 0; n < b.N; n++ {
+		b.StopTimer()
+		dest := tempDir(b)
+		b.StartTimer()
+		if _, err := Pull(reg.ref("library/alpine", "3.18"), dest, opts); err != nil {
+			b.Fatal(err)
+		}
+		b.StopTimer()
+		os.RemoveAll(dest)
+		b.StartTimer()
+	}
+}
+
+func BenchmarkPullSequential(b *testing.B) { benchmarkPull(b, 1) }
+
+func BenchmarkPullParallel(b *testing.B) { benchmarkPull(b, 8) }
+
+func TestPullCacheHit(t *testing.T) {
+	reg := newFakeRegistry(t)
+	defer reg.Close()
+	m, _ := reg.addImage("library/alpine", "3.18", "amd64", "base layer", "app layer")
+
+	dest := tempDir(t)
+	defer os.RemoveAll(dest)
+
+	first, err := Pull(reg.ref("library/alpine", "3.18"), dest, reg.opts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for idx, layer := range first.Layers {
+		if layer.CacheHit {
+			t.Errorf("layer %d of the first pull is a cache hit", idx)
+		}
+	}
+
+	// an updated tag sharing the base layer only downloads the new layer
+	reg.addImage("library/alpine", "3.18", "amd64", "base layer", "new app layer")
+	second, err := Pull(reg.ref("library/alpine", "3.18"), dest, reg.opts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := second.Layers[0]; !got.CacheHit || got.BytesDownloaded != 0 || got.Digest != m.Layers[0].Digest {
+		t.Errorf("shared layer = %+v, want a cache hit", got)
+	}
+	if got := second.Layers[1]; got.CacheHit || got.BytesDownloaded != int64(len("new app layer")) {
+		t.Errorf("new layer = %+v, want it downloaded", got)
+	}
+	if got := reg.hits(m.Layers[0].Digest); got != 1 {
+		t.Errorf("shared layer downloaded %d times", got)
+	}
+}
+
+func TestPullPlatform(t *testing.T) {
+	reg := newFakeRegistry(t)
+	defer reg.Close()
+	reg.addIndex("library/alpine", "3.18",
+		image.Platform{OS: "linux", Arch: "amd64"},
+		image.Platform{OS: "linux", Arch: "arm64", Variant: "v8"},
+	)
+	reg.addImage("library/amd64only", "1", "amd64", "layer")
+
+	dest := tempDir(t)
+	defer os.RemoveAll(dest)
+
+	opts := reg.opts()
+	opts.Platform = image.Platform{OS: "linux", Arch: "arm64"}
+	res, err := Pull(reg.ref("library/alpine", "3.18"), dest, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := res.Image.Config.Labels["name"]; got != "library/alpine/linux/arm64/v8" {
+		t.Errorf("pulled the image of %s, want the arm64 one", got)
+	}
+
+	opts.Platform = image.Platform{OS: "windows", Arch: "amd64"}
+	if _, err := Pull(reg.ref("library/alpine", "3.18"), dest, opts); !errors.Is(err, image.ErrNoPlatformMatch) {
+		t.Errorf("Pull() of a missing platform = %v, want ErrNoPlatformMatch", err)
+	}
+	opts.Platform = image.Platform{OS: "linux", Arch: "arm64"}
+	if _, err := Pull(reg.ref("library/amd64only", "1"), dest, opts); err == nil {
+		t.Error("Pull() accepted a single platform image built for another platform")
+	}
+}
+
+func TestPullOtherPlatformByDefault(t *testing.T) {
+	reg := newFakeRegistry(t)
+	defer reg.Close()
+	arch := "s390x"
+	if runtime.GOARCH == arch {
+		arch = "amd64"
+	}
+	reg.addImage("library/foreign", "1", arch, "layer")
+
+	dest := tempDir(t)
+	defer os.RemoveAll(dest)
+
+	// without a requested platform single platform images of any platform are pulled
+	opts := PullOptions{ClientOptions: reg.opts().ClientOptions}
+	res, err := Pull(reg.ref("library/foreign", "1"), dest, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := res.Image.Platform().Arch; got != arch {
+		t.Errorf("pulled an image for %s, want %s", got, arch)
+	}
+}
+
+func TestPullNotFound(t *testing.T) {
+	reg := newFakeRegistry(t)
+	defer reg.Close()
+
+	dest := tempDir(t)
+	defer os.RemoveAll(dest)
+
+	if _, err := Pull(reg.ref("library/missing", "latest"), dest, reg.opts()); !errors.Is(err, registry.ErrNotFound) {
+		t.Errorf("Pull() of a missing image = %v, want ErrNotFound", err)
+	}
+}
+
+func TestPullInsecure(t *testing.T) {
+	tests := []struct {
+		name     string
+		registry func(testing.TB) *fakeRegistry
+	}{
+		{name: "plain http", registry: newPlainFakeRegistry},
+		{name: "self-signed", registry: newFakeRegistry},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := tt.registry(t)
+			defer reg.Close()
+			m, _ := reg.addImage("library/alpine", "3.18", "amd64", "base layer")
+
+			dest := tempDir(t)
+			defer os.RemoveAll(dest)
+			// no TLS config trusting the registry certificate
+			opts := PullOptions{Platform: image.Platform{OS: "linux", Arch: "amd64"}}
+
+			if _, err := Pull(reg.ref("library/alpine", "3.18"), dest, opts); err == nil {
+				t.Fatal("Pull() succeeded without Insecure")
+			}
+
+			opts.Insecure = true
+			res, err := Pull(reg.ref("library/alpine", "3.18"), dest, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(res.Layers) != 1 || res.Layers[0].Digest != m.Layers[0].Digest {
+				t.Errorf("pulled layers %+v, want %s", res.Layers, m.Layers[0].Digest)
+			}
+			if _, err := os.Stat(filepath.Join(dest, blobPath(m.Layers[0].Digest))); err != nil {
+				t.Errorf("layer not in the layout: %v", err)
+			}
+		})
+	}
+}
+
+func TestPullResume(t *testing.T) {
+	const dropAt = 1 << 20
+	for _, noRange := range []bool{false, true} {
+		t.Run(fmt.Sprintf("noRange=%t", noRange), func(t *testing.T) {
+			reg := newFakeRegistry(t)
+			defer reg.Close()
+			reg.noRange = noRange
+			large := strings.Repeat("0123456789abcdef", 3<<16) // 3 MB
+			m, _ := reg.addImage("library/ubuntu", "22.04", "amd64", large)
+			layer := m.Layers[0]
+			reg.dropAfter[layer.Digest] = dropAt
+
+			dest := tempDir(t)
+			defer os.RemoveAll(dest)
+			opts := reg.opts()
+			opts.ResumeDir = tempDir(t)
+			defer os.RemoveAll(opts.ResumeDir)
+			partial := filepath.Join(opts.ResumeDir, "sha256", layer.Digest.Hex()+".partial")
+
+			if _, err := Pull(reg.ref("library/ubuntu", "22.04"), dest, opts); err == nil {
+				t.Fatal("Pull() succeeded although the connection dropped")
+			}
+			fi, err := os.Stat(partial)
+			if err != nil {
+				t.Fatalf("no partial download kept: %v", err)
+			}
+			if fi.Size() != dropAt {
+				t.Errorf("partial download has %d bytes, want %d", fi.Size(), dropAt)
+			}
+			if _, err := os.Stat(filepath.Join(dest, blobPath(layer.Digest))); !os.IsNotExist(err) {
+				t.Errorf("incomplete blob written to the layout: %v", err)
+			}
+
+			res, err := Pull(reg.ref("library/ubuntu", "22.04"), dest, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := layer.Size - dropAt
+			if noRange {
+				// the registry ignored the range so the download restarted
+				want = layer.Size
+			}
+			if got := res.Layers[0].BytesDownloaded; got != want {
+				t.Errorf("resumed download got %d bytes, want %d", got, want)
+			}
+			data, err := ioutil.ReadFile(filepath.Join(dest, blobPath(layer.Digest)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if digest.FromBytes(data) != layer.Digest {
+				t.Error("resumed blob does not match its digest")
+			}
+			if _, err := os.Stat(partial); !os.IsNotExist(err) {
+				t.Errorf("partial download kept after the pull: %v", err)
+			}
+		})
+	}
+}
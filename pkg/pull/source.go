@@ -0,0 +1,122 @@
+package pull
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/blacktop/graboid/pkg/image"
+	"github.com/blacktop/graboid/pkg/oci"
+	"github.com/opencontainers/go-digest"
+)
+
+// source is where manifests and blobs are pulled from, a registry or a local OCI layout
+type source interface {
+	GetRawManifestOrIndex(ref string) ([]byte, string, error)
+	GetManifestByDigest(repo string, d digest.Digest) ([]byte, string, error)
+	GetBlob(repo, d string) (io.ReadCloser, error)
+	GetBlobFrom(repo, d string, offset int64) (io.ReadCloser, bool, error)
+}
+
+// localSource serves the manifests and blobs of an OCI image layout directory
+type localSource struct {
+	layout *oci.Layout
+}
+
+func newLocalSource(dir string) (*localSource, error) {
+	layout, err := oci.OpenLayout(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &localSource{layout: layout}, nil
+}
+
+// GetRawManifestOrIndex returns the manifest tagged or with the digest of ref.
+// An untagged layout with a single manifest returns it for any tag, otherwise
+// index.json itself is returned so the platform can be picked from it.
+func (s *localSource) GetRawManifestOrIndex(ref string) ([]byte, string, error) {
+	if idx := strings.Index(ref, "@"); idx >= 0 {
+		d, err := digest.Parse(ref[idx+1:])
+		if err != nil {
+			return nil, "", err
+		}
+		return s.GetManifestByDigest("", d)
+	}
+	tag := ref[strings.LastIndex(ref, ":")+1:]
+
+	// layouts written by Pull record the full reference, others only the tag
+	manifests := s.layout.Index.Manifests
+	for _, name := range []string{ref, tag} {
+		for _, desc := range manifests {
+			if desc.Annotations[oci.AnnotationRefName] == name {
+				return s.GetManifestByDigest("", desc.Digest)
+			}
+		}
+	}
+	if len(manifests) == 1 {
+		return s.GetManifestByDigest("", manifests[0].Digest)
+	}
+
+	raw, err := json.Marshal(s.layout.Index)
+	if err != nil {
+		return nil, "", err
+	}
+	return raw, oci.MediaTypeOCIIndex, nil
+}
+
+// GetManifestByDigest returns the manifest or index blob d and its media type
+func (s *localSource) GetManifestByDigest(repo string, d digest.Digest) ([]byte, string, error) {
+	rc, err := s.layout.BlobReader(d)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rc.Close()
+
+	raw, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, "", err
+	}
+	if got := d.Algorithm().FromBytes(raw); got != d {
+		return nil, "", fmt.Errorf("manifest %s has digest %s", d, got)
+	}
+
+	var probe struct {
+		MediaType string            `json:"mediaType"`
+		Manifests []json.RawMessage `json:"manifests"`
+	}
+	if err := json.Unmarshal(raw, &probe); err != nil {
+		return nil, "", err
+	}
+	mediaType := probe.MediaType
+	if len(mediaType) == 0 {
+		mediaType = image.MediaTypeOCIManifest
+		if probe.Manifests != nil {
+			mediaType = oci.MediaTypeOCIIndex
+		}
+	}
+	return raw, mediaType, nil
+}
+
+// GetBlob opens the blob d
+func (s *localSource) GetBlob(repo, d string) (io.ReadCloser, error) {
+	return s.layout.BlobReader(digest.Digest(d))
+}
+
+// GetBlobFrom opens the blob d at offset, local blobs can always be resumed
+func (s *localSource) GetBlobFrom(repo, d string, offset int64) (io.ReadCloser, bool, error) {
+	rc, err := s.layout.BlobReader(digest.Digest(d))
+	if err != nil {
+		return nil, false, err
+	}
+	if f, ok := rc.(*os.File); ok && offset > 0 {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			f.Close()
+			return nil, false, err
+		}
+		return f, true, nil
+	}
+	return rc, false, nil
+}
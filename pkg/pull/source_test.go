@@ -0,0 +1,155 @@
+package pull
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blacktop/graboid/pkg/image"
+	"github.com/blacktop/graboid/pkg/oci"
+	"github.com/opencontainers/go-digest"
+)
+
+// ociLayout holds a "multi" index with linux/amd64 and linux/arm64/v8
+// images, a "single" linux/amd64 image and an SPDX document
+const ociLayout = "../oci/testdata/layout"
+
+const (
+	singleManifest = digest.Digest("sha256:d30abedae45e6c5d2c89d8160591442f32eda1cc079ffb0549c1f22cd325986b")
+	singleConfig   = digest.Digest("sha256:905212823bf68a24def34da7a1acc160852b16a45cf5d9e8873be1b7bfdb1f9b")
+	singleLayer    = digest.Digest("sha256:5deff79930820eb6104122350fa0b07962c6a02d68e31923f7de065be4b66568")
+	amd64Manifest  = digest.Digest("sha256:2995f9171ced13aa56da21973e0b083f5f6bdfe48c2fcfee4b26ead4830c8129")
+	arm64Manifest  = digest.Digest("sha256:a79e187e40469357f427ec02ab3003a42ab5dc12ab6450971dc65007b3efb874")
+)
+
+func TestPullLocal(t *testing.T) {
+	amd64 := image.Platform{OS: "linux", Arch: "amd64"}
+	arm64 := image.Platform{OS: "linux", Arch: "arm64", Variant: "v8"}
+
+	tests := []struct {
+		name     string
+		ref      string
+		platform image.Platform
+		manifest digest.Digest
+	}{
+		{name: "tag", ref: "local://" + ociLayout + ":single", platform: amd64, manifest: singleManifest},
+		{name: "digest", ref: "local://" + ociLayout + "@" + singleManifest.String(), platform: amd64, manifest: singleManifest},
+		{name: "index amd64", ref: "local://" + ociLayout + ":multi", platform: amd64, manifest: amd64Manifest},
+		{name: "index arm64", ref: "local://" + ociLayout + ":multi", platform: arm64, manifest: arm64Manifest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := tempDir(t)
+			defer os.RemoveAll(dest)
+
+			res, err := Pull(tt.ref, dest, PullOptions{Platform: tt.platform})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := res.Image.Platform(); got.String() != tt.platform.String() {
+				t.Errorf("pulled the image for %s, want %s", got, tt.platform)
+			}
+			if len(res.Layers) != 1 || len(res.OCIManifest.Layers) != 1 || res.Layers[0].Digest != res.OCIManifest.Layers[0].Digest {
+				t.Fatalf("pulled layers %+v of manifest %+v", res.Layers, res.OCIManifest)
+			}
+			if res.Layers[0].BytesDownloaded != res.OCIManifest.Layers[0].Size {
+				t.Errorf("copied %d bytes of the %d byte layer", res.Layers[0].BytesDownloaded, res.OCIManifest.Layers[0].Size)
+			}
+
+			blobs := []digest.Digest{tt.manifest, res.OCIManifest.Config.Digest, res.OCIManifest.Layers[0].Digest}
+			for _, d := range blobs {
+				if _, err := os.Stat(filepath.Join(dest, blobPath(d))); err != nil {
+					t.Errorf("blob %s not in the layout: %v", d, err)
+				}
+			}
+			if got := readIndex(t, dest)[imageName(tt.ref)]; got != tt.manifest {
+				t.Errorf("index.json records %s, want %s", got, tt.manifest)
+			}
+
+			// the pulled layout is a valid OCI layout holding the same image
+			l, err := oci.OpenLayout(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			manifests, err := l.Manifests()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(manifests) != 1 || manifests[0].Config.Digest != res.OCIManifest.Config.Digest {
+				t.Errorf("pulled layout holds %+v", manifests)
+			}
+		})
+	}
+}
+
+func TestPullLocalSingle(t *testing.T) {
+	dest := tempDir(t)
+	defer os.RemoveAll(dest)
+
+	res, err := Pull("local://"+ociLayout+":single", dest, PullOptions{Platform: image.Platform{OS: "linux", Arch: "amd64"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.OCIManifest.Config.Digest != singleConfig || res.OCIManifest.Layers[0].Digest != singleLayer {
+		t.Errorf("pulled manifest %+v", res.OCIManifest)
+	}
+	if res.Layers[0].CacheHit {
+		t.Error("first pull was a cache hit")
+	}
+
+	// pulling again only finds blobs already in the layout
+	again, err := Pull("local://"+ociLayout+":single", dest, PullOptions{Platform: image.Platform{OS: "linux", Arch: "amd64"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !again.Layers[0].CacheHit || again.Layers[0].BytesDownloaded != 0 {
+		t.Errorf("second pull = %+v, want a cache hit", again.Layers[0])
+	}
+}
+
+func TestPullLocalAllPlatforms(t *testing.T) {
+	dest := tempDir(t)
+	defer os.RemoveAll(dest)
+
+	res, err := Pull("local://"+ociLayout+":multi", dest, PullOptions{AllPlatforms: true, Platform: image.Platform{OS: "linux", Arch: "arm64", Variant: "v8"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Platforms) != 2 {
+		t.Fatalf("pulled %d platforms, want 2", len(res.Platforms))
+	}
+	if got := res.Image.Platform().String(); got != "linux/arm64/v8" {
+		t.Errorf("result describes %s, want the requested platform", got)
+	}
+	for _, d := range []digest.Digest{amd64Manifest, arm64Manifest} {
+		if _, err := os.Stat(filepath.Join(dest, blobPath(d))); err != nil {
+			t.Errorf("manifest %s not in the layout: %v", d, err)
+		}
+	}
+}
+
+func TestPullLocalErrors(t *testing.T) {
+	dest := tempDir(t)
+	defer os.RemoveAll(dest)
+	opts := PullOptions{Platform: image.Platform{OS: "linux", Arch: "amd64"}}
+
+	if _, err := Pull("local://"+filepath.Join(dest, "missing"), dest, opts); err == nil {
+		t.Error("Pull() of a missing layout succeeded")
+	}
+	empty := tempDir(t)
+	defer os.RemoveAll(empty)
+	if _, err := Pull("local://"+empty, dest, opts); !errors.Is(err, oci.ErrNotLayout) {
+		t.Errorf("Pull() of a directory that is not a layout = %v, want ErrNotLayout", err)
+	}
+	if _, err := Pull("local://"+ociLayout+"@"+digest.FromString("missing").String(), dest, opts); err == nil {
+		t.Error("Pull() of a missing digest succeeded")
+	}
+	if _, err := Pull("local://", dest, opts); err == nil {
+		t.Error("Pull() of a local reference without a path succeeded")
+	}
+	opts.Platform = image.Platform{OS: "windows", Arch: "amd64"}
+	if _, err := Pull("local://"+ociLayout+":multi", dest, opts); !errors.Is(err, image.ErrNoPlatformMatch) {
+		t.Errorf("Pull() of a missing platform = %v, want ErrNoPlatformMatch", err)
+	}
+}
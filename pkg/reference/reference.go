@@ -0,0 +1,167 @@
+package reference
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	// register sha256 for go-digest
+	_ "crypto/sha256"
+
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	defaultRegistry = "docker.io"
+	officialRepo    = "library/"
+	defaultTag      = "latest"
+	maxNameLength   = 255
+
+	// LocalScheme prefixes references to OCI image layout directories
+	LocalScheme = "local://"
+)
+
+var (
+	// ErrInvalidReference is returned for references that do not follow the distribution spec
+	ErrInvalidReference = errors.New("invalid reference")
+
+	// path components of a repository name as defined by the OCI distribution spec
+	componentRegexp = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|[-]+)[a-z0-9]+)*$`)
+	tagRegexp       = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+	registryRegexp  = regexp.MustCompile(`^(?:[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?)*|\[[0-9a-fA-F:]+\])(?::[0-9]+)?$`)
+)
+
+// Reference is a parsed and normalized image reference
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     digest.Digest
+	// Path is the OCI image layout directory of local:// references
+	Path string
+}
+
+// DefaultRegistry returns the registry used for references without one
+func DefaultRegistry() string {
+	return defaultRegistry
+}
+
+// Parse parses and normalizes an image reference like ubuntu, ubuntu:22.04,
+// localhost:5000/foo or registry.example.com/org/ubuntu:22.04@sha256:...
+// Docker Hub references get the docker.io registry and official images the library/ prefix.
+// References without a tag or digest get the latest tag.
+// local://path/to/layout[:tag][@digest] references an OCI image layout directory
+// and only has a tag or digest when one is given.
+func Parse(ref string) (Reference, error) {
+	var r Reference
+
+	if ref == "" {
+		return r, fmt.Errorf("%w: empty reference", ErrInvalidReference)
+	}
+
+	name := ref
+	local := strings.HasPrefix(name, LocalScheme)
+	if local {
+		name = strings.TrimPrefix(name, LocalScheme)
+	}
+	if idx := strings.Index(name, "@"); idx >= 0 {
+		d, err := digest.Parse(name[idx+1:])
+		if err != nil {
+			return r, fmt.Errorf("%w: %s: %v", ErrInvalidReference, ref, err)
+		}
+		r.Digest = d
+		name = name[:idx]
+	}
+	if idx := strings.LastIndex(name, ":"); idx > strings.LastIndex(name, "/") {
+		r.Tag = name[idx+1:]
+		name = name[:idx]
+		if !tagRegexp.MatchString(r.Tag) {
+			return r, fmt.Errorf("%w: invalid tag %q", ErrInvalidReference, r.Tag)
+		}
+	}
+
+	if local {
+		if name == "" {
+			return r, fmt.Errorf("%w: %s has no path", ErrInvalidReference, ref)
+		}
+		r.Path = name
+		return r, nil
+	}
+
+	r.Registry = defaultRegistry
+	if parts := strings.SplitN(name, "/", 2); len(parts) == 2 && isRegistry(parts[0]) {
+		r.Registry, name = parts[0], parts[1]
+		if !registryRegexp.MatchString(r.Registry) {
+			return r, fmt.Errorf("%w: invalid registry %q", ErrInvalidReference, r.Registry)
+		}
+	}
+	if r.Registry == "index.docker.io" || r.Registry == "registry-1.docker.io" {
+		r.Registry = defaultRegistry
+	}
+
+	if name == "" {
+		return r, fmt.Errorf("%w: %s has no repository", ErrInvalidReference, ref)
+	}
+	for _, component := range strings.Split(name, "/") {
+		if !componentRegexp.MatchString(component) {
+			return r, fmt.Errorf("%w: invalid repository component %q", ErrInvalidReference, component)
+		}
+	}
+	if r.Registry == defaultRegistry && !strings.Contains(name, "/") {
+		name = officialRepo + name
+	}
+	r.Repository = name
+	if len(r.Registry)+1+len(r.Repository) > maxNameLength {
+		return r, fmt.Errorf("%w: name longer than %d characters", ErrInvalidReference, maxNameLength)
+	}
+
+	if r.Tag == "" && r.Digest == "" {
+		r.Tag = defaultTag
+	}
+
+	return r, nil
+}
+
+// isRegistry returns true if the first path component of a reference is a registry host
+func isRegistry(component string) bool {
+	return strings.ContainsAny(component, ".:[") || component == "localhost" || strings.ToLower(component) != component
+}
+
+// FamiliarizeName returns the repository name as the registry knows it,
+// which for Docker Hub official images includes the library/ prefix
+func FamiliarizeName(ref Reference) string {
+	repo := ref.Repository
+	if ref.Registry == defaultRegistry && !strings.Contains(repo, "/") {
+		repo = officialRepo + repo
+	}
+	if ref.Registry == "" || ref.Registry == defaultRegistry {
+		return repo
+	}
+	return ref.Registry + "/" + repo
+}
+
+// IsLocal returns true for local:// references to OCI image layouts
+func (r Reference) IsLocal() bool {
+	return r.Path != ""
+}
+
+// Name returns the registry and repository, or the layout path of local references
+func (r Reference) Name() string {
+	if r.IsLocal() {
+		return LocalScheme + r.Path
+	}
+	return r.Registry + "/" + r.Repository
+}
+
+// String returns the normalized reference, parsing it again returns the same Reference
+func (r Reference) String() string {
+	s := r.Name()
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest.String()
+	}
+	return s
+}
@@ -0,0 +1,122 @@
+package reference
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+)
+
+const testDigest = digest.Digest("sha256:6c3c624b58dbbcd3c0dd82b4c53f04194d1247c6eebdaab7c610cf7d66709b3b")
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		ref      string
+		want     Reference
+		familiar string
+	}{
+		// Docker Hub
+		{ref: "ubuntu", want: Reference{Registry: "docker.io", Repository: "library/ubuntu", Tag: "latest"}, familiar: "library/ubuntu"},
+		{ref: "ubuntu:22.04", want: Reference{Registry: "docker.io", Repository: "library/ubuntu", Tag: "22.04"}, familiar: "library/ubuntu"},
+		{ref: "library/ubuntu", want: Reference{Registry: "docker.io", Repository: "library/ubuntu", Tag: "latest"}, familiar: "library/ubuntu"},
+		{ref: "docker.io/ubuntu", want: Reference{Registry: "docker.io", Repository: "library/ubuntu", Tag: "latest"}, familiar: "library/ubuntu"},
+		{ref: "index.docker.io/ubuntu", want: Reference{Registry: "docker.io", Repository: "library/ubuntu", Tag: "latest"}, familiar: "library/ubuntu"},
+		{ref: "registry-1.docker.io/library/ubuntu:latest", want: Reference{Registry: "docker.io", Repository: "library/ubuntu", Tag: "latest"}, familiar: "library/ubuntu"},
+		{ref: "blacktop/graboid", want: Reference{Registry: "docker.io", Repository: "blacktop/graboid", Tag: "latest"}, familiar: "blacktop/graboid"},
+		{ref: "docker.io/blacktop/graboid:0.15.8", want: Reference{Registry: "docker.io", Repository: "blacktop/graboid", Tag: "0.15.8"}, familiar: "blacktop/graboid"},
+		{ref: "ubuntu@" + testDigest.String(), want: Reference{Registry: "docker.io", Repository: "library/ubuntu", Digest: testDigest}, familiar: "library/ubuntu"},
+		// a single name with a port is a tag, not a registry
+		{ref: "localhost:5000", want: Reference{Registry: "docker.io", Repository: "library/localhost", Tag: "5000"}, familiar: "library/localhost"},
+		// other registries
+		{ref: "localhost/foo", want: Reference{Registry: "localhost", Repository: "foo", Tag: "latest"}, familiar: "localhost/foo"},
+		{ref: "localhost:5000/foo", want: Reference{Registry: "localhost:5000", Repository: "foo", Tag: "latest"}, familiar: "localhost:5000/foo"},
+		{ref: "registry.example.com/org/ubuntu:22.04@" + testDigest.String(), want: Reference{Registry: "registry.example.com", Repository: "org/ubuntu", Tag: "22.04", Digest: testDigest}, familiar: "registry.example.com/org/ubuntu"},
+		{ref: "ghcr.io/a/b/c/d", want: Reference{Registry: "ghcr.io", Repository: "a/b/c/d", Tag: "latest"}, familiar: "ghcr.io/a/b/c/d"},
+		{ref: "Registry/foo", want: Reference{Registry: "Registry", Repository: "foo", Tag: "latest"}, familiar: "Registry/foo"},
+		{ref: "[::1]:5000/foo:bar", want: Reference{Registry: "[::1]:5000", Repository: "foo", Tag: "bar"}, familiar: "[::1]:5000/foo"},
+		{ref: "quay.io/coreos/etcd_backup__v2-a.b:v3.5_rc.1", want: Reference{Registry: "quay.io", Repository: "coreos/etcd_backup__v2-a.b", Tag: "v3.5_rc.1"}, familiar: "quay.io/coreos/etcd_backup__v2-a.b"},
+		// OCI layouts
+		{ref: "local://./layout", want: Reference{Path: "./layout"}},
+		{ref: "local:///tmp/layout:v1@" + testDigest.String(), want: Reference{Path: "/tmp/layout", Tag: "v1", Digest: testDigest}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			got, err := Parse(tt.ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+			if !got.IsLocal() {
+				if familiar := FamiliarizeName(got); familiar != tt.familiar {
+					t.Errorf("FamiliarizeName() = %q, want %q", familiar, tt.familiar)
+				}
+			}
+
+			again, err := Parse(got.String())
+			if err != nil || again != got {
+				t.Errorf("Parse(%q) = %+v, %v, want the same reference", got.String(), again, err)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, ref := range []string{
+		"",
+		"Ubuntu",
+		"ubuntu:",
+		"ubuntu:-tag",
+		"ubuntu:" + strings.Repeat("a", 129),
+		"ubuntu@sha256:abc",
+		"ubuntu@" + testDigest.String()[:20],
+		":latest",
+		"-ubuntu",
+		"ubuntu-",
+		"org//ubuntu",
+		"org/ubuntu/",
+		"org/ubu..ntu",
+		"localhost:5000/",
+		"registry.example.com:port/foo",
+		"-registry.example.com/foo",
+		"local://",
+		"local://:tag",
+		"example.com/" + strings.Repeat("a", 250),
+	} {
+		if r, err := Parse(ref); !errors.Is(err, ErrInvalidReference) {
+			t.Errorf("Parse(%q) = %+v, %v, want %v", ref, r, err, ErrInvalidReference)
+		}
+	}
+}
+
+func TestReferenceString(t *testing.T) {
+	tests := []struct {
+		ref  Reference
+		want string
+	}{
+		{ref: Reference{Registry: "docker.io", Repository: "library/ubuntu", Tag: "latest"}, want: "docker.io/library/ubuntu:latest"},
+		{ref: Reference{Registry: "ghcr.io", Repository: "org/app", Digest: testDigest}, want: "ghcr.io/org/app@" + testDigest.String()},
+		{ref: Reference{Registry: "ghcr.io", Repository: "org/app", Tag: "v1", Digest: testDigest}, want: "ghcr.io/org/app:v1@" + testDigest.String()},
+		{ref: Reference{Path: "layout", Tag: "v1"}, want: "local://layout:v1"},
+	}
+	for _, tt := range tests {
+		if got := tt.ref.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestFamiliarizeName(t *testing.T) {
+	// references that were not made by Parse still get the Docker Hub prefix
+	if name := FamiliarizeName(Reference{Registry: "docker.io", Repository: "alpine"}); name != "library/alpine" {
+		t.Errorf("FamiliarizeName() = %q", name)
+	}
+	if name := FamiliarizeName(Reference{Repository: "org/app"}); name != "org/app" {
+		t.Errorf("FamiliarizeName() = %q", name)
+	}
+	if DefaultRegistry() != "docker.io" {
+		t.Errorf("DefaultRegistry() = %q", DefaultRegistry())
+	}
+}
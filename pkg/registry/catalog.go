@@ -0,0 +1,86 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/apex/log"
+)
+
+// ErrNotSupported is returned when the registry does not serve the catalog
+var ErrNotSupported = errors.New("registry does not support the catalog API")
+
+// GetCatalogOptions configures GetCatalogWithOptions
+type GetCatalogOptions struct {
+	// MaxResults stops listing once that many repositories were found (0 means no limit)
+	MaxResults int
+	// LastRepo lists the repositories after it, pass the last one of the previous call to continue
+	LastRepo string
+}
+
+type catalog struct {
+	Repositories []string `json:"repositories"`
+}
+
+// GetCatalog returns all repositories of the registry
+func (c *Client) GetCatalog() ([]string, error) {
+	return c.GetCatalogWithOptions(GetCatalogOptions{})
+}
+
+// GetCatalogWithOptions returns the repositories of the registry in the
+// registry's (lexical) order following its pagination
+func (c *Client) GetCatalogWithOptions(opts GetCatalogOptions) ([]string, error) {
+	var repos []string
+
+	u, err := url.Parse(c.host + "/v2/_catalog")
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	if opts.MaxResults > 0 {
+		q.Set("n", strconv.Itoa(opts.MaxResults))
+	}
+	if len(opts.LastRepo) > 0 {
+		q.Set("last", opts.LastRepo)
+	}
+	u.RawQuery = q.Encode()
+
+	next := u.String()
+	for next != "" {
+		log.WithField("url", next).Debug("get catalog")
+
+		req, err := http.NewRequest("GET", next, nil)
+		if err != nil {
+			return nil, err
+		}
+		res, err := c.do(req, "")
+		if errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf("%w: %v", ErrNotSupported, err)
+		} else if err != nil {
+			return nil, err
+		}
+
+		var page catalog
+		err = json.NewDecoder(res.Body).Decode(&page)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		repos = append(repos, page.Repositories...)
+		if opts.MaxResults > 0 && len(repos) >= opts.MaxResults {
+			repos = repos[:opts.MaxResults]
+			break
+		}
+
+		if next, err = nextLink(next, res.Header.Get("Link")); err != nil {
+			return nil, err
+		}
+	}
+
+	return repos, nil
+}
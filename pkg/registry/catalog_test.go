@@ -0,0 +1,115 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+// catalogServer serves repos (in lexical order) two per page unless the
+// client asks for another page size, pages are counted in requests
+func catalogServer(t *testing.T, repos []string, requests *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/_catalog" {
+			http.NotFound(w, r)
+			return
+		}
+		*requests++
+
+		n := 2
+		if v := r.URL.Query().Get("n"); v != "" {
+			n, _ = strconv.Atoi(v)
+		}
+		last := r.URL.Query().Get("last")
+		start := sort.SearchStrings(repos, last)
+		if start < len(repos) && repos[start] == last {
+			start++
+		}
+		if last == "" {
+			start = 0
+		}
+		end := start + n
+		if end < len(repos) {
+			q := url.Values{"n": {strconv.Itoa(n)}, "last": {repos[end-1]}}
+			w.Header().Set("Link", fmt.Sprintf(`</v2/_catalog?%s>; rel="next"`, q.Encode()))
+		} else {
+			end = len(repos)
+		}
+		json.NewEncoder(w).Encode(catalog{Repositories: repos[start:end]})
+	}))
+}
+
+func TestGetCatalog(t *testing.T) {
+	repos := []string{"alpine", "busybox", "debian", "library/golang", "nginx", "ubuntu"}
+	var requests int
+	srv := catalogServer(t, repos, &requests)
+	defer srv.Close()
+	c := NewClient(srv.URL)
+
+	got, err := c.GetCatalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, repos) {
+		t.Errorf("GetCatalog() = %v, want %v", got, repos)
+	}
+	if requests != 3 {
+		t.Errorf("GetCatalog() requested %d pages, want 3", requests)
+	}
+
+	tests := []struct {
+		name  string
+		opts  GetCatalogOptions
+		want  []string
+		pages int
+	}{
+		{name: "max results", opts: GetCatalogOptions{MaxResults: 3}, want: repos[:3], pages: 1},
+		{name: "max results above count", opts: GetCatalogOptions{MaxResults: 10}, want: repos, pages: 1},
+		{name: "last repo", opts: GetCatalogOptions{LastRepo: "busybox"}, want: repos[2:], pages: 2},
+		{name: "last repo and max results", opts: GetCatalogOptions{LastRepo: "debian", MaxResults: 1}, want: repos[3:4], pages: 1},
+		{name: "last repo at the end", opts: GetCatalogOptions{LastRepo: "ubuntu"}, want: nil, pages: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests = 0
+			got, err := c.GetCatalogWithOptions(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetCatalogWithOptions() = %v, want %v", got, tt.want)
+			}
+			if requests != tt.pages {
+				t.Errorf("GetCatalogWithOptions() requested %d pages, want %d", requests, tt.pages)
+			}
+		})
+	}
+}
+
+func TestGetCatalogNotSupported(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	if _, err := NewClient(srv.URL).GetCatalog(); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("GetCatalog() error = %v, want ErrNotSupported", err)
+	}
+}
+
+func TestGetCatalogUnauthorized(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	_, err := NewClient(srv.URL).GetCatalog()
+	if !errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrNotSupported) {
+		t.Errorf("GetCatalog() error = %v, want ErrUnauthorized", err)
+	}
+}
@@ -0,0 +1,561 @@
+package registry
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/apex/log"
+	regauth "github.com/blacktop/graboid/pkg/auth"
+	"github.com/blacktop/graboid/pkg/extract"
+	"github.com/blacktop/graboid/pkg/image"
+)
+
+// manifestAccept are the manifest media types the client understands
+var manifestAccept = []string{
+	image.MediaTypeOCIManifest,
+	image.MediaTypeDockerManifest,
+}
+
+// indexAccept also accepts multi-platform indexes
+var indexAccept = append([]string{
+	image.MediaTypeOCIIndex,
+	image.MediaTypeDockerManifestList,
+}, manifestAccept...)
+
+// blobAccept are the layer media types the client understands
+var blobAccept = []string{
+	image.MediaTypeOCILayer,
+	image.MediaTypeDockerLayer,
+	"application/vnd.oci.image.layer.v1.tar",
+	"*/*",
+}
+
+var (
+	// ErrUnauthorized is returned when the registry rejects the request's credentials
+	ErrUnauthorized = errors.New("authentication required")
+	// ErrNotFound is returned when the registry does not have the requested content
+	ErrNotFound = errors.New("not found")
+	// ErrBodyNotRewindable is returned when a request has to be resent after
+	// authenticating but its body is no io.ReadSeeker that can be read again
+	ErrBodyNotRewindable = errors.New("request body can't be resent after authenticating")
+)
+
+// Client is a docker registry v2 API client that handles bearer token auth
+type Client struct {
+	host      string
+	client    *http.Client
+	transport *http.Transport
+
+	username    string
+	password    string
+	credentials CredentialFunc
+	helper      CredentialFunc
+	retry       *RetryOptions
+	chunkSize   int64
+	zstd        bool
+	stats       *connStats
+	insecure    bool
+	manifests   ManifestCache
+
+	mu     sync.Mutex
+	tokens map[string]string // repo -> bearer token
+}
+
+// ClientOption configures a Client
+type ClientOption func(*Client)
+
+// CredentialFunc returns the username and password to use for a registry host
+type CredentialFunc = regauth.CredentialFunc
+
+// WithHTTPClient sets the http.Client used to talk to the registry
+func WithHTTPClient(hc *http.Client) ClientOption {
+	return func(c *Client) {
+		c.client = hc
+	}
+}
+
+// WithCredentials sets the username and password used to get auth tokens
+func WithCredentials(username, password string) ClientOption {
+	return func(c *Client) {
+		c.username = username
+		c.password = password
+	}
+}
+
+// WithCredentialFunc sets a function that looks up credentials when the registry asks for them
+func WithCredentialFunc(fn CredentialFunc) ClientOption {
+	return func(c *Client) {
+		c.credentials = fn
+	}
+}
+
+// WithCredentialHelper gets credentials from the docker-credential-<helperName> binary,
+// falling back to the static credentials when the helper has none for the registry
+func WithCredentialHelper(helperName string) ClientOption {
+	return func(c *Client) {
+		c.helper = regauth.NewCredentialHelper(helperName).Credentials
+	}
+}
+
+// WithTLSConfig sets the TLS config used to connect to the registry
+func WithTLSConfig(cfg *tls.Config) ClientOption {
+	return func(c *Client) {
+		c.transport.TLSClientConfig = cfg
+	}
+}
+
+// WithZstdSupport sets whether the client tells the registry it accepts zstd
+// compressed layers (default true)
+func WithZstdSupport(enabled bool) ClientOption {
+	return func(c *Client) {
+		c.zstd = enabled
+	}
+}
+
+// NewClient creates a registry client for host (e.g. registry-1.docker.io)
+func NewClient(host string, opts ...ClientOption) *Client {
+	c := &Client{
+		transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			MaxIdleConns:        defaultMaxIdleConns,
+			MaxIdleConnsPerHost: defaultMaxIdleConnsPerHost,
+			IdleConnTimeout:     defaultIdleConnTimeout,
+			// layers and manifests are already compressed or small
+			DisableCompression: true,
+		},
+		tokens:    make(map[string]string),
+		chunkSize: defaultChunkSize,
+		zstd:      true,
+		stats:     &connStats{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	fallback := false
+	if !strings.Contains(host, "://") {
+		// insecure registries may only serve plain HTTP
+		fallback = c.insecure
+		host = "https://" + host
+	}
+	c.host = strings.TrimSuffix(host, "/")
+	if c.insecure {
+		c.allowInsecure()
+	}
+	if c.client == nil {
+		c.client = &http.Client{Transport: c.transport}
+	}
+	hc := *c.client
+	if hc.Transport == nil {
+		hc.Transport = http.DefaultTransport
+	}
+	hc.Transport = &statsTransport{base: hc.Transport, stats: c.stats}
+	if fallback {
+		u, _ := url.Parse(c.host)
+		hc.Transport = &plainHTTPFallback{base: hc.Transport, host: u.Host}
+	}
+	if c.retry != nil {
+		hc.Transport = NewRetryTransport(hc.Transport, *c.retry)
+	}
+	c.client = &hc
+	return c
+}
+
+// splitRef splits a repo:tag or repo@digest reference into the repo and the tag or digest
+func splitRef(ref string) (string, string) {
+	if idx := strings.Index(ref, "@"); idx >= 0 {
+		return ref[:idx], ref[idx+1:]
+	}
+	if idx := strings.LastIndex(ref, ":"); idx > strings.LastIndex(ref, "/") {
+		return ref[:idx], ref[idx+1:]
+	}
+	return ref, "latest"
+}
+
+// Host returns the registry URL the client talks to
+func (c *Client) Host() string {
+	return c.host
+}
+
+// GetManifest gets the image manifest for a repo:tag or repo@digest reference
+func (c *Client) GetManifest(ref string) (*image.OCIManifest, error) {
+	rawJSON, _, err := c.GetRawManifest(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &image.OCIManifest{}
+	if err := json.Unmarshal(rawJSON, m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// GetRawManifest gets the manifest JSON and its content type for a repo:tag or repo@digest reference
+func (c *Client) GetRawManifest(ref string) ([]byte, string, error) {
+	repo, reference := splitRef(ref)
+	return c.getManifest(repo, reference, manifestAccept)
+}
+
+// GetRawManifestOrIndex is GetRawManifest but multi-platform images return their index (or manifest list)
+func (c *Client) GetRawManifestOrIndex(ref string) ([]byte, string, error) {
+	repo, reference := splitRef(ref)
+	return c.getManifest(repo, reference, indexAccept)
+}
+
+func (c *Client) getManifest(repo, reference string, accept []string) ([]byte, string, error) {
+	u := fmt.Sprintf("%s/v2/%s/manifests/%s", c.host, repo, reference)
+	log.WithFields(log.Fields{
+		"url":   u,
+		"image": repo,
+		"ref":   reference,
+	}).Debug("get manifest")
+
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Accept", strings.Join(accept, ", "))
+
+	key := manifestCacheKey(c.host, repo, reference, accept)
+	var cached CachedManifest
+	ok := false
+	if c.manifests != nil {
+		if cached, ok = c.manifests.Get(key); ok && len(cached.ETag) > 0 {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+	}
+
+	res, err := c.do(req, repo)
+	var se *statusError
+	if ok && errors.As(err, &se) && se.code == http.StatusNotModified {
+		log.WithField("ref", key).Debug("manifest not modified")
+		return cached.Data, cached.MediaType, nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+
+	rawJSON, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	mediaType := res.Header.Get("Content-Type")
+
+	if etag := res.Header.Get("ETag"); c.manifests != nil && len(etag) > 0 {
+		if err := c.manifests.Put(key, CachedManifest{ETag: etag, MediaType: mediaType, Data: rawJSON}); err != nil {
+			log.WithError(err).Debug("failed to cache manifest")
+		}
+	}
+
+	return rawJSON, mediaType, nil
+}
+
+// manifestCacheKey returns the ManifestCache key of the manifest request. The
+// accepted media types are part of it since the registry answers a request
+// accepting indexes with a different document than one that does not.
+func manifestCacheKey(host, repo, reference string, accept []string) string {
+	host = strings.TrimPrefix(strings.TrimPrefix(host, "https://"), "http://")
+	return fmt.Sprintf("%s/%s@%s;accept=%s", host, repo, reference, strings.Join(accept, ","))
+}
+
+// GetBlob returns a reader for the blob with digest d in repo. The caller must close it.
+func (c *Client) GetBlob(repo, d string) (io.ReadCloser, error) {
+	u := fmt.Sprintf("%s/v2/%s/blobs/%s", c.host, repo, d)
+	log.WithField("url", u).Debug("get blob")
+
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", c.blobAccept())
+
+	res, err := c.do(req, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Body, nil
+}
+
+// GetLayer returns the uncompressed tar of the layer with digest d in repo,
+// gzip and zstd compressed blobs are decompressed transparently. The caller must close it.
+func (c *Client) GetLayer(repo, d string) (io.ReadCloser, error) {
+	body, err := c.GetBlob(repo, d)
+	if err != nil {
+		return nil, err
+	}
+	r, err := extract.Decompress(body)
+	if err != nil {
+		body.Close()
+		return nil, fmt.Errorf("failed to decompress layer %s: %w", d, err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, body}, nil
+}
+
+// GetBlobFrom returns a reader for the blob with digest d in repo starting at
+// offset using a Range request. The returned bool is false when the registry
+// ignored the range and the reader starts at the beginning of the blob.
+func (c *Client) GetBlobFrom(repo, d string, offset int64) (io.ReadCloser, bool, error) {
+	if offset <= 0 {
+		body, err := c.GetBlob(repo, d)
+		return body, false, err
+	}
+
+	u := fmt.Sprintf("%s/v2/%s/blobs/%s", c.host, repo, d)
+	log.WithFields(log.Fields{
+		"url":    u,
+		"offset": offset,
+	}).Debug("resume blob")
+
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	req.Header.Set("Accept", c.blobAccept())
+
+	res, err := c.do(req, repo)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return res.Body, res.StatusCode == http.StatusPartialContent, nil
+}
+
+// blobAccept returns the Accept header of blob requests
+func (c *Client) blobAccept() string {
+	accept := blobAccept
+	if c.zstd {
+		accept = append([]string{image.MediaTypeOCILayerZstd}, accept...)
+	}
+	return strings.Join(accept, ", ")
+}
+
+// do sends the request answering the registry's auth challenge if needed.
+// Non 2xx responses are returned as errors.
+func (c *Client) do(req *http.Request, repo string) (*http.Response, error) {
+	c.authorize(req, repo)
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusUnauthorized {
+		challenge := res.Header.Get("WWW-Authenticate")
+		res.Body.Close()
+		if challenge == "" {
+			return nil, fmt.Errorf("HTTP Error: %s: %w", res.Status, ErrUnauthorized)
+		}
+		push := req.Method != "GET" && req.Method != "HEAD"
+		if err := c.authenticate(challenge, repo, push); err != nil {
+			return nil, err
+		}
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		} else if req.Body != nil && req.Body != http.NoBody {
+			// the first attempt consumed the body
+			return nil, fmt.Errorf("%s %s: %w", req.Method, req.URL.Path, ErrBodyNotRewindable)
+		}
+		c.authorize(req, repo)
+		if res, err = c.client.Do(req); err != nil {
+			return nil, err
+		}
+	}
+
+	if res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden {
+		res.Body.Close()
+		return nil, fmt.Errorf("HTTP Error: %s: %w", res.Status, ErrUnauthorized)
+	}
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return nil, fmt.Errorf("HTTP Error: %s: %w", res.Status, ErrNotFound)
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		res.Body.Close()
+		return nil, &statusError{code: res.StatusCode, status: res.Status}
+	}
+
+	return res, nil
+}
+
+// statusError is the error of a request the registry answered with a non 2xx status
+type statusError struct {
+	code   int
+	status string
+}
+
+func (se *statusError) Error() string {
+	return "HTTP Error: " + se.status
+}
+
+// isClientError returns true if err is a 4xx response
+func isClientError(err error) bool {
+	var se *statusError
+	return errors.As(err, &se) && se.code >= 400 && se.code < 500
+}
+
+func (c *Client) authorize(req *http.Request, repo string) {
+	c.mu.Lock()
+	token, ok := c.tokens[repo]
+	c.mu.Unlock()
+
+	if ok {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if c.username != "" && c.password != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+}
+
+// authenticate answers a WWW-Authenticate challenge by getting a bearer token for repo
+func (c *Client) authenticate(challenge, repo string, push bool) error {
+	scheme, params := parseChallenge(challenge)
+	if !strings.EqualFold(scheme, "bearer") {
+		return fmt.Errorf("%w: unsupported auth challenge %q", ErrUnauthorized, challenge)
+	}
+	realm, ok := params["realm"]
+	if !ok {
+		return errors.New("bearer challenge has no realm")
+	}
+
+	u, err := url.Parse(realm)
+	if err != nil {
+		return err
+	}
+	q := u.Query()
+	if service, ok := params["service"]; ok {
+		q.Set("service", service)
+	}
+	if scope, ok := params["scope"]; ok {
+		q.Set("scope", scope)
+	} else if repo == "" {
+		q.Set("scope", "registry:catalog:*")
+	} else if push {
+		q.Set("scope", fmt.Sprintf("repository:%s:pull,push", repo))
+	} else {
+		q.Set("scope", fmt.Sprintf("repository:%s:pull", repo))
+	}
+	u.RawQuery = q.Encode()
+
+	log.WithField("url", u.String()).Debug("getting auth token")
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return err
+	}
+	username, password, err := c.credentialsFor()
+	if err != nil {
+		return err
+	}
+	if username != "" && password != "" {
+		req.SetBasicAuth(username, password)
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("HTTP Error: %s: %w", res.Status, ErrUnauthorized)
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP Error: %s", res.Status)
+	}
+
+	var a auth
+	if err := json.NewDecoder(res.Body).Decode(&a); err != nil {
+		return err
+	}
+	token := a.Token
+	if token == "" {
+		token = a.AccessToken
+	}
+	if token == "" {
+		return errors.New("auth server returned an empty token")
+	}
+
+	c.mu.Lock()
+	c.tokens[repo] = token
+	c.mu.Unlock()
+
+	return nil
+}
+
+// credentialsFor asks the credential helper for credentials and otherwise
+// returns the static credentials or asks the CredentialFunc for them
+func (c *Client) credentialsFor() (string, string, error) {
+	host := c.host
+	if u, err := url.Parse(c.host); err == nil {
+		host = u.Host
+	}
+	if c.helper != nil {
+		username, password, err := c.helper(host)
+		if err == nil {
+			return username, password, nil
+		}
+		if !errors.Is(err, regauth.ErrCredentialsNotFound) {
+			return "", "", err
+		}
+		log.WithError(err).Debug("credential helper has no credentials")
+	}
+	if c.username != "" || c.credentials == nil {
+		return c.username, c.password, nil
+	}
+	return c.credentials(host)
+}
+
+// parseChallenge parses a WWW-Authenticate header like
+// Bearer realm="https://auth.docker.io/token",service="registry.docker.io"
+func parseChallenge(header string) (string, map[string]string) {
+	params := make(map[string]string)
+
+	header = strings.TrimSpace(header)
+	idx := strings.Index(header, " ")
+	if idx < 0 {
+		return header, params
+	}
+	scheme, rest := header[:idx], header[idx+1:]
+
+	for len(rest) > 0 {
+		rest = strings.TrimLeft(rest, " ,")
+		eq := strings.Index(rest, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = rest[eq+1:]
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else if comma := strings.Index(rest, ","); comma >= 0 {
+			value, rest = rest[:comma], rest[comma:]
+		} else {
+			value, rest = rest, ""
+		}
+		params[key] = value
+	}
+
+	return scheme, params
+}
@@ -0,0 +1,376 @@
+package registry
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/blacktop/graboid/pkg/image"
+	"github.com/klauspost/compress/zstd"
+)
+
+func zstdLayer(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw, err := zstd.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(zw)
+	for name, body := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(body))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(tw, body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGetLayerZstd(t *testing.T) {
+	files := map[string]string{"etc/hostname": "graboid\n"}
+	blob := zstdLayer(t, files)
+
+	tests := []struct {
+		name   string
+		opts   []ClientOption
+		accept bool
+	}{
+		{name: "default", accept: true},
+		{name: "enabled", opts: []ClientOption{WithZstdSupport(true)}, accept: true},
+		{name: "disabled", opts: []ClientOption{WithZstdSupport(false)}, accept: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var accept string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v2/library/test/blobs/sha256:layer" {
+					http.NotFound(w, r)
+					return
+				}
+				accept = r.Header.Get("Accept")
+				w.Header().Set("Content-Type", image.MediaTypeOCILayerZstd)
+				w.Write(blob)
+			}))
+			defer srv.Close()
+
+			c := NewClient(srv.URL, tt.opts...)
+			rc, err := c.GetLayer("library/test", "sha256:layer")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rc.Close()
+
+			if got := strings.Contains(accept, image.MediaTypeOCILayerZstd); got != tt.accept {
+				t.Errorf("Accept %q advertises zstd = %t, want %t", accept, got, tt.accept)
+			}
+
+			got := make(map[string]string)
+			tr := tar.NewReader(rc)
+			for {
+				hdr, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				body, err := ioutil.ReadAll(tr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got[hdr.Name] = string(body)
+			}
+			if len(got) != len(files) || got["etc/hostname"] != files["etc/hostname"] {
+				t.Errorf("layer contents = %v, want %v", got, files)
+			}
+		})
+	}
+}
+
+// tokenRegistry serves a manifest and a blob of library/test behind the
+// bearer token flow of Docker Hub, tokens are issued for user:secret
+type tokenRegistry struct {
+	srv *httptest.Server
+
+	mu            sync.Mutex
+	tokenRequests []*http.Request
+	accessToken   bool // answer with access_token instead of token
+}
+
+const (
+	testLayerManifest = `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"sha256:config","size":2},"layers":[{"mediaType":"application/vnd.oci.image.layer.v1.tar+gzip","digest":"sha256:layer","size":5}]}`
+	testToken         = "token-for-library-test"
+)
+
+func newTokenRegistry() *tokenRegistry {
+	tr := &tokenRegistry{}
+	tr.srv = httptest.NewServer(http.HandlerFunc(tr.serve))
+	return tr
+}
+
+func (tr *tokenRegistry) serve(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/token" {
+		tr.mu.Lock()
+		tr.tokenRequests = append(tr.tokenRequests, r)
+		tr.mu.Unlock()
+		if username, password, ok := r.BasicAuth(); !ok || username != "user" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		field := "token"
+		if tr.accessToken {
+			field = "access_token"
+		}
+		fmt.Fprintf(w, `{%q: %q, "expires_in": 300}`, field, testToken)
+		return
+	}
+
+	if r.Header.Get("Authorization") != "Bearer "+testToken {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test-registry",scope="repository:library/test:pull"`, tr.srv.URL))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch r.URL.Path {
+	case "/v2/library/test/manifests/latest":
+		w.Header().Set("Content-Type", image.MediaTypeOCIManifest)
+		io.WriteString(w, testLayerManifest)
+	case "/v2/library/test/blobs/sha256:layer":
+		io.WriteString(w, "layer")
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (tr *tokenRegistry) tokens() []*http.Request {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	return tr.tokenRequests
+}
+
+func TestClientBearerToken(t *testing.T) {
+	for _, accessToken := range []bool{false, true} {
+		t.Run(fmt.Sprintf("access_token=%t", accessToken), func(t *testing.T) {
+			reg := newTokenRegistry()
+			defer reg.srv.Close()
+			reg.accessToken = accessToken
+			c := NewClient(reg.srv.URL, WithCredentials("user", "secret"))
+
+			m, err := c.GetManifest("library/test:latest")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(m.Layers) != 1 || m.Layers[0].Digest != "sha256:layer" {
+				t.Errorf("GetManifest() = %+v", m)
+			}
+
+			rc, err := c.GetBlob("library/test", "sha256:layer")
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := ioutil.ReadAll(rc)
+			rc.Close()
+			if err != nil || string(body) != "layer" {
+				t.Errorf("GetBlob() = %q, %v", body, err)
+			}
+
+			tokens := reg.tokens()
+			if len(tokens) != 1 {
+				t.Fatalf("got %d token requests, want the token to be reused", len(tokens))
+			}
+			q := tokens[0].URL.Query()
+			if q.Get("service") != "test-registry" || q.Get("scope") != "repository:library/test:pull" {
+				t.Errorf("token request query = %v", q)
+			}
+		})
+	}
+}
+
+func TestClientBearerTokenCredentials(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []ClientOption
+		err  error
+	}{
+		{name: "no credentials", err: ErrUnauthorized},
+		{name: "wrong password", opts: []ClientOption{WithCredentials("user", "wrong")}, err: ErrUnauthorized},
+		{name: "credential func", opts: []ClientOption{WithCredentialFunc(func(host string) (string, string, error) {
+			return "user", "secret", nil
+		})}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := newTokenRegistry()
+			defer reg.srv.Close()
+			_, err := NewClient(reg.srv.URL, tt.opts...).GetManifest("library/test:latest")
+			if !errors.Is(err, tt.err) {
+				t.Errorf("GetManifest() = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+// useFakeHelpers puts the fake credential helpers of pkg/auth on the PATH
+// and pretends the test registry is one docker-credential-graboid-test knows
+func useFakeHelpers(t *testing.T, host string) func() {
+	t.Helper()
+	testdata, err := filepath.Abs(filepath.Join("..", "auth", "testdata"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", testdata+string(os.PathListSeparator)+path)
+	os.Setenv("GRABOID_TEST_REGISTRY", host)
+	return func() {
+		os.Setenv("PATH", path)
+		os.Unsetenv("GRABOID_TEST_REGISTRY")
+	}
+}
+
+func TestClientCredentialHelper(t *testing.T) {
+	tests := []struct {
+		name  string
+		known bool // whether the helper has credentials for the registry
+		opts  []ClientOption
+		err   error
+	}{
+		{name: "helper credentials", known: true},
+		{name: "helper wins over static credentials", known: true, opts: []ClientOption{WithCredentials("user", "wrong")}},
+		{name: "fallback to static credentials", opts: []ClientOption{WithCredentials("user", "secret")}},
+		{name: "fallback to credential func", opts: []ClientOption{WithCredentialFunc(func(host string) (string, string, error) {
+			return "user", "secret", nil
+		})}},
+		{name: "no fallback", err: ErrUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := newTokenRegistry()
+			defer reg.srv.Close()
+			host := strings.TrimPrefix(reg.srv.URL, "http://")
+			if !tt.known {
+				host = "unknown.example.com"
+			}
+			defer useFakeHelpers(t, host)()
+
+			opts := append([]ClientOption{WithCredentialHelper("graboid-test")}, tt.opts...)
+			_, err := NewClient(reg.srv.URL, opts...).GetManifest("library/test:latest")
+			if !errors.Is(err, tt.err) {
+				t.Errorf("GetManifest() = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestClientCredentialHelperError(t *testing.T) {
+	reg := newTokenRegistry()
+	defer reg.srv.Close()
+	defer useFakeHelpers(t, "")()
+
+	// a failing helper must not silently fall back to other credentials
+	_, err := NewClient(reg.srv.URL, WithCredentialHelper("graboid-missing"), WithCredentials("user", "secret")).GetManifest("library/test:latest")
+	if err == nil || !strings.Contains(err.Error(), "docker-credential-graboid-missing") {
+		t.Errorf("GetManifest() = %v, want the helper error", err)
+	}
+}
+
+func TestClientNotFound(t *testing.T) {
+	reg := newTokenRegistry()
+	defer reg.srv.Close()
+	c := NewClient(reg.srv.URL, WithCredentials("user", "secret"))
+	if _, err := c.GetManifest("library/test:missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetManifest() of a missing tag = %v, want ErrNotFound", err)
+	}
+	if _, err := c.GetBlob("library/test", "sha256:missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetBlob() of a missing blob = %v, want ErrNotFound", err)
+	}
+}
+
+// countingTransport counts the requests sent through it
+type countingTransport struct {
+	mu       sync.Mutex
+	requests int
+}
+
+func (ct *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ct.mu.Lock()
+	ct.requests++
+	ct.mu.Unlock()
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestClientWithHTTPClient(t *testing.T) {
+	reg := newTokenRegistry()
+	defer reg.srv.Close()
+	ct := &countingTransport{}
+	c := NewClient(reg.srv.URL, WithHTTPClient(&http.Client{Transport: ct}), WithCredentials("user", "secret"))
+	if _, err := c.GetManifest("library/test:latest"); err != nil {
+		t.Fatal(err)
+	}
+	// challenged manifest request, token request and the authorized retry
+	if ct.requests != 3 {
+		t.Errorf("custom http.Client sent %d requests, want 3", ct.requests)
+	}
+}
+
+func TestClientWithTLSConfig(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", image.MediaTypeOCIManifest)
+		io.WriteString(w, testLayerManifest)
+	}))
+	defer srv.Close()
+
+	if _, err := NewClient(srv.URL).GetManifest("library/test:latest"); err == nil {
+		t.Error("GetManifest() trusted the unknown certificate")
+	}
+	tlsConfig := srv.Client().Transport.(*http.Transport).TLSClientConfig
+	if _, err := NewClient(srv.URL, WithTLSConfig(tlsConfig)).GetManifest("library/test:latest"); err != nil {
+		t.Errorf("GetManifest() with the server's TLS config = %v", err)
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	tests := []struct {
+		header string
+		scheme string
+		params map[string]string
+	}{
+		{
+			header: `Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/alpine:pull"`,
+			scheme: "Bearer",
+			params: map[string]string{"realm": "https://auth.docker.io/token", "service": "registry.docker.io", "scope": "repository:library/alpine:pull"},
+		},
+		{
+			header: `Bearer realm="https://ghcr.io/token", service="ghcr.io",scope="repository:a/b:pull,push"`,
+			scheme: "Bearer",
+			params: map[string]string{"realm": "https://ghcr.io/token", "service": "ghcr.io", "scope": "repository:a/b:pull,push"},
+		},
+		{header: `Basic realm="Registry"`, scheme: "Basic", params: map[string]string{"realm": "Registry"}},
+		{header: `Bearer realm=https://auth.example.com/token,Service=example`, scheme: "Bearer", params: map[string]string{"realm": "https://auth.example.com/token", "service": "example"}},
+		{header: `Bearer realm="unterminated`, scheme: "Bearer", params: map[string]string{"realm": "unterminated"}},
+		{header: "Bearer", scheme: "Bearer", params: map[string]string{}},
+	}
+	for _, tt := range tests {
+		scheme, params := parseChallenge(tt.header)
+		if scheme != tt.scheme || !reflect.DeepEqual(params, tt.params) {
+			t.Errorf("parseChallenge(%q) = %q, %v, want %q, %v", tt.header, scheme, params, tt.scheme, tt.params)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package registry
+
+import (
+	"fmt"
+	"mime"
+
+	blobdigest "github.com/blacktop/graboid/pkg/digest"
+	"github.com/blacktop/graboid/pkg/image"
+	"github.com/opencontainers/go-digest"
+)
+
+// GetManifestByDigest gets the manifest JSON and its content type for repo@d
+// and verifies the registry returned the content d names
+func (c *Client) GetManifestByDigest(repo string, d digest.Digest) ([]byte, string, error) {
+	if err := d.Validate(); err != nil {
+		return nil, "", err
+	}
+
+	rawJSON, contentType, err := c.getManifest(repo, d.String(), manifestAccept)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if got := d.Algorithm().FromBytes(rawJSON); got != d {
+		return nil, "", &blobdigest.ErrDigestMismatch{Expected: d, Got: got}
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid manifest content type %q: %w", contentType, err)
+	}
+	switch mediaType {
+	case image.MediaTypeOCIManifest, image.MediaTypeDockerManifest:
+	default:
+		return nil, "", fmt.Errorf("unsupported manifest content type %q", mediaType)
+	}
+
+	return rawJSON, mediaType, nil
+}
@@ -0,0 +1,84 @@
+package registry
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	blobdigest "github.com/blacktop/graboid/pkg/digest"
+	"github.com/blacktop/graboid/pkg/image"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestGetManifestByDigest(t *testing.T) {
+	manifest := testLayerManifest
+	d := digest.FromString(manifest)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        string
+		err         error
+	}{
+		{name: "oci", contentType: image.MediaTypeOCIManifest, body: manifest, want: image.MediaTypeOCIManifest},
+		{name: "docker", contentType: image.MediaTypeDockerManifest, body: manifest, want: image.MediaTypeDockerManifest},
+		{name: "parameters", contentType: image.MediaTypeDockerManifest + "; charset=utf-8", body: manifest, want: image.MediaTypeDockerManifest},
+		{name: "tampered", contentType: image.MediaTypeOCIManifest, body: manifest[:len(manifest)-1] + ` }`, err: &blobdigest.ErrDigestMismatch{}},
+		{name: "index", contentType: image.MediaTypeOCIIndex, body: manifest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var accept string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v2/library/test/manifests/"+d.String() {
+					http.NotFound(w, r)
+					return
+				}
+				accept = r.Header.Get("Accept")
+				w.Header().Set("Content-Type", tt.contentType)
+				io.WriteString(w, tt.body)
+			}))
+			defer srv.Close()
+
+			raw, mediaType, err := NewClient(srv.URL).GetManifestByDigest("library/test", d)
+			if accept != image.MediaTypeOCIManifest+", "+image.MediaTypeDockerManifest {
+				t.Errorf("Accept = %q", accept)
+			}
+			switch {
+			case tt.want != "":
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(raw) != manifest || mediaType != tt.want {
+					t.Errorf("GetManifestByDigest() = %s, %q, want %q", raw, mediaType, tt.want)
+				}
+			case tt.err != nil:
+				var mismatch *blobdigest.ErrDigestMismatch
+				if !errors.As(err, &mismatch) {
+					t.Fatalf("GetManifestByDigest() = %v, want a digest mismatch", err)
+				}
+				if mismatch.Expected != d || mismatch.Got != digest.FromString(tt.body) {
+					t.Errorf("mismatch = %+v", mismatch)
+				}
+			case err == nil:
+				t.Errorf("GetManifestByDigest() accepted content type %q", tt.contentType)
+			}
+		})
+	}
+}
+
+func TestGetManifestByDigestInvalid(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("requested %s for an invalid digest", r.URL)
+	}))
+	defer srv.Close()
+
+	for _, d := range []digest.Digest{"", "latest", "sha256:abc", digest.Digest("md5:" + digest.FromString("x").Hex())} {
+		if _, _, err := NewClient(srv.URL).GetManifestByDigest("library/test", d); err == nil {
+			t.Errorf("GetManifestByDigest(%q) succeeded", d)
+		}
+	}
+}
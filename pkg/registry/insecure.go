@@ -0,0 +1,89 @@
+package registry
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/apex/log"
+)
+
+// WithInsecure skips TLS certificate verification and falls back to plain
+// HTTP when the registry doesn't speak TLS, unless its host is given with an
+// https:// scheme. Only use it for local and test registries.
+func WithInsecure(allow bool) ClientOption {
+	return func(c *Client) {
+		c.insecure = allow
+	}
+}
+
+// allowInsecure turns off certificate verification of the client's transport
+func (c *Client) allowInsecure() {
+	log.WithField("registry", c.host).Warn("insecure registry: TLS certificates are not verified and plain HTTP is allowed")
+
+	cfg := &tls.Config{}
+	if c.transport.TLSClientConfig != nil {
+		cfg = c.transport.TLSClientConfig.Clone()
+	}
+	cfg.InsecureSkipVerify = true
+	c.transport.TLSClientConfig = cfg
+}
+
+// plainHTTPFallback resends HTTPS requests to host over plain HTTP once it
+// answered an HTTPS request with plain HTTP, and all later requests to it
+type plainHTTPFallback struct {
+	base  http.RoundTripper
+	host  string
+	plain int32
+}
+
+func (t *plainHTTPFallback) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "https" || req.URL.Host != t.host {
+		return t.base.RoundTrip(req)
+	}
+	if atomic.LoadInt32(&t.plain) == 1 {
+		return t.base.RoundTrip(plainHTTP(req))
+	}
+
+	res, err := t.base.RoundTrip(req)
+	if err == nil || !isPlainHTTPResponse(err) {
+		return res, err
+	}
+	if req.Body != nil && req.GetBody == nil {
+		return nil, err
+	}
+
+	log.WithField("host", req.URL.Host).Warn("registry does not support TLS, falling back to plain HTTP")
+	atomic.StoreInt32(&t.plain, 1)
+	retry := plainHTTP(req)
+	if req.GetBody != nil {
+		body, gerr := req.GetBody()
+		if gerr != nil {
+			return nil, err
+		}
+		retry.Body = body
+	}
+	return t.base.RoundTrip(retry)
+}
+
+// isPlainHTTPResponse returns true if the TLS handshake failed because the
+// server answered with plain HTTP. Like http.Client it closes the connection
+// the error holds.
+func isPlainHTTPResponse(err error) bool {
+	var rerr tls.RecordHeaderError
+	if !errors.As(err, &rerr) {
+		return false
+	}
+	if rerr.Conn != nil {
+		rerr.Conn.Close()
+	}
+	return string(rerr.RecordHeader[:]) == "HTTP/"
+}
+
+// plainHTTP returns a copy of req sent with the http scheme
+func plainHTTP(req *http.Request) *http.Request {
+	clone := req.Clone(req.Context())
+	clone.URL.Scheme = "http"
+	return clone
+}
@@ -0,0 +1,95 @@
+package registry
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithInsecurePlainHTTP(t *testing.T) {
+	var manifest string
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/v2/library/test/manifests/latest":
+			body, _ := ioutil.ReadAll(r.Body)
+			manifest = string(body)
+			w.WriteHeader(http.StatusCreated)
+		case r.URL.Path == "/v2/library/test/tags/list":
+			w.Write([]byte(`{"name":"library/test","tags":["latest"]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	host := srv.Listener.Addr().String()
+
+	if _, err := NewClient(host).ListTags("library/test"); err == nil {
+		t.Error("ListTags() over plain HTTP succeeded without WithInsecure")
+	}
+	if _, err := NewClient("https://"+host, WithInsecure(true)).ListTags("library/test"); err == nil {
+		t.Error("ListTags() fell back to plain HTTP although the host has an https scheme")
+	}
+	if requests != 0 {
+		t.Fatalf("registry got %d requests over plain HTTP, want none", requests)
+	}
+
+	c := NewClient(host, WithInsecure(true))
+	// the first request falls back with its body
+	raw := `{"schemaVersion":2}`
+	if _, err := c.PutManifest("library/test", "latest", []byte(raw), "application/vnd.oci.image.manifest.v1+json"); err != nil {
+		t.Fatal(err)
+	}
+	if manifest != raw {
+		t.Errorf("registry got manifest %q, want %q", manifest, raw)
+	}
+	tags, err := c.ListTags("library/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 1 || tags[0] != "latest" || requests != 2 {
+		t.Errorf("ListTags() = %v after %d requests, want [latest] after 2", tags, requests)
+	}
+
+	// an explicit http scheme needs no insecure mode
+	if _, err := NewClient("http://" + host).ListTags("library/test"); err != nil {
+		t.Errorf("ListTags() with an http scheme = %v", err)
+	}
+}
+
+func TestWithInsecureSelfSigned(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name":"library/test","tags":["latest"]}`))
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "https://")
+
+	if _, err := NewClient(host).ListTags("library/test"); err == nil {
+		t.Error("ListTags() trusted a self-signed certificate without WithInsecure")
+	}
+	for _, h := range []string{host, srv.URL} {
+		if _, err := NewClient(h, WithInsecure(true)).ListTags("library/test"); err != nil {
+			t.Errorf("ListTags(%s) with WithInsecure = %v", h, err)
+		}
+	}
+	if _, err := NewClient(host, WithInsecure(false)).ListTags("library/test"); err == nil {
+		t.Error("ListTags() trusted a self-signed certificate with WithInsecure(false)")
+	}
+}
+
+func TestWithInsecureKeepsTLSConfig(t *testing.T) {
+	cfg := &tls.Config{ServerName: "registry.example.com", MinVersion: tls.VersionTLS12}
+	c := NewClient("registry.example.com", WithTLSConfig(cfg), WithInsecure(true))
+
+	got := c.transport.TLSClientConfig
+	if !got.InsecureSkipVerify || got.ServerName != cfg.ServerName || got.MinVersion != cfg.MinVersion {
+		t.Errorf("TLS config = %+v, want %+v skipping verification", got, cfg)
+	}
+	if cfg.InsecureSkipVerify {
+		t.Error("WithInsecure() changed the config passed to WithTLSConfig")
+	}
+}
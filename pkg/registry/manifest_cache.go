@@ -0,0 +1,112 @@
+package registry
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// CachedManifest is a manifest response stored by a ManifestCache
+type CachedManifest struct {
+	ETag      string `json:"etag"`
+	MediaType string `json:"mediaType"`
+	Data      []byte `json:"data"`
+}
+
+// ManifestCache stores manifests and their ETags keyed by reference and the
+// accepted media types so unchanged manifests are revalidated with a conditional GET
+type ManifestCache interface {
+	Get(ref string) (CachedManifest, bool)
+	Put(ref string, m CachedManifest) error
+}
+
+// WithManifestCache sets the cache manifest requests are revalidated against
+func WithManifestCache(cache ManifestCache) ClientOption {
+	return func(c *Client) {
+		c.manifests = cache
+	}
+}
+
+// MemoryManifestCache is a ManifestCache kept in memory
+type MemoryManifestCache struct {
+	mu        sync.RWMutex
+	manifests map[string]CachedManifest
+}
+
+// NewMemoryManifestCache creates an empty in-memory manifest cache
+func NewMemoryManifestCache() *MemoryManifestCache {
+	return &MemoryManifestCache{manifests: make(map[string]CachedManifest)}
+}
+
+// Get returns the manifest cached for ref
+func (mc *MemoryManifestCache) Get(ref string) (CachedManifest, bool) {
+	mc.mu.RLock()
+	defer mc.mu.RUnlock()
+	m, ok := mc.manifests[ref]
+	return m, ok
+}
+
+// Put caches the manifest of ref
+func (mc *MemoryManifestCache) Put(ref string, m CachedManifest) error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.manifests[ref] = m
+	return nil
+}
+
+// DiskManifestCache is a ManifestCache storing one json file per reference
+type DiskManifestCache struct {
+	root string
+}
+
+// NewDiskManifestCache creates a manifest cache rooted at dir
+func NewDiskManifestCache(dir string) (*DiskManifestCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &DiskManifestCache{root: dir}, nil
+}
+
+// path names the file after the digest of ref since refs contain slashes and colons
+func (dc *DiskManifestCache) path(ref string) string {
+	return filepath.Join(dc.root, digest.FromString(ref).Hex()+".json")
+}
+
+// Get returns the manifest cached for ref
+func (dc *DiskManifestCache) Get(ref string) (CachedManifest, bool) {
+	var m CachedManifest
+	raw, err := ioutil.ReadFile(dc.path(ref))
+	if err != nil {
+		return m, false
+	}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return m, false
+	}
+	return m, true
+}
+
+// Put caches the manifest of ref. The file is renamed into place so readers never see partial entries.
+func (dc *DiskManifestCache) Put(ref string, m CachedManifest) error {
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dc.root, "manifest.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dc.path(ref))
+}
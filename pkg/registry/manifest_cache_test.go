@@ -0,0 +1,142 @@
+package registry
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/blacktop/graboid/pkg/image"
+)
+
+// manifestServer serves an index or a manifest for library/test:latest
+// depending on the Accept header. Both share the ETag of the tag like
+// registries that tag the stored document return.
+type manifestServer struct {
+	mu          sync.Mutex
+	requests    int
+	ifNoneMatch []string
+}
+
+const (
+	testIndex    = `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[]}`
+	testManifest = `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","layers":[]}`
+	testETag     = `"sha256:tag"`
+)
+
+func (ms *manifestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v2/library/test/manifests/latest" {
+		http.NotFound(w, r)
+		return
+	}
+	ms.mu.Lock()
+	ms.requests++
+	ms.ifNoneMatch = append(ms.ifNoneMatch, r.Header.Get("If-None-Match"))
+	ms.mu.Unlock()
+
+	w.Header().Set("ETag", testETag)
+	if r.Header.Get("If-None-Match") == testETag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if strings.Contains(r.Header.Get("Accept"), image.MediaTypeOCIIndex) {
+		w.Header().Set("Content-Type", image.MediaTypeOCIIndex)
+		w.Write([]byte(testIndex))
+		return
+	}
+	w.Header().Set("Content-Type", image.MediaTypeOCIManifest)
+	w.Write([]byte(testManifest))
+}
+
+func manifestCaches(t *testing.T) (map[string]ManifestCache, func()) {
+	dir, err := ioutil.TempDir("", "graboid-manifests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	disk, err := NewDiskManifestCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]ManifestCache{
+		"memory": NewMemoryManifestCache(),
+		"disk":   disk,
+	}, func() { os.RemoveAll(dir) }
+}
+
+func TestManifestCacheConditionalGet(t *testing.T) {
+	caches, cleanup := manifestCaches(t)
+	defer cleanup()
+
+	for name, cache := range caches {
+		t.Run(name, func(t *testing.T) {
+			ms := &manifestServer{}
+			srv := httptest.NewServer(ms)
+			defer srv.Close()
+			c := NewClient(srv.URL, WithManifestCache(cache))
+
+			for i := 0; i < 2; i++ {
+				raw, mediaType, err := c.GetRawManifest("library/test:latest")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(raw) != testManifest || mediaType != image.MediaTypeOCIManifest {
+					t.Errorf("request %d = %s (%s)", i, raw, mediaType)
+				}
+			}
+			if ms.requests != 2 {
+				t.Fatalf("server got %d requests, want 2", ms.requests)
+			}
+			if ms.ifNoneMatch[0] != "" || ms.ifNoneMatch[1] != testETag {
+				t.Errorf("If-None-Match = %q, want none then %s", ms.ifNoneMatch, testETag)
+			}
+		})
+	}
+}
+
+func TestManifestCacheKeyedByAccept(t *testing.T) {
+	caches, cleanup := manifestCaches(t)
+	defer cleanup()
+
+	for name, cache := range caches {
+		t.Run(name, func(t *testing.T) {
+			ms := &manifestServer{}
+			srv := httptest.NewServer(ms)
+			defer srv.Close()
+			c := NewClient(srv.URL, WithManifestCache(cache))
+
+			raw, mediaType, err := c.GetRawManifestOrIndex("library/test:latest")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(raw) != testIndex || mediaType != image.MediaTypeOCIIndex {
+				t.Fatalf("GetRawManifestOrIndex() = %s (%s)", raw, mediaType)
+			}
+
+			// the cached index must not answer a request that does not accept indexes
+			raw, mediaType, err = c.GetRawManifest("library/test:latest")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(raw) != testManifest || mediaType != image.MediaTypeOCIManifest {
+				t.Errorf("GetRawManifest() = %s (%s), want the manifest", raw, mediaType)
+			}
+			if ms.ifNoneMatch[1] != "" {
+				t.Errorf("GetRawManifest() revalidated the index: If-None-Match %q", ms.ifNoneMatch[1])
+			}
+
+			raw, _, err = c.GetRawManifestOrIndex("library/test:latest")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(raw) != testIndex {
+				t.Errorf("cached GetRawManifestOrIndex() = %s", raw)
+			}
+			if ms.ifNoneMatch[2] != testETag {
+				t.Errorf("GetRawManifestOrIndex() did not revalidate: If-None-Match %q", ms.ifNoneMatch[2])
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package registry
+
+import (
+	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultMaxIdleConns        = 100
+	defaultMaxIdleConnsPerHost = 10
+	defaultIdleConnTimeout     = 90 * time.Second
+)
+
+// ConnectionStats counts the requests sent by a Client and the connections they used
+type ConnectionStats struct {
+	ConnectionsReused int
+	ConnectionsNew    int
+	TotalRequests     int
+}
+
+// WithConnectionPool sets how many idle connections are kept open in total
+// and per registry host and how long they are kept.
+// It has no effect on clients set with WithHTTPClient.
+func WithConnectionPool(maxIdle, maxIdlePerHost int, idleTimeout time.Duration) ClientOption {
+	return func(c *Client) {
+		c.transport.MaxIdleConns = maxIdle
+		c.transport.MaxIdleConnsPerHost = maxIdlePerHost
+		c.transport.IdleConnTimeout = idleTimeout
+	}
+}
+
+// Stats returns the connection stats of every request the client sent, retries included
+func (c *Client) Stats() ConnectionStats {
+	return ConnectionStats{
+		ConnectionsReused: int(atomic.LoadInt64(&c.stats.reused)),
+		ConnectionsNew:    int(atomic.LoadInt64(&c.stats.created)),
+		TotalRequests:     int(atomic.LoadInt64(&c.stats.requests)),
+	}
+}
+
+type connStats struct {
+	reused   int64
+	created  int64
+	requests int64
+}
+
+// statsTransport counts the requests and whether their connection was reused
+type statsTransport struct {
+	base  http.RoundTripper
+	stats *connStats
+}
+
+func (t *statsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt64(&t.stats.requests, 1)
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				atomic.AddInt64(&t.stats.reused, 1)
+			} else {
+				atomic.AddInt64(&t.stats.created, 1)
+			}
+		},
+	}
+	return t.base.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+}
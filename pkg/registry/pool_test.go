@@ -0,0 +1,123 @@
+package registry
+
+import (
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// poolBlob is the blob served by blobServer
+var poolBlob = strings.Repeat("graboid", 1024)
+
+// blobServer is a TLS registry serving the same blob for every digest, it
+// fails requests asking for a compressed transfer
+func blobServer(tb testing.TB) *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v2/library/test/blobs/") {
+			http.NotFound(w, r)
+			return
+		}
+		if enc := r.Header.Get("Accept-Encoding"); enc != "" {
+			tb.Errorf("request accepts %s encoding, blobs are already compressed", enc)
+		}
+		io.WriteString(w, poolBlob)
+	}))
+}
+
+// getBlobs downloads n blobs one after the other
+func getBlobs(tb testing.TB, c *Client, n int) {
+	tb.Helper()
+	for i := 0; i < n; i++ {
+		rc, err := c.GetBlob("library/test", digest.FromString(poolBlob).String())
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if _, err := io.Copy(ioutil.Discard, rc); err != nil {
+			tb.Fatal(err)
+		}
+		rc.Close()
+	}
+}
+
+// unpooledClient creates a client opening a new connection for every request
+func unpooledClient(srv *httptest.Server) *Client {
+	return NewClient(srv.URL, WithHTTPClient(&http.Client{Transport: &http.Transport{
+		DisableKeepAlives:  true,
+		DisableCompression: true,
+		TLSClientConfig:    &tls.Config{RootCAs: certPool(srv)},
+	}}))
+}
+
+func TestClientStats(t *testing.T) {
+	srv := blobServer(t)
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		client *Client
+		want   ConnectionStats
+	}{
+		{
+			name:   "pooled",
+			client: NewClient(srv.URL, WithTLSConfig(&tls.Config{RootCAs: certPool(srv)})),
+			want:   ConnectionStats{ConnectionsReused: 9, ConnectionsNew: 1, TotalRequests: 10},
+		},
+		{
+			name:   "unpooled",
+			client: unpooledClient(srv),
+			want:   ConnectionStats{ConnectionsReused: 0, ConnectionsNew: 10, TotalRequests: 10},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.client.Stats(); got != (ConnectionStats{}) {
+				t.Errorf("Stats() of a new client = %+v", got)
+			}
+			getBlobs(t, tt.client, 10)
+			if got := tt.client.Stats(); got != tt.want {
+				t.Errorf("Stats() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithConnectionPool(t *testing.T) {
+	c := NewClient("registry.example.com")
+	if c.transport.MaxIdleConns != defaultMaxIdleConns || c.transport.MaxIdleConnsPerHost != defaultMaxIdleConnsPerHost ||
+		c.transport.IdleConnTimeout != defaultIdleConnTimeout || !c.transport.DisableCompression {
+		t.Errorf("default transport = %+v", c.transport)
+	}
+
+	c = NewClient("registry.example.com", WithConnectionPool(20, 4, time.Minute))
+	if c.transport.MaxIdleConns != 20 || c.transport.MaxIdleConnsPerHost != 4 || c.transport.IdleConnTimeout != time.Minute {
+		t.Errorf("WithConnectionPool() transport = %+v", c.transport)
+	}
+}
+
+func benchmarkGetBlobs(b *testing.B, newClient func(*httptest.Server) *Client) {
+	srv := blobServer(b)
+	defer srv.Close()
+	c := newClient(srv)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		getBlobs(b, c, 50)
+	}
+}
+
+func BenchmarkGetBlobsPooled(b *testing.B) {
+	benchmarkGetBlobs(b, func(srv *httptest.Server) *Client {
+		return NewClient(srv.URL, WithTLSConfig(&tls.Config{RootCAs: certPool(srv)}))
+	})
+}
+
+func BenchmarkGetBlobsUnpooled(b *testing.B) {
+	benchmarkGetBlobs(b, unpooledClient)
+}
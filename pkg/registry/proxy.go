@@ -0,0 +1,88 @@
+package registry
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// WithProxy sends all registry requests through the HTTP proxy at proxyURL.
+// HTTPS requests are tunneled through the proxy with CONNECT.
+// It has no effect on clients set with WithHTTPClient.
+func WithProxy(proxyURL *url.URL) ClientOption {
+	return func(c *Client) {
+		c.transport.Proxy = http.ProxyURL(proxyURL)
+	}
+}
+
+// WithEnvProxy picks the proxy from the HTTPS_PROXY, HTTP_PROXY and NO_PROXY
+// environment variables (or their lowercase forms) for every request, unlike
+// the default which reads them once per process.
+// It has no effect on clients set with WithHTTPClient.
+func WithEnvProxy() ClientOption {
+	return func(c *Client) {
+		c.transport.Proxy = envProxy
+	}
+}
+
+// envProxy returns the proxy the environment configures for req
+func envProxy(req *http.Request) (*url.URL, error) {
+	proxy := getenv("HTTP_PROXY")
+	if req.URL.Scheme == "https" {
+		proxy = getenv("HTTPS_PROXY")
+	}
+	if proxy == "" || noProxy(req.URL.Hostname(), getenv("NO_PROXY")) {
+		return nil, nil
+	}
+
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+	return url.Parse(proxy)
+}
+
+func getenv(key string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return os.Getenv(strings.ToLower(key))
+}
+
+// noProxy returns true if host matches the comma separated NO_PROXY list of
+// hosts, domain suffixes, IPs and CIDRs. "*" matches every host.
+func noProxy(host, list string) bool {
+	host = strings.ToLower(host)
+	ip := net.ParseIP(host)
+
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if entry == "*" {
+			return true
+		}
+		if _, cidr, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && cidr.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if h, _, err := net.SplitHostPort(entry); err == nil {
+			entry = h
+		}
+		if ip != nil {
+			if other := net.ParseIP(entry); other != nil && other.Equal(ip) {
+				return true
+			}
+			continue
+		}
+		entry = strings.TrimPrefix(entry, "*")
+		if host == strings.TrimPrefix(entry, ".") || strings.HasSuffix(host, "."+strings.TrimPrefix(entry, ".")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,213 @@
+package registry
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// connectProxy is an HTTP proxy tunneling CONNECT requests and forwarding
+// plain HTTP requests, it records the hosts it was asked to reach
+type connectProxy struct {
+	t   *testing.T
+	srv *httptest.Server
+
+	mu       sync.Mutex
+	tunnels  []string
+	forwards []string
+}
+
+func newConnectProxy(t *testing.T) *connectProxy {
+	p := &connectProxy{t: t}
+	p.srv = httptest.NewServer(http.HandlerFunc(p.serve))
+	return p
+}
+
+func (p *connectProxy) URL() *url.URL {
+	u, _ := url.Parse(p.srv.URL)
+	return u
+}
+
+func (p *connectProxy) serve(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	if r.Method == http.MethodConnect {
+		p.tunnels = append(p.tunnels, r.Host)
+	} else {
+		p.forwards = append(p.forwards, r.URL.Host)
+	}
+	p.mu.Unlock()
+
+	if r.Method != http.MethodConnect {
+		// plain HTTP requests carry the absolute URL of the target
+		r.RequestURI = ""
+		res, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer res.Body.Close()
+		for k, v := range res.Header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(res.StatusCode)
+		io.Copy(w, res.Body)
+		return
+	}
+
+	target, err := net.Dial("tcp", r.Host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		target.Close()
+		p.t.Error(err)
+		return
+	}
+	go func() {
+		io.Copy(target, conn)
+		target.Close()
+	}()
+	io.Copy(conn, target)
+	conn.Close()
+}
+
+func (p *connectProxy) hosts() (tunnels, forwards []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.tunnels...), append([]string(nil), p.forwards...)
+}
+
+// tagRegistry serves the tags of library/test and counts the requests
+func tagRegistry(secure bool, requests *int) *httptest.Server {
+	var mu sync.Mutex
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		*requests++
+		mu.Unlock()
+		if r.URL.Path != "/v2/library/test/tags/list" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(tagList{Name: "library/test", Tags: []string{"latest"}})
+	})
+	if secure {
+		return httptest.NewTLSServer(h)
+	}
+	return httptest.NewServer(h)
+}
+
+func TestWithProxy(t *testing.T) {
+	for _, secure := range []bool{true, false} {
+		name := "http"
+		if secure {
+			name = "https connect"
+		}
+		t.Run(name, func(t *testing.T) {
+			var requests int
+			srv := tagRegistry(secure, &requests)
+			defer srv.Close()
+			proxy := newConnectProxy(t)
+			defer proxy.srv.Close()
+
+			opts := []ClientOption{WithProxy(proxy.URL())}
+			if secure {
+				opts = append(opts, WithTLSConfig(&tls.Config{RootCAs: certPool(srv)}))
+			}
+			tags, err := NewClient(srv.URL, opts...).ListTags("library/test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tags, []string{"latest"}) || requests != 1 {
+				t.Errorf("ListTags() = %v with %d registry requests, want [latest] with 1", tags, requests)
+			}
+
+			host := srv.Listener.Addr().String()
+			tunnels, forwards := proxy.hosts()
+			want := []string{host}
+			if secure && (!reflect.DeepEqual(tunnels, want) || len(forwards) != 0) {
+				t.Errorf("proxy tunneled %v and forwarded %v, want a tunnel to %s", tunnels, forwards, host)
+			}
+			if !secure && (!reflect.DeepEqual(forwards, want) || len(tunnels) != 0) {
+				t.Errorf("proxy tunneled %v and forwarded %v, want a forward to %s", tunnels, forwards, host)
+			}
+		})
+	}
+}
+
+func TestWithEnvProxy(t *testing.T) {
+	var requests int
+	srv := tagRegistry(true, &requests)
+	defer srv.Close()
+	proxy := newConnectProxy(t)
+	defer proxy.srv.Close()
+
+	t.Setenv("HTTP_PROXY", "")
+	t.Setenv("http_proxy", "")
+	t.Setenv("NO_PROXY", "")
+	t.Setenv("no_proxy", "")
+	t.Setenv("HTTPS_PROXY", "")
+	t.Setenv("https_proxy", proxy.srv.Listener.Addr().String())
+
+	c := NewClient(srv.URL, WithEnvProxy(), WithTLSConfig(&tls.Config{RootCAs: certPool(srv)}))
+	if _, err := c.ListTags("library/test"); err != nil {
+		t.Fatal(err)
+	}
+	if tunnels, _ := proxy.hosts(); len(tunnels) != 1 {
+		t.Errorf("proxy tunneled %v, want one tunnel", tunnels)
+	}
+
+	// the environment is read for every request
+	t.Setenv("NO_PROXY", "127.0.0.0/8")
+	if _, err := c.ListTags("library/test"); err != nil {
+		t.Fatal(err)
+	}
+	if tunnels, _ := proxy.hosts(); len(tunnels) != 1 || requests != 2 {
+		t.Errorf("proxy tunneled %v with %d registry requests, want the second request to bypass it", tunnels, requests)
+	}
+}
+
+// certPool trusts the certificate of the TLS server srv
+func certPool(srv *httptest.Server) *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	return pool
+}
+
+func TestNoProxy(t *testing.T) {
+	tests := []struct {
+		host string
+		list string
+		want bool
+	}{
+		{host: "registry.example.com", list: "", want: false},
+		{host: "registry.example.com", list: "*", want: true},
+		{host: "registry.example.com", list: "registry.example.com", want: true},
+		{host: "registry.example.com", list: "example.com", want: true},
+		{host: "registry.example.com", list: ".example.com", want: true},
+		{host: "registry.example.com", list: "*.example.com", want: true},
+		{host: "registry.example.com", list: "ample.com", want: false},
+		{host: "Registry.Example.com", list: " other.org , EXAMPLE.com ", want: true},
+		{host: "registry.example.com", list: "registry.example.com:5000", want: true},
+		{host: "10.1.2.3", list: "10.0.0.0/8", want: true},
+		{host: "192.168.1.1", list: "10.0.0.0/8", want: false},
+		{host: "::1", list: "::1", want: true},
+		{host: "10.1.2.3", list: "10.1.2.3:443", want: true},
+		{host: "10.1.2.3", list: "1.2.3", want: false},
+	}
+	for _, tt := range tests {
+		if got := noProxy(tt.host, tt.list); got != tt.want {
+			t.Errorf("noProxy(%q, %q) = %t, want %t", tt.host, tt.list, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	// register sha256 for go-digest
+	_ "crypto/sha256"
+
+	"github.com/apex/log"
+	"github.com/blacktop/graboid/pkg/image"
+	"github.com/blacktop/graboid/pkg/oci"
+	"github.com/opencontainers/go-digest"
+)
+
+// defaultChunkSize is the size above which blobs are uploaded in chunks
+const defaultChunkSize = 32 * 1024 * 1024
+
+var (
+	// ErrBlobUploadInvalid is returned when the registry rejects an uploaded blob
+	ErrBlobUploadInvalid = errors.New("blob upload invalid")
+	// ErrManifestRejected is returned when the registry rejects a pushed manifest
+	ErrManifestRejected = errors.New("manifest rejected")
+)
+
+// WithChunkSize uploads blobs larger than size in chunks of size bytes,
+// a size of 0 always uploads blobs in a single request
+func WithChunkSize(size int64) ClientOption {
+	return func(c *Client) {
+		c.chunkSize = size
+	}
+}
+
+// BlobExists checks with a HEAD request whether repo has the blob d
+func (c *Client) BlobExists(repo string, d digest.Digest) (bool, error) {
+	u := fmt.Sprintf("%s/v2/%s/blobs/%s", c.host, repo, d)
+	log.WithField("url", u).Debug("head blob")
+
+	req, err := http.NewRequest("HEAD", u, nil)
+	if err != nil {
+		return false, err
+	}
+	res, err := c.do(req, repo)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	res.Body.Close()
+
+	return true, nil
+}
+
+// UploadBlob uploads the size bytes of blob d read from r to repo. Blobs
+// larger than the client's chunk size are uploaded in chunks, others in a
+// single request.
+func (c *Client) UploadBlob(repo string, d digest.Digest, r io.Reader, size int64) error {
+	u := fmt.Sprintf("%s/v2/%s/blobs/uploads/", c.host, repo)
+	log.WithFields(log.Fields{
+		"url":    u,
+		"digest": d,
+		"size":   size,
+	}).Debug("start blob upload")
+
+	req, err := http.NewRequest("POST", u, nil)
+	if err != nil {
+		return err
+	}
+	res, err := c.do(req, repo)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+
+	upload, err := uploadLocation(res)
+	if err != nil {
+		return err
+	}
+
+	var body io.Reader = r
+	if c.chunkSize > 0 && size > c.chunkSize {
+		if upload, err = c.uploadChunks(repo, upload, r, size); err != nil {
+			return err
+		}
+		body = nil
+	}
+
+	q := upload.Query()
+	q.Set("digest", d.String())
+	upload.RawQuery = q.Encode()
+
+	req, err = http.NewRequest("PUT", upload.String(), body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.ContentLength = size
+		req.Header.Set("Content-Type", "application/octet-stream")
+		if err := rewindBody(req, r, size); err != nil {
+			return err
+		}
+	}
+	res, err = c.do(req, repo)
+	if isClientError(err) {
+		return fmt.Errorf("%w: blob %s: %v", ErrBlobUploadInvalid, d, err)
+	} else if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	return nil
+}
+
+// uploadChunks PATCHes the blob to the upload session in chunks and returns the location to finish the upload at
+func (c *Client) uploadChunks(repo string, upload *url.URL, r io.Reader, size int64) (*url.URL, error) {
+	for offset := int64(0); offset < size; {
+		n := c.chunkSize
+		if offset+n > size {
+			n = size - offset
+		}
+		log.WithFields(log.Fields{
+			"url":    upload.String(),
+			"offset": offset,
+			"size":   n,
+		}).Debug("upload blob chunk")
+
+		req, err := http.NewRequest("PATCH", upload.String(), io.LimitReader(r, n))
+		if err != nil {
+			return nil, err
+		}
+		req.ContentLength = n
+		req.Header.Set("Content-Type", "application/octet-stream")
+		req.Header.Set("Content-Range", fmt.Sprintf("%d-%d", offset, offset+n-1))
+		if err := rewindBody(req, r, n); err != nil {
+			return nil, err
+		}
+		res, err := c.do(req, repo)
+		if isClientError(err) {
+			return nil, fmt.Errorf("%w: chunk at %d: %v", ErrBlobUploadInvalid, offset, err)
+		} else if err != nil {
+			return nil, err
+		}
+		io.Copy(ioutil.Discard, res.Body)
+		res.Body.Close()
+
+		if upload, err = uploadLocation(res); err != nil {
+			return nil, err
+		}
+		offset += n
+	}
+	return upload, nil
+}
+
+// rewindBody lets req resend the n bytes at the current offset of r after an
+// auth challenge when r is an io.ReadSeeker
+func rewindBody(req *http.Request, r io.Reader, n int64) error {
+	rs, ok := r.(io.ReadSeeker)
+	if !ok {
+		return nil
+	}
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	req.GetBody = func() (io.ReadCloser, error) {
+		if _, err := rs.Seek(start, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(io.LimitReader(rs, n)), nil
+	}
+	return nil
+}
+
+// uploadLocation returns the URL of the upload session from the Location header
+// which may be relative to the request URL
+func uploadLocation(res *http.Response) (*url.URL, error) {
+	location := res.Header.Get("Location")
+	if location == "" {
+		return nil, errors.New("registry did not return an upload location")
+	}
+	return res.Request.URL.Parse(location)
+}
+
+// PutManifest uploads the manifest to repo under reference (a tag or digest) and returns its digest
+func (c *Client) PutManifest(repo, reference string, rawManifest []byte, mediaType string) (digest.Digest, error) {
+	u := fmt.Sprintf("%s/v2/%s/manifests/%s", c.host, repo, reference)
+	log.WithFields(log.Fields{
+		"url":  u,
+		"type": mediaType,
+	}).Debug("put manifest")
+
+	req, err := http.NewRequest("PUT", u, bytes.NewReader(rawManifest))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", mediaType)
+	res, err := c.do(req, repo)
+	if isClientError(err) {
+		return "", fmt.Errorf("%w: %v", ErrManifestRejected, err)
+	} else if err != nil {
+		return "", err
+	}
+	res.Body.Close()
+
+	d := digest.FromBytes(rawManifest)
+	if header := res.Header.Get("Docker-Content-Digest"); header != "" && header != d.String() {
+		return d, fmt.Errorf("registry stored manifest as %s but it hashes to %s", header, d)
+	}
+	return d, nil
+}
+
+// ManifestDigest returns the digest of the manifest repo has under reference using a HEAD request.
+// The returned bool is false when the manifest does not exist.
+func (c *Client) ManifestDigest(repo, reference string) (digest.Digest, bool, error) {
+	u := fmt.Sprintf("%s/v2/%s/manifests/%s", c.host, repo, reference)
+	log.WithField("url", u).Debug("head manifest")
+
+	req, err := http.NewRequest("HEAD", u, nil)
+	if err != nil {
+		return "", false, err
+	}
+	req.Header.Set("Accept", strings.Join(indexAccept, ", "))
+	res, err := c.do(req, repo)
+	if errors.Is(err, ErrNotFound) {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+	res.Body.Close()
+
+	d, err := digest.Parse(res.Header.Get("Docker-Content-Digest"))
+	if err != nil {
+		return "", true, fmt.Errorf("registry returned no valid Docker-Content-Digest: %w", err)
+	}
+	return d, true, nil
+}
+
+// Push uploads the image config and its layer tars (optionally gzipped,
+// ordered from the base layer up) and pushes an OCI manifest for them to ref
+// (repo:tag). Blobs the registry already has are not uploaded again.
+func (c *Client) Push(ref string, img *image.Image, layers []io.Reader) error {
+	repo, tag := splitRef(ref)
+	if img == nil {
+		return image.ErrNoImageConfig
+	}
+	if img.RootFS != nil && len(img.RootFS.DiffIDs) != len(layers) {
+		return fmt.Errorf("image has %d diff_ids but %d layers were given", len(img.RootFS.DiffIDs), len(layers))
+	}
+
+	rawConfig := img.RawJSON()
+	if rawConfig == nil {
+		var err error
+		if rawConfig, err = json.Marshal(img); err != nil {
+			return err
+		}
+	}
+	m := image.OCIManifest{
+		SchemaVersion: 2,
+		MediaType:     image.MediaTypeOCIManifest,
+		Config: image.Descriptor{
+			MediaType: image.MediaTypeOCIConfig,
+			Digest:    digest.FromBytes(rawConfig),
+			Size:      int64(len(rawConfig)),
+		},
+		Layers: []image.Descriptor{},
+	}
+	if err := c.pushBlob(repo, m.Config, bytes.NewReader(rawConfig)); err != nil {
+		return err
+	}
+
+	for idx, layer := range layers {
+		desc, err := c.pushLayer(repo, layer)
+		if err != nil {
+			return fmt.Errorf("failed to push layer %d: %w", idx, err)
+		}
+		m.Layers = append(m.Layers, desc)
+	}
+
+	rawManifest, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = c.PutManifest(repo, tag, rawManifest, m.MediaType)
+	return err
+}
+
+// pushBlob uploads the blob desc describes unless repo already has it
+func (c *Client) pushBlob(repo string, desc image.Descriptor, r io.Reader) error {
+	exists, err := c.BlobExists(repo, desc.Digest)
+	if err != nil {
+		return err
+	}
+	if exists {
+		log.WithField("digest", desc.Digest).Debug("blob already exists")
+		return nil
+	}
+	return c.UploadBlob(repo, desc.Digest, r, desc.Size)
+}
+
+// pushLayer spools the layer to a temp file to learn its digest, size and
+// media type and uploads it
+func (c *Client) pushLayer(repo string, r io.Reader) (image.Descriptor, error) {
+	var desc image.Descriptor
+
+	tmp, err := ioutil.TempFile("", "graboid-push")
+	if err != nil {
+		return desc, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	digester := digest.Canonical.Digester()
+	if desc.Size, err = io.Copy(io.MultiWriter(tmp, digester.Hash()), r); err != nil {
+		return desc, err
+	}
+	desc.Digest = digester.Digest()
+
+	magic := make([]byte, 2)
+	if _, err := tmp.ReadAt(magic, 0); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		desc.MediaType = image.MediaTypeOCILayer
+	} else {
+		desc.MediaType = oci.MediaTypeOCILayerTar
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return desc, err
+	}
+	return desc, c.pushBlob(repo, desc, tmp)
+}
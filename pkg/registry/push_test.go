@@ -0,0 +1,423 @@
+package registry
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/blacktop/graboid/pkg/image"
+	"github.com/blacktop/graboid/pkg/oci"
+	"github.com/opencontainers/go-digest"
+)
+
+// pushRegistry implements the push endpoints of the distribution spec
+type pushRegistry struct {
+	srv *httptest.Server
+
+	mu        sync.Mutex
+	blobs     map[digest.Digest][]byte
+	manifests map[string][]byte // repo:reference
+	types     map[string]string
+	uploads   map[string]*bytes.Buffer
+	requests  []string // method and path of every request
+	ranges    []string // Content-Range of every chunk
+	absolute  bool     // return absolute upload locations
+}
+
+func newPushRegistry() *pushRegistry {
+	r := &pushRegistry{
+		blobs:     make(map[digest.Digest][]byte),
+		manifests: make(map[string][]byte),
+		types:     make(map[string]string),
+		uploads:   make(map[string]*bytes.Buffer),
+	}
+	r.srv = httptest.NewServer(http.HandlerFunc(r.serve))
+	return r
+}
+
+// calls returns the requests made with method
+func (r *pushRegistry) calls(method string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var calls []string
+	for _, req := range r.requests {
+		if strings.HasPrefix(req, method+" ") {
+			calls = append(calls, strings.TrimPrefix(req, method+" "))
+		}
+	}
+	return calls
+}
+
+func (r *pushRegistry) location(repo, id string) string {
+	location := "/v2/" + repo + "/blobs/uploads/" + id
+	if r.absolute {
+		location = r.srv.URL + location
+	}
+	return location
+}
+
+func (r *pushRegistry) fail(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `{"errors":[{"code":%q}]}`, code)
+}
+
+func (r *pushRegistry) serve(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req.Method+" "+req.URL.Path)
+
+	p := strings.TrimPrefix(req.URL.Path, "/v2/")
+	switch {
+	case strings.Contains(p, "/manifests/"):
+		parts := strings.SplitN(p, "/manifests/", 2)
+		key := parts[0] + ":" + parts[1]
+		switch req.Method {
+		case http.MethodPut:
+			raw, _ := ioutil.ReadAll(req.Body)
+			var m image.OCIManifest
+			if err := json.Unmarshal(raw, &m); err != nil {
+				r.fail(w, http.StatusBadRequest, "MANIFEST_INVALID")
+				return
+			}
+			for _, desc := range append([]image.Descriptor{m.Config}, m.Layers...) {
+				if _, ok := r.blobs[desc.Digest]; !ok {
+					r.fail(w, http.StatusBadRequest, "MANIFEST_BLOB_UNKNOWN")
+					return
+				}
+			}
+			d := digest.FromBytes(raw)
+			for _, ref := range []string{parts[1], d.String()} {
+				r.manifests[parts[0]+":"+ref] = raw
+				r.types[parts[0]+":"+ref] = req.Header.Get("Content-Type")
+			}
+			w.Header().Set("Docker-Content-Digest", d.String())
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodHead:
+			raw, ok := r.manifests[key]
+			if !ok {
+				http.NotFound(w, req)
+				return
+			}
+			w.Header().Set("Docker-Content-Digest", digest.FromBytes(raw).String())
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	case strings.Contains(p, "/blobs/uploads/"):
+		parts := strings.SplitN(p, "/blobs/uploads/", 2)
+		repo, id := parts[0], parts[1]
+		if req.Method == http.MethodPost {
+			id = strconv.Itoa(len(r.uploads) + 1)
+			r.uploads[id] = &bytes.Buffer{}
+			w.Header().Set("Location", r.location(repo, id))
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		buf, ok := r.uploads[id]
+		if !ok {
+			r.fail(w, http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN")
+			return
+		}
+		switch req.Method {
+		case http.MethodPatch:
+			rng := req.Header.Get("Content-Range")
+			r.ranges = append(r.ranges, rng)
+			if !strings.HasPrefix(rng, fmt.Sprintf("%d-", buf.Len())) {
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			buf.ReadFrom(req.Body)
+			w.Header().Set("Location", r.location(repo, id))
+			w.WriteHeader(http.StatusAccepted)
+		case http.MethodPut:
+			buf.ReadFrom(req.Body)
+			d := digest.Digest(req.URL.Query().Get("digest"))
+			if digest.FromBytes(buf.Bytes()) != d {
+				r.fail(w, http.StatusBadRequest, "DIGEST_INVALID")
+				return
+			}
+			r.blobs[d] = buf.Bytes()
+			delete(r.uploads, id)
+			w.Header().Set("Docker-Content-Digest", d.String())
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	case strings.Contains(p, "/blobs/"):
+		d := digest.Digest(p[strings.LastIndex(p, "/")+1:])
+		data, ok := r.blobs[d]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		if req.Method == http.MethodGet {
+			w.Write(data)
+		}
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(data)
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestPush(t *testing.T) {
+	for _, absolute := range []bool{false, true} {
+		t.Run(fmt.Sprintf("absolute=%t", absolute), func(t *testing.T) {
+			reg := newPushRegistry()
+			defer reg.srv.Close()
+			reg.absolute = absolute
+
+			layers := [][]byte{gzipBytes(t, []byte("base layer")), []byte("app layer")}
+			img := &image.Image{OS: "linux", Architecture: "amd64", RootFS: &image.ImageRootFS{Type: "layers", DiffIDs: []image.DiffID{
+				image.DiffID(digest.FromString("base layer")),
+				image.DiffID(digest.FromString("app layer")),
+			}}}
+			c := NewClient(reg.srv.URL)
+			if err := c.Push("graboid/app:1.0", img, []io.Reader{bytes.NewReader(layers[0]), bytes.NewReader(layers[1])}); err != nil {
+				t.Fatal(err)
+			}
+
+			raw, ok := reg.manifests["graboid/app:1.0"]
+			if !ok {
+				t.Fatal("manifest was not pushed")
+			}
+			if got := reg.types["graboid/app:1.0"]; got != image.MediaTypeOCIManifest {
+				t.Errorf("manifest pushed as %s", got)
+			}
+			var m image.OCIManifest
+			if err := json.Unmarshal(raw, &m); err != nil {
+				t.Fatal(err)
+			}
+			config, err := json.Marshal(img)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Config.Digest != digest.FromBytes(config) || m.Config.MediaType != image.MediaTypeOCIConfig || !bytes.Equal(reg.blobs[m.Config.Digest], config) {
+				t.Errorf("config pushed as %+v", m.Config)
+			}
+			wantTypes := []string{image.MediaTypeOCILayer, oci.MediaTypeOCILayerTar}
+			for idx, layer := range m.Layers {
+				if layer.Digest != digest.FromBytes(layers[idx]) || layer.Size != int64(len(layers[idx])) || layer.MediaType != wantTypes[idx] {
+					t.Errorf("layer %d pushed as %+v", idx, layer)
+				}
+				if !bytes.Equal(reg.blobs[layer.Digest], layers[idx]) {
+					t.Errorf("layer %d uploaded as %q", idx, reg.blobs[layer.Digest])
+				}
+			}
+			if posts := reg.calls("POST"); len(posts) != 3 {
+				t.Errorf("started %d uploads, want one per blob", len(posts))
+			}
+			if patches := reg.calls("PATCH"); len(patches) != 0 {
+				t.Errorf("small blobs were uploaded in %d chunks", len(patches))
+			}
+
+			// pushing again only checks the blobs exist
+			if err := c.Push("graboid/app:1.1", img, []io.Reader{bytes.NewReader(layers[0]), bytes.NewReader(layers[1])}); err != nil {
+				t.Fatal(err)
+			}
+			if posts := reg.calls("POST"); len(posts) != 3 {
+				t.Errorf("second push started %d more uploads", len(posts)-3)
+			}
+			if !bytes.Equal(reg.manifests["graboid/app:1.1"], raw) {
+				t.Error("second push has another manifest")
+			}
+		})
+	}
+}
+
+func TestPushChunked(t *testing.T) {
+	reg := newPushRegistry()
+	defer reg.srv.Close()
+
+	layer := []byte("0123456789")
+	c := NewClient(reg.srv.URL, WithChunkSize(4))
+	d := digest.FromBytes(layer)
+	if err := c.UploadBlob("graboid/app", d, bytes.NewReader(layer), int64(len(layer))); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(reg.blobs[d], layer) {
+		t.Errorf("chunked blob uploaded as %q", reg.blobs[d])
+	}
+	if want := []string{"0-3", "4-7", "8-9"}; !reflect.DeepEqual(reg.ranges, want) {
+		t.Errorf("chunks uploaded with ranges %q, want %q", reg.ranges, want)
+	}
+	if puts := reg.calls("PUT"); len(puts) != 1 {
+		t.Errorf("upload finished with %d PUTs", len(puts))
+	}
+
+	// blobs of exactly the chunk size are uploaded in a single request
+	small := []byte("abcd")
+	if err := c.UploadBlob("graboid/app", digest.FromBytes(small), bytes.NewReader(small), int64(len(small))); err != nil {
+		t.Fatal(err)
+	}
+	if len(reg.ranges) != 3 {
+		t.Errorf("blob of the chunk size was uploaded in chunks %q", reg.ranges[3:])
+	}
+}
+
+func TestUploadBlobInvalid(t *testing.T) {
+	reg := newPushRegistry()
+	defer reg.srv.Close()
+
+	for _, chunkSize := range []int64{0, 2} {
+		c := NewClient(reg.srv.URL, WithChunkSize(chunkSize))
+		err := c.UploadBlob("graboid/app", digest.FromString("other"), strings.NewReader("blob"), 4)
+		if !errors.Is(err, ErrBlobUploadInvalid) {
+			t.Errorf("chunk size %d: UploadBlob() with the wrong digest = %v, want ErrBlobUploadInvalid", chunkSize, err)
+		}
+	}
+	if len(reg.blobs) != 0 {
+		t.Errorf("registry stored %d invalid blobs", len(reg.blobs))
+	}
+}
+
+func TestUploadBlobNoLocation(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	err := NewClient(srv.URL).UploadBlob("graboid/app", digest.FromString("blob"), strings.NewReader("blob"), 4)
+	if err == nil || !strings.Contains(err.Error(), "upload location") {
+		t.Errorf("UploadBlob() without a Location header = %v", err)
+	}
+}
+
+func TestUploadBlobAuthRetry(t *testing.T) {
+	var mu sync.Mutex
+	var uploaded []byte
+	var challenged int
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.URL.Path == "/token":
+			io.WriteString(w, `{"token": "push-token"}`)
+		case r.Method == "POST":
+			uploaded = nil
+			w.Header().Set("Location", "/upload")
+			w.WriteHeader(http.StatusAccepted)
+		case r.Header.Get("Authorization") != "Bearer push-token":
+			// the registry asks for push access once the upload data arrives
+			io.Copy(ioutil.Discard, r.Body)
+			challenged++
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test-registry",scope="repository:graboid/app:push"`, srv.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+		default:
+			body, _ := ioutil.ReadAll(r.Body)
+			uploaded = append(uploaded, body...)
+			w.Header().Set("Location", "/upload")
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}))
+	defer srv.Close()
+
+	blob := []byte("0123456789")
+	d := digest.FromBytes(blob)
+	for _, chunkSize := range []int64{0, 4} {
+		challenged = 0
+		c := NewClient(srv.URL, WithChunkSize(chunkSize))
+		// a file like seeker that http.NewRequest can't rewind on its own, not
+		// at its start so the retry must seek back to where the blob begins
+		data := append([]byte("skip"), blob...)
+		r := io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data)))
+		r.Seek(4, io.SeekStart)
+		if err := c.UploadBlob("graboid/app", d, r, int64(len(blob))); err != nil {
+			t.Fatalf("chunk size %d: %v", chunkSize, err)
+		}
+		if challenged != 1 || !bytes.Equal(uploaded, blob) {
+			t.Errorf("chunk size %d: uploaded %q after %d challenges, want %q after 1", chunkSize, uploaded, challenged, blob)
+		}
+	}
+
+	// a body that can't be read again fails instead of being resent empty
+	c := NewClient(srv.URL)
+	err := c.UploadBlob("graboid/app", d, struct{ io.Reader }{bytes.NewReader(blob)}, int64(len(blob)))
+	if !errors.Is(err, ErrBodyNotRewindable) {
+		t.Errorf("UploadBlob() of a plain reader after a challenge = %v, want ErrBodyNotRewindable", err)
+	}
+	if len(uploaded) != 0 {
+		t.Errorf("plain reader was resent as %q", uploaded)
+	}
+}
+
+func TestPutManifestRejected(t *testing.T) {
+	reg := newPushRegistry()
+	defer reg.srv.Close()
+	c := NewClient(reg.srv.URL)
+
+	m := image.OCIManifest{SchemaVersion: 2, MediaType: image.MediaTypeOCIManifest, Config: image.Descriptor{Digest: digest.FromString("missing config")}}
+	raw, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.PutManifest("graboid/app", "1.0", raw, m.MediaType); !errors.Is(err, ErrManifestRejected) {
+		t.Errorf("PutManifest() referencing a missing blob = %v, want ErrManifestRejected", err)
+	}
+	if _, err := c.PutManifest("graboid/app", "1.0", []byte("not json"), m.MediaType); !errors.Is(err, ErrManifestRejected) {
+		t.Errorf("PutManifest() of invalid JSON = %v, want ErrManifestRejected", err)
+	}
+	if _, ok, err := c.ManifestDigest("graboid/app", "1.0"); err != nil || ok {
+		t.Errorf("ManifestDigest() of a rejected manifest = %t, %v", ok, err)
+	}
+}
+
+func TestPushManifestDigest(t *testing.T) {
+	reg := newPushRegistry()
+	defer reg.srv.Close()
+	c := NewClient(reg.srv.URL)
+
+	img := &image.Image{OS: "linux", Architecture: "amd64"}
+	if err := c.Push("graboid/app", img, nil); err != nil {
+		t.Fatal(err)
+	}
+	d, ok, err := c.ManifestDigest("graboid/app", "latest")
+	if err != nil || !ok {
+		t.Fatalf("ManifestDigest() = %s, %t, %v", d, ok, err)
+	}
+	if want := digest.FromBytes(reg.manifests["graboid/app:latest"]); d != want {
+		t.Errorf("ManifestDigest() = %s, want %s", d, want)
+	}
+	if exists, err := c.BlobExists("graboid/app", digest.FromString("missing")); err != nil || exists {
+		t.Errorf("BlobExists() of a missing blob = %t, %v", exists, err)
+	}
+}
+
+func TestPushInvalid(t *testing.T) {
+	reg := newPushRegistry()
+	defer reg.srv.Close()
+	c := NewClient(reg.srv.URL)
+
+	if err := c.Push("graboid/app:1.0", nil, nil); !errors.Is(err, image.ErrNoImageConfig) {
+		t.Errorf("Push() without a config = %v, want ErrNoImageConfig", err)
+	}
+	img := &image.Image{RootFS: &image.ImageRootFS{Type: "layers", DiffIDs: []image.DiffID{image.DiffID(digest.FromString("layer"))}}}
+	if err := c.Push("graboid/app:1.0", img, nil); err == nil {
+		t.Error("Push() with fewer layers than diff IDs succeeded")
+	}
+	if len(reg.requests) != 0 {
+		t.Errorf("invalid pushes made requests %q", reg.requests)
+	}
+}
@@ -16,6 +16,8 @@ import (
 	pb "gopkg.in/cheggaaa/pb.v1"
 
 	"github.com/apex/log"
+	blobdigest "github.com/blacktop/graboid/pkg/digest"
+	"github.com/opencontainers/go-digest"
 )
 
 // Config registry config struct
@@ -321,13 +323,19 @@ func (reg *Registry) RepoGetLayers(tempDir, reposName string, manifest *Manifest
 		bar := pb.New(layer.Size).SetUnits(pb.U_BYTES)
 		bar.SetWidth(90)
 		bar.Start()
-		reader := bar.NewProxyReader(res.Body)
+		reader, err := blobdigest.NewVerifyingReader(bar.NewProxyReader(res.Body), digest.Digest(layer.Digest))
+		if err != nil {
+			return nil, err
+		}
 		// Write the body to file
 		_, err = io.Copy(out, reader)
 		if err != nil {
 			log.WithError(err).Error("writing tar file failed")
 		}
 		bar.Finish()
+		if err := reader.Close(); err != nil {
+			return nil, err
+		}
 	}
 
 	return layerFiles, nil
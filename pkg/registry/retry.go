@@ -0,0 +1,176 @@
+package registry
+
+import (
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/apex/log"
+)
+
+const (
+	defaultMaxRetries = 3
+	defaultBaseDelay  = 500 * time.Millisecond
+	defaultMaxDelay   = 30 * time.Second
+)
+
+// RetryOptions configures the backoff of a RetryTransport
+type RetryOptions struct {
+	// MaxRetries is the number of times a request is retried (default 3)
+	MaxRetries int
+	// BaseDelay is the delay before the first retry, doubled for every following one (default 500ms)
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between two attempts (default 30s)
+	MaxDelay time.Duration
+	// Jitter is the fraction (0 to 1) of each delay that is randomized
+	Jitter float64
+}
+
+// RetryTransport retries requests that got a 429 Too Many Requests or a
+// transient 5xx response with exponential backoff, honouring Retry-After
+type RetryTransport struct {
+	Base    http.RoundTripper
+	Options RetryOptions
+
+	// sleep and now are replaced in tests
+	sleep func(time.Duration)
+	now   func() time.Time
+}
+
+// NewRetryTransport wraps base (http.DefaultTransport if nil) in a RetryTransport
+func NewRetryTransport(base http.RoundTripper, opts RetryOptions) *RetryTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if opts.MaxRetries <= 0 {
+		opts.MaxRetries = defaultMaxRetries
+	}
+	if opts.BaseDelay <= 0 {
+		opts.BaseDelay = defaultBaseDelay
+	}
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = defaultMaxDelay
+	}
+	return &RetryTransport{
+		Base:    base,
+		Options: opts,
+		sleep:   time.Sleep,
+		now:     time.Now,
+	}
+}
+
+// WithRetry retries rate limited and failed requests as configured by opts
+func WithRetry(opts RetryOptions) ClientOption {
+	return func(c *Client) {
+		c.retry = &opts
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		res, err := t.Base.RoundTrip(req)
+		if err != nil || !retryable(res.StatusCode) || attempt >= t.Options.MaxRetries {
+			return res, err
+		}
+		// a request body that was already sent can only be replayed if it can be recreated
+		if req.Body != nil && req.GetBody == nil {
+			return res, nil
+		}
+
+		delay := t.backoff(attempt, res.Header.Get("Retry-After"))
+		io.Copy(ioutil.Discard, res.Body)
+		res.Body.Close()
+
+		log.WithFields(log.Fields{
+			"url":     req.URL.String(),
+			"status":  res.Status,
+			"attempt": attempt + 1,
+			"delay":   delay,
+		}).Debug("retrying request")
+
+		if err := t.wait(req, delay); err != nil {
+			return nil, err
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// backoff returns how long to wait before retrying after attempt
+func (t *RetryTransport) backoff(attempt int, retryAfter string) time.Duration {
+	if d, ok := t.parseRetryAfter(retryAfter); ok {
+		if d > t.Options.MaxDelay {
+			return t.Options.MaxDelay
+		}
+		return d
+	}
+
+	delay := t.Options.BaseDelay << uint(attempt)
+	if delay <= 0 || delay > t.Options.MaxDelay {
+		delay = t.Options.MaxDelay
+	}
+	if t.Options.Jitter > 0 {
+		spread := float64(delay) * t.Options.Jitter
+		delay = time.Duration(float64(delay) - spread + rand.Float64()*2*spread)
+		if delay > t.Options.MaxDelay {
+			delay = t.Options.MaxDelay
+		}
+	}
+	return delay
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date
+func (t *RetryTransport) parseRetryAfter(header string) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(header); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if when, err := http.ParseTime(header); err == nil {
+		d := when.Sub(t.now())
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// wait sleeps for delay unless the request is cancelled first
+func (t *RetryTransport) wait(req *http.Request, delay time.Duration) error {
+	done := make(chan struct{})
+	go func() {
+		t.sleep(delay)
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-req.Context().Done():
+		return req.Context().Err()
+	}
+}
+
+// retryable reports whether a response with status code is worth retrying
+func retryable(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
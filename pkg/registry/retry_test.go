@@ -0,0 +1,290 @@
+package registry
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock records the delays a RetryTransport sleeps for without sleeping
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func (c *fakeClock) sleep(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sleeps = append(c.sleeps, d)
+	c.now = c.now.Add(d)
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) delays() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]time.Duration(nil), c.sleeps...)
+}
+
+// flakyServer fails the first failures requests with status and then succeeds
+type flakyServer struct {
+	srv        *httptest.Server
+	failures   int
+	status     int
+	retryAfter string
+
+	mu     sync.Mutex
+	bodies []string
+}
+
+func newFlakyServer(failures, status int) *flakyServer {
+	fs := &flakyServer{failures: failures, status: status}
+	fs.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		fs.mu.Lock()
+		fs.bodies = append(fs.bodies, string(body))
+		attempt := len(fs.bodies)
+		fs.mu.Unlock()
+		if attempt <= fs.failures {
+			if fs.retryAfter != "" {
+				w.Header().Set("Retry-After", fs.retryAfter)
+			}
+			w.WriteHeader(fs.status)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	return fs
+}
+
+func (fs *flakyServer) attempts() int {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return len(fs.bodies)
+}
+
+func newTestRetryTransport(opts RetryOptions) (*RetryTransport, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	rt := NewRetryTransport(nil, opts)
+	rt.sleep = clock.sleep
+	rt.now = clock.Now
+	return rt, clock
+}
+
+func delaysEqual(a, b []time.Duration) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx := range a {
+		if a[idx] != b[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name       string
+		failures   int
+		status     int
+		retryAfter string
+		opts       RetryOptions
+		wantStatus int
+		attempts   int
+		delays     []time.Duration
+	}{
+		{name: "success", status: http.StatusTooManyRequests, wantStatus: 200, attempts: 1},
+		{
+			name: "429 then success", failures: 2, status: http.StatusTooManyRequests,
+			opts:       RetryOptions{BaseDelay: 100 * time.Millisecond},
+			wantStatus: 200, attempts: 3, delays: []time.Duration{100 * time.Millisecond, 200 * time.Millisecond},
+		},
+		{
+			name: "exponential backoff capped", failures: 4, status: http.StatusServiceUnavailable,
+			opts:       RetryOptions{MaxRetries: 5, BaseDelay: time.Second, MaxDelay: 5 * time.Second},
+			wantStatus: 200, attempts: 5, delays: []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second},
+		},
+		{
+			name: "retries exhausted", failures: 10, status: http.StatusTooManyRequests,
+			opts:       RetryOptions{MaxRetries: 2, BaseDelay: time.Second},
+			wantStatus: http.StatusTooManyRequests, attempts: 3, delays: []time.Duration{time.Second, 2 * time.Second},
+		},
+		{
+			name: "default options", failures: 10, status: http.StatusBadGateway,
+			wantStatus: http.StatusBadGateway, attempts: 4, delays: []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second},
+		},
+		{
+			name: "retry after seconds", failures: 1, status: http.StatusTooManyRequests, retryAfter: "7",
+			wantStatus: 200, attempts: 2, delays: []time.Duration{7 * time.Second},
+		},
+		{
+			name: "retry after capped", failures: 1, status: http.StatusTooManyRequests, retryAfter: "3600",
+			opts:       RetryOptions{MaxDelay: time.Minute},
+			wantStatus: 200, attempts: 2, delays: []time.Duration{time.Minute},
+		},
+		{
+			name: "retry after date", failures: 1, status: http.StatusServiceUnavailable, retryAfter: "Tue, 02 Jan 2024 03:04:17 GMT",
+			wantStatus: 200, attempts: 2, delays: []time.Duration{12 * time.Second},
+		},
+		{
+			name: "retry after date in the past", failures: 1, status: http.StatusServiceUnavailable, retryAfter: "Mon, 01 Jan 2024 00:00:00 GMT",
+			wantStatus: 200, attempts: 2, delays: []time.Duration{0},
+		},
+		{
+			name: "invalid retry after", failures: 1, status: http.StatusTooManyRequests, retryAfter: "soon",
+			opts:       RetryOptions{BaseDelay: time.Second},
+			wantStatus: 200, attempts: 2, delays: []time.Duration{time.Second},
+		},
+		{name: "not found is not retried", failures: 1, status: http.StatusNotFound, wantStatus: http.StatusNotFound, attempts: 1},
+		{name: "not implemented is not retried", failures: 1, status: http.StatusNotImplemented, wantStatus: http.StatusNotImplemented, attempts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := newFlakyServer(tt.failures, tt.status)
+			defer fs.srv.Close()
+			fs.retryAfter = tt.retryAfter
+			rt, clock := newTestRetryTransport(tt.opts)
+
+			res, err := (&http.Client{Transport: rt}).Get(fs.srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			if res.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", res.StatusCode, tt.wantStatus)
+			}
+			if fs.attempts() != tt.attempts {
+				t.Errorf("got %d attempts, want %d", fs.attempts(), tt.attempts)
+			}
+			if delays := clock.delays(); !delaysEqual(delays, tt.delays) {
+				t.Errorf("delays = %v, want %v", delays, tt.delays)
+			}
+		})
+	}
+}
+
+func TestRetryTransportJitter(t *testing.T) {
+	rt, _ := newTestRetryTransport(RetryOptions{BaseDelay: time.Second, MaxDelay: 3 * time.Second, Jitter: 0.5})
+	for attempt := 0; attempt < 3; attempt++ {
+		base := time.Second << uint(attempt)
+		if base > 3*time.Second {
+			base = 3 * time.Second
+		}
+		for i := 0; i < 100; i++ {
+			d := rt.backoff(attempt, "")
+			if d < base/2 || d > base+base/2 || d > 3*time.Second {
+				t.Fatalf("backoff(%d) = %v, want %v ± 50%% and at most 3s", attempt, d, base)
+			}
+		}
+	}
+}
+
+func TestRetryTransportBody(t *testing.T) {
+	fs := newFlakyServer(2, http.StatusInternalServerError)
+	defer fs.srv.Close()
+	rt, _ := newTestRetryTransport(RetryOptions{})
+
+	// http.NewRequest sets GetBody for a strings.Reader so the body is replayed
+	req, err := http.NewRequest("PUT", fs.srv.URL, strings.NewReader("manifest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != 200 || strings.Join(fs.bodies, ",") != "manifest,manifest,manifest" {
+		t.Errorf("status %d, bodies %q", res.StatusCode, fs.bodies)
+	}
+
+	// a body that can't be recreated is only sent once
+	fs = newFlakyServer(2, http.StatusInternalServerError)
+	defer fs.srv.Close()
+	req, err = http.NewRequest("PUT", fs.srv.URL, ioutil.NopCloser(strings.NewReader("stream")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err = rt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusInternalServerError || fs.attempts() != 1 {
+		t.Errorf("status %d after %d attempts, want a single attempt", res.StatusCode, fs.attempts())
+	}
+}
+
+func TestRetryTransportCancel(t *testing.T) {
+	fs := newFlakyServer(10, http.StatusTooManyRequests)
+	defer fs.srv.Close()
+	rt := NewRetryTransport(nil, RetryOptions{BaseDelay: time.Hour})
+	block := make(chan struct{})
+	defer close(block)
+	rt.sleep = func(time.Duration) { <-block }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequest("GET", fs.srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for fs.attempts() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+	if _, err := rt.RoundTrip(req.WithContext(ctx)); err != context.Canceled {
+		t.Errorf("RoundTrip() = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestClientWithRetry(t *testing.T) {
+	reg := newTokenRegistry()
+	defer reg.srv.Close()
+
+	// rate limit requests before they reach the registry
+	var mu sync.Mutex
+	limited := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		limit := limited > 0
+		if limit {
+			limited--
+		}
+		mu.Unlock()
+		if limit {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		reg.serve(w, r)
+	}))
+	defer srv.Close()
+
+	limited = 2
+	c := NewClient(srv.URL, WithCredentials("user", "secret"), WithRetry(RetryOptions{MaxRetries: 2}))
+	if _, err := c.GetManifest("library/test:latest"); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	limited = 1
+	mu.Unlock()
+	c = NewClient(srv.URL, WithCredentials("user", "secret"))
+	if _, err := c.GetManifest("library/test:latest"); err == nil {
+		t.Error("GetManifest() without retries succeeded after a 429")
+	}
+}
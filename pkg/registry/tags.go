@@ -0,0 +1,101 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/apex/log"
+)
+
+// ListTagsOptions configures ListTagsWithOptions
+type ListTagsOptions struct {
+	// Filter keeps only the tags it matches
+	Filter *regexp.Regexp
+	// MaxResults keeps only the first that many of the sorted tags (0 means no limit)
+	MaxResults int
+}
+
+type tagList struct {
+	Name string   `json:"name"`
+	Tags []string `json:"tags"`
+}
+
+// ListTags returns the sorted tags of repo
+func (c *Client) ListTags(repo string) ([]string, error) {
+	return c.ListTagsWithOptions(repo, ListTagsOptions{})
+}
+
+// ListTagsWithOptions returns the sorted tags of repo following the registry's pagination
+func (c *Client) ListTagsWithOptions(repo string, opts ListTagsOptions) ([]string, error) {
+	var tags []string
+
+	u := fmt.Sprintf("%s/v2/%s/tags/list", c.host, repo)
+	for u != "" {
+		log.WithField("url", u).Debug("list tags")
+
+		req, err := http.NewRequest("GET", u, nil)
+		if err != nil {
+			return nil, err
+		}
+		res, err := c.do(req, repo)
+		if err != nil {
+			return nil, err
+		}
+
+		var page tagList
+		err = json.NewDecoder(res.Body).Decode(&page)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tag := range page.Tags {
+			if opts.Filter == nil || opts.Filter.MatchString(tag) {
+				tags = append(tags, tag)
+			}
+		}
+
+		if u, err = nextLink(u, res.Header.Get("Link")); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(tags)
+	if opts.MaxResults > 0 && len(tags) > opts.MaxResults {
+		tags = tags[:opts.MaxResults]
+	}
+
+	return tags, nil
+}
+
+// nextLink returns the absolute URL of the rel="next" entry of a Link header (RFC 5988) or "" if there is none
+func nextLink(current, header string) (string, error) {
+	for _, link := range strings.Split(header, ",") {
+		parts := strings.Split(link, ";")
+		target := strings.TrimSpace(parts[0])
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+		for _, param := range parts[1:] {
+			param = strings.Replace(strings.TrimSpace(param), " ", "", -1)
+			if param != `rel="next"` && param != "rel=next" {
+				continue
+			}
+			base, err := url.Parse(current)
+			if err != nil {
+				return "", err
+			}
+			next, err := base.Parse(strings.Trim(target, "<>"))
+			if err != nil {
+				return "", err
+			}
+			return next.String(), nil
+		}
+	}
+	return "", nil
+}
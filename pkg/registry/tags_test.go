@@ -0,0 +1,72 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+// tagServer serves the tags of library/test two per page in registry order
+func tagServer(t *testing.T, tags []string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/library/test/tags/list" {
+			http.NotFound(w, r)
+			return
+		}
+		start, _ := strconv.Atoi(r.URL.Query().Get("last"))
+		end := start + 2
+		if end < len(tags) {
+			w.Header().Set("Link", fmt.Sprintf(`</v2/library/test/tags/list?n=2&last=%d>; rel="next"`, end))
+		} else {
+			end = len(tags)
+		}
+		json.NewEncoder(w).Encode(tagList{Name: "library/test", Tags: tags[start:end]})
+	}))
+}
+
+func TestListTags(t *testing.T) {
+	srv := tagServer(t, []string{"latest", "3.9", "3.18", "edge", "3.10"})
+	defer srv.Close()
+	c := NewClient(srv.URL)
+
+	tests := []struct {
+		name string
+		opts ListTagsOptions
+		want []string
+	}{
+		{name: "all pages", want: []string{"3.10", "3.18", "3.9", "edge", "latest"}},
+		{name: "filter", opts: ListTagsOptions{Filter: regexp.MustCompile(`^3\.`)}, want: []string{"3.10", "3.18", "3.9"}},
+		// the first tags of the sorted list, not of the first page
+		{name: "max results", opts: ListTagsOptions{MaxResults: 2}, want: []string{"3.10", "3.18"}},
+		{name: "max results above count", opts: ListTagsOptions{MaxResults: 10}, want: []string{"3.10", "3.18", "3.9", "edge", "latest"}},
+		{name: "filter and max results", opts: ListTagsOptions{Filter: regexp.MustCompile(`^[a-z]`), MaxResults: 1}, want: []string{"edge"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.ListTagsWithOptions("library/test", tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ListTagsWithOptions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListTagsUnauthorized(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	if _, err := NewClient(srv.URL).ListTags("library/test"); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("ListTags() error = %v, want ErrUnauthorized", err)
+	}
+}
@@ -0,0 +1,260 @@
+package sbom
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/graboid/pkg/extract"
+	"github.com/blacktop/graboid/pkg/image"
+)
+
+const (
+	dpkgStatus   = "var/lib/dpkg/status"
+	rpmPackages  = "var/lib/rpm/Packages"
+	apkInstalled = "lib/apk/db/installed"
+	osRelease    = "etc/os-release"
+	usrOSRelease = "usr/lib/os-release"
+)
+
+// dbFiles are the files read from the merged filesystem
+var dbFiles = map[string]bool{
+	dpkgStatus:   true,
+	rpmPackages:  true,
+	apkInstalled: true,
+	osRelease:    true,
+	usrOSRelease: true,
+}
+
+// Package is an OS package installed in the image
+type Package struct {
+	Name    string
+	Version string
+	Arch    string
+	// Type is the purl type (deb, apk)
+	Type string
+	PURL string
+}
+
+// mergeFiles applies the layers in order and returns the final content of the package databases
+func mergeFiles(layers []io.Reader) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	for idx, layer := range layers {
+		r, err := extract.Decompress(layer)
+		if err != nil {
+			return nil, fmt.Errorf("layer %d: %w", idx, err)
+		}
+		tr := tar.NewReader(r)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break // End of archive
+			}
+			if err != nil {
+				return nil, fmt.Errorf("layer %d: %w", idx, err)
+			}
+			name := strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+
+			switch {
+			case image.IsOpaqueWhiteout(name):
+				dir := path.Dir(name) + "/"
+				for f := range files {
+					if strings.HasPrefix(f, dir) {
+						delete(files, f)
+					}
+				}
+				continue
+			case image.IsWhiteout(name):
+				target := image.WhiteoutTarget(name)
+				for f := range files {
+					if f == target || strings.HasPrefix(f, target+"/") {
+						delete(files, f)
+					}
+				}
+				continue
+			}
+
+			if !dbFiles[name] {
+				continue
+			}
+			switch hdr.Typeflag {
+			case tar.TypeReg, tar.TypeRegA:
+				data, err := ioutil.ReadAll(tr)
+				if err != nil {
+					return nil, fmt.Errorf("layer %d: %w", idx, err)
+				}
+				files[name] = data
+			default:
+				// a link like /etc/os-release -> ../usr/lib/os-release replaces the file
+				delete(files, name)
+			}
+		}
+	}
+	return files, nil
+}
+
+// distroID returns the ID field of os-release
+func distroID(files map[string][]byte) string {
+	data := files[osRelease]
+	if data == nil {
+		data = files[usrOSRelease]
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "ID=") {
+			return strings.Trim(strings.TrimPrefix(line, "ID="), `"'`)
+		}
+	}
+	return ""
+}
+
+func purl(typ, namespace, name, version, arch string) string {
+	p := "pkg:" + typ + "/"
+	if namespace != "" {
+		p += url.PathEscape(namespace) + "/"
+	}
+	p += url.PathEscape(name) + "@" + url.PathEscape(version)
+	if arch != "" {
+		p += "?arch=" + url.QueryEscape(arch)
+	}
+	return p
+}
+
+// parseStanzas splits a deb822 style file (dpkg status) into paragraphs of fields
+func parseStanzas(data []byte) []map[string]string {
+	var stanzas []map[string]string
+	stanza := make(map[string]string)
+	var last string
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.TrimSpace(line) == "":
+			if len(stanza) > 0 {
+				stanzas = append(stanzas, stanza)
+				stanza = make(map[string]string)
+			}
+		case line[0] == ' ' || line[0] == '\t':
+			// continuation of a multi line field
+			if last != "" {
+				stanza[last] += "\n" + strings.TrimSpace(line)
+			}
+		default:
+			idx := strings.Index(line, ":")
+			if idx < 0 {
+				continue
+			}
+			last = line[:idx]
+			stanza[last] = strings.TrimSpace(line[idx+1:])
+		}
+	}
+	if len(stanza) > 0 {
+		stanzas = append(stanzas, stanza)
+	}
+	return stanzas
+}
+
+func parseDpkgStatus(data []byte, distro string) []Package {
+	if distro == "" {
+		distro = "debian"
+	}
+	var pkgs []Package
+	for _, stanza := range parseStanzas(data) {
+		name, version := stanza["Package"], stanza["Version"]
+		if name == "" || version == "" {
+			continue
+		}
+		if status := stanza["Status"]; status != "" && !strings.HasSuffix(status, " installed") {
+			continue
+		}
+		arch := stanza["Architecture"]
+		pkgs = append(pkgs, Package{
+			Name:    name,
+			Version: version,
+			Arch:    arch,
+			Type:    "deb",
+			PURL:    purl("deb", distro, name, version, arch),
+		})
+	}
+	return pkgs
+}
+
+func parseApkInstalled(data []byte, distro string) []Package {
+	if distro == "" {
+		distro = "alpine"
+	}
+	var pkgs []Package
+	var pkg Package
+
+	flush := func() {
+		if pkg.Name != "" && pkg.Version != "" {
+			pkg.Type = "apk"
+			pkg.PURL = purl("apk", distro, pkg.Name, pkg.Version, pkg.Arch)
+			pkgs = append(pkgs, pkg)
+		}
+		pkg = Package{}
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			flush()
+			continue
+		}
+		if len(line) < 2 || line[1] != ':' {
+			continue
+		}
+		switch line[0] {
+		case 'P':
+			pkg.Name = line[2:]
+		case 'V':
+			pkg.Version = line[2:]
+		case 'A':
+			pkg.Arch = line[2:]
+		}
+	}
+	flush()
+	return pkgs
+}
+
+// DetectPackages merges the layer tars (base layer first) and lists the OS packages
+// recorded by dpkg and apk. RPM databases are Berkeley DB files that can't be read
+// without librpm so they are only reported in the debug log.
+func DetectPackages(layers []io.Reader) ([]Package, error) {
+	files, err := mergeFiles(layers)
+	if err != nil {
+		return nil, err
+	}
+	distro := distroID(files)
+
+	var pkgs []Package
+	if data, ok := files[dpkgStatus]; ok {
+		pkgs = append(pkgs, parseDpkgStatus(data, distro)...)
+	}
+	if data, ok := files[apkInstalled]; ok {
+		pkgs = append(pkgs, parseApkInstalled(data, distro)...)
+	}
+	if _, ok := files[rpmPackages]; ok {
+		log.WithField("path", "/"+rpmPackages).Debug("rpm database found but rpm packages are not supported")
+	}
+
+	sort.Slice(pkgs, func(i, j int) bool {
+		if pkgs[i].Type != pkgs[j].Type {
+			return pkgs[i].Type < pkgs[j].Type
+		}
+		return pkgs[i].Name < pkgs[j].Name
+	})
+	return pkgs, nil
+}
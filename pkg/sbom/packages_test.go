@@ -0,0 +1,193 @@
+package sbom
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+const debianRelease = `PRETTY_NAME="Debian GNU/Linux 12 (bookworm)"
+NAME="Debian GNU/Linux"
+VERSION_ID="12"
+ID=debian
+`
+
+const dpkgStatusFile = `Package: base-files
+Status: install ok installed
+Priority: required
+Architecture: amd64
+Version: 12.4+deb12u5
+Description: Debian base system miscellaneous files
+ This package contains the basic filesystem hierarchy of a Debian system.
+ .
+ It also contains several important miscellaneous files.
+
+Package: libc6
+Status: install ok installed
+Architecture: amd64
+Multi-Arch: same
+Version: 2.36-9+deb12u4
+Depends: libgcc-s1
+
+Package: vim
+Status: deinstall ok config-files
+Architecture: amd64
+Version: 2:9.0.1378-2
+
+Package: tzdata
+Status: install ok installed
+Architecture: all
+Version: 2024a-0+deb12u1
+`
+
+const apkInstalledFile = `C:Q1abc=
+P:musl
+V:1.2.4-r2
+A:x86_64
+T:the musl c library
+
+P:busybox
+V:1.36.1-r5
+A:x86_64
+`
+
+// layerTar returns a gzipped layer holding the files in order, whiteouts are empty files
+func layerTar(t *testing.T, files ...[2]string) io.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, file := range files {
+		hdr := &tar.Header{Name: file[0], Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(file[1]))}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(tw, file[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func packageNames(pkgs []Package) []string {
+	var names []string
+	for _, pkg := range pkgs {
+		names = append(names, pkg.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestDetectPackagesDpkg(t *testing.T) {
+	pkgs, err := DetectPackages([]io.Reader{
+		layerTar(t, [2]string{"etc/os-release", debianRelease}, [2]string{"var/lib/dpkg/status", dpkgStatusFile}),
+		layerTar(t, [2]string{"usr/bin/app", "binary"}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Package{
+		{Name: "base-files", Version: "12.4+deb12u5", Arch: "amd64", Type: "deb", PURL: "pkg:deb/debian/base-files@12.4+deb12u5?arch=amd64"},
+		{Name: "libc6", Version: "2.36-9+deb12u4", Arch: "amd64", Type: "deb", PURL: "pkg:deb/debian/libc6@2.36-9+deb12u4?arch=amd64"},
+		{Name: "tzdata", Version: "2024a-0+deb12u1", Arch: "all", Type: "deb", PURL: "pkg:deb/debian/tzdata@2024a-0+deb12u1?arch=all"},
+	}
+	if !reflect.DeepEqual(pkgs, want) {
+		t.Errorf("DetectPackages() =\n%+v\nwant\n%+v", pkgs, want)
+	}
+}
+
+func TestDetectPackagesLayers(t *testing.T) {
+	status := [2]string{"var/lib/dpkg/status", dpkgStatusFile}
+	tests := []struct {
+		name   string
+		layers []io.Reader
+		want   []string
+	}{
+		{
+			name: "upper layer replaces the status file",
+			layers: []io.Reader{
+				layerTar(t, status),
+				layerTar(t, [2]string{"./var/lib/dpkg/status", "Package: curl\nStatus: install ok installed\nVersion: 7.88.1-10\n"}),
+			},
+			want: []string{"curl"},
+		},
+		{
+			name:   "whiteout",
+			layers: []io.Reader{layerTar(t, status), layerTar(t, [2]string{"var/lib/.wh.dpkg", ""})},
+		},
+		{
+			name:   "opaque whiteout",
+			layers: []io.Reader{layerTar(t, status), layerTar(t, [2]string{"var/lib/dpkg/.wh..wh..opq", ""})},
+		},
+		{
+			name: "dpkg and apk",
+			layers: []io.Reader{
+				layerTar(t, status),
+				layerTar(t, [2]string{"lib/apk/db/installed", apkInstalledFile}),
+			},
+			want: []string{"base-files", "busybox", "libc6", "musl", "tzdata"},
+		},
+		{
+			name:   "rpm is not supported",
+			layers: []io.Reader{layerTar(t, [2]string{"var/lib/rpm/Packages", "\x00\x06\x15\x61"})},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pkgs, err := DetectPackages(tt.layers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := packageNames(pkgs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DetectPackages() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectPackagesApk(t *testing.T) {
+	pkgs, err := DetectPackages([]io.Reader{layerTar(t,
+		[2]string{"usr/lib/os-release", "NAME=\"Alpine Linux\"\nID=alpine\n"},
+		[2]string{"lib/apk/db/installed", apkInstalledFile},
+	)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Package{
+		{Name: "busybox", Version: "1.36.1-r5", Arch: "x86_64", Type: "apk", PURL: "pkg:apk/alpine/busybox@1.36.1-r5?arch=x86_64"},
+		{Name: "musl", Version: "1.2.4-r2", Arch: "x86_64", Type: "apk", PURL: "pkg:apk/alpine/musl@1.2.4-r2?arch=x86_64"},
+	}
+	if !reflect.DeepEqual(pkgs, want) {
+		t.Errorf("DetectPackages() =\n%+v\nwant\n%+v", pkgs, want)
+	}
+}
+
+func TestDetectPackagesDistro(t *testing.T) {
+	// derivatives keep the dpkg format but their purls use their own namespace
+	pkgs, err := DetectPackages([]io.Reader{layerTar(t,
+		[2]string{"etc/os-release", "ID=\"ubuntu\"\nID_LIKE=debian\n"},
+		[2]string{"var/lib/dpkg/status", "Package: bash\nStatus: install ok installed\nVersion: 5.1-6ubuntu1\nArchitecture: arm64\n"},
+	)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 1 || pkgs[0].PURL != "pkg:deb/ubuntu/bash@5.1-6ubuntu1?arch=arm64" {
+		t.Errorf("DetectPackages() = %+v", pkgs)
+	}
+}
+
+func TestDetectPackagesInvalid(t *testing.T) {
+	if _, err := DetectPackages([]io.Reader{bytes.NewReader([]byte{0x1f, 0x8b, 0})}); err == nil {
+		t.Error("DetectPackages() of a broken layer succeeded")
+	}
+}
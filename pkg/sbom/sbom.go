@@ -0,0 +1,218 @@
+package sbom
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/blacktop/graboid/pkg/image"
+)
+
+// SBOMFormat is the document format Generate writes
+type SBOMFormat int
+
+const (
+	// FormatCycloneDXJSON is CycloneDX 1.4 JSON
+	FormatCycloneDXJSON SBOMFormat = iota
+	// FormatCycloneDXXML is CycloneDX 1.4 XML
+	FormatCycloneDXXML
+	// FormatSPDXJSON is SPDX 2.3 JSON
+	FormatSPDXJSON
+)
+
+func (f SBOMFormat) String() string {
+	switch f {
+	case FormatCycloneDXJSON:
+		return "cyclonedx-json"
+	case FormatCycloneDXXML:
+		return "cyclonedx-xml"
+	case FormatSPDXJSON:
+		return "spdx-json"
+	}
+	return fmt.Sprintf("SBOMFormat(%d)", int(f))
+}
+
+const (
+	cycloneDXNamespace = "http://cyclonedx.org/schema/bom/1.4"
+	cycloneDXVersion   = "1.4"
+	spdxVersion        = "SPDX-2.3"
+	toolName           = "graboid"
+)
+
+// Generate detects the OS packages in the layer tars (base layer first) and writes an SBOM for img
+func Generate(img *image.Image, layers []io.Reader, format SBOMFormat) ([]byte, error) {
+	pkgs, err := DetectPackages(layers)
+	if err != nil {
+		return nil, err
+	}
+
+	name := "image"
+	if d, err := img.ConfigDigest(); err == nil {
+		name = d.String()
+	}
+
+	switch format {
+	case FormatCycloneDXJSON:
+		return json.MarshalIndent(cycloneDX(img, name, pkgs), "", "  ")
+	case FormatCycloneDXXML:
+		out, err := xml.MarshalIndent(cycloneDX(img, name, pkgs), "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(xml.Header), out...), nil
+	case FormatSPDXJSON:
+		return json.MarshalIndent(spdx(img, name, pkgs), "", "  ")
+	}
+	return nil, fmt.Errorf("unsupported SBOM format %s", format)
+}
+
+type cdxComponent struct {
+	Type    string `json:"type" xml:"type,attr"`
+	BOMRef  string `json:"bom-ref,omitempty" xml:"bom-ref,attr,omitempty"`
+	Name    string `json:"name" xml:"name"`
+	Version string `json:"version,omitempty" xml:"version,omitempty"`
+	PURL    string `json:"purl,omitempty" xml:"purl,omitempty"`
+}
+
+type cdxTool struct {
+	Name string `json:"name" xml:"name"`
+}
+
+type cdxMetadata struct {
+	Timestamp string        `json:"timestamp,omitempty" xml:"timestamp,omitempty"`
+	Tools     []cdxTool     `json:"tools" xml:"tools>tool"`
+	Component *cdxComponent `json:"component,omitempty" xml:"component,omitempty"`
+}
+
+type cdxBOM struct {
+	XMLName     xml.Name       `json:"-" xml:"bom"`
+	XMLNS       string         `json:"-" xml:"xmlns,attr"`
+	BOMFormat   string         `json:"bomFormat" xml:"-"`
+	SpecVersion string         `json:"specVersion" xml:"-"`
+	Version     int            `json:"version" xml:"version,attr"`
+	Metadata    cdxMetadata    `json:"metadata" xml:"metadata"`
+	Components  []cdxComponent `json:"components" xml:"components>component"`
+}
+
+func timestamp(img *image.Image) string {
+	if img.Created.IsZero() {
+		return ""
+	}
+	return img.Created.UTC().Format(time.RFC3339)
+}
+
+func cycloneDX(img *image.Image, name string, pkgs []Package) cdxBOM {
+	bom := cdxBOM{
+		XMLNS:       cycloneDXNamespace,
+		BOMFormat:   "CycloneDX",
+		SpecVersion: cycloneDXVersion,
+		Version:     1,
+		Metadata: cdxMetadata{
+			Timestamp: timestamp(img),
+			Tools:     []cdxTool{{Name: toolName}},
+			Component: &cdxComponent{Type: "container", Name: name},
+		},
+		Components: []cdxComponent{},
+	}
+	for _, pkg := range pkgs {
+		bom.Components = append(bom.Components, cdxComponent{
+			Type:    "library",
+			BOMRef:  pkg.PURL,
+			Name:    pkg.Name,
+			Version: pkg.Version,
+			PURL:    pkg.PURL,
+		})
+	}
+	return bom
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxPackage struct {
+	Name             string            `json:"name"`
+	SPDXID           string            `json:"SPDXID"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships,omitempty"`
+}
+
+// spdxID returns a valid SPDX identifier (letters, numbers, . and -) for a package
+func spdxID(idx int, pkg Package) string {
+	id := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		}
+		return '-'
+	}, pkg.Name)
+	return fmt.Sprintf("SPDXRef-Package-%s-%s-%d", pkg.Type, id, idx)
+}
+
+func spdx(img *image.Image, name string, pkgs []Package) spdxDocument {
+	created := timestamp(img)
+	if created == "" {
+		created = time.Unix(0, 0).UTC().Format(time.RFC3339)
+	}
+	doc := spdxDocument{
+		SPDXVersion:       spdxVersion,
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              name,
+		DocumentNamespace: "https://github.com/blacktop/graboid/spdx/" + strings.Replace(name, ":", "-", 1),
+		CreationInfo: spdxCreationInfo{
+			Created:  created,
+			Creators: []string{"Tool: " + toolName},
+		},
+		Packages: []spdxPackage{},
+	}
+	for idx, pkg := range pkgs {
+		id := spdxID(idx, pkg)
+		doc.Packages = append(doc.Packages, spdxPackage{
+			Name:             pkg.Name,
+			SPDXID:           id,
+			VersionInfo:      pkg.Version,
+			DownloadLocation: "NOASSERTION",
+			ExternalRefs: []spdxExternalRef{{
+				ReferenceCategory: "PACKAGE-MANAGER",
+				ReferenceType:     "purl",
+				ReferenceLocator:  pkg.PURL,
+			}},
+		})
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			SPDXElementID:      "SPDXRef-DOCUMENT",
+			RelationshipType:   "DESCRIBES",
+			RelatedSPDXElement: id,
+		})
+	}
+	return doc
+}
@@ -0,0 +1,140 @@
+package sbom
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blacktop/graboid/pkg/image"
+)
+
+func testImage(t *testing.T) (*image.Image, []io.Reader) {
+	t.Helper()
+	img := &image.Image{
+		Created: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		RootFS:  &image.ImageRootFS{Type: "layers", DiffIDs: []image.DiffID{"sha256:a"}},
+	}
+	return img, []io.Reader{layerTar(t, [2]string{"etc/os-release", debianRelease}, [2]string{"var/lib/dpkg/status", dpkgStatusFile})}
+}
+
+func TestGenerateCycloneDXJSON(t *testing.T) {
+	img, layers := testImage(t)
+	out, err := Generate(img, layers, FormatCycloneDXJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var bom struct {
+		BOMFormat   string `json:"bomFormat"`
+		SpecVersion string `json:"specVersion"`
+		Metadata    struct {
+			Timestamp string `json:"timestamp"`
+			Component struct {
+				Type string `json:"type"`
+				Name string `json:"name"`
+			} `json:"component"`
+		} `json:"metadata"`
+		Components []struct {
+			Type    string `json:"type"`
+			BOMRef  string `json:"bom-ref"`
+			Name    string `json:"name"`
+			Version string `json:"version"`
+			PURL    string `json:"purl"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(out, &bom); err != nil {
+		t.Fatal(err)
+	}
+	d, _ := img.ConfigDigest()
+	if bom.BOMFormat != "CycloneDX" || bom.SpecVersion != "1.4" || bom.Metadata.Timestamp != "2024-03-01T12:00:00Z" {
+		t.Errorf("header = %s %s %s", bom.BOMFormat, bom.SpecVersion, bom.Metadata.Timestamp)
+	}
+	if bom.Metadata.Component.Type != "container" || bom.Metadata.Component.Name != d.String() {
+		t.Errorf("metadata component = %+v", bom.Metadata.Component)
+	}
+	if len(bom.Components) != 3 {
+		t.Fatalf("got %d components, want 3", len(bom.Components))
+	}
+	libc := bom.Components[1]
+	if libc.Type != "library" || libc.Name != "libc6" || libc.Version != "2.36-9+deb12u4" || libc.PURL != "pkg:deb/debian/libc6@2.36-9+deb12u4?arch=amd64" || libc.BOMRef != libc.PURL {
+		t.Errorf("component = %+v", libc)
+	}
+}
+
+func TestGenerateCycloneDXXML(t *testing.T) {
+	img, layers := testImage(t)
+	out, err := Generate(img, layers, FormatCycloneDXXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(out), xml.Header) {
+		t.Errorf("document does not start with the XML header: %q", out[:40])
+	}
+
+	var bom struct {
+		XMLName    xml.Name
+		Version    int `xml:"version,attr"`
+		Components []struct {
+			Type    string `xml:"type,attr"`
+			Name    string `xml:"name"`
+			Version string `xml:"version"`
+			PURL    string `xml:"purl"`
+		} `xml:"components>component"`
+	}
+	if err := xml.Unmarshal(out, &bom); err != nil {
+		t.Fatal(err)
+	}
+	if bom.XMLName.Space != cycloneDXNamespace || bom.XMLName.Local != "bom" || bom.Version != 1 {
+		t.Errorf("root = %v version %d", bom.XMLName, bom.Version)
+	}
+	if len(bom.Components) != 3 || bom.Components[2].Name != "tzdata" || bom.Components[2].PURL != "pkg:deb/debian/tzdata@2024a-0+deb12u1?arch=all" {
+		t.Errorf("components = %+v", bom.Components)
+	}
+}
+
+func TestGenerateSPDXJSON(t *testing.T) {
+	img, layers := testImage(t)
+	out, err := Generate(img, layers, FormatSPDXJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc spdxDocument
+	if err := json.Unmarshal(out, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.SPDXVersion != "SPDX-2.3" || doc.DataLicense != "CC0-1.0" || doc.CreationInfo.Created != "2024-03-01T12:00:00Z" {
+		t.Errorf("document = %s %s %s", doc.SPDXVersion, doc.DataLicense, doc.CreationInfo.Created)
+	}
+	if strings.Contains(doc.DocumentNamespace, "sha256:") {
+		t.Errorf("documentNamespace %q is not a valid URI", doc.DocumentNamespace)
+	}
+	if len(doc.Packages) != 3 || len(doc.Relationships) != 3 {
+		t.Fatalf("got %d packages and %d relationships, want 3", len(doc.Packages), len(doc.Relationships))
+	}
+	base := doc.Packages[0]
+	if base.SPDXID != "SPDXRef-Package-deb-base-files-0" || base.VersionInfo != "12.4+deb12u5" || base.ExternalRefs[0].ReferenceLocator != "pkg:deb/debian/base-files@12.4+deb12u5?arch=amd64" {
+		t.Errorf("package = %+v", base)
+	}
+	for idx, rel := range doc.Relationships {
+		if rel.SPDXElementID != "SPDXRef-DOCUMENT" || rel.RelationshipType != "DESCRIBES" || rel.RelatedSPDXElement != doc.Packages[idx].SPDXID {
+			t.Errorf("relationship %d = %+v", idx, rel)
+		}
+	}
+}
+
+func TestGenerateUnsupportedFormat(t *testing.T) {
+	img, layers := testImage(t)
+	if _, err := Generate(img, layers, SBOMFormat(42)); err == nil || !strings.Contains(err.Error(), "SBOMFormat(42)") {
+		t.Errorf("Generate() = %v, want an unsupported format error", err)
+	}
+}
+
+func TestSPDXID(t *testing.T) {
+	if id := spdxID(7, Package{Name: "libstdc++6", Type: "deb"}); id != "SPDXRef-Package-deb-libstdc--6-7" {
+		t.Errorf("spdxID() = %q", id)
+	}
+}
@@ -0,0 +1,168 @@
+package security
+
+import (
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/blacktop/graboid/pkg/image"
+)
+
+// AuditRule flags environment variables that Check returns true for
+type AuditRule struct {
+	Name     string
+	Severity Severity
+	Check    func(key, value string) bool
+}
+
+// AuditFinding is an environment variable flagged by an AuditRule
+type AuditFinding struct {
+	Rule     string
+	Key      string
+	Value    string
+	Severity Severity
+}
+
+var (
+	rulesMu    sync.RWMutex
+	auditRules = []AuditRule{
+		{Name: "internal-proxy", Severity: SeverityMedium, Check: internalProxy},
+		{Name: "ld-preload", Severity: SeverityHigh, Check: ldPreload},
+		{Name: "writable-path", Severity: SeverityMedium, Check: writablePath},
+	}
+)
+
+// RegisterRule adds rule to the rules applied by EnvVarAudit, replacing a rule with the same name
+func RegisterRule(rule AuditRule) {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+
+	for idx := range auditRules {
+		if auditRules[idx].Name == rule.Name {
+			auditRules[idx] = rule
+			return
+		}
+	}
+	auditRules = append(auditRules, rule)
+}
+
+// UnregisterRule removes the rule called name
+func UnregisterRule(name string) {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+
+	for idx := range auditRules {
+		if auditRules[idx].Name == name {
+			auditRules = append(auditRules[:idx], auditRules[idx+1:]...)
+			return
+		}
+	}
+}
+
+// EnvVarAudit checks the image's environment variables against the registered audit rules
+func EnvVarAudit(img *image.Image) []AuditFinding {
+	env := img.Env()
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	rulesMu.RLock()
+	defer rulesMu.RUnlock()
+
+	var findings []AuditFinding
+	for _, key := range keys {
+		for _, rule := range auditRules {
+			if rule.Check != nil && rule.Check(key, env[key]) {
+				findings = append(findings, AuditFinding{
+					Rule:     rule.Name,
+					Key:      key,
+					Value:    env[key],
+					Severity: rule.Severity,
+				})
+			}
+		}
+	}
+	return findings
+}
+
+// internalProxy flags proxies pointing at loopback or private addresses which invite SSRF
+func internalProxy(key, value string) bool {
+	switch strings.ToUpper(key) {
+	case "HTTP_PROXY", "HTTPS_PROXY", "ALL_PROXY", "FTP_PROXY":
+	default:
+		return false
+	}
+	if value == "" {
+		return false
+	}
+	if !strings.Contains(value, "://") {
+		value = "http://" + value
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	if host == "localhost" || strings.HasSuffix(host, ".internal") || strings.HasSuffix(host, ".local") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	return ip.IsLoopback() || ip.IsLinkLocalUnicast() || isPrivateIP(ip)
+}
+
+// privateNets are the RFC 1918 and RFC 4193 address ranges
+var privateNets = []*net.IPNet{
+	mustCIDR("10.0.0.0/8"),
+	mustCIDR("172.16.0.0/12"),
+	mustCIDR("192.168.0.0/16"),
+	mustCIDR("fc00::/7"),
+}
+
+func mustCIDR(cidr string) *net.IPNet {
+	_, n, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+func isPrivateIP(ip net.IP) bool {
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ldPreload flags libraries preloaded into every process
+func ldPreload(key, value string) bool {
+	return key == "LD_PRELOAD" && strings.TrimSpace(value) != ""
+}
+
+// writablePath flags PATH entries that are world writable or relative
+func writablePath(key, value string) bool {
+	if key != "PATH" {
+		return false
+	}
+	for _, dir := range strings.Split(value, ":") {
+		if dir != "/" {
+			dir = strings.TrimSuffix(dir, "/")
+		}
+		switch {
+		case dir == "", dir == ".", !strings.HasPrefix(dir, "/"):
+			return true
+		case dir == "/tmp", dir == "/var/tmp", dir == "/dev/shm",
+			strings.HasPrefix(dir, "/tmp/"), strings.HasPrefix(dir, "/var/tmp/"), strings.HasPrefix(dir, "/dev/shm/"):
+			return true
+		}
+	}
+	return false
+}
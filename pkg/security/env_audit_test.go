@@ -0,0 +1,157 @@
+package security
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/blacktop/graboid/pkg/image"
+	"github.com/docker/docker/api/types/container"
+)
+
+func envImage(env ...string) *image.Image {
+	return &image.Image{Config: &container.Config{Env: env}}
+}
+
+func TestEnvVarAudit(t *testing.T) {
+	tests := []struct {
+		name string
+		env  []string
+		want []AuditFinding
+	}{
+		{
+			name: "safe",
+			env: []string{
+				"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
+				"HTTP_PROXY=http://proxy.example.com:3128",
+				"LD_LIBRARY_PATH=/opt/lib",
+				"LD_PRELOAD=",
+			},
+		},
+		{
+			name: "root in path",
+			env:  []string{"PATH=/:/usr/bin/"},
+		},
+		{
+			name: "private proxy",
+			env:  []string{"HTTP_PROXY=http://10.0.0.5:3128"},
+			want: []AuditFinding{{Rule: "internal-proxy", Key: "HTTP_PROXY", Value: "http://10.0.0.5:3128", Severity: SeverityMedium}},
+		},
+		{
+			name: "proxies",
+			env: []string{
+				"https_proxy=192.168.1.1:8080",
+				"ALL_PROXY=socks5://localhost:1080",
+				"FTP_PROXY=http://[::1]:21",
+				"HTTPS_PROXY=http://proxy.corp.internal",
+				"HTTP_PROXY=http://169.254.169.254",
+				"NO_PROXY=localhost",
+			},
+			want: []AuditFinding{
+				{Rule: "internal-proxy", Key: "ALL_PROXY", Value: "socks5://localhost:1080", Severity: SeverityMedium},
+				{Rule: "internal-proxy", Key: "FTP_PROXY", Value: "http://[::1]:21", Severity: SeverityMedium},
+				{Rule: "internal-proxy", Key: "HTTPS_PROXY", Value: "http://proxy.corp.internal", Severity: SeverityMedium},
+				{Rule: "internal-proxy", Key: "HTTP_PROXY", Value: "http://169.254.169.254", Severity: SeverityMedium},
+				{Rule: "internal-proxy", Key: "https_proxy", Value: "192.168.1.1:8080", Severity: SeverityMedium},
+			},
+		},
+		{
+			name: "ld preload",
+			env:  []string{"LD_PRELOAD=/usr/lib/libjemalloc.so"},
+			want: []AuditFinding{{Rule: "ld-preload", Key: "LD_PRELOAD", Value: "/usr/lib/libjemalloc.so", Severity: SeverityHigh}},
+		},
+		{
+			name: "tmp in path",
+			env:  []string{"PATH=/usr/bin:/tmp/bin"},
+			want: []AuditFinding{{Rule: "writable-path", Key: "PATH", Value: "/usr/bin:/tmp/bin", Severity: SeverityMedium}},
+		},
+		{
+			name: "relative path entries",
+			env:  []string{"PATH=/usr/bin:."},
+			want: []AuditFinding{{Rule: "writable-path", Key: "PATH", Value: "/usr/bin:.", Severity: SeverityMedium}},
+		},
+		{
+			name: "empty path entry",
+			env:  []string{"PATH=/usr/bin::/bin"},
+			want: []AuditFinding{{Rule: "writable-path", Key: "PATH", Value: "/usr/bin::/bin", Severity: SeverityMedium}},
+		},
+		{
+			name: "all rules",
+			env:  []string{"PATH=/dev/shm:/usr/bin", "LD_PRELOAD=/tmp/hook.so", "HTTP_PROXY=127.0.0.1:8080"},
+			want: []AuditFinding{
+				{Rule: "internal-proxy", Key: "HTTP_PROXY", Value: "127.0.0.1:8080", Severity: SeverityMedium},
+				{Rule: "ld-preload", Key: "LD_PRELOAD", Value: "/tmp/hook.so", Severity: SeverityHigh},
+				{Rule: "writable-path", Key: "PATH", Value: "/dev/shm:/usr/bin", Severity: SeverityMedium},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EnvVarAudit(envImage(tt.env...)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("EnvVarAudit() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if got := EnvVarAudit(&image.Image{}); got != nil {
+		t.Errorf("EnvVarAudit() without config = %+v", got)
+	}
+}
+
+func TestRegisterRule(t *testing.T) {
+	debug := AuditRule{
+		Name:     "debug-enabled",
+		Severity: SeverityLow,
+		Check: func(key, value string) bool {
+			return strings.HasSuffix(key, "_DEBUG") && value == "1"
+		},
+	}
+	RegisterRule(debug)
+	defer UnregisterRule(debug.Name)
+
+	img := envImage("APP_DEBUG=1", "LD_PRELOAD=/lib/hook.so")
+	want := []AuditFinding{
+		{Rule: "debug-enabled", Key: "APP_DEBUG", Value: "1", Severity: SeverityLow},
+		{Rule: "ld-preload", Key: "LD_PRELOAD", Value: "/lib/hook.so", Severity: SeverityHigh},
+	}
+	if got := EnvVarAudit(img); !reflect.DeepEqual(got, want) {
+		t.Errorf("EnvVarAudit() with a registered rule = %+v, want %+v", got, want)
+	}
+
+	// registering a rule again replaces it
+	debug.Severity = SeverityMedium
+	RegisterRule(debug)
+	if got := EnvVarAudit(envImage("APP_DEBUG=1")); len(got) != 1 || got[0].Severity != SeverityMedium {
+		t.Errorf("EnvVarAudit() after replacing the rule = %+v", got)
+	}
+
+	UnregisterRule(debug.Name)
+	if got := EnvVarAudit(envImage("APP_DEBUG=1")); got != nil {
+		t.Errorf("EnvVarAudit() after UnregisterRule() = %+v", got)
+	}
+	UnregisterRule("missing")
+}
+
+func TestUnregisterBuiltinRule(t *testing.T) {
+	rulesMu.RLock()
+	saved := append([]AuditRule(nil), auditRules...)
+	rulesMu.RUnlock()
+	defer func() {
+		rulesMu.Lock()
+		auditRules = saved
+		rulesMu.Unlock()
+	}()
+
+	UnregisterRule("ld-preload")
+	img := envImage("LD_PRELOAD=/lib/hook.so", "PATH=/tmp")
+	want := []AuditFinding{{Rule: "writable-path", Key: "PATH", Value: "/tmp", Severity: SeverityMedium}}
+	if got := EnvVarAudit(img); !reflect.DeepEqual(got, want) {
+		t.Errorf("EnvVarAudit() without the ld-preload rule = %+v, want %+v", got, want)
+	}
+
+	// a rule without a check never matches
+	RegisterRule(AuditRule{Name: "no-check", Severity: SeverityHigh})
+	if got := EnvVarAudit(img); !reflect.DeepEqual(got, want) {
+		t.Errorf("EnvVarAudit() with a nil check = %+v", got)
+	}
+}
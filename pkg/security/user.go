@@ -0,0 +1,47 @@
+package security
+
+import (
+	"strings"
+
+	"github.com/blacktop/graboid/pkg/image"
+)
+
+// EffectiveUser returns the user the container of img runs as. Containers
+// without a user run as root and the root forms 0, 0:0 and root:root are all
+// returned as root, other users are returned as user[:group].
+func EffectiveUser(img *image.Image) string {
+	var user string
+	if img != nil && img.Config != nil {
+		user = strings.TrimSpace(img.Config.User)
+	}
+	if len(user) == 0 {
+		return "root"
+	}
+
+	name, group := user, ""
+	if idx := strings.Index(user, ":"); idx >= 0 {
+		name, group = user[:idx], user[idx+1:]
+	}
+	if isRoot(name) && (len(group) == 0 || isRoot(group)) {
+		return "root"
+	}
+	return user
+}
+
+// RunAsRoot returns true if the container of img runs as the root user (uid 0)
+func RunAsRoot(img *image.Image) bool {
+	user := EffectiveUser(img)
+	if idx := strings.Index(user, ":"); idx >= 0 {
+		user = user[:idx]
+	}
+	return isRoot(user)
+}
+
+// RunAsNonRoot returns true if the container of img runs as a user other than root
+func RunAsNonRoot(img *image.Image) bool {
+	return !RunAsRoot(img)
+}
+
+func isRoot(id string) bool {
+	return id == "0" || id == "root"
+}
@@ -0,0 +1,69 @@
+package security
+
+import (
+	"testing"
+
+	"github.com/blacktop/graboid/pkg/image"
+	"github.com/docker/docker/api/types/container"
+)
+
+func userImage(user string) *image.Image {
+	return &image.Image{Config: &container.Config{User: user}}
+}
+
+func TestRunAsRoot(t *testing.T) {
+	tests := []struct {
+		user      string
+		effective string
+		root      bool
+	}{
+		// every form that means root
+		{user: "", effective: "root", root: true},
+		{user: "  ", effective: "root", root: true},
+		{user: "0", effective: "root", root: true},
+		{user: "root", effective: "root", root: true},
+		{user: "0:0", effective: "root", root: true},
+		{user: "root:root", effective: "root", root: true},
+		{user: "root:0", effective: "root", root: true},
+		{user: "0:root", effective: "root", root: true},
+		{user: " root ", effective: "root", root: true},
+		{user: "0:", effective: "root", root: true},
+		// uid 0 with another group is still root
+		{user: "root:staff", effective: "root:staff", root: true},
+		{user: "0:1000", effective: "0:1000", root: true},
+		// non-root users
+		{user: "nobody", effective: "nobody"},
+		{user: "1000", effective: "1000"},
+		{user: "1000:1000", effective: "1000:1000"},
+		{user: "65532:65532", effective: "65532:65532"},
+		{user: "app:root", effective: "app:root"},
+		{user: "1000:0", effective: "1000:0"},
+		{user: "rootless", effective: "rootless"},
+		{user: "00", effective: "00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.user, func(t *testing.T) {
+			img := userImage(tt.user)
+			if got := EffectiveUser(img); got != tt.effective {
+				t.Errorf("EffectiveUser() = %q, want %q", got, tt.effective)
+			}
+			if got := RunAsRoot(img); got != tt.root {
+				t.Errorf("RunAsRoot() = %v, want %v", got, tt.root)
+			}
+			if got := RunAsNonRoot(img); got == tt.root {
+				t.Errorf("RunAsNonRoot() = %v, want %v", got, !tt.root)
+			}
+		})
+	}
+}
+
+func TestRunAsRootWithoutConfig(t *testing.T) {
+	for name, img := range map[string]*image.Image{"nil image": nil, "nil config": {}} {
+		if got := EffectiveUser(img); got != "root" {
+			t.Errorf("%s: EffectiveUser() = %q, want root", name, got)
+		}
+		if !RunAsRoot(img) {
+			t.Errorf("%s: RunAsRoot() = false, want true", name)
+		}
+	}
+}
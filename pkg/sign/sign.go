@@ -0,0 +1,204 @@
+package sign
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// SimpleSigningType is the critical.type of a cosign signature payload
+const SimpleSigningType = "cosign container image signature"
+
+var (
+	// ErrInvalidSignature is returned when a signature does not verify
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrUnsupportedKey is returned for keys that are not ECDSA P-256 PEM keys
+	ErrUnsupportedKey = errors.New("unsupported key")
+)
+
+// SimpleSigning is the payload cosign signs for a container image
+type SimpleSigning struct {
+	Critical Critical               `json:"critical"`
+	Optional map[string]interface{} `json:"optional"`
+}
+
+// Critical is the part of the payload that identifies the signed image
+type Critical struct {
+	Identity Identity `json:"identity"`
+	Image    Image    `json:"image"`
+	Type     string   `json:"type"`
+}
+
+// Identity is the reference the image was signed under
+type Identity struct {
+	DockerReference string `json:"docker-reference"`
+}
+
+// Image is the signed manifest
+type Image struct {
+	DockerManifestDigest string `json:"docker-manifest-digest"`
+}
+
+// Signature is a cosign payload and the base64 ASN.1 ECDSA signature of its sha256 hash.
+// cosign keeps the payload as the signature layer and the signature in its
+// dev.cosignproject.cosign/signature annotation.
+type Signature struct {
+	Payload   []byte `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// Sign signs the manifest digest with the unencrypted PEM ECDSA P-256 private key at keyPath
+// and returns the JSON encoded Signature
+func Sign(manifestDigest digest.Digest, keyPath string) ([]byte, error) {
+	if err := manifestDigest.Validate(); err != nil {
+		return nil, err
+	}
+	key, err := loadPrivateKey(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(SimpleSigning{
+		Critical: Critical{
+			Image: Image{DockerManifestDigest: manifestDigest.String()},
+			Type:  SimpleSigningType,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(payload)
+	r, s, err := ecdsa.Sign(rand.Reader, key, hash[:])
+	if err != nil {
+		return nil, err
+	}
+	sig, err := asn1.Marshal(ecdsaSignature{R: r, S: s})
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(Signature{
+		Payload:   payload,
+		Signature: base64.StdEncoding.EncodeToString(sig),
+	})
+}
+
+// Verify checks that sig was made over manifestDigest with the key at keyPath,
+// which can be the PEM public key or the private key
+func Verify(manifestDigest digest.Digest, sig []byte, keyPath string) error {
+	key, err := loadPublicKey(keyPath)
+	if err != nil {
+		return err
+	}
+
+	var s Signature
+	if err := json.Unmarshal(sig, &s); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	rawSig, err := base64.StdEncoding.DecodeString(s.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	var es ecdsaSignature
+	if rest, err := asn1.Unmarshal(rawSig, &es); err != nil || len(rest) > 0 || es.R == nil || es.S == nil {
+		return fmt.Errorf("%w: malformed ASN.1 signature", ErrInvalidSignature)
+	}
+
+	hash := sha256.Sum256(s.Payload)
+	if !ecdsa.Verify(key, hash[:], es.R, es.S) {
+		return ErrInvalidSignature
+	}
+
+	var payload SimpleSigning
+	if err := json.Unmarshal(s.Payload, &payload); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	if payload.Critical.Type != SimpleSigningType {
+		return fmt.Errorf("%w: unexpected payload type %q", ErrInvalidSignature, payload.Critical.Type)
+	}
+	if payload.Critical.Image.DockerManifestDigest != manifestDigest.String() {
+		return fmt.Errorf("%w: signed digest %s does not match %s", ErrInvalidSignature, payload.Critical.Image.DockerManifestDigest, manifestDigest)
+	}
+
+	return nil
+}
+
+func readPEM(keyPath string) (*pem.Block, error) {
+	data, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: %s is not PEM encoded", ErrUnsupportedKey, keyPath)
+	}
+	return block, nil
+}
+
+func loadPrivateKey(keyPath string) (*ecdsa.PrivateKey, error) {
+	block, err := readPEM(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		// cosign's ENCRYPTED COSIGN PRIVATE KEY needs scrypt and secretbox to decrypt
+		return nil, fmt.Errorf("%w: PEM type %q", ErrUnsupportedKey, block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok || ecKey.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("%w: not an ECDSA P-256 key", ErrUnsupportedKey)
+	}
+	return ecKey, nil
+}
+
+func loadPublicKey(keyPath string) (*ecdsa.PublicKey, error) {
+	block, err := readPEM(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type != "PUBLIC KEY" {
+		key, err := loadPrivateKey(keyPath)
+		if err != nil {
+			return nil, err
+		}
+		return &key.PublicKey, nil
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	ecKey, ok := key.(*ecdsa.PublicKey)
+	if !ok || ecKey.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("%w: not an ECDSA P-256 key", ErrUnsupportedKey)
+	}
+	return ecKey, nil
+}
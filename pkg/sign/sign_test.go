@@ -0,0 +1,253 @@
+package sign
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+)
+
+const testDigest = digest.Digest("sha256:6c3c624b58dbbcd3c0dd82b4c53f04194d1247c6eebdaab7c610cf7d66709b3b")
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "graboid-sign")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// writeKey PEM encodes the DER bytes to name in dir
+func writeKey(t *testing.T, dir, name, pemType string, der []byte) string {
+	t.Helper()
+	keyPath := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: pemType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return keyPath
+}
+
+// keyPair generates a P-256 key pair and returns the paths of the private and the public key
+func keyPair(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writeKey(t, dir, "cosign.key", "EC PRIVATE KEY", der), writeKey(t, dir, "cosign.pub", "PUBLIC KEY", pub)
+}
+
+func TestSignVerify(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	keyPath, pubPath := keyPair(t, dir)
+
+	sig, err := Sign(testDigest, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{pubPath, keyPath} {
+		if err := Verify(testDigest, sig, path); err != nil {
+			t.Errorf("Verify() with %s = %v", filepath.Base(path), err)
+		}
+	}
+
+	var s Signature
+	if err := json.Unmarshal(sig, &s); err != nil {
+		t.Fatal(err)
+	}
+	var payload SimpleSigning
+	if err := json.Unmarshal(s.Payload, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Critical.Type != SimpleSigningType || payload.Critical.Image.DockerManifestDigest != testDigest.String() {
+		t.Errorf("payload = %s", s.Payload)
+	}
+}
+
+func TestSignPKCS8(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := writeKey(t, dir, "pkcs8.key", "PRIVATE KEY", der)
+
+	sig, err := Sign(testDigest, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(testDigest, sig, keyPath); err != nil {
+		t.Errorf("Verify() = %v", err)
+	}
+}
+
+// resign signs payload with the key at keyPath like Sign does
+func resign(t *testing.T, keyPath, payload string) []byte {
+	t.Helper()
+	key, err := loadPrivateKey(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := sha256.Sum256([]byte(payload))
+	r, s, err := ecdsa.Sign(rand.Reader, key, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := asn1.Marshal(ecdsaSignature{R: r, S: s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := json.Marshal(Signature{Payload: []byte(payload), Signature: base64.StdEncoding.EncodeToString(raw)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sig
+}
+
+func TestVerifyInvalidSignature(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	keyPath, pubPath := keyPair(t, dir)
+	otherDir := tempDir(t)
+	defer os.RemoveAll(otherDir)
+	_, otherPub := keyPair(t, otherDir)
+
+	sig, err := Sign(testDigest, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s Signature
+	if err := json.Unmarshal(sig, &s); err != nil {
+		t.Fatal(err)
+	}
+	corrupt := func(fn func(s *Signature)) []byte {
+		c := Signature{Payload: append([]byte(nil), s.Payload...), Signature: s.Signature}
+		fn(&c)
+		out, err := json.Marshal(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	rawSig, _ := base64.StdEncoding.DecodeString(s.Signature)
+
+	tests := []struct {
+		name   string
+		digest digest.Digest
+		sig    []byte
+		key    string
+	}{
+		{name: "flipped signature bit", sig: corrupt(func(s *Signature) {
+			flipped := append([]byte(nil), rawSig...)
+			flipped[len(flipped)-1] ^= 0x01
+			s.Signature = base64.StdEncoding.EncodeToString(flipped)
+		})},
+		{name: "tampered payload", sig: corrupt(func(s *Signature) {
+			s.Payload = []byte(strings.Replace(string(s.Payload), testDigest.Encoded()[:8], "00000000", 1))
+		})},
+		{name: "truncated signature", sig: corrupt(func(s *Signature) {
+			s.Signature = base64.StdEncoding.EncodeToString(rawSig[:len(rawSig)/2])
+		})},
+		{name: "signature not base64", sig: corrupt(func(s *Signature) { s.Signature = "not base64!" })},
+		{name: "not json", sig: []byte("MEUCIQ")},
+		{name: "other digest", digest: digest.FromString("other"), sig: sig},
+		{name: "other key", sig: sig, key: otherPub},
+		{name: "payload type", sig: resign(t, keyPath, `{"critical":{"image":{"docker-manifest-digest":"`+testDigest.String()+`"},"type":"atomic container signature"}}`)},
+		{name: "payload not json", sig: resign(t, keyPath, "not json")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, key := tt.digest, tt.key
+			if d == "" {
+				d = testDigest
+			}
+			if key == "" {
+				key = pubPath
+			}
+			if err := Verify(d, tt.sig, key); !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("Verify() = %v, want %v", err, ErrInvalidSignature)
+			}
+		})
+	}
+}
+
+func TestUnsupportedKey(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384DER, _ := x509.MarshalECPrivateKey(p384)
+	p384Pub, _ := x509.MarshalPKIXPublicKey(&p384.PublicKey)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaDER, _ := x509.MarshalPKCS8PrivateKey(rsaKey)
+	rsaPub, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	notPEM := filepath.Join(dir, "plain.key")
+	if err := ioutil.WriteFile(notPEM, []byte("not a key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := []string{
+		writeKey(t, dir, "p384.key", "EC PRIVATE KEY", p384DER),
+		writeKey(t, dir, "p384.pub", "PUBLIC KEY", p384Pub),
+		writeKey(t, dir, "rsa.key", "PRIVATE KEY", rsaDER),
+		writeKey(t, dir, "rsa.pub", "PUBLIC KEY", rsaPub),
+		writeKey(t, dir, "encrypted.key", "ENCRYPTED COSIGN PRIVATE KEY", []byte("scrypt")),
+		notPEM,
+	}
+	for _, keyPath := range keys {
+		if _, err := Sign(testDigest, keyPath); !errors.Is(err, ErrUnsupportedKey) {
+			t.Errorf("Sign() with %s = %v, want %v", filepath.Base(keyPath), err, ErrUnsupportedKey)
+		}
+		if err := Verify(testDigest, []byte("{}"), keyPath); !errors.Is(err, ErrUnsupportedKey) {
+			t.Errorf("Verify() with %s = %v, want %v", filepath.Base(keyPath), err, ErrUnsupportedKey)
+		}
+	}
+}
+
+func TestSignInvalid(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	keyPath, _ := keyPair(t, dir)
+
+	if _, err := Sign("sha256:short", keyPath); err == nil {
+		t.Error("Sign() of an invalid digest succeeded")
+	}
+	if _, err := Sign(testDigest, filepath.Join(dir, "missing.key")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Sign() with a missing key = %v", err)
+	}
+}
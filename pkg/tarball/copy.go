@@ -0,0 +1,38 @@
+package tarball
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/blacktop/graboid/pkg/image"
+)
+
+// ErrLayerNotFound is returned when the manifest has no layer at the index or the archive lacks its file
+var ErrLayerNotFound = errors.New("layer not found")
+
+// CopyLayer copies the manifest's nth layer to w as it is stored in the
+// archive, gzipped layers are not decompressed. It returns the bytes copied.
+func (a *Archive) CopyLayer(m *image.Manifest, index int, w io.Writer) (int64, error) {
+	if index < 0 || index >= len(m.Layers) {
+		return 0, fmt.Errorf("%w: index %d out of range, manifest has %d layers", ErrLayerNotFound, index, len(m.Layers))
+	}
+	if _, ok := a.entries[cleanName(m.Layers[index])]; !ok {
+		return 0, fmt.Errorf("%w: %s not in %s", ErrLayerNotFound, m.Layers[index], a.path)
+	}
+	return a.copyFile(m.Layers[index], w)
+}
+
+// CopyConfig copies the raw config json of the manifest to w and returns the bytes copied
+func (a *Archive) CopyConfig(m *image.Manifest, w io.Writer) (int64, error) {
+	return a.copyFile(m.Config, w)
+}
+
+func (a *Archive) copyFile(name string, w io.Writer) (int64, error) {
+	rc, err := a.open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+	return io.Copy(w, rc)
+}
@@ -0,0 +1,152 @@
+package tarball
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blacktop/graboid/pkg/image"
+	"github.com/opencontainers/go-digest"
+)
+
+// copyToFile copies with fn to a file of dir and returns its sha256 and the bytes fn reported
+func copyToFile(t *testing.T, dir, name string, fn func(f *os.File) (int64, error)) (digest.Digest, int64) {
+	t.Helper()
+	f, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := fn(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(data)) != n {
+		t.Errorf("copied %d bytes but reported %d", len(data), n)
+	}
+	return digest.FromBytes(data), n
+}
+
+func TestArchiveCopyLayer(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	a := writeArchive(t, dir, testImage{tag: "graboid/copy:latest", layers: []io.Reader{
+		gzipLayer(t, layerTar(t, tarEntry{name: "etc/hostname", body: "graboid\n"})),
+		layerTar(t, tarEntry{name: "app/hello.txt", body: "hello world\n"}),
+	}})
+	p := a.path
+	a.Close()
+
+	for _, name := range []string{p, gzipFile(t, p, dir)} {
+		t.Run(filepath.Base(name), func(t *testing.T) {
+			a, err := Open(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer a.Close()
+			m := &a.Manifests[0]
+
+			// the writer stores layers at the sha256 of their bytes so a raw copy matches the path
+			for idx, layer := range m.Layers {
+				got, _ := copyToFile(t, dir, fmt.Sprintf("layer-%d", idx), func(f *os.File) (int64, error) {
+					return a.CopyLayer(m, idx, f)
+				})
+				if want := path.Dir(layer); got.Hex() != want {
+					t.Errorf("layer %d copied with sha256 %s, want %s", idx, got.Hex(), want)
+				}
+			}
+
+			var first bytes.Buffer
+			if _, err := a.CopyLayer(m, 0, &first); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(first.Bytes(), gzipMagic) {
+				t.Error("CopyLayer() decompressed the gzipped layer")
+			}
+
+			got, _ := copyToFile(t, dir, "config", func(f *os.File) (int64, error) {
+				return a.CopyConfig(m, f)
+			})
+			if want := strings.TrimSuffix(m.Config, ".json"); got.Hex() != want {
+				t.Errorf("config copied with sha256 %s, want %s", got.Hex(), want)
+			}
+		})
+	}
+}
+
+func TestArchiveCopyLayerDockerSave(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	a, err := Open(dockerSave)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	m := &a.Manifests[0]
+	img, err := a.Image(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// docker save layers are uncompressed so they match the diff_ids
+	for idx := range m.Layers {
+		got, n := copyToFile(t, dir, fmt.Sprintf("layer-%d", idx), func(f *os.File) (int64, error) {
+			return a.CopyLayer(m, idx, f)
+		})
+		if want := digest.Digest(img.RootFS.DiffIDs[idx]); got != want {
+			t.Errorf("layer %d copied with %s, want %s", idx, got, want)
+		}
+		if n != 10240 {
+			t.Errorf("layer %d copied %d bytes, want 10240", idx, n)
+		}
+	}
+}
+
+func TestArchiveCopyLayerNotFound(t *testing.T) {
+	a, err := Open(dockerSave)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	m := &a.Manifests[0]
+	missing := &image.Manifest{Config: m.Config, Layers: []string{"missing/layer.tar"}}
+
+	tests := []struct {
+		name  string
+		m     *image.Manifest
+		index int
+	}{
+		{name: "negative index", m: m, index: -1},
+		{name: "index past the layers", m: m, index: len(m.Layers)},
+		{name: "layer not in the archive", m: missing, index: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			n, err := a.CopyLayer(tt.m, tt.index, &buf)
+			if !errors.Is(err, ErrLayerNotFound) {
+				t.Errorf("CopyLayer() error = %v, want %v", err, ErrLayerNotFound)
+			}
+			if n != 0 || buf.Len() != 0 {
+				t.Errorf("CopyLayer() copied %d bytes", n)
+			}
+		})
+	}
+
+	if _, err := a.CopyConfig(&image.Manifest{Config: "missing.json"}, ioutil.Discard); err == nil {
+		t.Error("CopyConfig() of a missing config succeeded")
+	}
+}
@@ -0,0 +1,138 @@
+package tarball
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/apex/log"
+	"github.com/blacktop/graboid/pkg/extract"
+	"github.com/blacktop/graboid/pkg/image"
+)
+
+// SentinelFile records in dest how far an unfinished extraction got so it can be resumed
+const SentinelFile = ".graboid-manifest"
+
+type sentinel struct {
+	Config string `json:"config"`
+	Layers int    `json:"layers"`
+}
+
+type progressReader struct {
+	r        io.Reader
+	index    int
+	total    int
+	n        int64
+	progress extract.ProgressFunc
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	pr.n += int64(n)
+	pr.progress(pr.index, pr.total, pr.n)
+	return n, err
+}
+
+// ExtractAll applies the layers of the archive's first image in order and
+// writes the merged filesystem to dest. Archives holding several images (a
+// docker save of several tags) only have their first one extracted, use
+// ImageByName and ExtractImage for the others.
+func (a *Archive) ExtractAll(dest string, opts extract.ExtractOptions) error {
+	if len(a.Manifests) == 0 {
+		return fmt.Errorf("no images found in %s", a.path)
+	}
+	if len(a.Manifests) > 1 {
+		log.Warnf("%s contains %d images, extracting %s", a.path, len(a.Manifests), a.Manifests[0].Config)
+	}
+	return a.ExtractImage(&a.Manifests[0], dest, opts)
+}
+
+// ExtractImage applies the layers of the image m in order and writes the
+// merged filesystem to dest. While it runs dest holds SentinelFile so an
+// interrupted extraction of the same image resumes at the first layer not
+// applied yet, the file is removed once all layers are.
+func (a *Archive) ExtractImage(m *image.Manifest, dest string, opts extract.ExtractOptions) error {
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+
+	sentinelPath := filepath.Join(dest, SentinelFile)
+	state := sentinel{Config: m.Config}
+	if rawJSON, err := ioutil.ReadFile(sentinelPath); err == nil {
+		var prev sentinel
+		if err := json.Unmarshal(rawJSON, &prev); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", sentinelPath, err)
+		}
+		if prev.Config != m.Config {
+			return fmt.Errorf("%s already contains an extraction of %s", dest, prev.Config)
+		}
+		state.Layers = prev.Layers
+		if state.Layers > 0 {
+			log.Infof("resuming extraction at layer %d/%d", state.Layers+1, len(m.Layers))
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	// later layers replace the files of earlier ones
+	opts.OverwriteExisting = true
+	// progress is reported per layer here rather than by ExtractLayer
+	reporter := opts.Progress
+	opts.Progress = nil
+
+	for i := state.Layers; i < len(m.Layers); i++ {
+		rc, err := a.layerReader(m, i, reporter)
+		if err != nil {
+			if reporter != nil {
+				reporter.Done(err)
+			}
+			return err
+		}
+		var r io.Reader = rc
+		if opts.ProgressFunc != nil {
+			r = &progressReader{r: rc, index: i, total: len(m.Layers), progress: opts.ProgressFunc}
+		}
+		err = extract.ExtractLayer(r, dest, opts)
+		rc.Close()
+		if reporter != nil {
+			reporter.Done(err)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to extract layer %d: %w", i, err)
+		}
+
+		state.Layers = i + 1
+		if err := writeSentinel(sentinelPath, state); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Remove(sentinelPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// writeSentinel replaces the sentinel file, whatever a layer put at its
+// path is removed first so the state is never written through a symlink
+func writeSentinel(path string, state sentinel) error {
+	rawJSON, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(path); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(rawJSON); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
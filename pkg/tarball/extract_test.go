@@ -0,0 +1,166 @@
+package tarball
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blacktop/graboid/pkg/extract"
+)
+
+func TestExtractAll(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	a := writeArchive(t, dir, testImage{tag: "test:latest", layers: []io.Reader{
+		layerTar(t, tarEntry{name: "etc/", typeflag: tar.TypeDir}, tarEntry{name: "etc/motd", body: "base"}, tarEntry{name: "etc/os-release", body: "base"}),
+		layerTar(t, tarEntry{name: "etc/.wh.motd"}, tarEntry{name: "etc/os-release", body: "upper"}),
+	}})
+	defer a.Close()
+
+	var progress []int
+	dest := filepath.Join(dir, "rootfs")
+	err := a.ExtractAll(dest, extract.ExtractOptions{ProgressFunc: func(layer, total int, n int64) {
+		if total != 2 {
+			t.Errorf("progress total = %d, want 2", total)
+		}
+		if len(progress) == 0 || progress[len(progress)-1] != layer {
+			progress = append(progress, layer)
+		}
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readFile(t, filepath.Join(dest, "etc", "os-release")); got != "upper" {
+		t.Errorf("etc/os-release = %q, want the upper layer's", got)
+	}
+	if _, err := os.Lstat(filepath.Join(dest, "etc", "motd")); !os.IsNotExist(err) {
+		t.Errorf("whited out etc/motd: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(dest, SentinelFile)); !os.IsNotExist(err) {
+		t.Errorf("%s left in dest: %v", SentinelFile, err)
+	}
+	if len(progress) != 2 || progress[0] != 0 || progress[1] != 1 {
+		t.Errorf("progress reported for layers %v, want [0 1]", progress)
+	}
+}
+
+func TestExtractAllResume(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	a := writeArchive(t, dir, testImage{tag: "test:latest", layers: []io.Reader{
+		layerTar(t, tarEntry{name: "lower", body: "lower"}),
+		layerTar(t, tarEntry{name: "upper", body: "upper"}),
+	}})
+	defer a.Close()
+
+	dest := filepath.Join(dir, "rootfs")
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		t.Fatal(err)
+	}
+	state, err := json.Marshal(sentinel{Config: a.Manifests[0].Config, Layers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dest, SentinelFile), state, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.ExtractAll(dest, extract.ExtractOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(filepath.Join(dest, "lower")); !os.IsNotExist(err) {
+		t.Errorf("layer 0 applied again: %v", err)
+	}
+	if got := readFile(t, filepath.Join(dest, "upper")); got != "upper" {
+		t.Errorf("upper = %q", got)
+	}
+	if _, err := os.Lstat(filepath.Join(dest, SentinelFile)); !os.IsNotExist(err) {
+		t.Errorf("%s left in dest: %v", SentinelFile, err)
+	}
+}
+
+func TestExtractAllOtherImage(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	a := writeArchive(t, dir, testImage{tag: "test:latest", layers: []io.Reader{layerTar(t, tarEntry{name: "file", body: "x"})}})
+	defer a.Close()
+
+	dest := filepath.Join(dir, "rootfs")
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		t.Fatal(err)
+	}
+	state, _ := json.Marshal(sentinel{Config: "other.json", Layers: 1})
+	if err := ioutil.WriteFile(filepath.Join(dest, SentinelFile), state, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.ExtractAll(dest, extract.ExtractOptions{}); err == nil {
+		t.Error("ExtractAll() resumed the extraction of another image")
+	}
+}
+
+func TestExtractAllFirstImageOnly(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	a := writeArchive(t, dir,
+		testImage{tag: "first:latest", layers: []io.Reader{layerTar(t, tarEntry{name: "first", body: "1"})}},
+		testImage{tag: "second:latest", layers: []io.Reader{layerTar(t, tarEntry{name: "second", body: "2"})}},
+	)
+	defer a.Close()
+
+	dest := filepath.Join(dir, "first")
+	if err := a.ExtractAll(dest, extract.ExtractOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(filepath.Join(dest, "second")); !os.IsNotExist(err) {
+		t.Errorf("ExtractAll() extracted the second image: %v", err)
+	}
+
+	m, err := a.ImageByName("second:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest = filepath.Join(dir, "second")
+	if err := a.ExtractImage(m, dest, extract.ExtractOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(dest, "second")); got != "2" {
+		t.Errorf("second = %q", got)
+	}
+}
+
+func TestExtractAllTarSlip(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	outside := filepath.Join(dir, "outside")
+	if err := os.Mkdir(outside, 0755); err != nil {
+		t.Fatal(err)
+	}
+	a := writeArchive(t, dir, testImage{tag: "evil:latest", layers: []io.Reader{
+		layerTar(t,
+			tarEntry{name: "escape", typeflag: tar.TypeSymlink, linkname: outside},
+			tarEntry{name: SentinelFile, typeflag: tar.TypeSymlink, linkname: filepath.Join(outside, "sentinel")},
+			tarEntry{name: "../parent", body: "evil"},
+		),
+		layerTar(t, tarEntry{name: "escape/file", body: "evil"}),
+	}})
+	defer a.Close()
+
+	dest := filepath.Join(dir, "rootfs")
+	a.ExtractAll(dest, extract.ExtractOptions{})
+
+	entries, err := ioutil.ReadDir(outside)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		t.Errorf("extraction wrote %s outside dest", entry.Name())
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "parent")); !os.IsNotExist(err) {
+		t.Errorf("extraction wrote ../parent: %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package tarball
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/blacktop/graboid/pkg/image"
+)
+
+var (
+	// ErrImageNotFound is returned when no image in the archive has the requested name
+	ErrImageNotFound = errors.New("image not found in archive")
+	// ErrAmbiguousName is returned when more than one image in the archive has the requested name
+	ErrAmbiguousName = errors.New("image name matches more than one image")
+)
+
+// ImageNames returns the sorted, deduplicated repo tags of all images in the archive
+func (a *Archive) ImageNames() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, m := range a.Manifests {
+		for _, tag := range m.RepoTags {
+			if len(tag) == 0 || seen[tag] {
+				continue
+			}
+			seen[tag] = true
+			names = append(names, tag)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ImageByName returns the manifest of the image tagged nameTag
+func (a *Archive) ImageByName(nameTag string) (*image.Manifest, error) {
+	var found *image.Manifest
+	for idx := range a.Manifests {
+		for _, tag := range a.Manifests[idx].RepoTags {
+			if len(tag) == 0 || tag != nameTag {
+				continue
+			}
+			if found != nil {
+				return nil, fmt.Errorf("%w: %s", ErrAmbiguousName, nameTag)
+			}
+			found = &a.Manifests[idx]
+			break
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("%w: %s", ErrImageNotFound, nameTag)
+	}
+	return found, nil
+}
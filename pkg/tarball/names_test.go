@@ -0,0 +1,119 @@
+package tarball
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// multiImageManifest tags alpine twice, leaves one image untagged and has
+// two images claim busybox:latest
+const multiImageManifest = `[
+	{"Config":"alpine.json","RepoTags":["alpine:3.12","alpine:latest"],"Layers":["alpine/layer.tar"]},
+	{"Config":"untagged.json","RepoTags":null,"Layers":["alpine/layer.tar"]},
+	{"Config":"nginx.json","RepoTags":["nginx:1.19","","alpine:latest"],"Layers":["alpine/layer.tar","nginx/layer.tar"]},
+	{"Config":"busybox.json","RepoTags":["busybox:latest"],"Layers":["busybox/layer.tar"]},
+	{"Config":"busybox-old.json","RepoTags":["busybox:latest","busybox:1.31"],"Layers":["busybox/layer.tar"]}
+]`
+
+// openMultiImage writes a docker save tarball with the images of multiImageManifest to dir
+func openMultiImage(t *testing.T, dir string) *Archive {
+	t.Helper()
+	entries := []tarEntry{{name: manifestFile, body: multiImageManifest}}
+	for _, config := range []string{"alpine", "untagged", "nginx", "busybox", "busybox-old"} {
+		entries = append(entries, tarEntry{name: config + ".json", body: `{"os":"linux","architecture":"amd64"}`})
+	}
+	for _, layer := range []string{"alpine", "nginx", "busybox"} {
+		entries = append(entries, tarEntry{name: layer + "/layer.tar", body: layerTar(t).(*bytes.Buffer).String()})
+	}
+
+	p := filepath.Join(dir, "images.tar")
+	if err := ioutil.WriteFile(p, layerTar(t, entries...).(*bytes.Buffer).Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	a, err := Open(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestArchiveImageNames(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	a := openMultiImage(t, dir)
+	defer a.Close()
+
+	want := []string{"alpine:3.12", "alpine:latest", "busybox:1.31", "busybox:latest", "nginx:1.19"}
+	if got := a.ImageNames(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ImageNames() = %q, want %q", got, want)
+	}
+
+	single, err := Open(dockerSave)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer single.Close()
+	if got := single.ImageNames(); !reflect.DeepEqual(got, []string{"graboid/test:latest"}) {
+		t.Errorf("ImageNames() of the docker save fixture = %q", got)
+	}
+	if got := (&Archive{}).ImageNames(); len(got) != 0 {
+		t.Errorf("ImageNames() of an empty archive = %q", got)
+	}
+}
+
+func TestArchiveImageByName(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	a := openMultiImage(t, dir)
+	defer a.Close()
+
+	tests := []struct {
+		name   string
+		config string
+		err    error
+	}{
+		{name: "alpine:3.12", config: "alpine.json"},
+		{name: "nginx:1.19", config: "nginx.json"},
+		{name: "busybox:1.31", config: "busybox-old.json"},
+		{name: "alpine:latest", err: ErrAmbiguousName},
+		{name: "busybox:latest", err: ErrAmbiguousName},
+		{name: "alpine", err: ErrImageNotFound},
+		{name: "debian:buster", err: ErrImageNotFound},
+		{name: "", err: ErrImageNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := a.ImageByName(tt.name)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) || m != nil {
+					t.Errorf("ImageByName() = %v, %v, want %v", m, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Config != tt.config {
+				t.Errorf("ImageByName() returned the manifest of %s, want %s", m.Config, tt.config)
+			}
+			if m != &a.Manifests[indexOf(a, tt.config)] {
+				t.Error("ImageByName() returned a copy of the manifest")
+			}
+		})
+	}
+}
+
+// indexOf returns the index of the manifest with config in a
+func indexOf(a *Archive, config string) int {
+	for idx, m := range a.Manifests {
+		if m.Config == config {
+			return idx
+		}
+	}
+	return -1
+}
@@ -0,0 +1,54 @@
+package tarball
+
+import (
+	"io"
+	"io/ioutil"
+)
+
+// LayerCount returns the number of distinct layer blobs referenced by the manifests
+func (a *Archive) LayerCount() int {
+	unique := make(map[string]bool)
+	for _, m := range a.Manifests {
+		for _, layer := range m.Layers {
+			unique[cleanName(layer)] = true
+		}
+	}
+	return len(unique)
+}
+
+// TotalLayers returns the number of layers of all the images, layers shared by images are counted for each
+func (a *Archive) TotalLayers() int {
+	var total int
+	for _, m := range a.Manifests {
+		total += len(m.Layers)
+	}
+	return total
+}
+
+// UncompressedSize returns the size of the distinct layer tars once
+// decompressed. Every layer is read so this is as slow as extracting it.
+func (a *Archive) UncompressedSize() (int64, error) {
+	var total int64
+	seen := make(map[string]bool)
+	for idx := range a.Manifests {
+		m := &a.Manifests[idx]
+		for layerIdx, layer := range m.Layers {
+			if seen[cleanName(layer)] {
+				continue
+			}
+			seen[cleanName(layer)] = true
+
+			rc, err := a.LayerReader(m, layerIdx)
+			if err != nil {
+				return total, err
+			}
+			n, err := io.Copy(ioutil.Discard, rc)
+			rc.Close()
+			total += n
+			if err != nil {
+				return total, err
+			}
+		}
+	}
+	return total, nil
+}
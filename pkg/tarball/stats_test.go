@@ -0,0 +1,64 @@
+package tarball
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestArchiveLayerStats(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	base := layerTar(t, tarEntry{name: "etc/hostname", body: "graboid\n"}).(*bytes.Buffer).Bytes()
+	app := layerTar(t, tarEntry{name: "app/hello.txt", body: "hello\n"}, tarEntry{name: "app/run", body: "#!/bin/sh\n"}).(*bytes.Buffer).Bytes()
+	compressedApp := gzipLayer(t, bytes.NewReader(app)).(*bytes.Buffer).Bytes()
+
+	a := writeArchive(t, dir,
+		testImage{tag: "graboid/base:latest", layers: []io.Reader{bytes.NewReader(base)}},
+		testImage{tag: "graboid/app:latest", layers: []io.Reader{bytes.NewReader(base), bytes.NewReader(compressedApp)}},
+	)
+	defer a.Close()
+
+	if got := a.LayerCount(); got != 2 {
+		t.Errorf("LayerCount() = %d, want 2", got)
+	}
+	if got := a.TotalLayers(); got != 3 {
+		t.Errorf("TotalLayers() = %d, want 3", got)
+	}
+	// the shared layer is counted once and the app layer decompressed
+	size, err := a.UncompressedSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(len(base) + len(app)); size != want {
+		t.Errorf("UncompressedSize() = %d, want %d", size, want)
+	}
+}
+
+func TestArchiveLayerStatsDockerSave(t *testing.T) {
+	a, err := Open(dockerSave)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	if a.LayerCount() != 2 || a.TotalLayers() != 2 {
+		t.Errorf("LayerCount() = %d, TotalLayers() = %d, want 2 and 2", a.LayerCount(), a.TotalLayers())
+	}
+	// both layer.tar files of the fixture are 10240 bytes
+	if size, err := a.UncompressedSize(); err != nil || size != 2*10240 {
+		t.Errorf("UncompressedSize() = %d, %v, want %d", size, err, 2*10240)
+	}
+}
+
+func TestArchiveLayerStatsEmpty(t *testing.T) {
+	a := &Archive{}
+	if a.LayerCount() != 0 || a.TotalLayers() != 0 {
+		t.Errorf("LayerCount() = %d, TotalLayers() = %d of an empty archive", a.LayerCount(), a.TotalLayers())
+	}
+	if size, err := a.UncompressedSize(); err != nil || size != 0 {
+		t.Errorf("UncompressedSize() of an empty archive = %d, %v", size, err)
+	}
+}
@@ -0,0 +1,101 @@
+package tarball
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"io"
+	"os"
+)
+
+// EntryType tells what a file of the archive is
+type EntryType int
+
+const (
+	// EntryOther is a file the manifests don't reference, like repositories
+	EntryOther EntryType = iota
+	// EntryManifest is manifest.json
+	EntryManifest
+	// EntryConfig is an image config
+	EntryConfig
+	// EntryLayer is a layer tar, possibly compressed
+	EntryLayer
+)
+
+func (t EntryType) String() string {
+	switch t {
+	case EntryManifest:
+		return "manifest"
+	case EntryConfig:
+		return "config"
+	case EntryLayer:
+		return "layer"
+	}
+	return "other"
+}
+
+// ArchiveEntry is a file of the archive visited by Stream
+type ArchiveEntry struct {
+	Name string
+	Type EntryType
+	Size int64
+	// Reader is the raw content of the file, it is only valid until the callback returns
+	Reader io.Reader
+}
+
+// Stream reads the archive sequentially from the start and calls fn for
+// every regular file in archive order. Nothing is buffered in memory so it
+// works for archives of any size. Whatever fn leaves unread is skipped and
+// an error returned by fn stops the stream and is returned.
+func (a *Archive) Stream(fn func(entry ArchiveEntry) error) error {
+	types := make(map[string]EntryType, len(a.entries))
+	for _, m := range a.Manifests {
+		types[cleanName(m.Config)] = EntryConfig
+		for _, layer := range m.Layers {
+			types[cleanName(layer)] = EntryLayer
+		}
+	}
+	types[manifestFile] = EntryManifest
+
+	// the archive file is shared with random access reads so stream a separate one
+	f, err := os.Open(a.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = bufio.NewReader(f)
+	if a.compressed {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+
+		name := cleanName(hdr.Name)
+		entry := ArchiveEntry{
+			Name:   name,
+			Type:   types[name],
+			Size:   hdr.Size,
+			Reader: tr,
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+}
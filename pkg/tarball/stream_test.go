@@ -0,0 +1,203 @@
+package tarball
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/blacktop/graboid/pkg/image"
+)
+
+// streamArchive writes a docker save style tarball of 100 files to dir: 49
+// layer directories holding VERSION and layer.tar, the config and
+// manifest.json last. It returns its path and the entries in archive order.
+func streamArchive(t *testing.T, dir string) (string, []ArchiveEntry) {
+	t.Helper()
+	manifest := image.Manifest{Config: "config.json", RepoTags: []string{"graboid/stream:latest"}}
+	var want []ArchiveEntry
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	add := func(name string, typ EntryType, body string) {
+		if err := tw.WriteHeader(&tar.Header{Name: "./" + name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(body))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, ArchiveEntry{Name: name, Type: typ, Size: int64(len(body)), Reader: strings.NewReader(body)})
+	}
+
+	for n := 0; n < 49; n++ {
+		id := fmt.Sprintf("%064x", n)
+		if err := tw.WriteHeader(&tar.Header{Name: "./" + id + "/", Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+			t.Fatal(err)
+		}
+		add(id+"/VERSION", EntryOther, "1.0")
+		add(id+"/layer.tar", EntryLayer, strings.Repeat("l", 512*n))
+		manifest.Layers = append(manifest.Layers, id+"/layer.tar")
+	}
+	add("config.json", EntryConfig, `{"architecture":"amd64","os":"linux"}`)
+	manifests, err := json.Marshal([]image.Manifest{manifest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	add(manifestFile, EntryManifest, string(manifests))
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	p := filepath.Join(dir, "stream.tar")
+	if err := ioutil.WriteFile(p, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p, want
+}
+
+// streamedEntry is an entry visited by Stream with the content it read
+type streamedEntry struct {
+	Name string
+	Type EntryType
+	Size int64
+	Body string
+}
+
+func streamed(entries []ArchiveEntry) []streamedEntry {
+	var s []streamedEntry
+	for _, e := range entries {
+		body, _ := ioutil.ReadAll(e.Reader)
+		s = append(s, streamedEntry{Name: e.Name, Type: e.Type, Size: e.Size, Body: string(body)})
+	}
+	return s
+}
+
+func TestArchiveStream(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	p, entries := streamArchive(t, dir)
+	want := streamed(entries)
+	if len(want) != 100 {
+		t.Fatalf("synthetic archive has %d files, want 100", len(want))
+	}
+
+	for _, name := range []string{p, gzipFile(t, p, dir)} {
+		t.Run(filepath.Base(name), func(t *testing.T) {
+			a, err := Open(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer a.Close()
+
+			var got []streamedEntry
+			err = a.Stream(func(entry ArchiveEntry) error {
+				body, err := ioutil.ReadAll(entry.Reader)
+				if err != nil {
+					return err
+				}
+				got = append(got, streamedEntry{Name: entry.Name, Type: entry.Type, Size: entry.Size, Body: string(body)})
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Stream() visited %d entries, want %d in archive order", len(got), len(want))
+				for idx := 0; idx < len(got) && idx < len(want); idx++ {
+					if got[idx] != want[idx] {
+						t.Errorf("entry %d = %s (%s, %d bytes), want %s (%s, %d bytes)", idx,
+							got[idx].Name, got[idx].Type, got[idx].Size, want[idx].Name, want[idx].Type, want[idx].Size)
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestArchiveStreamUnread(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	p, want := streamArchive(t, dir)
+	a, err := Open(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	// only peeking at the layers must not shift the following entries
+	var names []string
+	err = a.Stream(func(entry ArchiveEntry) error {
+		names = append(names, entry.Name)
+		if entry.Type == EntryLayer && entry.Size > 0 {
+			if _, err := io.ReadFull(entry.Reader, make([]byte, 1)); err != nil {
+				return err
+			}
+		}
+		if entry.Type == EntryManifest {
+			body, err := ioutil.ReadAll(entry.Reader)
+			if err != nil {
+				return err
+			}
+			if !json.Valid(body) {
+				return fmt.Errorf("manifest is not json: %q", body)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != len(want) || names[len(names)-1] != manifestFile {
+		t.Errorf("Stream() visited %d entries ending with %q, want %d ending with %q", len(names), names[len(names)-1], len(want), manifestFile)
+	}
+}
+
+func TestArchiveStreamError(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	p, _ := streamArchive(t, dir)
+	a, err := Open(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	errStop := errors.New("stop")
+	visited := 0
+	err = a.Stream(func(entry ArchiveEntry) error {
+		visited++
+		if entry.Type == EntryLayer {
+			return errStop
+		}
+		return nil
+	})
+	if !errors.Is(err, errStop) {
+		t.Errorf("Stream() error = %v, want %v", err, errStop)
+	}
+	if visited != 2 {
+		t.Errorf("Stream() visited %d entries after the error, want 2", visited)
+	}
+}
+
+func TestEntryTypeString(t *testing.T) {
+	tests := map[EntryType]string{
+		EntryOther:    "other",
+		EntryManifest: "manifest",
+		EntryConfig:   "config",
+		EntryLayer:    "layer",
+		EntryType(42): "other",
+	}
+	for typ, want := range tests {
+		if got := typ.String(); got != want {
+			t.Errorf("EntryType(%d).String() = %q, want %q", typ, got, want)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package tarball
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/blacktop/graboid/pkg/extract"
+	"github.com/blacktop/graboid/pkg/image"
+	"github.com/blacktop/graboid/pkg/progress"
+)
+
+const manifestFile = "manifest.json"
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+type entry struct {
+	offset int64
+	size   int64
+}
+
+// Archive is a docker save tarball (or a graboid tar.gz) opened for reading
+type Archive struct {
+	Manifests image.Manifests
+
+	f          *os.File
+	path       string
+	compressed bool
+	entries    map[string]entry
+
+	mu     sync.Mutex
+	images map[string]*image.Image
+}
+
+// Open opens the docker tarball at path and parses its manifest.json
+func Open(path string) (*Archive, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Archive{
+		f:       f,
+		path:    path,
+		entries: make(map[string]entry),
+		images:  make(map[string]*image.Image),
+	}
+	if err := a.index(); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// cleanName normalizes tar entry names like ./manifest.json
+func cleanName(name string) string {
+	return path.Clean("/" + name)[1:]
+}
+
+// index records the position of every file in the archive and reads manifest.json
+func (a *Archive) index() error {
+	magic := make([]byte, len(gzipMagic))
+	if _, err := io.ReadFull(a.f, magic); err != nil {
+		return err
+	}
+	a.compressed = bytes.Equal(magic, gzipMagic)
+	if _, err := a.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	var r io.Reader = a.f
+	if a.compressed {
+		gz, err := gzip.NewReader(bufio.NewReader(a.f))
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break // End of archive
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+
+		name := cleanName(hdr.Name)
+		e := entry{size: hdr.Size}
+		if !a.compressed {
+			// the tar reader does not buffer so the file is at the start of the entry's data
+			if e.offset, err = a.f.Seek(0, io.SeekCurrent); err != nil {
+				return err
+			}
+		}
+		a.entries[name] = e
+
+		if name == manifestFile {
+			rawJSON, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return err
+			}
+			if err := json.Unmarshal(rawJSON, &a.Manifests); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, ok := a.entries[manifestFile]; !ok {
+		return fmt.Errorf("%s not found in %s", manifestFile, a.path)
+	}
+
+	return nil
+}
+
+type readCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (rc *readCloser) Close() error {
+	var err error
+	for _, c := range rc.closers {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// open returns a reader for the raw content of the named file in the archive
+func (a *Archive) open(name string) (io.ReadCloser, error) {
+	name = cleanName(name)
+	e, ok := a.entries[name]
+	if !ok {
+		return nil, fmt.Errorf("%s not found in %s", name, a.path)
+	}
+
+	if !a.compressed {
+		return ioutil.NopCloser(io.NewSectionReader(a.f, e.offset, e.size)), nil
+	}
+
+	// gzipped archives cannot seek so scan a fresh reader up to the entry
+	f, err := os.Open(a.path)
+	if err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			gz.Close()
+			f.Close()
+			if err == io.EOF {
+				err = fmt.Errorf("%s not found in %s", name, a.path)
+			}
+			return nil, err
+		}
+		if cleanName(hdr.Name) == name {
+			return &readCloser{Reader: tr, closers: []io.Closer{gz, f}}, nil
+		}
+	}
+}
+
+// File returns a reader for the raw content of the named file in the archive
+func (a *Archive) File(name string) (io.ReadCloser, error) {
+	return a.open(name)
+}
+
+// Image returns the parsed image config of the manifest
+func (a *Archive) Image(m *image.Manifest) (*image.Image, error) {
+	a.mu.Lock()
+	img, ok := a.images[m.Config]
+	a.mu.Unlock()
+	if ok {
+		return img, nil
+	}
+
+	rc, err := a.open(m.Config)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	rawJSON, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	img, err = image.NewFromJSON(rawJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	a.images[m.Config] = img
+	a.mu.Unlock()
+
+	return img, nil
+}
+
+// LayerReader returns a reader for the uncompressed tar of the manifest's nth layer
+func (a *Archive) LayerReader(m *image.Manifest, index int) (io.ReadCloser, error) {
+	return a.layerReader(m, index, nil)
+}
+
+// layerReader is LayerReader reporting the bytes read of the layer as stored in the archive to reporter
+func (a *Archive) layerReader(m *image.Manifest, index int, reporter progress.ProgressReporter) (io.ReadCloser, error) {
+	if index < 0 || index >= len(m.Layers) {
+		return nil, fmt.Errorf("%w: index %d out of range, manifest has %d layers", ErrLayerNotFound, index, len(m.Layers))
+	}
+	if _, ok := a.entries[cleanName(m.Layers[index])]; !ok {
+		return nil, fmt.Errorf("%w: %s not in %s", ErrLayerNotFound, m.Layers[index], a.path)
+	}
+
+	rc, err := a.open(m.Layers[index])
+	if err != nil {
+		return nil, err
+	}
+	var raw io.Reader = rc
+	if reporter != nil {
+		reporter.Start(fmt.Sprintf("layer %d/%d", index+1, len(m.Layers)), a.entries[cleanName(m.Layers[index])].size)
+		raw = progress.NewReader(rc, reporter)
+	}
+	r, err := extract.Decompress(raw)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	closers := []io.Closer{rc}
+	if c, ok := r.(io.Closer); ok {
+		closers = append([]io.Closer{c}, closers...)
+	}
+	return &readCloser{Reader: r, closers: closers}, nil
+}
+
+// Close closes the underlying archive file
+func (a *Archive) Close() error {
+	return a.f.Close()
+}
@@ -0,0 +1,230 @@
+package tarball
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/blacktop/graboid/pkg/image"
+)
+
+type tarEntry struct {
+	name     string
+	typeflag byte
+	linkname string
+	body     string
+}
+
+func layerTar(t *testing.T, entries ...tarEntry) io.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Typeflag: e.typeflag, Linkname: e.linkname, Mode: 0644}
+		if hdr.Typeflag == 0 {
+			hdr.Typeflag = tar.TypeReg
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			hdr.Mode = 0755
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = int64(len(e.body))
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+type testImage struct {
+	tag    string
+	layers []io.Reader
+}
+
+// writeArchive writes a docker save tarball of the images to dir and opens it
+func writeArchive(t *testing.T, dir string, images ...testImage) *Archive {
+	t.Helper()
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, img := range images {
+		cfg := &image.Image{OS: "linux", Architecture: "amd64", Author: img.tag}
+		if err := w.AddImage(cfg, img.layers, img.tag); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(dir, "image.tar")
+	if err := ioutil.WriteFile(p, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	a, err := Open(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "graboid-tarball")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// dockerSave is a docker save tarball of graboid/test:latest with a busybox
+// layer and a layer adding /app/hello.txt and deleting /etc/motd
+const dockerSave = "testdata/docker-save.tar"
+
+// gzipFile writes the gzipped file src to dir and returns its path
+func gzipFile(t *testing.T, src, dir string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(readFile(t, src)))
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(dir, filepath.Base(src)+".gz")
+	if err := ioutil.WriteFile(p, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// layerNames returns the entry names of the layer tar read from rc and closes it
+func layerNames(t *testing.T, rc io.ReadCloser) []string {
+	t.Helper()
+	defer rc.Close()
+	var names []string
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return names
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+	}
+}
+
+func TestOpenDockerSave(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	for _, p := range []string{dockerSave, gzipFile(t, dockerSave, dir)} {
+		t.Run(filepath.Base(p), func(t *testing.T) {
+			a, err := Open(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer a.Close()
+
+			if len(a.Manifests) != 1 || !reflect.DeepEqual(a.Manifests.Tags(), []string{"graboid/test:latest"}) {
+				t.Fatalf("Manifests = %+v", a.Manifests)
+			}
+			m := &a.Manifests[0]
+
+			img, err := a.Image(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if img.OS != "linux" || img.Architecture != "amd64" || img.Config.WorkingDir != "/app" || len(img.History) != 3 {
+				t.Errorf("Image() = %+v", img)
+			}
+			if d, _ := img.ConfigDigest(); d.Hex()+".json" != m.Config {
+				t.Errorf("config digest %s does not match %s", d, m.Config)
+			}
+			if again, _ := a.Image(m); again != img {
+				t.Error("Image() parsed the config again")
+			}
+
+			layers := [][]string{
+				{"bin/", "bin/busybox", "bin/sh", "etc/", "etc/hostname", "etc/motd"},
+				{"app/", "app/hello.txt", "etc/", "etc/.wh.motd"},
+			}
+			for idx, want := range layers {
+				rc, err := a.LayerReader(m, idx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := layerNames(t, rc); !reflect.DeepEqual(got, want) {
+					t.Errorf("layer %d has %v, want %v", idx, got, want)
+				}
+			}
+			if _, err := a.LayerReader(m, 2); !errors.Is(err, ErrLayerNotFound) {
+				t.Errorf("LayerReader() out of range = %v, want ErrLayerNotFound", err)
+			}
+			if _, err := a.LayerReader(&image.Manifest{Layers: []string{"missing/layer.tar"}}, 0); !errors.Is(err, ErrLayerNotFound) {
+				t.Errorf("LayerReader() of a missing file = %v, want ErrLayerNotFound", err)
+			}
+
+			rc, err := a.File("./repositories")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rc.Close()
+			if data, _ := ioutil.ReadAll(rc); !bytes.Contains(data, []byte(`"graboid/test"`)) {
+				t.Errorf("repositories = %s", data)
+			}
+		})
+	}
+}
+
+func TestOpenInvalid(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	if _, err := Open(filepath.Join(dir, "missing.tar")); !os.IsNotExist(err) {
+		t.Errorf("Open() of a missing file = %v", err)
+	}
+	noManifest := filepath.Join(dir, "layer.tar")
+	if err := ioutil.WriteFile(noManifest, layerTar(t, tarEntry{name: "etc/hostname", body: "x"}).(*bytes.Buffer).Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(noManifest); err == nil || !strings.Contains(err.Error(), manifestFile) {
+		t.Errorf("Open() of a tar without manifest.json = %v", err)
+	}
+}
+
+func TestArchiveClose(t *testing.T) {
+	a, err := Open(dockerSave)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.LayerReader(&a.Manifests[0], 0); err == nil {
+		t.Error("LayerReader() succeeded on a closed archive")
+	}
+}
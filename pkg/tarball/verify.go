@@ -0,0 +1,144 @@
+package tarball
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/blacktop/graboid/pkg/image"
+	"github.com/opencontainers/go-digest"
+)
+
+// BlobError is the integrity failure of a single file of the archive
+type BlobError struct {
+	Path string
+	Err  error
+}
+
+func (be BlobError) Error() string {
+	return fmt.Sprintf("%s: %v", be.Path, be.Err)
+}
+
+// IntegrityError lists the files of the archive that failed verification
+type IntegrityError struct {
+	Blobs []BlobError
+}
+
+func (ie *IntegrityError) Error() string {
+	if len(ie.Blobs) == 1 {
+		return "archive integrity check failed: " + ie.Blobs[0].Error()
+	}
+	return fmt.Sprintf("archive integrity check failed for %d files, first: %s", len(ie.Blobs), ie.Blobs[0].Error())
+}
+
+// VerifyIntegrity checks the SHA256 of every config and layer referenced by
+// the manifests against the digest their path is named after (<hex>.json or
+// blobs/sha256/<hex>). The directories of <hex>/layer.tar layers are named
+// after v1 layer IDs by docker save so those layers are checked against the
+// diff_ids of the image config instead. All failures are returned as an
+// *IntegrityError.
+func (a *Archive) VerifyIntegrity() error {
+	ie := &IntegrityError{}
+	checked := make(map[string]bool)
+	fail := func(name string, err error) {
+		ie.Blobs = append(ie.Blobs, BlobError{Path: name, Err: err})
+	}
+
+	for idx := range a.Manifests {
+		m := &a.Manifests[idx]
+		if !checked[m.Config] {
+			checked[m.Config] = true
+			if expected, ok := pathDigest(m.Config); ok {
+				if err := a.verify(m.Config, expected); err != nil {
+					fail(m.Config, err)
+				}
+			}
+		}
+
+		for layerIdx, name := range m.Layers {
+			if checked[name] {
+				continue
+			}
+			checked[name] = true
+
+			if expected, ok := pathDigest(name); ok {
+				if err := a.verify(name, expected); err != nil {
+					fail(name, err)
+				}
+				continue
+			}
+			if err := a.verifyDiffID(m, layerIdx); err != nil {
+				fail(name, err)
+			}
+		}
+	}
+
+	if len(ie.Blobs) > 0 {
+		return ie
+	}
+	return nil
+}
+
+// verify hashes the raw content of the named file
+func (a *Archive) verify(name string, expected digest.Digest) error {
+	rc, err := a.open(name)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	digester := digest.Canonical.Digester()
+	if _, err := io.Copy(digester.Hash(), rc); err != nil {
+		return err
+	}
+	if got := digester.Digest(); got != expected {
+		return fmt.Errorf("expected digest %s, got %s", expected, got)
+	}
+	return nil
+}
+
+// verifyDiffID hashes the uncompressed nth layer of the manifest against the image's diff_ids
+func (a *Archive) verifyDiffID(m *image.Manifest, index int) error {
+	img, err := a.Image(m)
+	if err != nil {
+		return fmt.Errorf("failed to parse config %s: %w", m.Config, err)
+	}
+	if img.RootFS == nil || index >= len(img.RootFS.DiffIDs) {
+		return fmt.Errorf("image config has no diff_id for layer %d", index)
+	}
+
+	rc, err := a.LayerReader(m, index)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	got, _, err := image.DiffIDFromReader(rc)
+	if err != nil {
+		return err
+	}
+	if expected := img.RootFS.DiffIDs[index]; got != expected {
+		return fmt.Errorf("expected diff_id %s, got %s", expected, got)
+	}
+	return nil
+}
+
+// pathDigest returns the sha256 digest a file of the archive is named after
+func pathDigest(name string) (digest.Digest, bool) {
+	name = cleanName(name)
+
+	var hex string
+	switch {
+	case strings.HasPrefix(name, "blobs/sha256/"):
+		hex = path.Base(name)
+	case strings.HasSuffix(name, ".json"), strings.HasSuffix(name, ".tar"):
+		hex = strings.TrimSuffix(strings.TrimSuffix(name, ".json"), ".tar")
+	}
+
+	d := digest.NewDigestFromHex(digest.SHA256.String(), hex)
+	if d.Validate() != nil {
+		return "", false
+	}
+	return d, true
+}
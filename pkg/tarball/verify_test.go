@@ -0,0 +1,144 @@
+package tarball
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// integrityArchive is a docker save tarball of two images sharing a base
+// layer stored as <v1 id>/layer.tar, checked against the diff_ids, and an app
+// layer stored as blobs/sha256/<hex>, checked against its path
+type integrityArchive struct {
+	raw     []byte
+	configs []string
+	base    string
+	app     string
+}
+
+func newIntegrityArchive(t *testing.T) *integrityArchive {
+	t.Helper()
+	base := layerTar(t, tarEntry{name: "etc/hostname", body: "base-layer-content\n"}).(*bytes.Buffer).String()
+	app := layerTar(t, tarEntry{name: "app/hello.txt", body: "app-layer-content\n"}).(*bytes.Buffer).String()
+
+	ia := &integrityArchive{
+		base: "5f1dd8a2ad5bbd0b7f3e2d0b0b9e6f5f0b7a1c4bdf9b1b0e8a4d91a7c1f0e2a3/layer.tar",
+		app:  "blobs/sha256/" + digest.FromString(app).Hex(),
+	}
+	configs := []string{
+		fmt.Sprintf(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[%q,%q]}}`, digest.FromString(base), digest.FromString(app)),
+		fmt.Sprintf(`{"architecture":"arm64","os":"linux","rootfs":{"type":"layers","diff_ids":[%q]}}`, digest.FromString(base)),
+	}
+	var entries []tarEntry
+	for _, config := range configs {
+		name := digest.FromString(config).Hex() + ".json"
+		ia.configs = append(ia.configs, name)
+		entries = append(entries, tarEntry{name: name, body: config})
+	}
+	manifest := fmt.Sprintf(`[
+		{"Config":%q,"RepoTags":["graboid/app:latest"],"Layers":[%q,%q]},
+		{"Config":%q,"RepoTags":["graboid/base:latest"],"Layers":[%q]}
+	]`, ia.configs[0], ia.base, ia.app, ia.configs[1], ia.base)
+	entries = append(entries,
+		tarEntry{name: manifestFile, body: manifest},
+		tarEntry{name: ia.base, body: base},
+		tarEntry{name: ia.app, body: app},
+	)
+	ia.raw = layerTar(t, entries...).(*bytes.Buffer).Bytes()
+	return ia
+}
+
+// flipBit flips the lowest bit of the first byte of content in the archive
+func (ia *integrityArchive) flipBit(t *testing.T, content string) {
+	t.Helper()
+	idx := bytes.Index(ia.raw, []byte(content))
+	if idx < 0 || bytes.Count(ia.raw, []byte(content)) != 1 {
+		t.Fatalf("%q is not in the archive exactly once", content)
+	}
+	ia.raw[idx] ^= 1
+}
+
+func (ia *integrityArchive) open(t *testing.T, dir string) *Archive {
+	t.Helper()
+	p := filepath.Join(dir, "image.tar")
+	if err := ioutil.WriteFile(p, ia.raw, 0644); err != nil {
+		t.Fatal(err)
+	}
+	a, err := Open(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestVerifyIntegrity(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	ref := newIntegrityArchive(t)
+	tests := []struct {
+		name  string
+		flips []string
+		want  []string // paths of the broken blobs
+	}{
+		{name: "intact"},
+		// flipping a letter keeps the config valid JSON
+		{name: "config", flips: []string{"amd64"}, want: []string{ref.configs[0]}},
+		// the diff_ids of a config that doesn't parse can't be checked
+		{name: "config not json", flips: []string{`"amd64"`}, want: []string{ref.configs[0], ref.base}},
+		{name: "diff_id layer shared by both images", flips: []string{"base-layer-content"}, want: []string{ref.base}},
+		{name: "blob layer", flips: []string{"app-layer-content"}, want: []string{ref.app}},
+		{
+			name:  "everything",
+			flips: []string{"amd64", "arm64", "base-layer-content", "app-layer-content"},
+			want:  []string{ref.configs[0], ref.base, ref.app, ref.configs[1]},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ia := newIntegrityArchive(t)
+			for _, content := range tt.flips {
+				ia.flipBit(t, content)
+			}
+			a := ia.open(t, dir)
+			defer a.Close()
+
+			err := a.VerifyIntegrity()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("VerifyIntegrity() = %v, want nil", err)
+				}
+				return
+			}
+			var ie *IntegrityError
+			if !errors.As(err, &ie) {
+				t.Fatalf("VerifyIntegrity() = %v, want an IntegrityError", err)
+			}
+			var got []string
+			for _, be := range ie.Blobs {
+				got = append(got, be.Path)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("VerifyIntegrity() failed for %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyIntegrityDockerSave(t *testing.T) {
+	a, err := Open(dockerSave)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	if err := a.VerifyIntegrity(); err != nil {
+		t.Errorf("VerifyIntegrity() of the docker save fixture = %v", err)
+	}
+}
@@ -0,0 +1,169 @@
+package tarball
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	// register sha256 for go-digest
+	_ "crypto/sha256"
+
+	"github.com/blacktop/graboid/pkg/extract"
+	"github.com/blacktop/graboid/pkg/image"
+	"github.com/opencontainers/go-digest"
+)
+
+// Writer writes images as a docker save tarball that docker load accepts
+type Writer struct {
+	tw        *tar.Writer
+	manifests image.Manifests
+	written   map[string]bool
+	closed    bool
+}
+
+// NewWriter creates a Writer writing the tarball to w
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{
+		tw:        tar.NewWriter(w),
+		manifests: image.Manifests{},
+		written:   make(map[string]bool),
+	}
+}
+
+// AddImage adds the image with its layer tars (optionally gzipped) ordered from
+// the base layer up. The image is tagged with tag (e.g. ubuntu:22.04) unless it is empty.
+// Images without a rootfs are written with the diff IDs of the layers, the
+// layers of images with one must match its diff IDs.
+func (w *Writer) AddImage(img *image.Image, layers []io.Reader, tag string) error {
+	if w.closed {
+		return errors.New("tarball writer is closed")
+	}
+	if img == nil {
+		return image.ErrNoImageConfig
+	}
+	if img.RootFS != nil && len(img.RootFS.DiffIDs) != len(layers) {
+		return fmt.Errorf("image has %d diff_ids but %d layers were given", len(img.RootFS.DiffIDs), len(layers))
+	}
+
+	var m image.Manifest
+	diffIDs := make([]image.DiffID, len(layers))
+	for idx, layer := range layers {
+		layerPath, diffID, err := w.writeLayer(layer)
+		if err != nil {
+			return fmt.Errorf("failed to write layer %d: %w", idx, err)
+		}
+		if img.RootFS != nil && img.RootFS.DiffIDs[idx] != diffID {
+			return fmt.Errorf("layer %d has diff_id %s but the image config expects %s", idx, diffID, img.RootFS.DiffIDs[idx])
+		}
+		m.Layers = append(m.Layers, layerPath)
+		diffIDs[idx] = diffID
+	}
+
+	rawConfig := img.RawJSON()
+	if rawConfig == nil {
+		if img.RootFS == nil {
+			// docker load checks the layers against the config's diff_ids
+			img = img.Clone()
+			img.RootFS = &image.ImageRootFS{Type: "layers", DiffIDs: diffIDs}
+		}
+		var err error
+		if rawConfig, err = json.Marshal(img); err != nil {
+			return err
+		}
+	}
+
+	m.Config = digest.FromBytes(rawConfig).Hex() + ".json"
+	if len(tag) > 0 {
+		if strings.LastIndex(tag, ":") <= strings.LastIndex(tag, "/") {
+			tag += ":latest"
+		}
+		m.RepoTags = []string{tag}
+	}
+	if err := w.writeFile(m.Config, rawConfig); err != nil {
+		return err
+	}
+
+	w.manifests = append(w.manifests, m)
+	return nil
+}
+
+// writeFile writes data to the tar as name unless it was already written
+func (w *Writer) writeFile(name string, data []byte) error {
+	if w.written[name] {
+		return nil
+	}
+	if err := w.tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(data))}); err != nil {
+		return err
+	}
+	if _, err := w.tw.Write(data); err != nil {
+		return err
+	}
+	w.written[name] = true
+	return nil
+}
+
+// writeLayer spools the layer to a temp file to learn its size, digest and
+// diff ID and writes it to the tar as <hex>/layer.tar
+func (w *Writer) writeLayer(r io.Reader) (string, image.DiffID, error) {
+	tmp, err := ioutil.TempFile("", "graboid-layer")
+	if err != nil {
+		return "", "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	digester := digest.Canonical.Digester()
+	size, err := io.Copy(io.MultiWriter(tmp, digester.Hash()), r)
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return "", "", err
+	}
+	uncompressed, err := extract.Decompress(tmp)
+	if err != nil {
+		return "", "", err
+	}
+	diffID, err := digest.Canonical.FromReader(uncompressed)
+	if err != nil {
+		return "", "", err
+	}
+
+	layerPath := digester.Digest().Hex() + "/layer.tar"
+	if w.written[layerPath] {
+		return layerPath, image.DiffID(diffID), nil
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return "", "", err
+	}
+	if err := w.tw.WriteHeader(&tar.Header{Name: layerPath, Typeflag: tar.TypeReg, Mode: 0644, Size: size}); err != nil {
+		return "", "", err
+	}
+	if _, err := io.Copy(w.tw, tmp); err != nil {
+		return "", "", err
+	}
+	w.written[layerPath] = true
+	return layerPath, image.DiffID(diffID), nil
+}
+
+// Close writes manifest.json and finishes the tarball. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	rawManifests, err := json.Marshal(w.manifests)
+	if err != nil {
+		return err
+	}
+	if err := w.writeFile(manifestFile, rawManifests); err != nil {
+		return err
+	}
+	return w.tw.Close()
+}
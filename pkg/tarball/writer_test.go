@@ -0,0 +1,269 @@
+package tarball
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/blacktop/graboid/pkg/image"
+	"github.com/opencontainers/go-digest"
+)
+
+// gzipLayer gzips the layer tar read from r
+func gzipLayer(t *testing.T, r io.Reader) io.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := io.Copy(gz, r); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+// tarNames returns the names of the entries of the tarball at p
+func tarNames(t *testing.T, p string) []string {
+	t.Helper()
+	f, err := os.Open(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var names []string
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return names
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+	}
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	base := func() io.Reader {
+		return layerTar(t, tarEntry{name: "etc/", typeflag: tar.TypeDir}, tarEntry{name: "etc/os-release", body: "ID=alpine"})
+	}
+	raw := []byte(`{"architecture": "arm64", "os": "linux", "author": "raw", "rootfs": {"type": "layers", "diff_ids": []}}`)
+	rawImage, err := image.NewFromJSON(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	images := []struct {
+		img    *image.Image
+		tag    string
+		layers []io.Reader
+		tags   []string
+		files  [][]string
+	}{
+		{
+			img:    &image.Image{OS: "linux", Architecture: "amd64", Author: "app"},
+			tag:    "graboid/app:1.0",
+			layers: []io.Reader{base(), layerTar(t, tarEntry{name: "app/main", body: "#!app"})},
+			tags:   []string{"graboid/app:1.0"},
+			files:  [][]string{{"etc/", "etc/os-release"}, {"app/main"}},
+		},
+		{
+			img:    &image.Image{OS: "linux", Architecture: "amd64", Author: "tool"},
+			tag:    "localhost:5000/graboid/tool",
+			layers: []io.Reader{base(), gzipLayer(t, layerTar(t, tarEntry{name: "usr/bin/tool", body: "#!tool"}))},
+			tags:   []string{"localhost:5000/graboid/tool:latest"},
+			files:  [][]string{{"etc/", "etc/os-release"}, {"usr/bin/tool"}},
+		},
+		{
+			img: rawImage,
+		},
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, img := range images {
+		if err := w.AddImage(img.img, img.layers, img.tag); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(dir, "images.tar")
+	if err := ioutil.WriteFile(p, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := Open(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	if len(a.Manifests) != len(images) {
+		t.Fatalf("archive has %d manifests, want %d", len(a.Manifests), len(images))
+	}
+	for idx, want := range images {
+		m := &a.Manifests[idx]
+		if !reflect.DeepEqual(m.RepoTags, want.tags) {
+			t.Errorf("image %d is tagged %q, want %q", idx, m.RepoTags, want.tags)
+		}
+
+		img, err := a.Image(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img.OS != want.img.OS || img.Architecture != want.img.Architecture || img.Author != want.img.Author {
+			t.Errorf("image %d config = %s/%s by %s", idx, img.OS, img.Architecture, img.Author)
+		}
+		if d := digest.FromBytes(img.RawJSON()); d.Hex()+".json" != m.Config {
+			t.Errorf("image %d config %s has digest %s", idx, m.Config, d)
+		}
+
+		if len(m.Layers) != len(want.files) || len(img.RootFS.DiffIDs) != len(want.files) {
+			t.Fatalf("image %d has %d layers and %d diff IDs, want %d", idx, len(m.Layers), len(img.RootFS.DiffIDs), len(want.files))
+		}
+		for layer, files := range want.files {
+			rc, err := a.LayerReader(m, layer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := layerNames(t, rc); !reflect.DeepEqual(got, files) {
+				t.Errorf("image %d layer %d holds %v, want %v", idx, layer, got, files)
+			}
+			if rc, err = a.LayerReader(m, layer); err != nil {
+				t.Fatal(err)
+			}
+			diffID, err := digest.FromReader(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := digest.Digest(img.RootFS.DiffIDs[layer]); got != diffID {
+				t.Errorf("image %d layer %d has diff ID %s in the config, want %s", idx, layer, got, diffID)
+			}
+		}
+	}
+	if images[0].img.RootFS != nil {
+		t.Error("AddImage() changed the rootfs of the image")
+	}
+
+	// configs with raw JSON are written as they were read
+	if got, _ := a.Image(&a.Manifests[2]); !bytes.Equal(got.RawJSON(), raw) {
+		t.Errorf("raw config written as %s", got.RawJSON())
+	}
+
+	// the shared base layer is written once
+	if a.Manifests[0].Layers[0] != a.Manifests[1].Layers[0] {
+		t.Errorf("base layer written as %s and %s", a.Manifests[0].Layers[0], a.Manifests[1].Layers[0])
+	}
+	seen := make(map[string]bool)
+	for _, name := range tarNames(t, p) {
+		if seen[name] {
+			t.Errorf("%s written twice", name)
+		}
+		seen[name] = true
+	}
+	if len(seen) != 3+3+1 {
+		t.Errorf("tarball holds %d files, want 3 configs, 3 layers and manifest.json", len(seen))
+	}
+}
+
+func TestWriterErrors(t *testing.T) {
+	w := NewWriter(ioutil.Discard)
+	if err := w.AddImage(nil, nil, "x"); !errors.Is(err, image.ErrNoImageConfig) {
+		t.Errorf("AddImage() without a config = %v, want ErrNoImageConfig", err)
+	}
+
+	img := &image.Image{RootFS: &image.ImageRootFS{Type: "layers", DiffIDs: []image.DiffID{image.DiffID(digest.FromString("layer"))}}}
+	if err := w.AddImage(img, nil, "x"); err == nil {
+		t.Error("AddImage() with fewer layers than diff IDs succeeded")
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("second Close() = %v", err)
+	}
+	if err := w.AddImage(&image.Image{}, nil, "x"); err == nil {
+		t.Error("AddImage() after Close() succeeded")
+	}
+}
+
+func TestWriterDiffIDMismatch(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	img := &image.Image{RootFS: &image.ImageRootFS{Type: "layers", DiffIDs: []image.DiffID{image.DiffID(digest.FromString("layer"))}}}
+	layers := []io.Reader{layerTar(t, tarEntry{name: "etc/hostname", body: "graboid\n"})}
+	if err := w.AddImage(img, layers, "graboid/mismatch"); err == nil {
+		t.Error("AddImage() with a layer not matching its diff_id succeeded")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// neither the config nor a manifest entry of the image was written
+	tr := tar.NewReader(bytes.NewReader(buf.Bytes()))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasSuffix(hdr.Name, ".json") && hdr.Name != manifestFile {
+			t.Errorf("config %s of the rejected image was written", hdr.Name)
+		}
+	}
+	p := filepath.Join(dir, "mismatch.tar")
+	if err := ioutil.WriteFile(p, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	a, err := Open(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	if len(a.Manifests) != 0 {
+		t.Errorf("tarball has manifests %+v", a.Manifests)
+	}
+}
+
+func TestWriterEmpty(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	if err := NewWriter(&buf).Close(); err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(dir, "empty.tar")
+	if err := ioutil.WriteFile(p, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	a, err := Open(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	if len(a.Manifests) != 0 {
+		t.Errorf("empty tarball has manifests %+v", a.Manifests)
+	}
+}
@@ -0,0 +1,259 @@
+package unpack
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/graboid/pkg/extract"
+	"github.com/blacktop/graboid/pkg/image"
+)
+
+// streamer applies layers directly to dest
+type streamer struct {
+	dest string
+	dirs map[string]*tar.Header // directory metadata applied once all layers are written
+}
+
+// UnpackStream merges the layer tars (optionally compressed, ordered from the
+// base layer up) like Unpack does but writes every entry to dest as it is
+// read instead of staging file contents in a temp directory. Each layer is
+// decompressed in its own goroutine and piped to the tar reader. Hardlinks
+// keep the content their target had when the link was written like they do
+// on overlayfs.
+func UnpackStream(layers []io.Reader, dest string) error {
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+
+	s := &streamer{
+		dest: dest,
+		dirs: make(map[string]*tar.Header),
+	}
+	for idx, layer := range layers {
+		if err := s.apply(layer); err != nil {
+			return fmt.Errorf("failed to apply layer %d: %w", idx, err)
+		}
+	}
+
+	return s.finish()
+}
+
+// decompress pipes the decompressed layer read from r. done is closed once
+// the goroutine stopped reading r.
+func decompress(r io.Reader) (*io.PipeReader, <-chan struct{}) {
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		dr, err := extract.Decompress(r)
+		if err == nil {
+			_, err = io.Copy(pw, dr)
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr, done
+}
+
+// apply writes the layer read from r to dest
+func (s *streamer) apply(r io.Reader) error {
+	pr, done := decompress(r)
+	defer func() {
+		pr.Close()
+		<-done
+	}()
+
+	// whiteouts only hide lower layers so they skip what this layer wrote already
+	written := make(map[string]bool)
+	tr := tar.NewReader(pr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := cleanPath(hdr.Name)
+		if name == "" {
+			continue
+		}
+		switch {
+		case image.IsOpaqueWhiteout(name):
+			if err := s.clearDir(path.Dir(name), written); err != nil {
+				return err
+			}
+			continue
+		case image.IsWhiteout(name):
+			if target := image.WhiteoutTarget(name); !written[target] {
+				if err := s.remove(target); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		hdr.Name = name
+		if err := s.write(tr, hdr); err != nil {
+			return err
+		}
+		written[name] = true
+	}
+}
+
+// parents makes sure every parent of name is a real directory of dest so
+// nothing is written through a symlink. With create set missing parents are
+// created and non-directories replaced, otherwise it reports whether all exist.
+func (s *streamer) parents(name string, create bool) (bool, error) {
+	mode := extract.ParentsCheck
+	if create {
+		mode = extract.ParentsReplace
+	}
+	return extract.SecureParents(s.dest, name, mode)
+}
+
+// write puts the entry at its path replacing what lower layers left there
+func (s *streamer) write(tr *tar.Reader, hdr *tar.Header) error {
+	if _, err := s.parents(hdr.Name, true); err != nil {
+		return err
+	}
+	dst := filepath.Join(s.dest, filepath.FromSlash(hdr.Name))
+
+	fi, err := os.Lstat(dst)
+	exists := err == nil
+	if exists && !(fi.IsDir() && hdr.Typeflag == tar.TypeDir) {
+		// directories merge, anything else replaces the lower entry
+		if err := s.remove(hdr.Name); err != nil {
+			return err
+		}
+	}
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		// keep directories writable until all layers are written
+		if err := os.MkdirAll(dst, 0755); err != nil {
+			return err
+		}
+		s.dirs[hdr.Name] = hdr
+		return nil
+	case tar.TypeReg, tar.TypeRegA:
+		f, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(hdr.Mode).Perm())
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, tr); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		if err := os.Chmod(dst, os.FileMode(hdr.Mode).Perm()); err != nil {
+			return err
+		}
+		return os.Chtimes(dst, hdr.ModTime, hdr.ModTime)
+	case tar.TypeLink:
+		return s.link(hdr, dst)
+	case tar.TypeSymlink:
+		return os.Symlink(hdr.Linkname, dst)
+	default:
+		log.WithField("path", hdr.Name).Debug("skipping special file")
+		return nil
+	}
+}
+
+// link creates a hardlink to a regular file already written to dest
+func (s *streamer) link(hdr *tar.Header, dst string) error {
+	name := cleanPath(hdr.Linkname)
+	ok, err := s.parents(name, false)
+	if err != nil {
+		return err
+	}
+	src := filepath.Join(s.dest, filepath.FromSlash(name))
+	if ok {
+		fi, err := os.Lstat(src)
+		ok = err == nil && fi.Mode().IsRegular()
+	}
+	if !ok {
+		log.WithField("path", hdr.Name).Debug("skipping hardlink to missing file")
+		return nil
+	}
+	return os.Link(src, dst)
+}
+
+// remove deletes name and everything below it from dest
+func (s *streamer) remove(name string) error {
+	if ok, err := s.parents(name, false); err != nil || !ok {
+		return err
+	}
+	s.forget(name)
+	return os.RemoveAll(filepath.Join(s.dest, filepath.FromSlash(name)))
+}
+
+// clearDir deletes the lower contents of dir keeping what this layer wrote
+func (s *streamer) clearDir(dir string, written map[string]bool) error {
+	if ok, err := s.parents(dir+"/", false); err != nil || !ok {
+		return err
+	}
+	entries, err := ioutil.ReadDir(filepath.Join(s.dest, filepath.FromSlash(dir)))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		name := path.Join(dir, entry.Name())
+		switch {
+		case !written[name]:
+			if err := s.remove(name); err != nil {
+				return err
+			}
+		case entry.IsDir():
+			// the directory itself is new but may still hold lower entries
+			if err := s.clearDir(name, written); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// forget drops the metadata of name and the directories below it
+func (s *streamer) forget(name string) {
+	delete(s.dirs, name)
+	prefix := name + "/"
+	for dir := range s.dirs {
+		if strings.HasPrefix(dir, prefix) {
+			delete(s.dirs, dir)
+		}
+	}
+}
+
+// finish applies the directory modes, deepest first so setting a parent
+// read-only can't fail its children
+func (s *streamer) finish() error {
+	names := make([]string, 0, len(s.dirs))
+	for name := range s.dirs {
+		names = append(names, name)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+
+	for _, name := range names {
+		hdr := s.dirs[name]
+		dst := filepath.Join(s.dest, filepath.FromSlash(name))
+		if err := os.Chmod(dst, os.FileMode(hdr.Mode).Perm()); err != nil {
+			return err
+		}
+		os.Chtimes(dst, hdr.ModTime, hdr.ModTime)
+	}
+	return nil
+}
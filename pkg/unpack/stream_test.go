@@ -0,0 +1,113 @@
+package unpack
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func gzipLayer(t *testing.T, entries ...tarEntry) io.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	if _, err := io.Copy(gw, layerTar(t, entries...)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestUnpackStream(t *testing.T) {
+	dest := tempDir(t)
+	defer os.RemoveAll(dest)
+
+	// nothing may be staged so point the temp directory at a file
+	tmp, err := ioutil.TempFile("", "graboid-unpack-tmpdir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	t.Setenv("TMPDIR", tmp.Name())
+
+	layers := []io.Reader{
+		gzipLayer(t,
+			dir("bin/"), file("bin/busybox", "busybox"), symlink("bin/sh", "busybox"),
+			dir("etc/"), file("etc/motd", "welcome"), file("etc/hostname", "base"),
+			dir("var/"), dir("var/cache/"), dir("var/cache/apk/"), file("var/cache/apk/index", "index"),
+		),
+		zstdLayer(t,
+			file("etc/.wh.motd", ""), file("etc/hostname", "graboid"),
+			dir("app/"), file("app/old", "old"), file("app/config", "v1"),
+		),
+		layerTar(t,
+			file("var/.wh.cache", ""),
+			dir("app/"), file("app/.wh..wh..opq", ""), file("app/config", "v2"),
+			hardlink("bin/ash", "bin/busybox"),
+		),
+	}
+	if err := UnpackStream(layers, dest); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"app":          "dir",
+		"app/config":   "file:v2",
+		"bin":          "dir",
+		"bin/ash":      "file:busybox",
+		"bin/busybox":  "file:busybox",
+		"bin/sh":       "link:busybox",
+		"etc":          "dir",
+		"etc/hostname": "file:graboid",
+		"var":          "dir",
+	}
+	if got := tree(t, dest); !reflect.DeepEqual(got, want) {
+		t.Errorf("unpacked %v, want %v", got, want)
+	}
+}
+
+func TestUnpackStreamNotWhiteouts(t *testing.T) {
+	// .wh. followed by nothing, . or .. names no file so the entries are plain files
+	for name, unpack := range unpackers {
+		t.Run(name, func(t *testing.T) {
+			dest := tempDir(t)
+			defer os.RemoveAll(dest)
+
+			layers := []io.Reader{
+				layerTar(t, dir("etc/"), file("etc/hostname", "base")),
+				layerTar(t, file("etc/.wh.", "a"), file("etc/.wh..", "b"), file("etc/.wh...", "c")),
+			}
+			if err := unpack(layers, dest); err != nil {
+				t.Fatal(err)
+			}
+			want := map[string]string{
+				"etc":          "dir",
+				"etc/hostname": "file:base",
+				"etc/.wh.":     "file:a",
+				"etc/.wh..":    "file:b",
+				"etc/.wh...":   "file:c",
+			}
+			if got := tree(t, dest); !reflect.DeepEqual(got, want) {
+				t.Errorf("unpacked %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestUnpackStreamCorruptLayer(t *testing.T) {
+	dest := tempDir(t)
+	defer os.RemoveAll(dest)
+
+	// a truncated gzip stream fails in the decompressing goroutine
+	gz := gzipLayer(t, file("etc/hostname", "graboid")).(*bytes.Buffer).Bytes()
+	layers := []io.Reader{layerTar(t, file("etc/motd", "x")), bytes.NewReader(gz[:len(gz)/2])}
+	if err := UnpackStream(layers, dest); err == nil {
+		t.Error("UnpackStream() with a truncated layer succeeded")
+	}
+}
@@ -0,0 +1,297 @@
+package unpack
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/graboid/pkg/extract"
+	"github.com/blacktop/graboid/pkg/image"
+)
+
+// fileNode is an entry of the merged view, the content of regular files is staged on disk
+type fileNode struct {
+	hdr    *tar.Header
+	staged string
+}
+
+func (n *fileNode) isDir() bool {
+	return n.hdr.Typeflag == tar.TypeDir
+}
+
+// overlay is the merged view of the layers applied so far keyed by clean relative path
+type overlay struct {
+	files   map[string]*fileNode
+	staging string
+	staged  int
+}
+
+// Unpack merges the layer tars (optionally gzip or zstd compressed, ordered from the base
+// layer up) like overlayfs does and writes the result to dest. Upper layers
+// replace files of lower ones, whiteouts delete them and opaque whiteouts
+// hide the lower contents of a directory. Ownership and device nodes are
+// skipped so no root privileges are needed.
+func Unpack(layers []io.Reader, dest string) error {
+	staging, err := ioutil.TempDir("", "graboid-unpack")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	o := &overlay{
+		files:   make(map[string]*fileNode),
+		staging: staging,
+	}
+	for idx, layer := range layers {
+		if err := o.apply(layer); err != nil {
+			return fmt.Errorf("failed to apply layer %d: %w", idx, err)
+		}
+	}
+
+	return o.materialize(dest)
+}
+
+// apply merges the layer read from r into the view
+func (o *overlay) apply(r io.Reader) error {
+	r, err := extract.Decompress(r)
+	if err != nil {
+		return err
+	}
+
+	// whiteouts only hide lower layers so they are applied before the layer's own entries
+	var (
+		whiteouts []string
+		opaque    []string
+		entries   []*fileNode
+	)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		name := cleanPath(hdr.Name)
+		if name == "" {
+			continue
+		}
+		switch {
+		case image.IsOpaqueWhiteout(name):
+			opaque = append(opaque, path.Dir(name))
+			continue
+		case image.IsWhiteout(name):
+			whiteouts = append(whiteouts, image.WhiteoutTarget(name))
+			continue
+		}
+
+		hdr.Name = name
+		node := &fileNode{hdr: hdr}
+		if hdr.Typeflag == tar.TypeReg || hdr.Typeflag == tar.TypeRegA {
+			if node.staged, err = o.stage(tr); err != nil {
+				return err
+			}
+		}
+		entries = append(entries, node)
+	}
+
+	for _, dir := range opaque {
+		o.removeChildren(dir)
+	}
+	for _, target := range whiteouts {
+		o.remove(target)
+	}
+	for _, node := range entries {
+		o.add(node)
+	}
+	return nil
+}
+
+// stage writes the content of a regular file to the staging directory
+func (o *overlay) stage(r io.Reader) (string, error) {
+	o.staged++
+	staged := filepath.Join(o.staging, fmt.Sprintf("%d", o.staged))
+	f, err := os.Create(staged)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return "", err
+	}
+	return staged, f.Close()
+}
+
+// add puts the node in the view replacing what was at its path. Parents that
+// are not directories in the view become directories.
+func (o *overlay) add(node *fileNode) {
+	name := node.hdr.Name
+
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if parent, ok := o.files[dir]; ok && !parent.isDir() {
+			o.remove(dir)
+		}
+	}
+
+	if existing, ok := o.files[name]; ok {
+		if existing.isDir() && node.isDir() {
+			// directories merge, the upper one only changes the metadata
+			o.files[name] = node
+			return
+		}
+		o.remove(name)
+	}
+	if !node.isDir() {
+		// the lower directory may only exist implicitly as the parent of its files
+		o.removeChildren(name)
+	}
+	o.files[name] = node
+}
+
+// remove deletes name and everything below it from the view
+func (o *overlay) remove(name string) {
+	delete(o.files, name)
+	o.removeChildren(name)
+}
+
+// removeChildren deletes everything below dir from the view
+func (o *overlay) removeChildren(dir string) {
+	prefix := dir + "/"
+	for name := range o.files {
+		if strings.HasPrefix(name, prefix) {
+			delete(o.files, name)
+		}
+	}
+}
+
+// materialize writes the view to dest. Directories are created first and
+// symlinks last so no link is followed while writing.
+func (o *overlay) materialize(dest string) error {
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(o.files))
+	for name := range o.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var dirs, files, links, symlinks []*fileNode
+	for _, name := range names {
+		node := o.files[name]
+		switch node.hdr.Typeflag {
+		case tar.TypeDir:
+			dirs = append(dirs, node)
+		case tar.TypeReg, tar.TypeRegA:
+			files = append(files, node)
+		case tar.TypeLink:
+			links = append(links, node)
+		case tar.TypeSymlink:
+			symlinks = append(symlinks, node)
+		default:
+			log.WithField("path", name).Debug("skipping special file")
+		}
+	}
+
+	for _, node := range dirs {
+		// keep directories writable until their contents are written
+		if err := os.MkdirAll(target(dest, node), 0755); err != nil {
+			return err
+		}
+	}
+	for _, node := range files {
+		if err := writeFile(dest, node); err != nil {
+			return err
+		}
+	}
+	for _, node := range links {
+		if err := writeLink(dest, node, o.files); err != nil {
+			return err
+		}
+	}
+	for _, node := range symlinks {
+		if err := os.MkdirAll(filepath.Dir(target(dest, node)), 0755); err != nil {
+			return err
+		}
+		if err := os.Symlink(node.hdr.Linkname, target(dest, node)); err != nil {
+			return err
+		}
+	}
+	// deepest directories first so setting a parent read-only can't fail its children
+	for idx := len(dirs) - 1; idx >= 0; idx-- {
+		node := dirs[idx]
+		if err := os.Chmod(target(dest, node), os.FileMode(node.hdr.Mode).Perm()); err != nil {
+			return err
+		}
+		os.Chtimes(target(dest, node), node.hdr.ModTime, node.hdr.ModTime)
+	}
+
+	return nil
+}
+
+func target(dest string, node *fileNode) string {
+	return filepath.Join(dest, filepath.FromSlash(node.hdr.Name))
+}
+
+func writeFile(dest string, node *fileNode) error {
+	dst := target(dest, node)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(node.staged, dst); err != nil {
+		// the staging directory may be on another filesystem
+		if err := copyFile(node.staged, dst); err != nil {
+			return err
+		}
+	}
+	if err := os.Chmod(dst, os.FileMode(node.hdr.Mode).Perm()); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, node.hdr.ModTime, node.hdr.ModTime)
+}
+
+// writeLink creates a hardlink to a regular file of the view
+func writeLink(dest string, node *fileNode, files map[string]*fileNode) error {
+	linkTarget, ok := files[cleanPath(node.hdr.Linkname)]
+	if !ok || (linkTarget.hdr.Typeflag != tar.TypeReg && linkTarget.hdr.Typeflag != tar.TypeRegA) {
+		log.WithField("path", node.hdr.Name).Debug("skipping hardlink to missing file")
+		return nil
+	}
+	dst := target(dest, node)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return os.Link(target(dest, linkTarget), dst)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// cleanPath returns the tar entry name relative to the root, names escaping the root are clamped to it
+func cleanPath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
@@ -0,0 +1,384 @@
+package unpack
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+type tarEntry struct {
+	name     string
+	typeflag byte
+	linkname string
+	body     string
+}
+
+func layerTar(t *testing.T, entries ...tarEntry) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Typeflag: e.typeflag, Linkname: e.linkname, Mode: 0644}
+		if hdr.Typeflag == 0 {
+			hdr.Typeflag = tar.TypeReg
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			hdr.Mode = 0755
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = int64(len(e.body))
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func zstdLayer(t *testing.T, entries ...tarEntry) io.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	zw, err := zstd.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(zw, layerTar(t, entries...)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "graboid-unpack-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// unpackers are the two ways to merge layers, both must give the same tree
+var unpackers = map[string]func([]io.Reader, string) error{
+	"Unpack":       Unpack,
+	"UnpackStream": UnpackStream,
+}
+
+func TestUnpackZstd(t *testing.T) {
+	for name, unpack := range unpackers {
+		t.Run(name, func(t *testing.T) {
+			dest := tempDir(t)
+			defer os.RemoveAll(dest)
+
+			layers := []io.Reader{
+				zstdLayer(t, tarEntry{name: "etc/", typeflag: tar.TypeDir}, tarEntry{name: "etc/os-release", body: "base"}),
+				layerTar(t, tarEntry{name: "etc/hostname", body: "graboid"}),
+			}
+			if err := unpack(layers, dest); err != nil {
+				t.Fatal(err)
+			}
+			for file, want := range map[string]string{"etc/os-release": "base", "etc/hostname": "graboid"} {
+				got, err := ioutil.ReadFile(filepath.Join(dest, filepath.FromSlash(file)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != want {
+					t.Errorf("%s = %q, want %q", file, got, want)
+				}
+			}
+		})
+	}
+}
+
+// tree describes every entry below dest as "dir", "file:<content>" or "link:<target>"
+func tree(t *testing.T, dest string) map[string]string {
+	t.Helper()
+	entries := make(map[string]string)
+	err := filepath.Walk(dest, func(p string, fi os.FileInfo, err error) error {
+		if err != nil || p == dest {
+			return err
+		}
+		rel, err := filepath.Rel(dest, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		switch {
+		case fi.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			entries[rel] = "link:" + target
+		case fi.IsDir():
+			entries[rel] = "dir"
+		default:
+			data, err := ioutil.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			entries[rel] = "file:" + string(data)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func dir(name string) tarEntry { return tarEntry{name: name, typeflag: tar.TypeDir} }
+
+func file(name, body string) tarEntry { return tarEntry{name: name, body: body} }
+
+func symlink(name, target string) tarEntry {
+	return tarEntry{name: name, typeflag: tar.TypeSymlink, linkname: target}
+}
+
+func hardlink(name, target string) tarEntry {
+	return tarEntry{name: name, typeflag: tar.TypeLink, linkname: target}
+}
+
+var overlayTests = []struct {
+	name   string
+	layers [][]tarEntry
+	want   map[string]string
+}{
+	{
+		name: "upper file replaces lower",
+		layers: [][]tarEntry{
+			{dir("etc/"), file("etc/os-release", "base"), file("etc/hostname", "base")},
+			{file("etc/os-release", "upper")},
+		},
+		want: map[string]string{"etc": "dir", "etc/os-release": "file:upper", "etc/hostname": "file:base"},
+	},
+	{
+		name: "whiteout",
+		layers: [][]tarEntry{
+			{dir("etc/"), file("etc/motd", "welcome"), file("etc/hostname", "base")},
+			{file("etc/.wh.motd", "")},
+		},
+		want: map[string]string{"etc": "dir", "etc/hostname": "file:base"},
+	},
+	{
+		name: "whiteout of a directory",
+		layers: [][]tarEntry{
+			{dir("var/"), dir("var/cache/"), dir("var/cache/apk/"), file("var/cache/apk/index", "x"), file("var/log", "log")},
+			{file("var/.wh.cache", "")},
+		},
+		want: map[string]string{"var": "dir", "var/log": "file:log"},
+	},
+	{
+		name: "whiteout of a missing file",
+		layers: [][]tarEntry{
+			{file("etc/hostname", "base")},
+			{file("etc/.wh.missing", ""), file(".wh.nothing", "")},
+		},
+		want: map[string]string{"etc": "dir", "etc/hostname": "file:base"},
+	},
+	{
+		name: "whiteout and new file in the same layer",
+		layers: [][]tarEntry{
+			{dir("app/"), dir("app/config/"), file("app/config/old", "old")},
+			{file("app/.wh.config", ""), file("app/config", "now a file")},
+		},
+		want: map[string]string{"app": "dir", "app/config": "file:now a file"},
+	},
+	{
+		name: "whiteout after the new file in the same layer",
+		layers: [][]tarEntry{
+			{file("app/main", "v1")},
+			{file("app/main", "v2"), file("app/.wh.main", "")},
+		},
+		want: map[string]string{"app": "dir", "app/main": "file:v2"},
+	},
+	{
+		name: "opaque whiteout",
+		layers: [][]tarEntry{
+			{dir("app/"), file("app/old", "old"), dir("app/lib/"), file("app/lib/old.so", "old"), file("keep", "keep")},
+			{dir("app/"), file("app/.wh..wh..opq", ""), file("app/new", "new")},
+		},
+		want: map[string]string{"app": "dir", "app/new": "file:new", "keep": "file:keep"},
+	},
+	{
+		name: "opaque whiteout after the new contents",
+		layers: [][]tarEntry{
+			{dir("app/"), dir("app/lib/"), file("app/lib/old.so", "old"), file("app/old", "old")},
+			{dir("app/"), dir("app/lib/"), file("app/lib/new.so", "new"), file("app/.wh..wh..opq", "")},
+		},
+		want: map[string]string{"app": "dir", "app/lib": "dir", "app/lib/new.so": "file:new"},
+	},
+	{
+		name: "opaque whiteout of a missing directory",
+		layers: [][]tarEntry{
+			{file("keep", "keep")},
+			{dir("new/"), file("new/.wh..wh..opq", ""), file("new/file", "new")},
+		},
+		want: map[string]string{"keep": "file:keep", "new": "dir", "new/file": "file:new"},
+	},
+	{
+		name: "file replaced by directory",
+		layers: [][]tarEntry{
+			{dir("opt/"), file("opt/app", "binary")},
+			{dir("opt/app/"), file("opt/app/bin", "new binary")},
+		},
+		want: map[string]string{"opt": "dir", "opt/app": "dir", "opt/app/bin": "file:new binary"},
+	},
+	{
+		name: "file replaced by implicit directory",
+		layers: [][]tarEntry{
+			{file("opt/app", "binary")},
+			{file("opt/app/bin", "new binary")},
+		},
+		want: map[string]string{"opt": "dir", "opt/app": "dir", "opt/app/bin": "file:new binary"},
+	},
+	{
+		name: "directory replaced by file",
+		layers: [][]tarEntry{
+			{dir("opt/"), dir("opt/app/"), file("opt/app/bin", "binary"), dir("opt/app/lib/"), file("opt/app/lib/x.so", "x")},
+			{file("opt/app", "single binary")},
+		},
+		want: map[string]string{"opt": "dir", "opt/app": "file:single binary"},
+	},
+	{
+		name: "implicit directory replaced by file",
+		layers: [][]tarEntry{
+			{file("opt/app/bin", "binary")},
+			{file("opt/app", "single binary")},
+		},
+		want: map[string]string{"opt": "dir", "opt/app": "file:single binary"},
+	},
+	{
+		name: "directory replaced by symlink",
+		layers: [][]tarEntry{
+			{dir("lib/"), file("lib/libc.so", "libc"), dir("usr/"), dir("usr/lib/"), file("usr/lib/libz.so", "libz")},
+			{symlink("lib", "usr/lib")},
+		},
+		want: map[string]string{"lib": "link:usr/lib", "usr": "dir", "usr/lib": "dir", "usr/lib/libz.so": "file:libz"},
+	},
+	{
+		name: "symlink replaced by directory",
+		layers: [][]tarEntry{
+			{dir("usr/"), dir("usr/lib/"), file("usr/lib/libz.so", "libz"), symlink("lib", "usr/lib")},
+			{file("lib/libc.so", "libc")},
+		},
+		want: map[string]string{"lib": "dir", "lib/libc.so": "file:libc", "usr": "dir", "usr/lib": "dir", "usr/lib/libz.so": "file:libz"},
+	},
+	{
+		name: "hardlink to a lower file",
+		layers: [][]tarEntry{
+			{dir("bin/"), file("bin/busybox", "busybox")},
+			{hardlink("bin/sh", "bin/busybox")},
+		},
+		want: map[string]string{"bin": "dir", "bin/busybox": "file:busybox", "bin/sh": "file:busybox"},
+	},
+	{
+		name: "hardlink to a whited out file",
+		layers: [][]tarEntry{
+			{dir("bin/"), file("bin/busybox", "busybox")},
+			{file("bin/.wh.busybox", ""), hardlink("bin/sh", "bin/busybox")},
+		},
+		want: map[string]string{"bin": "dir"},
+	},
+}
+
+func TestUnpackOverlay(t *testing.T) {
+	for name, unpack := range unpackers {
+		for _, tt := range overlayTests {
+			t.Run(fmt.Sprintf("%s/%s", name, tt.name), func(t *testing.T) {
+				dest := tempDir(t)
+				defer os.RemoveAll(dest)
+
+				layers := make([]io.Reader, len(tt.layers))
+				for idx, entries := range tt.layers {
+					layers[idx] = layerTar(t, entries...)
+				}
+				if err := unpack(layers, dest); err != nil {
+					t.Fatal(err)
+				}
+				if got := tree(t, dest); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("unpacked %v, want %v", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestUnpackDirectoryModes(t *testing.T) {
+	for name, unpack := range unpackers {
+		t.Run(name, func(t *testing.T) {
+			dest := tempDir(t)
+			defer func() {
+				filepath.Walk(dest, func(p string, fi os.FileInfo, err error) error {
+					if err == nil && fi.IsDir() {
+						os.Chmod(p, 0755)
+					}
+					return nil
+				})
+				os.RemoveAll(dest)
+			}()
+
+			var buf bytes.Buffer
+			tw := tar.NewWriter(&buf)
+			for _, hdr := range []*tar.Header{
+				{Name: "ro/", Typeflag: tar.TypeDir, Mode: 0555},
+				{Name: "ro/sub/", Typeflag: tar.TypeDir, Mode: 0500},
+				{Name: "ro/sub/file", Typeflag: tar.TypeReg, Mode: 0600, Size: 4},
+			} {
+				if err := tw.WriteHeader(hdr); err != nil {
+					t.Fatal(err)
+				}
+				if hdr.Size > 0 {
+					tw.Write([]byte("data"))
+				}
+			}
+			if err := tw.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			// the read-only directory of the lower layer still gets the upper layer's file
+			if err := unpack([]io.Reader{&buf, layerTar(t, file("ro/upper", "upper"))}, dest); err != nil {
+				t.Fatal(err)
+			}
+			for p, want := range map[string]os.FileMode{"ro": 0555, "ro/sub": 0500, "ro/sub/file": 0600, "ro/upper": 0644} {
+				fi, err := os.Stat(filepath.Join(dest, filepath.FromSlash(p)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := fi.Mode().Perm(); got != want {
+					t.Errorf("%s has mode %o, want %o", p, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestUnpackInvalidLayer(t *testing.T) {
+	for name, unpack := range unpackers {
+		t.Run(name, func(t *testing.T) {
+			dest := tempDir(t)
+			defer os.RemoveAll(dest)
+
+			layers := []io.Reader{layerTar(t, file("etc/hostname", "x")), bytes.NewBufferString("not a tar")}
+			if err := unpack(layers, dest); err == nil {
+				t.Error("unpacking a layer that is not a tar succeeded")
+			}
+		})
+	}
+}